@@ -0,0 +1,200 @@
+// 跨任务的结果去重记录：按Rule.ItemKey识别结果，已在此前的任务（或本次任务）中输出过的结果不再输出，
+// 以便增量采集时每次只输出新增的结果。仅记录确认输出成功的结果，输出失败或未及输出的结果下次仍会输出。
+// 记录保存于seen::dir下每个蜘蛛一个文件，超过seen::ttl天未再出现的记录在保存时丢弃，以限制其增长。
+package seen
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+type Set struct {
+	fileName string
+	keys     map[string]int64    // [键的摘要]最近出现的时刻(Unix秒)，仅含已成功输出的结果
+	pending  map[string]*pending // [键的摘要]已收集但尚未确认输出的结果
+	targets  int                 // 每条结果须确认输出的次数，即输出方式的数量
+	skipped  int                 // 本次任务跳过的结果数
+	lock     sync.Mutex
+}
+
+// 尚未确认输出的结果
+type pending struct {
+	left   int  // 尚待确认的输出方式数
+	failed bool // 是否有输出方式输出失败
+}
+
+// 记录文件名
+func fileName(name, subName string) string {
+	if subName != "" {
+		name += "__" + subName
+	}
+	return filepath.Join(config.SEEN_DIR, util.FileNameReplace(name))
+}
+
+// 读取蜘蛛的去重记录，文件不存在时返回空记录
+func Open(name, subName string) (*Set, error) {
+	self := &Set{
+		fileName: fileName(name, subName),
+		keys:     make(map[string]int64),
+		pending:  make(map[string]*pending),
+		targets:  1,
+	}
+	f, err := os.Open(self.fileName)
+	if os.IsNotExist(err) {
+		return self, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	expire := self.expire()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 每行为"摘要 Unix秒"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		at, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || at < expire {
+			continue
+		}
+		self.keys[fields[0]] = at
+	}
+	return self, scanner.Err()
+}
+
+// 早于该时刻的记录已过期
+func (self *Set) expire() int64 {
+	if config.SEEN_TTL <= 0 {
+		return 0
+	}
+	return time.Now().Add(-time.Duration(config.SEEN_TTL) * 24 * time.Hour).Unix()
+}
+
+// 设置每条结果须确认输出的次数，配置了多个输出方式时各输出方式均输出成功后才记录该结果
+func (self *Set) SetTargets(n int) {
+	if n < 1 {
+		n = 1
+	}
+	self.lock.Lock()
+	self.targets = n
+	self.lock.Unlock()
+}
+
+// 返回key此前是否已输出过或正在输出，并发安全；
+// 返回false时key计入待确认的结果，须在输出后调用Done()，确认输出成功后才记录
+func (self *Set) Seen(key string) bool {
+	digest := digest(key)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.keys[digest]; ok {
+		self.keys[digest] = time.Now().Unix()
+		self.skipped++
+		return true
+	}
+	if _, ok := self.pending[digest]; ok {
+		self.skipped++
+		return true
+	}
+	self.pending[digest] = &pending{left: self.targets}
+	return false
+}
+
+// 确认一个输出方式对key的输出结果，并发安全；
+// 各输出方式均已确认且全部成功时记录key，有失败时放弃，以便此后（含下次任务）再次输出
+func (self *Set) Done(key string, ok bool) {
+	digest := digest(key)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p := self.pending[digest]
+	if p == nil {
+		return
+	}
+	if !ok {
+		p.failed = true
+	}
+	if p.left--; p.left > 0 {
+		return
+	}
+	delete(self.pending, digest)
+	if !p.failed {
+		self.keys[digest] = time.Now().Unix()
+	}
+}
+
+func digest(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 本次任务因已出现过而跳过的结果数
+func (self *Set) Skipped() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.skipped
+}
+
+// 保存已确认输出的去重记录，丢弃已过期的记录
+func (self *Set) Save() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err := os.MkdirAll(config.SEEN_DIR, 0777); err != nil {
+		return err
+	}
+	tmp := self.fileName + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	expire := self.expire()
+	for digest, at := range self.keys {
+		if at < expire {
+			continue
+		}
+		fmt.Fprintf(w, "%s %d\n", digest, at)
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, self.fileName)
+}
+
+// 清空蜘蛛的去重记录（含各自定义配置下的记录），name为空时清空全部
+func Reset(name string) error {
+	pattern := "*"
+	if name != "" {
+		pattern = util.FileNameReplace(name)
+	}
+	files, _ := filepath.Glob(filepath.Join(config.SEEN_DIR, pattern))
+	if name != "" {
+		more, _ := filepath.Glob(filepath.Join(config.SEEN_DIR, pattern+"__*"))
+		files = append(files, more...)
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		logs.Log.Informational(" *     [结果去重] 已清空记录 %s\n", file)
+	}
+	return nil
+}
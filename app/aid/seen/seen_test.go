@@ -0,0 +1,148 @@
+package seen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+func testDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seenDir, ttl := config.SEEN_DIR, config.SEEN_TTL
+	config.SEEN_DIR = dir
+	t.Cleanup(func() {
+		config.SEEN_DIR, config.SEEN_TTL = seenDir, ttl
+		os.RemoveAll(dir)
+	})
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	testDir(t)
+	set, err := Open("spider", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Seen("a") {
+		t.Error("empty set reported a key as seen")
+	}
+}
+
+func TestSeenWithinRun(t *testing.T) {
+	testDir(t)
+	set, _ := Open("spider", "")
+	if set.Seen("a") {
+		t.Fatal("first Seen = true")
+	}
+	// 尚未确认输出的结果同样视为已出现
+	if !set.Seen("a") {
+		t.Fatal("pending key not seen")
+	}
+	set.Done("a", true)
+	if !set.Seen("a") {
+		t.Fatal("output key not seen")
+	}
+	if n := set.Skipped(); n != 2 {
+		t.Errorf("Skipped() = %v, want 2", n)
+	}
+}
+
+func TestSaveOnlyConfirmedKeys(t *testing.T) {
+	testDir(t)
+	set, _ := Open("spider", "sub")
+	for _, key := range []string{"ok", "failed", "unconfirmed"} {
+		set.Seen(key)
+	}
+	set.Done("ok", true)
+	set.Done("failed", false)
+	if err := set.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := Open("spider", "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"ok": true, "failed": false, "unconfirmed": false} {
+		if got := set.Seen(key); got != want {
+			t.Errorf("Seen(%q) after reopen = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestDoneWaitsForAllTargets(t *testing.T) {
+	testDir(t)
+	for _, results := range [][]bool{{true, true}, {true, false}, {false, true}} {
+		set, _ := Open("spider", "")
+		set.SetTargets(2)
+		set.Seen("a")
+		set.Done("a", results[0])
+		if len(set.keys) != 0 {
+			t.Fatalf("%v: recorded before all targets confirmed", results)
+		}
+		set.Done("a", results[1])
+		if _, ok := set.keys[digest("a")]; ok != (results[0] && results[1]) {
+			t.Errorf("%v: recorded = %v", results, ok)
+		}
+		if len(set.pending) != 0 {
+			t.Errorf("%v: pending = %v", results, set.pending)
+		}
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	testDir(t)
+	config.SEEN_TTL = 1
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	content := fmt.Sprintf("%s %d\n%s %d\nbroken line\n", digest("old"), old, digest("new"), time.Now().Unix())
+	if err := ioutil.WriteFile(filepath.Join(config.SEEN_DIR, "spider"), []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	set, err := Open("spider", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Seen("old") {
+		t.Error("expired key still seen")
+	}
+	if !set.Seen("new") {
+		t.Error("fresh key not seen")
+	}
+}
+
+func TestReset(t *testing.T) {
+	testDir(t)
+	for _, sub := range []string{"", "sub"} {
+		set, _ := Open("spider", sub)
+		set.Seen("a")
+		set.Done("a", true)
+		if err := set.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other, _ := Open("other", "")
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reset("spider"); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(config.SEEN_DIR, "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != "other" {
+		t.Errorf("files after Reset(spider) = %v", files)
+	}
+	if err := Reset(""); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(config.SEEN_DIR, "*")); len(files) != 0 {
+		t.Errorf("files after Reset() = %v", files)
+	}
+}
@@ -0,0 +1,80 @@
+// Tor线路切换：经Tor的SOCKS5代理访问时，目标站点封禁当前出口IP后，
+// 通过控制端口发送SIGNAL NEWNYM切换线路。默认不启用，见配置项tor::*，仅限合法用途。
+package tor
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+var (
+	lock    sync.Mutex
+	rotated time.Time // 最近一次切换线路完成的时刻
+)
+
+// 是否经Tor访问
+func Enabled() bool {
+	return config.TOR_SOCKS != ""
+}
+
+// 是否可切换线路
+func CanRotate() bool {
+	return config.TOR_SOCKS != "" && config.TOR_CONTROL != ""
+}
+
+// 切换线路，since为检测到封禁的响应开始下载的时刻：若此后已由其他请求完成切换，则直接返回。
+// 距上次切换不足tor::interval时先等待，wait返回false（如任务终止）时放弃切换并返回错误。
+func Rotate(since time.Time, wait func(time.Duration) bool) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if rotated.After(since) {
+		return nil
+	}
+	if d := time.Until(rotated.Add(time.Duration(config.TOR_INTERVAL) * time.Second)); d > 0 {
+		if !wait(d) {
+			return fmt.Errorf("任务已终止")
+		}
+	}
+	if err := newnym(config.TOR_CONTROL, config.TOR_PASSWORD); err != nil {
+		return err
+	}
+	rotated = time.Now()
+	logs.Log.Informational(" *     [Tor] 已切换线路\n")
+	return nil
+}
+
+// 通过控制端口认证并发送SIGNAL NEWNYM
+func newnym(addr, password string) error {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	auth := "AUTHENTICATE"
+	if password != "" {
+		auth += ` "` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(password) + `"`
+	}
+	for _, cmd := range []string{auth, "SIGNAL NEWNYM"} {
+		if _, err := conn.Write([]byte(cmd + "\r\n")); err != nil {
+			return err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if line = strings.TrimSpace(line); !strings.HasPrefix(line, "250") {
+			return fmt.Errorf("Tor控制端口: %s", line)
+		}
+	}
+	conn.Write([]byte("QUIT\r\n"))
+	return nil
+}
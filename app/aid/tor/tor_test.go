@@ -0,0 +1,157 @@
+package tor
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 模拟的控制端口，记录收到的命令，按replies依次应答（用尽后应答250 OK）
+type fakeControl struct {
+	net.Listener
+	replies []string
+	mu      sync.Mutex
+	cmds    []string
+}
+
+func newFakeControl(t *testing.T, replies ...string) *fakeControl {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := &fakeControl{Listener: l, replies: replies}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			self.serve(conn)
+		}
+	}()
+	return self
+}
+
+func (self *fakeControl) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		self.mu.Lock()
+		self.cmds = append(self.cmds, cmd)
+		reply := "250 OK"
+		if len(self.replies) > 0 {
+			reply, self.replies = self.replies[0], self.replies[1:]
+		}
+		self.mu.Unlock()
+		if cmd == "QUIT" {
+			return
+		}
+		conn.Write([]byte(reply + "\r\n"))
+	}
+}
+
+// 等待收到至少n条命令（至多1秒）后返回收到的命令
+func (self *fakeControl) commands(n int) []string {
+	for i := 0; ; i++ {
+		self.mu.Lock()
+		cmds := append([]string(nil), self.cmds...)
+		self.mu.Unlock()
+		if len(cmds) >= n || i >= 100 {
+			return cmds
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewnym(t *testing.T) {
+	ctl := newFakeControl(t)
+	defer ctl.Close()
+	if err := newnym(ctl.Addr().String(), `p"w\d`); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`AUTHENTICATE "p\"w\\d"`, "SIGNAL NEWNYM", "QUIT"}
+	if cmds := ctl.commands(3); strings.Join(cmds, "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+
+	// 无密码时不带参数
+	ctl2 := newFakeControl(t)
+	defer ctl2.Close()
+	if err := newnym(ctl2.Addr().String(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := ctl2.commands(1); cmds[0] != "AUTHENTICATE" {
+		t.Errorf("commands = %q", cmds)
+	}
+}
+
+// 非250应答时返回错误，不再发送后续命令
+func TestNewnymRejected(t *testing.T) {
+	ctl := newFakeControl(t, "515 Authentication failed: Password did not match")
+	defer ctl.Close()
+	err := newnym(ctl.Addr().String(), "wrong")
+	if err == nil || !strings.Contains(err.Error(), "515 Authentication failed") {
+		t.Errorf("err = %v", err)
+	}
+	if cmds := ctl.commands(1); len(cmds) != 1 {
+		t.Errorf("commands = %q", cmds)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctl := newFakeControl(t)
+	defer ctl.Close()
+	control, password, interval := config.TOR_CONTROL, config.TOR_PASSWORD, config.TOR_INTERVAL
+	config.TOR_CONTROL, config.TOR_PASSWORD, config.TOR_INTERVAL = ctl.Addr().String(), "", 10
+	defer func() {
+		config.TOR_CONTROL, config.TOR_PASSWORD, config.TOR_INTERVAL = control, password, interval
+		rotated = time.Time{}
+	}()
+	rotated = time.Time{}
+
+	var waits []time.Duration
+	wait := func(ok bool) func(time.Duration) bool {
+		return func(d time.Duration) bool {
+			waits = append(waits, d)
+			return ok
+		}
+	}
+
+	// 首次切换无需等待
+	since := time.Now()
+	if err := Rotate(since, wait(true)); err != nil || len(waits) != 0 {
+		t.Fatalf("err = %v, waits = %v", err, waits)
+	}
+	// 同一时刻前检测到的封禁已由上次切换解决
+	if err := Rotate(since, wait(true)); err != nil || len(waits) != 0 {
+		t.Fatalf("err = %v, waits = %v", err, waits)
+	}
+	if n := len(ctl.commands(3)); n != 3 {
+		t.Fatalf("%v commands after skipped rotation", n)
+	}
+
+	// 距上次切换不足tor::interval时先等待，等待被中止时放弃切换
+	last := rotated
+	if err := Rotate(time.Now(), wait(false)); err == nil || rotated != last {
+		t.Errorf("err = %v, rotated changed: %v", err, rotated != last)
+	}
+	if len(waits) != 1 || waits[0] <= 9*time.Second || waits[0] > 10*time.Second {
+		t.Errorf("waits = %v", waits)
+	}
+	if err := Rotate(time.Now(), wait(true)); err != nil || !rotated.After(last) || len(waits) != 2 {
+		t.Errorf("err = %v, waits = %v", err, waits)
+	}
+	if n := len(ctl.commands(6)); n != 6 {
+		t.Errorf("%v commands, want 6", n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/henrylee2cn/pholcus/app/aid/seen"
 	"github.com/henrylee2cn/pholcus/app/crawler"
 	"github.com/henrylee2cn/pholcus/app/distribute"
 	"github.com/henrylee2cn/pholcus/app/pipeline"
@@ -34,11 +35,18 @@ type (
 		SpiderPrepare(original []*spider.Spider) App                  // 须在设置全局运行参数后Run()前调用（client模式下不调用该方法）
 		Run()                                                         // 阻塞式运行直至任务完成（须在所有应当配置项配置完成后调用）
 		Stop()                                                        // Offline 模式下中途终止任务（对外为阻塞式运行直至当前任务终止）
+		GracefulStop(timeout time.Duration)                           // 停止派发新请求，等待进行中的请求完成（至多timeout）后终止任务并输出全部结果
+		OnStall(fn func(idle time.Duration)) App                      // 设置任务停滞（见配置项run::idletimeout）时的回调，未设置时优雅终止任务
 		IsRunning() bool                                              // 检查任务是否正在运行
 		IsPause() bool                                                // 检查任务是否处于暂停状态
 		IsStopped() bool                                              // 检查任务是否已经终止
 		PauseRecover()                                                // Offline 模式下暂停\恢复任务
 		Status() int                                                  // 返回当前状态
+		QueueLen() (total, spilled int)                               // 返回排队中的请求数及其中溢出至磁盘的部分
+		QueueStats() []scheduler.QueueStats                           // 返回各蜘蛛请求队列的统计快照
+		BufferStats() []collector.BufferStats                         // 返回各蜘蛛已收集但尚未输出的结果的统计快照
+		ResetSeen(spiderName string) error                            // 清空蜘蛛的跨任务结果去重记录，为空时清空全部
+		Reason() string                                               // 返回最近一次任务的结束原因，见cache.REASON_QUEUE_EMPTY等
 		GetSpiderLib() []*spider.Spider                               // 获取全部蜘蛛种类
 		GetSpiderByName(string) *spider.Spider                        // 通过名字获取某蜘蛛
 		GetSpiderQueue() crawler.SpiderQueue                          // 获取蜘蛛队列接口实例
@@ -47,15 +55,19 @@ type (
 		distribute.Distributer                                        // 实现分布式接口
 	}
 	Logic struct {
-		*cache.AppConf                      // 全局配置
-		*spider.SpiderSpecies               // 全部蜘蛛种类
-		crawler.SpiderQueue                 // 当前任务的蜘蛛队列
-		*distribute.TaskJar                 // 服务器与客户端间传递任务的存储库
-		crawler.CrawlerPool                 // 爬行回收池
-		teleport.Teleport                   // socket长连接双工通信接口，json数据传输
-		sum                   [2]uint64     // 执行计数
-		takeTime              time.Duration // 执行计时
-		status                int           // 运行状态
+		*cache.AppConf                       // 全局配置
+		*spider.SpiderSpecies                // 全部蜘蛛种类
+		crawler.SpiderQueue                  // 当前任务的蜘蛛队列
+		*distribute.TaskJar                  // 服务器与客户端间传递任务的存储库
+		crawler.CrawlerPool                  // 爬行回收池
+		teleport.Teleport                    // socket长连接双工通信接口，json数据传输
+		sum                   [2]uint64      // 执行计数
+		takeTime              time.Duration  // 执行计时
+		reason                string         // 最近一次任务的结束原因
+		onStall               StallHandler   // 任务停滞时的回调
+		shards                map[int]string // 主节点登记的各分片所在节点的UID
+		forwarding            chan struct{}  // 主节点转交中的请求，容量即同时转交的上限
+		status                int            // 运行状态
 		finish                chan bool
 		finishOnce            sync.Once
 		canSocketLog          bool
@@ -99,6 +111,7 @@ func newLogic() *Logic {
 		TaskJar:       distribute.NewTaskJar(),
 		SpiderQueue:   crawler.NewSpiderQueue(),
 		CrawlerPool:   crawler.NewCrawlerPool(),
+		forwarding:    make(chan struct{}, maxForwarding),
 	}
 }
 
@@ -169,6 +182,8 @@ func (self *Logic) Init(mode int, port int, master string, w ...io.Writer) App {
 	self.TaskJar = distribute.NewTaskJar()
 	self.SpiderQueue = crawler.NewSpiderQueue()
 	self.CrawlerPool = crawler.NewCrawlerPool()
+	self.shards = nil
+	spider.ShardRoute = nil
 
 	switch self.AppConf.Mode {
 	case status.SERVER:
@@ -182,6 +197,8 @@ func (self *Logic) Init(mode int, port int, master string, w ...io.Writer) App {
 		if self.checkAll() {
 			logs.Log.Informational("                                                                                               ！！当前运行模式为：[ 客户端 ] 模式！！")
 			self.Teleport.SetAPI(distribute.SlaveApi(self)).Client(self.AppConf.Master, ":"+strconv.Itoa(self.AppConf.Port))
+			// 不属于本节点分片的请求经主节点转交
+			spider.ShardRoute = self.routeShard
 			// 开启节点间log打印
 			self.canSocketLog = true
 			logs.Log.EnableStealOne(true)
@@ -224,6 +241,14 @@ func (self *Logic) ReInit(mode int, port int, master string, w ...io.Writer) App
 // client模式下不调用该方法
 func (self *Logic) SpiderPrepare(original []*spider.Spider) App {
 	self.SpiderQueue.Reset()
+	// 读取种子URL文件
+	var seeds []*spider.Seed
+	if self.AppConf.Seeds != "" {
+		var err error
+		if seeds, err = spider.LoadSeeds(self.AppConf.Seeds, self.AppConf.SeedRule); err != nil {
+			logs.Log.Error(" *     [种子URL] %v\n", err)
+		}
+	}
 	// 遍历任务
 	for _, sp := range original {
 		spcopy := sp.Copy()
@@ -233,6 +258,12 @@ func (self *Logic) SpiderPrepare(original []*spider.Spider) App {
 		} else {
 			spcopy.SetLimit(-1 * self.AppConf.Limit)
 		}
+		if self.AppConf.Preview > 0 {
+			spcopy.SetPreview(self.AppConf.Preview)
+		}
+		if len(seeds) > 0 {
+			spcopy.SetSeeds(seeds)
+		}
 		self.SpiderQueue.Add(spcopy)
 	}
 	// 遍历自定义配置
@@ -290,6 +321,9 @@ func (self *Logic) Run() {
 	self.sum[0], self.sum[1] = 0, 0
 	// 重置计时
 	self.takeTime = 0
+	self.RWMutex.Lock()
+	self.reason = ""
+	self.RWMutex.Unlock()
 	// 设置状态
 	self.setStatus(status.RUN)
 	defer self.setStatus(status.STOPPED)
@@ -338,6 +372,23 @@ func (self *Logic) Stop() {
 	}
 }
 
+// 优雅终止任务：停止派发新请求，等待进行中的请求完成（至多timeout），
+// 随后终止任务，输出管道在终止时会输出全部缓存结果
+func (self *Logic) GracefulStop(timeout time.Duration) {
+	if self.Status() == status.STOPPED {
+		return
+	}
+	scheduler.Drain()
+	deadline := time.Now().Add(timeout)
+	for scheduler.Running() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := scheduler.Running(); n > 0 {
+		logs.Log.Warning(" *     等待超时，放弃 %v 个进行中的请求\n", n)
+	}
+	self.Stop()
+}
+
 // 检查任务是否正在运行
 func (self *Logic) IsRunning() bool {
 	return self.status == status.RUN
@@ -353,6 +404,57 @@ func (self *Logic) IsStopped() bool {
 	return self.status == status.STOPPED
 }
 
+// 返回排队中的请求数及其中溢出至磁盘的部分
+func (self *Logic) QueueLen() (total, spilled int) {
+	return scheduler.QueueLen()
+}
+
+// 返回各蜘蛛请求队列的统计快照，供外部监控使用
+func (self *Logic) QueueStats() []scheduler.QueueStats {
+	return scheduler.Stats()
+}
+
+// 返回各蜘蛛已收集但尚未输出的结果的统计快照，供外部监控使用
+func (self *Logic) BufferStats() []collector.BufferStats {
+	return collector.Stats()
+}
+
+// 清空蜘蛛的跨任务结果去重记录（见seen::enable），spiderName为空时清空全部
+func (self *Logic) ResetSeen(spiderName string) error {
+	return seen.Reset(spiderName)
+}
+
+// 返回最近一次任务的结束原因，多个蜘蛛的结束原因不同时，
+// 按 stalled > signal > stopped > limit/preview > queue-empty 的优先级取其一
+func (self *Logic) Reason() string {
+	self.RWMutex.RLock()
+	defer self.RWMutex.RUnlock()
+	return self.reason
+}
+
+// 合并结束原因，返回合并后的结果
+func (self *Logic) addReason(reason string) string {
+	self.RWMutex.Lock()
+	defer self.RWMutex.Unlock()
+	self.reason = mergeReason(self.reason, reason)
+	return self.reason
+}
+
+func mergeReason(a, b string) string {
+	rank := map[string]int{
+		cache.REASON_QUEUE_EMPTY: 1,
+		cache.REASON_LIMIT:       2,
+		cache.REASON_PREVIEW:     2,
+		cache.REASON_STOPPED:     3,
+		cache.REASON_SIGNAL:      4,
+		cache.REASON_STALLED:     5,
+	}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
 // 返回当前运行状态
 func (self *Logic) Status() int {
 	self.RWMutex.RLock()
@@ -449,6 +551,7 @@ func (self *Logic) client() {
 
 		// 准备运行
 		self.taskToRun(t)
+		self.registerShard()
 
 		// 重置计数
 		self.sum[0], self.sum[1] = 0, 0
@@ -531,7 +634,8 @@ func (self *Logic) exec() {
 	logs.Log.Informational(` *********************************************************************************************************************************** `)
 
 	// 开始计时
-	cache.StartTime = time.Now()
+	cache.StartTask()
+	logs.Log.Informational(" *     任务ID %v\n", cache.TaskID)
 
 	// 根据模式选择合理的并发
 	if self.AppConf.Mode == status.OFFLINE {
@@ -545,6 +649,13 @@ func (self *Logic) exec() {
 
 // 任务执行
 func (self *Logic) goRun(count int) {
+	// 资源监控
+	done := make(chan bool)
+	defer close(done)
+	go self.watchdog(done)
+	// 停滞监控
+	go self.idleWatch(done)
+
 	// 执行任务
 	var i int
 	for i = 0; i < count && self.Status() != status.STOP; i++ {
@@ -571,6 +682,7 @@ func (self *Logic) goRun(count int) {
 	// 监控结束任务
 	for ii := 0; ii < i; ii++ {
 		s := <-cache.ReportChan
+		self.addReason(s.Reason)
 		if (s.DataNum == 0) && (s.FileNum == 0) {
 			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   无采集结果，用时 %v！\n", s.SpiderName, s.Keyin, s.Time)
 			continue
@@ -587,6 +699,17 @@ func (self *Logic) goRun(count int) {
 			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   共采集数据 %v 条 + 下载文件 %v 个，用时 %v！\n",
 				s.SpiderName, s.Keyin, s.DataNum, s.FileNum, s.Time)
 		}
+		// 同时输出至多个目标时，分别报告各目标的输出情况
+		if len(s.Outputs) > 1 {
+			for _, out := range cache.OutTypes() {
+				st := s.Outputs[out]
+				if st.FailBatch == 0 {
+					logs.Log.App(" *         [输出目标：%s]   成功 %v 条\n", out, st.DataNum)
+				} else {
+					logs.Log.App(" *         [输出目标：%s]   成功 %v 条，失败 %v 条（%v 批），最近错误：%v\n", out, st.DataNum, st.FailNum, st.FailBatch, st.LastError)
+				}
+			}
+		}
 
 		self.sum[0] += s.DataNum
 		self.sum[1] += s.FileNum
@@ -618,6 +741,11 @@ func (self *Logic) goRun(count int) {
 		logs.Log.App(" *                            —— %s合计采集【数据 %v 条 + 文件 %v 个】，实爬【成功 %v URL + 失败 %v URL = 合计 %v URL】，耗时【%v】 ——",
 			prefix, self.sum[0], self.sum[1], cache.GetPageCount(1), cache.GetPageCount(-1), cache.GetPageCount(0), self.takeTime)
 	}
+	reason := self.Reason()
+	if reason == "" || i < count {
+		reason = self.addReason(cache.REASON_STOPPED)
+	}
+	logs.Log.Informational(" *     结束原因：%v\n", reason)
 	logs.Log.Informational(" * ")
 	logs.Log.Informational(` *********************************************************************************************************************************** `)
 
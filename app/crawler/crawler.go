@@ -2,8 +2,10 @@ package crawler
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/henrylee2cn/pholcus/app/downloader"
@@ -24,11 +26,12 @@ type (
 		GetId() int                  //获取引擎ID
 	}
 	crawler struct {
-		*spider.Spider                 //执行的采集规则
-		downloader.Downloader          //全局公用的下载器
-		pipeline.Pipeline              //结果收集与输出管道
-		id                    int      //引擎ID
-		pause                 [2]int64 //[请求间隔的最短时长,请求间隔的增幅时长]
+		*spider.Spider                  //执行的采集规则
+		downloader.Downloader           //全局公用的下载器
+		pipeline.Pipeline               //结果收集与输出管道
+		id                    int       //引擎ID
+		pause                 [2]int64  //[请求间隔的最短时长,请求间隔的增幅时长]
+		retried               *sync.Map //本次运行中已因失败重新执行的请求
 	}
 )
 
@@ -42,6 +45,7 @@ func New(id int) Crawler {
 func (self *crawler) Init(sp *spider.Spider) Crawler {
 	self.Spider = sp.ReqmatrixInit()
 	self.Pipeline = pipeline.New(sp)
+	self.retried = new(sync.Map)
 	self.pause[0] = sp.Pausetime / 2
 	if self.pause[0] > 0 {
 		self.pause[1] = self.pause[0] * 3
@@ -58,18 +62,34 @@ func (self *crawler) Run() {
 
 	// 运行处理协程
 	c := make(chan bool)
-	go func() {
-		self.run()
-		close(c)
-	}()
+	start := func() {
+		go func() {
+			self.run()
+			close(c)
+		}()
+	}
 
-	// 启动任务
-	self.Spider.Start()
+	if cache.Task.Deterministic {
+		// 确定性模式下入口规则执行完毕后再处理请求，保证入队顺序稳定
+		self.Spider.Start()
+		self.doneGroups(nil)
+		self.replayFailed()
+		start()
+	} else {
+		start()
+		// 启动任务
+		self.Spider.Start()
+		// 释放入口规则中创建的请求组
+		self.doneGroups(nil)
+		// 重新执行上次记录的失败请求
+		self.replayFailed()
+	}
 
 	<-c // 等待处理协程退出
 
 	// 停止数据收集/输出管道
 	self.Pipeline.Stop()
+	closeFailedLog()
 }
 
 // 主动终止
@@ -92,15 +112,31 @@ func (self *crawler) run() {
 			continue
 		}
 
+		// 自适应限速，等待并发名额
+		acquired := self.Spider.ThrottleAcquire()
+		for !acquired && !self.Spider.IsStopping() {
+			time.Sleep(20 * time.Millisecond)
+			acquired = self.Spider.ThrottleAcquire()
+		}
+
 		// 执行请求
 		self.UseOne()
-		go func() {
+		process := func() {
 			defer func() {
 				self.FreeOne()
+				if acquired {
+					self.Spider.ThrottleRelease()
+				}
 			}()
 			logs.Log.Debug(" *     Start: %v", req.GetUrl())
 			self.Process(req)
-		}()
+		}
+		if cache.Task.Deterministic {
+			// 确定性模式下同步处理，保证后续请求在下次出队前全部入队
+			process()
+		} else {
+			go process()
+		}
 
 		// 随机等待
 		self.sleep()
@@ -122,11 +158,8 @@ func (self *crawler) Process(req *request.Request) {
 				// println("Process$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$")
 				return
 			}
-			// 返回是否作为新的失败请求被添加至队列尾部
-			if sp.DoHistory(req, false) {
-				// 统计失败数
-				cache.PageFailCount()
-			}
+			sp.ThrottleFeedback(false)
+			self.fail(req, fmt.Errorf("panic: %v", p))
 			// 提示错误
 			stack := make([]byte, 4<<10) //4KB
 			length := runtime.Stack(stack, true)
@@ -142,37 +175,65 @@ func (self *crawler) Process(req *request.Request) {
 		}
 	}()
 
+	// 处理完毕后结束请求组计数
+	defer self.doneGroups(req)
+
 	var ctx = self.Downloader.Download(sp, req) // download page
 
+	// 连接失败或5xx响应视为主机不可用，用于主机熔断
+	sp.HostFeedback(req, ctx.GetError() == nil || (ctx.GetStatusCode() > 0 && ctx.GetStatusCode() < 500))
+
 	if err := ctx.GetError(); err != nil {
-		// 返回是否作为新的失败请求被添加至队列尾部
-		if sp.DoHistory(req, false) {
-			// 统计失败数
-			cache.PageFailCount()
-		}
+		sp.ThrottleFeedback(false)
+		self.fail(req, err)
 		// 提示错误
-		logs.Log.Error(" *     Fail  [download][%v]: %v\n", downUrl, err)
+		if proxy := ctx.GetProxy(); proxy != "" {
+			logs.Log.Error(" *     Fail  [download][%v][代理 %v]: %v\n", downUrl, proxy, err)
+		} else {
+			logs.Log.Error(" *     Fail  [download][%v]: %v\n", downUrl, err)
+		}
+		return
+	}
+
+	// 内容过少的可疑页面
+	if sp.ThinPolicy != spider.THIN_PARSE && ctx.IsThin() {
+		if sp.ThinPolicy == spider.THIN_RETRY {
+			sp.ThrottleFeedback(false)
+			self.fail(req, fmt.Errorf("响应内容少于 %v 字节", sp.MinBodySize))
+			logs.Log.Error(" *     Fail  [thin][%v]: 响应内容少于 %v 字节\n", downUrl, sp.MinBodySize)
+		} else {
+			logs.Log.Warning(" *     Drop  [thin][%v]: 响应内容少于 %v 字节\n", downUrl, sp.MinBodySize)
+		}
+		spider.PutContext(ctx)
 		return
 	}
 
 	// 过程处理，提炼数据
 	ctx.Parse(req.GetRuleName())
 
-	// 该条请求文件结果存入pipeline
-	for _, f := range ctx.PullFiles() {
-		if self.Pipeline.CollectFile(f) != nil {
-			break
-		}
+	// 按配置保存响应内容，用于调试
+	ctx.TeeDebug()
+
+	// 解析前发现的错误，如响应类型与规则不符
+	if err := ctx.GetError(); err != nil {
+		self.fail(req, err)
+		logs.Log.Error(" *     Fail  [parse][%v]: %v\n", downUrl, err)
+		spider.PutContext(ctx)
+		return
 	}
-	// 该条请求文本结果存入pipeline
-	for _, item := range ctx.PullItems() {
-		if self.Pipeline.CollectData(item) != nil {
-			break
-		}
+
+	// 预览模式下已达到预览数量，丢弃并发完成的页面结果
+	if !sp.CountPreview() {
+		spider.PutContext(ctx)
+		return
 	}
 
+	// 该条请求结果存入pipeline
+	self.collect(ctx)
+
 	// 处理成功请求记录
 	sp.DoHistory(req, true)
+	sp.ThrottleFeedback(true)
 
 	// 统计成功页数
 	cache.PageSuccCount()
@@ -184,23 +245,53 @@ func (self *crawler) Process(req *request.Request) {
 	spider.PutContext(ctx)
 }
 
+// 文件结果与文本结果存入pipeline
+func (self *crawler) collect(ctx *spider.Context) {
+	for _, f := range ctx.PullFiles() {
+		if self.Pipeline.CollectFile(f) != nil {
+			break
+		}
+	}
+	for _, item := range ctx.PullItems() {
+		if self.Pipeline.CollectData(item) != nil {
+			break
+		}
+	}
+}
+
+// 结束请求组计数，已全部完成的请求组的汇总结果存入pipeline
+func (self *crawler) doneGroups(req *request.Request) {
+	if self.Spider.IsStopping() {
+		return
+	}
+	for _, ctx := range self.Spider.DoneGroups(req) {
+		self.collect(ctx)
+		spider.PutContext(ctx)
+	}
+}
+
 // 常用基础方法
 func (self *crawler) sleep() {
 	sleeptime := self.pause[0] + rand.Int63n(self.pause[1])
-	time.Sleep(time.Duration(sleeptime) * time.Millisecond)
+	time.Sleep(time.Duration(sleeptime)*time.Millisecond + self.Spider.ThrottlePause())
 }
 
 // 从调度读取一个请求
 func (self *crawler) GetOne() *request.Request {
-	return self.Spider.RequestPull()
+	req := self.Spider.RequestPull()
+	// 结束因等待过久而被丢弃的请求的请求组计数
+	for _, expired := range self.Spider.RequestExpired() {
+		self.doneGroups(expired)
+	}
+	return req
 }
 
-//从调度使用一个资源空位
+// 从调度使用一个资源空位
 func (self *crawler) UseOne() {
 	self.Spider.RequestUse()
 }
 
-//从调度释放一个资源空位
+// 从调度释放一个资源空位
 func (self *crawler) FreeOne() {
 	self.Spider.RequestFree()
 }
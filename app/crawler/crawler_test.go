@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/app/scheduler"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+)
+
+// 不经网络，按请求地址返回固定页面，并记录下载顺序
+type fakeDownloader struct {
+	sync.Mutex
+	urls []string
+}
+
+func (self *fakeDownloader) Download(sp *spider.Spider, req *request.Request) *spider.Context {
+	self.Lock()
+	self.urls = append(self.urls, req.GetUrl())
+	self.Unlock()
+	return spider.GetContext(sp, req).SetResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader("<p>" + req.GetUrl() + "</p>")),
+		Request:    &http.Request{Method: req.GetMethod(), Header: req.GetHeader()},
+	})
+}
+
+type discardPipeline struct{}
+
+func (discardPipeline) Start()                          {}
+func (discardPipeline) Stop()                           {}
+func (discardPipeline) CollectData(data.DataCell) error { return nil }
+func (discardPipeline) CollectFile(data.FileCell) error { return nil }
+func (discardPipeline) Flush() error                    { return nil }
+
+// 入口添加3个列表页，每个列表页再添加2个详情页
+var orderSpider = spider.Spider{
+	Name: "order",
+	RuleTree: &spider.RuleTree{
+		Root: func(ctx *spider.Context) {
+			for _, p := range []string{"1", "2", "3"} {
+				ctx.AddQueue(&request.Request{Url: "http://example.com/" + p, Rule: "list"})
+			}
+		},
+		Trunk: map[string]*spider.Rule{
+			"list": {ParseFunc: func(ctx *spider.Context) {
+				for _, p := range []string{"a", "b"} {
+					ctx.AddQueue(&request.Request{Url: ctx.GetUrl() + "/" + p, Rule: "item"})
+				}
+			}},
+			"item": {ParseFunc: func(*spider.Context) {}},
+		},
+	},
+}.Register()
+
+func crawlOrder() []string {
+	scheduler.Init()
+	defer scheduler.Stop()
+	sp := orderSpider.Copy()
+	down := &fakeDownloader{}
+	c := &crawler{Spider: sp.ReqmatrixInit(), Downloader: down, Pipeline: discardPipeline{}, retried: new(sync.Map)}
+	c.pause[1] = 1
+	c.Run()
+	return down.urls
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	cache.Task.Mode = status.SERVER
+	cache.Task.ThreadNum = 4
+	cache.Task.Deterministic = true
+	defer func() { cache.Task.Deterministic = false }()
+
+	want := []string{
+		"http://example.com/1", "http://example.com/2", "http://example.com/3",
+		"http://example.com/1/a", "http://example.com/1/b",
+		"http://example.com/2/a", "http://example.com/2/b",
+		"http://example.com/3/a", "http://example.com/3/b",
+	}
+	for i := 0; i < 3; i++ {
+		if got := crawlOrder(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: order = %v", i, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
 )
 
@@ -44,7 +45,8 @@ func (self *cq) Reset(spiderNum int) int {
 	} else {
 		wantNum = config.CRAWLS_CAP
 	}
-	if wantNum <= 0 {
+	if wantNum <= 0 || cache.Task.Deterministic {
+		// 确定性模式下逐个执行蜘蛛
 		wantNum = 1
 	}
 	self.capacity = wantNum
@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 最终失败的请求记录，配置项failed::path指定的文件中每行一条
+type failedRecord struct {
+	Time     string `json:"time"`
+	Spider   string `json:"spider"`
+	Keyin    string `json:"keyin,omitempty"`
+	Url      string `json:"url"`
+	Rule     string `json:"rule"`
+	Method   string `json:"method"`
+	Body     string `json:"body,omitempty"`
+	Error    string `json:"error"`
+	Proxy    string `json:"proxy,omitempty"`
+	Attempts int    `json:"attempts"`  // 本次运行中调度执行的次数，首次失败后会在队列末尾重新执行一次
+	TryTimes int    `json:"try_times"` // 每次执行时下载器的最大尝试次数
+	Request  string `json:"request"`   // Request.Serialize()的结果，用于failed::replay，不含Spider配置的认证信息
+}
+
+var failedLog struct {
+	file *os.File
+	path string // file对应的failed::path
+	sync.Mutex
+}
+
+// 记录失败请求：首次失败的请求加入队列末尾重新执行，再次失败时为最终失败，写入failed::path
+func (self *crawler) fail(req *request.Request, err error) {
+	// 返回是否作为新的失败请求被添加至队列尾部
+	if self.Spider.DoHistory(req, false) {
+		// 统计失败数
+		cache.PageFailCount()
+		self.retried.Store(req.Unique(), true)
+		return
+	}
+	if config.FAILED_PATH == "" {
+		return
+	}
+	// 继承自历史失败记录的请求本次仅执行一次
+	attempts := 1
+	if _, ok := self.retried.Load(req.Unique()); ok {
+		attempts = 2
+	}
+	rec := failedRecord{
+		Time:     time.Now().Format(time.RFC3339),
+		Spider:   self.Spider.GetName(),
+		Keyin:    self.Spider.GetKeyin(),
+		Url:      req.GetUrl(),
+		Rule:     req.GetRuleName(),
+		Method:   req.GetMethod(),
+		Body:     req.GetPostData(),
+		Proxy:    req.GetProxy(),
+		Attempts: attempts,
+		TryTimes: req.GetTryTimes(),
+		Request:  self.serializeFailed(req),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	b, _ := json.Marshal(rec)
+	b = append(b, '\n')
+
+	failedLog.Lock()
+	defer failedLog.Unlock()
+	path := filepath.Clean(config.FAILED_PATH)
+	if failedLog.file != nil && failedLog.path != path {
+		failedLog.file.Close()
+		failedLog.file = nil
+	}
+	if failedLog.file == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			logs.Log.Error(" *     [失败请求记录]: %v\n", err)
+			return
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			logs.Log.Error(" *     [失败请求记录]: %v\n", err)
+			return
+		}
+		failedLog.file, failedLog.path = file, path
+	}
+	if _, err := failedLog.file.Write(b); err != nil {
+		logs.Log.Error(" *     [失败请求记录]: %v\n", err)
+	}
+}
+
+// 序列化失败请求，剔除由Spider.SetBasicAuth()等设置的Authorization请求头，
+// 以免凭据写入失败记录，重新执行时下载器会再次设置。
+func (self *crawler) serializeFailed(req *request.Request) string {
+	auth := req.GetHeader().Get("Authorization")
+	if auth == "" || auth != self.Spider.GetAuthorization(req.GetUrl()) {
+		return req.Serialize()
+	}
+	req = req.Copy()
+	req.Header.Del("Authorization")
+	return req.Serialize()
+}
+
+// 关闭失败请求记录文件，此后的记录会重新打开failed::path
+func closeFailedLog() {
+	failedLog.Lock()
+	defer failedLog.Unlock()
+	if failedLog.file != nil {
+		failedLog.file.Close()
+		failedLog.file = nil
+	}
+}
+
+// 将failed::replay文件中属于该蜘蛛（名称与Keyin相同）的失败请求重新加入队列
+func (self *crawler) replayFailed() {
+	if config.FAILED_REPLAY == "" {
+		return
+	}
+	file, err := os.Open(config.FAILED_REPLAY)
+	if err != nil {
+		logs.Log.Error(" *     [重新执行失败请求]: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	var n int
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var rec failedRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Spider != self.Spider.GetName() || rec.Keyin != self.Spider.GetKeyin() {
+			continue
+		}
+		req, err := request.UnSerialize(rec.Request)
+		if err != nil {
+			logs.Log.Error(" *     [重新执行失败请求][%s]: %v\n", rec.Url, err)
+			continue
+		}
+		// 上次运行的请求组已不存在
+		req.SetGroup("")
+		self.Spider.RequestPush(req)
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		logs.Log.Error(" *     [重新执行失败请求]: %v\n", err)
+	}
+	logs.Log.Informational(" *     [%s] 从 %s 重新加入失败请求 %v 条\n", self.Spider.GetName(), config.FAILED_REPLAY, n)
+}
@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/scheduler"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+)
+
+func testCrawler(t *testing.T) *crawler {
+	cache.Task.Mode = status.SERVER
+	cache.Task.ThreadNum = 1
+	scheduler.Init()
+	t.Cleanup(scheduler.Stop)
+	sp := &spider.Spider{
+		Name:     "test",
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{"list": {}}},
+	}
+	sp.SetBasicAuth("example.com", "user", "secret")
+	return &crawler{Spider: sp.ReqmatrixInit(), retried: new(sync.Map)}
+}
+
+func readFailed(t *testing.T, path string) []failedRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []failedRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var rec failedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// 最终失败的请求写入failed::path（不含认证信息），并可经failed::replay重新加入队列
+func TestFailedRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, replay := config.FAILED_PATH, config.FAILED_REPLAY
+	defer func() { config.FAILED_PATH, config.FAILED_REPLAY = path, replay }()
+	config.FAILED_PATH = filepath.Join(dir, "a", "failed.jsonl")
+
+	c := testCrawler(t)
+	req := &request.Request{Url: "http://example.com/1", Rule: "list", Method: "POST", PostData: "k=v"}
+	req.SetSpiderName("test")
+	req.Prepare()
+	req.SetHeader("Authorization", c.Spider.GetAuthorization(req.GetUrl()))
+	c.fail(req, errors.New("timeout"))
+	c.fail(req, errors.New("timeout"))
+
+	recs := readFailed(t, config.FAILED_PATH)
+	if len(recs) != 1 {
+		t.Fatalf("records = %v", recs)
+	}
+	rec := recs[0]
+	if rec.Url != req.GetUrl() || rec.Method != "POST" || rec.Body != "k=v" || rec.Error != "timeout" || rec.Attempts != 2 {
+		t.Errorf("record = %+v", rec)
+	}
+	if strings.Contains(rec.Request, "Authorization") || strings.Contains(rec.Request, "Basic ") {
+		t.Errorf("credentials recorded: %s", rec.Request)
+	}
+	if req.GetHeader().Get("Authorization") == "" {
+		t.Error("Authorization removed from the request itself")
+	}
+
+	// 修改failed::path后写入新文件
+	config.FAILED_PATH = filepath.Join(dir, "b", "failed.jsonl")
+	other := &request.Request{Url: "http://example.com/2", Rule: "list"}
+	other.SetSpiderName("test")
+	other.Prepare()
+	c.fail(other, errors.New("timeout"))
+	c.fail(other, errors.New("timeout"))
+	closeFailedLog()
+	if recs := readFailed(t, config.FAILED_PATH); len(recs) != 1 || recs[0].Url != other.GetUrl() {
+		t.Errorf("records after path change = %v", recs)
+	}
+
+	var replayed []*request.Request
+	c.Spider.SetRequestSink(func(req *request.Request) { replayed = append(replayed, req) })
+	config.FAILED_REPLAY = filepath.Join(dir, "a", "failed.jsonl")
+	c.replayFailed()
+	if len(replayed) != 1 {
+		t.Fatalf("replayed = %v", replayed)
+	}
+	if r := replayed[0]; r.GetUrl() != req.GetUrl() || r.GetMethod() != "POST" || r.GetPostData() != "k=v" || r.GetRuleName() != "list" {
+		t.Errorf("replayed = %+v", r)
+	}
+}
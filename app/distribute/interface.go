@@ -8,4 +8,10 @@ type Distributer interface {
 	Receive(task *Task)
 	// 返回与之连接的节点数
 	CountNodes() int
+	// 主节点登记分片所在的节点
+	RegisterShard(shard int, nodeUID string)
+	// 主节点将请求转交其所属分片的节点
+	Forward(route *Route)
+	// 从节点接收转交的请求
+	Accept(route *Route)
 }
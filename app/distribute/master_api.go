@@ -2,6 +2,8 @@ package distribute
 
 import (
 	"encoding/json"
+	"strconv"
+
 	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/teleport"
 )
@@ -14,6 +16,12 @@ func MasterApi(n Distributer) teleport.API {
 
 		// 打印接收到的日志
 		"log": &masterLogHandle{},
+
+		// 登记从节点的分片序号
+		"shard": &masterShardHandle{n},
+
+		// 转交不属于发送节点分片的请求
+		"route": &masterRouteHandle{n},
 	}
 }
 
@@ -36,3 +44,33 @@ func (*masterLogHandle) Process(receive *teleport.NetData) *teleport.NetData {
 	logs.Log.Informational(" * ")
 	return nil
 }
+
+// 主节点登记从节点分片序号的操作
+type masterShardHandle struct {
+	Distributer
+}
+
+func (self *masterShardHandle) Process(receive *teleport.NetData) *teleport.NetData {
+	shard, err := strconv.Atoi(receive.Body.(string))
+	if err != nil {
+		logs.Log.Error("分片序号无效 %v", receive.Body)
+		return nil
+	}
+	self.RegisterShard(shard, receive.From)
+	return nil
+}
+
+// 主节点将请求转交其所属分片的节点的操作
+type masterRouteHandle struct {
+	Distributer
+}
+
+func (self *masterRouteHandle) Process(receive *teleport.NetData) *teleport.NetData {
+	route := &Route{}
+	if err := json.Unmarshal([]byte(receive.Body.(string)), route); err != nil {
+		logs.Log.Error("json解码失败 %v", receive.Body)
+		return nil
+	}
+	self.Forward(route)
+	return nil
+}
@@ -0,0 +1,10 @@
+package distribute
+
+// 分片路由：开启分片（配置项shard::count大于1）时，从节点将不属于本分片的请求发给主节点，
+// 由主节点转交登记了该分片的从节点
+type Route struct {
+	Shard   int    // 请求所属的分片序号
+	Spider  string // 蜘蛛名称
+	Keyin   string // 蜘蛛的自定义配置
+	Request string // Request.Serialize()的结果
+}
@@ -0,0 +1,49 @@
+package distribute
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/henrylee2cn/teleport"
+)
+
+type testNode struct {
+	*TaskJar
+	shards   map[int]string
+	forwards []*Route
+	accepts  []*Route
+}
+
+func (self *testNode) CountNodes() int { return len(self.shards) }
+
+func (self *testNode) RegisterShard(shard int, nodeUID string) { self.shards[shard] = nodeUID }
+
+func (self *testNode) Forward(route *Route) { self.forwards = append(self.forwards, route) }
+
+func (self *testNode) Accept(route *Route) { self.accepts = append(self.accepts, route) }
+
+func TestRouteHandles(t *testing.T) {
+	n := &testNode{TaskJar: NewTaskJar(), shards: map[int]string{}}
+	master, slave := MasterApi(n), SlaveApi(n)
+
+	master["shard"].Process(teleport.NewNetData("node1", "", "shard", "", "2"))
+	if n.shards[2] != "node1" {
+		t.Errorf("shards = %v", n.shards)
+	}
+
+	b, _ := json.Marshal(Route{Shard: 2, Spider: "test", Keyin: "k", Request: `{"Url":"http://example.com/"}`})
+	master["route"].Process(teleport.NewNetData("node0", "", "route", "", string(b)))
+	slave["route"].Process(teleport.NewNetData("server", "", "route", "", string(b)))
+	for _, routes := range [][]*Route{n.forwards, n.accepts} {
+		if len(routes) != 1 || routes[0].Shard != 2 || routes[0].Spider != "test" || routes[0].Keyin != "k" {
+			t.Errorf("routes = %+v", routes)
+		}
+	}
+
+	// 无效的消息被忽略
+	master["shard"].Process(teleport.NewNetData("node1", "", "shard", "", "x"))
+	master["route"].Process(teleport.NewNetData("node0", "", "route", "", "{"))
+	if len(n.shards) != 1 || len(n.forwards) != 1 {
+		t.Errorf("shards = %v, forwards = %v", n.shards, n.forwards)
+	}
+}
@@ -12,6 +12,9 @@ func SlaveApi(n Distributer) teleport.API {
 	return teleport.API{
 		// 接收来自服务器的任务并加入任务库
 		"task": &slaveTaskHandle{n},
+
+		// 接收主节点转交的属于本分片的请求
+		"route": &slaveRouteHandle{n},
 	}
 }
 
@@ -30,3 +33,18 @@ func (self *slaveTaskHandle) Process(receive *teleport.NetData) *teleport.NetDat
 	self.Receive(t)
 	return nil
 }
+
+// 从节点接收主节点转交的请求的操作
+type slaveRouteHandle struct {
+	Distributer
+}
+
+func (self *slaveRouteHandle) Process(receive *teleport.NetData) *teleport.NetData {
+	route := &Route{}
+	if err := json.Unmarshal([]byte(receive.Body.(string)), route); err != nil {
+		logs.Log.Error("json解码失败 %v", receive.Body)
+		return nil
+	}
+	self.Accept(route)
+	return nil
+}
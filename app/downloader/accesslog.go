@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 访问日志，以JSON Lines格式记录每次HTTP请求尝试，独立于程序日志，超过大小上限时轮转
+type accessLog struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	sync.Mutex
+}
+
+type accessRecord struct {
+	Time     string `json:"time"`
+	Method   string `json:"method"`
+	Url      string `json:"url"`
+	Status   int    `json:"status"`
+	Bytes    int64  `json:"bytes"`
+	Duration int64  `json:"duration_ms"`
+	Proxy    string `json:"proxy,omitempty"`
+	Try      int    `json:"try"`
+	Error    string `json:"error,omitempty"`
+}
+
+func init() {
+	if config.ACCESS_LOG_PATH == "" {
+		return
+	}
+	l := &accessLog{
+		path:    filepath.Clean(config.ACCESS_LOG_PATH),
+		maxSize: int64(config.ACCESS_LOG_MAX_SIZE) << 20,
+	}
+	surfer.OnTrace = l.write
+}
+
+func (self *accessLog) write(t *surfer.Trace) {
+	rec := accessRecord{
+		Time:     t.Time.Format(time.RFC3339Nano),
+		Method:   t.Method,
+		Url:      t.Url,
+		Status:   t.StatusCode,
+		Bytes:    t.Bytes,
+		Duration: int64(t.Duration / time.Millisecond),
+		Proxy:    t.Proxy,
+		Try:      t.Try,
+	}
+	if t.Err != nil {
+		rec.Error = t.Err.Error()
+	}
+	b, _ := json.Marshal(rec)
+	b = append(b, '\n')
+
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil || self.size+int64(len(b)) > self.maxSize {
+		if err := self.rotate(); err != nil {
+			logs.Log.Error(" *     [访问日志]: %v\n", err)
+			return
+		}
+	}
+	n, err := self.file.Write(b)
+	self.size += int64(n)
+	if err != nil {
+		logs.Log.Error(" *     [访问日志]: %v\n", err)
+	}
+}
+
+// 打开日志文件，已有内容超过大小上限时先重命名为带时间后缀的备份
+func (self *accessLog) rotate() error {
+	if self.file != nil {
+		self.file.Close()
+		self.file = nil
+	}
+	if info, err := os.Stat(self.path); err == nil && info.Size() > 0 && (info.Size() >= self.maxSize || self.size > 0) {
+		if err := os.Rename(self.path, self.path+"."+time.Now().Format("20060102-150405.000")); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(self.path), 0777); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(self.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	self.file, self.size = file, info.Size()
+	return nil
+}
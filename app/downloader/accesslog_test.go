@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
+)
+
+// 读取日志文件中各条记录的Url
+func accessUrls(t *testing.T, path string) (urls []string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var rec accessRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", scanner.Text(), err)
+		}
+		urls = append(urls, rec.Url)
+	}
+	return
+}
+
+func TestAccessLogRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log", "access.log")
+	os.MkdirAll(filepath.Dir(path), 0777)
+	if err := ioutil.WriteFile(path, []byte(`{"url":"old"}`+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &accessLog{path: path, maxSize: 200}
+	trace := func(url string, err error) *surfer.Trace {
+		return &surfer.Trace{Time: time.Now(), Method: "GET", Url: url, StatusCode: 200, Bytes: -1, Try: 1, Err: err}
+	}
+	// 未超过上限的已有日志继续追加
+	l.write(trace("http://example.com/1", nil))
+	if urls := accessUrls(t, path); len(urls) != 2 || urls[0] != "old" {
+		t.Fatalf("urls = %v", urls)
+	}
+	l.write(trace("http://example.com/2", errors.New("timeout")))
+	l.file.Close()
+
+	if urls := accessUrls(t, path); len(urls) != 1 || urls[0] != "http://example.com/2" {
+		t.Errorf("current urls = %v", urls)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+	if urls := accessUrls(t, backups[0]); len(urls) != 2 || urls[1] != "http://example.com/1" {
+		t.Errorf("backup urls = %v", urls)
+	}
+}
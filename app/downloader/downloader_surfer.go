@@ -2,13 +2,17 @@ package downloader
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/cookiejar"
+	"time"
 
+	"github.com/henrylee2cn/pholcus/app/aid/tor"
 	"github.com/henrylee2cn/pholcus/app/downloader/request"
 	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
 	"github.com/henrylee2cn/pholcus/app/spider"
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
 )
 
 type Surfer struct {
@@ -24,15 +28,156 @@ var (
 	}
 )
 
+func init() {
+	surfer.Dial = surfer.DialOptions{
+		Timeout:       time.Duration(config.DIAL_TIMEOUT) * time.Millisecond,
+		KeepAlive:     time.Duration(config.DIAL_KEEP_ALIVE) * time.Second,
+		HappyEyeballs: config.DIAL_HAPPY_EYEBALLS,
+	}
+}
+
 func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.Context {
+	start := time.Now()
+	ctx := self.fetch(sp, cReq)
+
+	// 响应为未登录页面时重新登录，并重新下载原请求
+	for times := 0; sp.Login != nil && sp.Login.IsLoggedOut(ctx); times++ {
+		if times >= sp.Login.GetMaxTimes() {
+			ctx.SetError(fmt.Errorf("重新登录%v次后仍为未登录页面", times))
+			break
+		}
+		err := sp.Login.Relogin(cReq, start, func() error {
+			logs.Log.Informational(" *     [%v] 会话已失效，重新登录: %v\n", sp.GetName(), sp.Login.Url)
+			return self.login(sp, cReq)
+		})
+		if err != nil {
+			ctx.SetError(fmt.Errorf("重新登录失败: %v", err))
+			break
+		}
+		spider.PutContext(ctx)
+		start = time.Now()
+		ctx = self.fetch(sp, cReq)
+	}
+
+	return rotateTor(sp, cReq, ctx, start, func() *spider.Context {
+		return self.fetch(sp, cReq)
+	})
+}
+
+// 切换Tor线路，测试时替换
+var torRotate = tor.Rotate
+
+// 经Tor访问且响应为封禁状态时切换线路（出口IP），并以fetch重新下载原请求，至多tor::maxrotate次；
+// start为ctx开始下载的时刻
+func rotateTor(sp *spider.Spider, cReq *request.Request, ctx *spider.Context, start time.Time, fetch func() *spider.Context) *spider.Context {
+	for times := 0; tor.CanRotate() && cReq.GetProxy() == config.TOR_SOCKS && ctx.IsBanned(); times++ {
+		if times >= config.TOR_MAX_ROTATE {
+			break
+		}
+		logs.Log.Informational(" *     [%v] 响应状态 %v，切换Tor线路后重试: %v\n", sp.GetName(), ctx.GetStatusCode(), cReq.GetUrl())
+		if err := torRotate(start, sp.Sleep); err != nil {
+			logs.Log.Error(" *     [%v] 切换Tor线路失败: %v\n", sp.GetName(), err)
+			break
+		}
+		spider.PutContext(ctx)
+		start = time.Now()
+		ctx = fetch()
+	}
+	return ctx
+}
+
+// 下载请求，响应为带Retry-After的429或503时按其等待（至多run::retryaftermax）后重试，
+// 响应内容符合Spider.SetRetryOnBody()的重试条件时等待Request.RetryPause后重试，
+// 重试次数受Request.TryTimes限制
+func (self *Surfer) fetch(sp *spider.Spider, cReq *request.Request) *spider.Context {
+	for tries := 1; ; tries++ {
+		sp.WaitHost(cReq.GetUrl())
+		ctx := self.download(sp, cReq)
+		last := cReq.GetTryTimes() > 0 && tries >= cReq.GetTryTimes()
+		wait, ok := spider.RetryAfter(ctx.Response)
+		if !ok || config.RETRY_AFTER_MAX <= 0 {
+			if ctx.GetError() != nil || !ctx.IsSoftFailure() {
+				return ctx
+			}
+			if last {
+				ctx.SetError(fmt.Errorf("响应内容符合重试条件，已尝试%v次", tries))
+				return ctx
+			}
+			logs.Log.Warning(" *     Retry  [body][%v]: 响应内容符合重试条件，第%v次重试\n", cReq.GetUrl(), tries)
+			if !sp.Sleep(cReq.GetRetryPause()) {
+				return ctx
+			}
+			spider.PutContext(ctx)
+			continue
+		}
+		if last {
+			return ctx
+		}
+		if max := time.Duration(config.RETRY_AFTER_MAX) * time.Second; wait > max {
+			wait = max
+		}
+		logs.Log.Informational(" *     [%v] 响应状态 %v，按Retry-After等待 %v 后重试: %v\n", sp.GetName(), ctx.GetStatusCode(), wait, cReq.GetUrl())
+		if sp.RetryAfterHost {
+			sp.HoldHost(cReq.GetUrl(), time.Now().Add(wait))
+		}
+		if !sp.Sleep(wait) {
+			return ctx
+		}
+		spider.PutContext(ctx)
+	}
+}
+
+// 执行登录，cookie存入请求所属会话的cookie容器
+func (self *Surfer) login(sp *spider.Spider, cReq *request.Request) error {
+	lReq := sp.Login.Request(sp, cReq)
+	resp, err := self.surf.Download(newSurfRequest(sp, lReq))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.New("响应状态 " + resp.Status)
+	}
+	return nil
+}
+
+func (self *Surfer) download(sp *spider.Spider, cReq *request.Request) *spider.Context {
 	ctx := spider.GetContext(sp, cReq)
 
+	// 请求未指定时使用Spider的默认Accept-Language
+	if lang := sp.GetAcceptLanguage(); lang != "" && cReq.GetHeader().Get("Accept-Language") == "" {
+		cReq.SetAcceptLanguage(lang)
+	}
+
+	// 请求未指定的字段使用Spider的默认请求头
+	sp.MergeDefaultHeaders(cReq)
+
+	// 请求未指定时使用Spider为该主机配置的认证信息
+	if cReq.GetHeader().Get("Authorization") == "" {
+		if auth := sp.GetAuthorization(cReq.GetUrl()); auth != "" {
+			cReq.SetHeader("Authorization", auth)
+		}
+	}
+
+	// Spider为该主机禁止复用连接
+	if sp.IsStickyHost(cReq.GetUrl()) {
+		cReq.SetNoKeepAlive(true)
+	}
+
+	// 存在未完成的文件下载时续传
+	spider.PrepareResume(sp, cReq)
+
+	// 未分配代理的请求经Tor访问（仅Surf下载器）
+	if tor.Enabled() && cReq.GetProxy() == "" && cReq.GetDownloaderID() == request.SURF_ID {
+		cReq.SetProxy(config.TOR_SOCKS)
+	}
+
 	var resp *http.Response
 	var err error
 
 	switch cReq.GetDownloaderID() {
 	case request.SURF_ID:
-		resp, err = self.surf.Download(cReq)
+		resp, err = self.surf.Download(newSurfRequest(sp, cReq))
 
 	case request.PHANTOM_ID:
 		resp, err = self.phantom.Download(cReq)
@@ -41,8 +186,55 @@ func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.C
 	if resp.StatusCode >= 400 {
 		err = errors.New("响应状态 " + resp.Status)
 	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && cReq.GetHeader().Get("Range") != "" {
+		spider.DiscardPartial(cReq.GetUrl())
+	}
 
-	ctx.SetResponse(resp).SetError(err)
+	ctx.SetResponse(resp).SetDownloaderID(cReq.GetDownloaderID()).SetProxyUsed(cReq.GetProxy()).SetError(err)
 
 	return ctx
 }
+
+func init() {
+	spider.BrowserDownload = SurferDownloader.browserDownload
+	spider.SyncDownload = SurferDownloader.Download
+}
+
+// 以PhantomJS内核重新下载请求，并在返回内容前执行页面操作
+func (self *Surfer) browserDownload(cReq *request.Request, actions *surfer.BrowserActions) (*http.Response, error) {
+	resp, err := self.phantom.Download(&browserRequest{cReq, actions})
+	if err == nil && resp.StatusCode >= 400 {
+		err = errors.New("响应状态 " + resp.Status)
+	}
+	return resp, err
+}
+
+type browserRequest struct {
+	*request.Request
+	actions *surfer.BrowserActions
+}
+
+func (self *browserRequest) GetBrowserActions() *surfer.BrowserActions {
+	return self.actions
+}
+
+// 附带Spider中Surf下载器相关设置的请求
+type surfRequest struct {
+	*request.Request
+	sp *spider.Spider
+}
+
+func newSurfRequest(sp *spider.Spider, req *request.Request) surfer.Request {
+	if sp.GetTransport() == nil && len(sp.HeaderOrder) == 0 && !sp.ShuffleHeaders {
+		return req
+	}
+	return &surfRequest{req, sp}
+}
+
+func (self *surfRequest) GetTransport() *http.Transport {
+	return self.sp.GetTransport()
+}
+
+func (self *surfRequest) GetHeaderOrder() ([]string, bool) {
+	return self.sp.HeaderOrder, self.sp.ShuffleHeaders
+}
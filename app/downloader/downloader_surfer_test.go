@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 以状态码构造响应
+func statusContext(sp *spider.Spider, req *request.Request, code int) *spider.Context {
+	return spider.GetContext(sp, req).SetResponse(&http.Response{StatusCode: code, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))})
+}
+
+func TestRotateTor(t *testing.T) {
+	socks, control, max, rotate := config.TOR_SOCKS, config.TOR_CONTROL, config.TOR_MAX_ROTATE, torRotate
+	config.TOR_SOCKS, config.TOR_CONTROL, config.TOR_MAX_ROTATE = "socks5://127.0.0.1:9050", "127.0.0.1:9051", 2
+	defer func() {
+		config.TOR_SOCKS, config.TOR_CONTROL, config.TOR_MAX_ROTATE, torRotate = socks, control, max, rotate
+	}()
+	sp := &spider.Spider{Name: "test"}
+
+	cases := []struct {
+		name      string
+		proxy     string
+		codes     []int // 依次重新下载得到的状态码
+		rotateErr error
+		rotations int
+		want      int
+	}{
+		{"不超过tor::maxrotate", config.TOR_SOCKS, []int{403, 403, 403}, nil, 2, 403},
+		{"解封后停止", config.TOR_SOCKS, []int{200}, nil, 1, 200},
+		{"切换失败", config.TOR_SOCKS, nil, errors.New("refused"), 1, 403},
+		{"未经Tor", "http://proxy:8080", nil, nil, 0, 403},
+	}
+	for _, c := range cases {
+		var sinces []time.Time
+		torRotate = func(since time.Time, wait func(time.Duration) bool) error {
+			sinces = append(sinces, since)
+			return c.rotateErr
+		}
+		req := &request.Request{Url: "http://example.com/", Rule: "r"}
+		req.Prepare()
+		req.SetProxy(c.proxy)
+		codes := c.codes
+		start := time.Now().Add(-time.Second)
+		ctx := rotateTor(sp, req, statusContext(sp, req, 403), start, func() *spider.Context {
+			code := codes[0]
+			codes = codes[1:]
+			return statusContext(sp, req, code)
+		})
+		if len(sinces) != c.rotations || ctx.GetStatusCode() != c.want {
+			t.Errorf("%s: rotations = %v, status = %v", c.name, len(sinces), ctx.GetStatusCode())
+		}
+		// 首次以原响应的下载时刻判断是否已切换，此后以重新下载的时刻判断
+		if len(sinces) > 0 && !sinces[0].Equal(start) {
+			t.Errorf("%s: first since = %v, want %v", c.name, sinces[0], start)
+		}
+		if len(sinces) > 1 && !sinces[1].After(start) {
+			t.Errorf("%s: second since = %v", c.name, sinces[1])
+		}
+		spider.PutContext(ctx)
+	}
+}
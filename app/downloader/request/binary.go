@@ -0,0 +1,276 @@
+package request
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Request的二进制序列化，采用protobuf编码格式，对应的消息定义如下：
+//
+//	message Request {
+//	  string spider = 1;
+//	  string url = 2;
+//	  string rule = 3;
+//	  string method = 4;
+//	  repeated Header header = 5;   // message Header { string key = 1; repeated string values = 2; }
+//	  bool enable_cookie = 6;
+//	  string post_data = 7;
+//	  sint64 dial_timeout = 8;      // 纳秒
+//	  sint64 conn_timeout = 9;      // 纳秒
+//	  sint64 try_times = 10;
+//	  sint64 retry_pause = 11;      // 纳秒
+//	  sint64 redirect_times = 12;
+//	  map<string, string> temp = 13; // 值为JSON文本
+//	  repeated string temp_is_json = 14;
+//	  sint64 priority = 15;
+//	  bool reloadable = 16;
+//	  string session = 17;
+//	  string parent_url = 18;
+//	  string fingerprint = 19;
+//	  sint64 downloader_id = 20;
+//	  string group = 21;
+//	  bool no_keep_alive = 22;
+//	}
+//
+// Temp中的值与Serialize()相同，统一以JSON文本保存，故仅支持可由encoding/json编码的值，
+// 读取时经GetTemp()解码。
+const (
+	pbVarint = 0
+	pbBytes  = 2
+)
+
+var errProtobuf = errors.New("request: 无效的protobuf数据")
+
+// 以protobuf格式序列化，实现encoding.BinaryMarshaler。
+func (self *Request) MarshalBinary() ([]byte, error) {
+	if self.TempIsJson == nil && len(self.Temp) > 0 {
+		self.TempIsJson = make(map[string]bool, len(self.Temp))
+	}
+	for k, v := range self.Temp {
+		if self.TempIsJson[k] {
+			continue
+		}
+		self.Temp.set(k, v)
+		self.TempIsJson[k] = true
+	}
+	var b []byte
+	b = pbAppendString(b, 1, self.Spider)
+	b = pbAppendString(b, 2, self.Url)
+	b = pbAppendString(b, 3, self.Rule)
+	b = pbAppendString(b, 4, self.Method)
+	for k, vs := range self.Header {
+		var e []byte
+		e = pbAppendString(e, 1, k)
+		for _, v := range vs {
+			e = pbAppendTag(e, 2, pbBytes)
+			e = pbAppendLen(e, v)
+		}
+		b = pbAppendMessage(b, 5, e)
+	}
+	b = pbAppendBool(b, 6, self.EnableCookie)
+	b = pbAppendString(b, 7, self.PostData)
+	b = pbAppendSint(b, 8, int64(self.DialTimeout))
+	b = pbAppendSint(b, 9, int64(self.ConnTimeout))
+	b = pbAppendSint(b, 10, int64(self.TryTimes))
+	b = pbAppendSint(b, 11, int64(self.RetryPause))
+	b = pbAppendSint(b, 12, int64(self.RedirectTimes))
+	for k, v := range self.Temp {
+		s, _ := v.(string)
+		var e []byte
+		e = pbAppendString(e, 1, k)
+		e = pbAppendString(e, 2, s)
+		b = pbAppendMessage(b, 13, e)
+	}
+	for k, ok := range self.TempIsJson {
+		if ok {
+			b = pbAppendTag(b, 14, pbBytes)
+			b = pbAppendLen(b, k)
+		}
+	}
+	b = pbAppendSint(b, 15, int64(self.Priority))
+	b = pbAppendBool(b, 16, self.Reloadable)
+	b = pbAppendString(b, 17, self.Session)
+	b = pbAppendString(b, 18, self.ParentUrl)
+	b = pbAppendString(b, 19, self.Fingerprint)
+	b = pbAppendSint(b, 20, int64(self.DownloaderID))
+	b = pbAppendString(b, 21, self.Group)
+	b = pbAppendBool(b, 22, self.NoKeepAlive)
+	return b, nil
+}
+
+// 从protobuf格式反序列化，实现encoding.BinaryUnmarshaler，未知字段将被忽略。
+func (self *Request) UnmarshalBinary(data []byte) error {
+	return pbEach(data, func(field int, u uint64, s string) error {
+		switch field {
+		case 1:
+			self.Spider = s
+		case 2:
+			self.Url = s
+		case 3:
+			self.Rule = s
+		case 4:
+			self.Method = s
+		case 5:
+			var key string
+			var values []string
+			err := pbEach([]byte(s), func(field int, u uint64, s string) error {
+				switch field {
+				case 1:
+					key = s
+				case 2:
+					values = append(values, s)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if self.Header == nil {
+				self.Header = make(http.Header)
+			}
+			self.Header[key] = append(self.Header[key], values...)
+		case 6:
+			self.EnableCookie = u != 0
+		case 7:
+			self.PostData = s
+		case 8:
+			self.DialTimeout = time.Duration(pbZigzag(u))
+		case 9:
+			self.ConnTimeout = time.Duration(pbZigzag(u))
+		case 10:
+			self.TryTimes = int(pbZigzag(u))
+		case 11:
+			self.RetryPause = time.Duration(pbZigzag(u))
+		case 12:
+			self.RedirectTimes = int(pbZigzag(u))
+		case 13:
+			var key, value string
+			err := pbEach([]byte(s), func(field int, u uint64, s string) error {
+				switch field {
+				case 1:
+					key = s
+				case 2:
+					value = s
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if self.Temp == nil {
+				self.Temp = make(Temp)
+			}
+			self.Temp[key] = value
+		case 14:
+			if self.TempIsJson == nil {
+				self.TempIsJson = make(map[string]bool)
+			}
+			self.TempIsJson[s] = true
+		case 15:
+			self.Priority = int(pbZigzag(u))
+		case 16:
+			self.Reloadable = u != 0
+		case 17:
+			self.Session = s
+		case 18:
+			self.ParentUrl = s
+		case 19:
+			self.Fingerprint = s
+		case 20:
+			self.DownloaderID = int(pbZigzag(u))
+		case 21:
+			self.Group = s
+		case 22:
+			self.NoKeepAlive = u != 0
+		}
+		return nil
+	})
+}
+
+func pbAppendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func pbAppendLen(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func pbAppendMessage(b []byte, field int, msg []byte) []byte {
+	b = binary.AppendUvarint(pbAppendTag(b, field, pbBytes), uint64(len(msg)))
+	return append(b, msg...)
+}
+
+// 零值字段不写入，与protobuf（proto3）一致
+func pbAppendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return pbAppendLen(pbAppendTag(b, field, pbBytes), s)
+}
+
+func pbAppendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return append(pbAppendTag(b, field, pbVarint), 1)
+}
+
+func pbAppendSint(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(pbAppendTag(b, field, pbVarint), uint64(v<<1)^uint64(v>>63))
+}
+
+func pbZigzag(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+// 依次解析每个字段，varint字段的值为u，length-delimited字段的值为s
+func pbEach(data []byte, fn func(field int, u uint64, s string) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+			return errProtobuf
+		}
+		data = data[n:]
+		var (
+			u uint64
+			s string
+		)
+		switch tag & 7 {
+		case pbVarint:
+			if u, n = binary.Uvarint(data); n <= 0 {
+				return errProtobuf
+			}
+			data = data[n:]
+		case pbBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return errProtobuf
+			}
+			s = string(data[n : n+int(l)])
+			data = data[n+int(l):]
+		case 1: // 64位定长，跳过
+			if len(data) < 8 {
+				return errProtobuf
+			}
+			data = data[8:]
+		case 5: // 32位定长，跳过
+			if len(data) < 4 {
+				return errProtobuf
+			}
+			data = data[4:]
+		default:
+			return errProtobuf
+		}
+		if err := fn(int(tag>>3), u, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/logs"
 )
 
 // Request represents object waiting for being crawled.
@@ -31,6 +32,11 @@ type Request struct {
 	TempIsJson    map[string]bool //将Temp中以JSON存储的字段标记为true，自动设置，禁止人为填写
 	Priority      int             //指定调度优先级，默认为0（最小优先级为0）
 	Reloadable    bool            //是否允许重复该链接下载
+	Session       string          //会话ID，EnableCookie时不同会话使用相互隔离的cookie，为空时使用默认会话
+	ParentUrl     string          //添加该请求的页面Url，自动设置，禁止人为填写
+	Fingerprint   string          //自定义去重指纹，非空时代替默认的去重依据，由Spider的指纹函数自动设置
+	Group         string          //所属请求组ID，由Context.NewGroup()生成，AddQueue()时自动继承当前请求的请求组
+	NoKeepAlive   bool            //是否禁止复用连接（仅Surf下载器），用于按连接绑定会话的主机，见SetNoKeepAlive()
 	//Surfer下载器内核ID
 	//0为Surf高并发下载器，各种控制功能齐全
 	//1为PhantomJS下载器，特点破防力强，速度慢，低并发
@@ -130,6 +136,9 @@ func UnSerialize(s string) (*Request, error) {
 // 序列化
 func (self *Request) Serialize() string {
 	for k, v := range self.Temp {
+		if self.TempIsJson[k] {
+			continue
+		}
 		self.Temp.set(k, v)
 		self.TempIsJson[k] = true
 	}
@@ -138,9 +147,18 @@ func (self *Request) Serialize() string {
 }
 
 // 请求的唯一识别码
+// JSON请求体及会话ID参与计算，以便同一接口的游标翻页请求、不同会话的同一请求不被去重
 func (self *Request) Unique() string {
+	if self.unique == "" && self.Fingerprint != "" {
+		block := md5.Sum([]byte(self.Spider + self.Fingerprint))
+		self.unique = hex.EncodeToString(block[:])
+	}
 	if self.unique == "" {
-		block := md5.Sum([]byte(self.Spider + self.Rule + self.Url + self.Method))
+		var body string
+		if self.isJSONBody() {
+			body = self.PostData
+		}
+		block := md5.Sum([]byte(self.Spider + self.Rule + self.Url + self.Method + body + self.Session))
 		self.unique = hex.EncodeToString(block[:])
 	}
 	return self.unique
@@ -154,6 +172,38 @@ func (self *Request) Copy() *Request {
 	return reqcopy
 }
 
+// 以当前请求为模板生成访问url、由rule解析的后续请求。
+// 沿用: Header（Referer除外）、EnableCookie、DialTimeout、ConnTimeout、TryTimes、
+// RetryPause、RedirectTimes、Priority、DownloaderID、Session、NoKeepAlive及代理IP（启用代理时由调度重新分配）；
+// 重置: Method（默认GET）、PostData、Temp、Reloadable。
+func (self *Request) Clone(url, rule string) *Request {
+	header := make(http.Header, len(self.Header))
+	for k, v := range self.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Del("Referer")
+	if self.isJSONBody() {
+		header.Del("Content-Type")
+	}
+	return &Request{
+		Spider:        self.Spider,
+		Url:           url,
+		Rule:          rule,
+		Header:        header,
+		EnableCookie:  self.EnableCookie,
+		DialTimeout:   self.DialTimeout,
+		ConnTimeout:   self.ConnTimeout,
+		TryTimes:      self.TryTimes,
+		RetryPause:    self.RetryPause,
+		RedirectTimes: self.RedirectTimes,
+		Priority:      self.Priority,
+		DownloaderID:  self.DownloaderID,
+		Session:       self.Session,
+		NoKeepAlive:   self.NoKeepAlive,
+		proxy:         self.proxy,
+	}
+}
+
 // 获取Url
 func (self *Request) GetUrl() string {
 	return self.Url
@@ -184,10 +234,75 @@ func (self *Request) SetReferer(referer string) *Request {
 	return self
 }
 
+// 获取添加该请求的页面Url，由入口规则添加时为空
+func (self *Request) GetParentUrl() string {
+	return self.ParentUrl
+}
+
 func (self *Request) GetPostData() string {
 	return self.PostData
 }
 
+// 将v序列化为JSON作为请求体，并设置Content-Type为application/json，
+// Method为空时默认为POST方法。
+func (self *Request) SetJSONBody(v interface{}) *Request {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logs.Log.Error(" *     Request.SetJSONBody(%v): %v", self.Url, err)
+		return self
+	}
+	if self.Method == "" {
+		self.Method = "POST"
+	}
+	if self.Header == nil {
+		self.Header = make(http.Header)
+	}
+	self.Header.Set("Content-Type", "application/json; charset=utf-8")
+	self.PostData = util.Bytes2String(b)
+	self.unique = ""
+	return self
+}
+
+// 将values编码为表单作为请求体，并设置Content-Type为application/x-www-form-urlencoded，
+// Method为空时默认为POST方法。
+func (self *Request) SetForm(values url.Values) *Request {
+	if self.Method == "" {
+		self.Method = "POST"
+	}
+	if self.Header == nil {
+		self.Header = make(http.Header)
+	}
+	self.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	self.PostData = values.Encode()
+	self.unique = ""
+	return self
+}
+
+// 将JSON请求体反序列化至v
+func (self *Request) GetJSONBody(v interface{}) error {
+	return json.Unmarshal([]byte(self.PostData), v)
+}
+
+// 获取副本，并以fields覆盖JSON请求体中的同名顶层字段，
+// 适用于仅游标等个别字段变化的POST接口翻页。
+func (self *Request) CopyWithJSONBody(fields map[string]interface{}) *Request {
+	reqcopy := self.Copy()
+	body := map[string]interface{}{}
+	if reqcopy.PostData != "" {
+		if err := reqcopy.GetJSONBody(&body); err != nil {
+			logs.Log.Error(" *     Request.CopyWithJSONBody(%v): %v", self.Url, err)
+		}
+	}
+	for k, v := range fields {
+		body[k] = v
+	}
+	return reqcopy.SetJSONBody(body)
+}
+
+func (self *Request) isJSONBody() bool {
+	return self.PostData != "" && strings.HasPrefix(self.Header.Get("Content-Type"), "application/json")
+}
+
 func (self *Request) GetHeader() http.Header {
 	return self.Header
 }
@@ -202,6 +317,15 @@ func (self *Request) AddHeader(key, value string) *Request {
 	return self
 }
 
+// 设置Accept-Language请求头，优先于Spider.AcceptLanguage
+func (self *Request) SetAcceptLanguage(lang string) *Request {
+	if self.Header == nil {
+		self.Header = make(http.Header)
+	}
+	self.Header.Set("Accept-Language", lang)
+	return self
+}
+
 func (self *Request) GetEnableCookie() bool {
 	return self.EnableCookie
 }
@@ -211,6 +335,38 @@ func (self *Request) SetEnableCookie(enableCookie bool) *Request {
 	return self
 }
 
+func (self *Request) GetSession() string {
+	return self.Session
+}
+
+// 设置会话ID，仅在EnableCookie时生效，cookie容器只保存于内存中，不随任务持久化
+func (self *Request) SetSession(session string) *Request {
+	self.Session = session
+	self.unique = ""
+	return self
+}
+
+func (self *Request) GetNoKeepAlive() bool {
+	return self.NoKeepAlive
+}
+
+// 设置是否禁止复用连接，为true时每次下载均新建连接并在响应后关闭，
+// 用于负载均衡按TCP连接绑定会话（粘性会话）的主机；代价是每个请求都需重新建立TCP连接（HTTPS还需TLS握手）
+func (self *Request) SetNoKeepAlive(noKeepAlive bool) *Request {
+	self.NoKeepAlive = noKeepAlive
+	return self
+}
+
+func (self *Request) GetGroup() string {
+	return self.Group
+}
+
+// 设置所属请求组，见Context.NewGroup()
+func (self *Request) SetGroup(group string) *Request {
+	self.Group = group
+	return self
+}
+
 func (self *Request) GetCookies() string {
 	return self.Header.Get("Cookie")
 }
@@ -276,6 +432,13 @@ func (self *Request) SetReloadable(can bool) *Request {
 	return self
 }
 
+// 设置自定义去重指纹，相同指纹的请求视为重复
+func (self *Request) SetFingerprint(fingerprint string) *Request {
+	self.Fingerprint = fingerprint
+	self.unique = ""
+	return self
+}
+
 // 获取临时缓存数据
 // defaultValue 不能为 interface{}(nil)
 func (self *Request) GetTemp(key string, defaultValue interface{}) interface{} {
@@ -2,7 +2,14 @@ package request
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
 )
 
 func TestReqTemp(t *testing.T) {
@@ -57,3 +64,256 @@ func TestReqTemp(t *testing.T) {
 type x struct {
 	Name string
 }
+
+// 游标翻页的POST接口：每页仅请求体中的cursor字段变化
+func TestJSONBodyCursorPagination(t *testing.T) {
+	pages := map[string]struct {
+		Items []int
+		Next  string
+	}{
+		"":   {[]int{1, 2}, "c1"},
+		"c1": {[]int{3, 4}, "c2"},
+		"c2": {[]int{5}, ""},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("Content-Type: %s", ct)
+		}
+		var body struct {
+			Cursor string `json:"cursor"`
+			Size   int    `json:"size"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		if body.Size != 2 {
+			t.Errorf("size字段未被保留: %d", body.Size)
+		}
+		json.NewEncoder(w).Encode(pages[body.Cursor])
+	}))
+	defer srv.Close()
+
+	req := (&Request{Url: srv.URL, Rule: "list"}).SetJSONBody(map[string]interface{}{"cursor": "", "size": 2})
+	var (
+		items   []int
+		uniques = map[string]bool{}
+	)
+	for {
+		if err := req.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		if req.GetMethod() != "POST" {
+			t.Fatalf("Method: %s", req.GetMethod())
+		}
+		uniques[req.Unique()] = true
+
+		resp, err := surfer.New().Download(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page struct {
+			Items []int
+			Next  string
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, page.Items...)
+		if page.Next == "" {
+			break
+		}
+		req = req.CopyWithJSONBody(map[string]interface{}{"cursor": page.Next})
+	}
+	if len(items) != 5 {
+		t.Fatalf("items: %v", items)
+	}
+	if len(uniques) != 3 {
+		t.Fatalf("翻页请求的唯一识别码应各不相同: %v", uniques)
+	}
+}
+
+func TestClone(t *testing.T) {
+	a := &Request{
+		Url:          "http://example.com/list",
+		Rule:         "list",
+		Header:       http.Header{"User-Agent": {"pholcus"}, "Referer": {"http://example.com/"}},
+		TryTimes:     7,
+		DownloaderID: PHANTOM_ID,
+		Temp:         Temp{"page": 1},
+	}
+	a.SetJSONBody(map[string]int{"cursor": 1}).SetProxy("http://127.0.0.1:8080")
+	a.Prepare()
+
+	b := a.Clone("http://example.com/detail", "detail")
+	if err := b.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if b.GetUrl() != "http://example.com/detail" || b.GetRuleName() != "detail" {
+		t.Fatalf("url/rule: %v %v", b.GetUrl(), b.GetRuleName())
+	}
+	if b.GetHeader().Get("User-Agent") != "pholcus" || b.GetProxy() != "http://127.0.0.1:8080" {
+		t.Fatalf("header/proxy not inherited: %v %v", b.GetHeader(), b.GetProxy())
+	}
+	if b.GetTryTimes() != 7 || b.GetDownloaderID() != PHANTOM_ID {
+		t.Fatalf("settings not inherited: %v %v", b.GetTryTimes(), b.GetDownloaderID())
+	}
+	if b.GetReferer() != "" || b.GetMethod() != "GET" || b.GetPostData() != "" || len(b.GetTemps()) != 0 {
+		t.Fatalf("fields not reset: %q %v %q %v", b.GetReferer(), b.GetMethod(), b.GetPostData(), b.GetTemps())
+	}
+
+	b.SetHeader("User-Agent", "other")
+	if a.GetHeader().Get("User-Agent") != "pholcus" {
+		t.Fatal("header shared with the template")
+	}
+}
+
+// 两个会话分别登录，各自的cookie互不干扰
+func TestSessionIsolation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.URL.Query().Get("login"); user != "" {
+			http.SetCookie(w, &http.Cookie{Name: "user", Value: user, Path: "/"})
+			return
+		}
+		if c, err := r.Cookie("user"); err == nil {
+			w.Write([]byte(c.Value))
+		}
+	}))
+	defer srv.Close()
+
+	surf := surfer.New()
+	get := func(session, query string) string {
+		req := &Request{Url: srv.URL + "/" + query, Rule: "r", EnableCookie: true}
+		req.SetSession(session).Prepare()
+		resp, err := surf.Download(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	get("a", "?login=alice")
+	get("b", "?login=bob")
+	if me := get("a", "me"); me != "alice" {
+		t.Fatalf("session a: %q", me)
+	}
+	if me := get("b", "me"); me != "bob" {
+		t.Fatalf("session b: %q", me)
+	}
+	if me := get("", "me"); me != "" {
+		t.Fatalf("default session: %q", me)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := &Request{Spider: "s", Rule: "r", Url: "http://example.com/item?id=1&utm=a"}
+	b := &Request{Spider: "s", Rule: "r", Url: "http://example.com/item?id=1&utm=b"}
+	if a.Unique() == b.Unique() {
+		t.Fatal("different urls share a key")
+	}
+	a.SetFingerprint("item-1")
+	b.SetFingerprint("item-1")
+	if a.Unique() != b.Unique() {
+		t.Fatal("same fingerprint, different keys")
+	}
+	c, err := UnSerialize(a.Serialize())
+	if err != nil || c.Unique() != a.Unique() {
+		t.Fatalf("fingerprint lost after serialization: %v", err)
+	}
+}
+
+func sampleRequest() *Request {
+	req := &Request{
+		Spider:        "s",
+		Url:           "http://example.com/list?page=2&q=a",
+		Rule:          "list",
+		Method:        "POST",
+		PostData:      `{"page":2}`,
+		TryTimes:      -1,
+		RedirectTimes: 5,
+		Priority:      3,
+		Reloadable:    true,
+		Session:       "alice",
+		ParentUrl:     "http://example.com/",
+		Fingerprint:   "list-2",
+		Group:         "g1",
+		NoKeepAlive:   true,
+		EnableCookie:  true,
+		DownloaderID:  PHANTOM_ID,
+	}
+	req.Prepare()
+	req.SetHeader("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+	req.SetTemp("page", 2)
+	req.SetTemp("tags", []string{"a", "b"})
+	return req
+}
+
+func TestMarshalBinary(t *testing.T) {
+	a := sampleRequest()
+	// 样例须设置全部导出字段，以免新增字段遗漏于protobuf格式
+	v := reflect.ValueOf(a).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Type().Field(i); f.PkgPath == "" && v.Field(i).IsZero() {
+			t.Errorf("sampleRequest() leaves %s unset", f.Name)
+		}
+	}
+	b, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := new(Request)
+	if err = c.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := UnSerialize(a.Serialize())
+	if !reflect.DeepEqual(c.Header, d.Header) || !reflect.DeepEqual(c.Temp, d.Temp) || !reflect.DeepEqual(c.TempIsJson, d.TempIsJson) {
+		t.Fatalf("maps differ:\n%#v\n%#v", c, d)
+	}
+	c.Header, c.Temp, c.TempIsJson = nil, nil, nil
+	d.Header, d.Temp, d.TempIsJson = nil, nil, nil
+	if c.Serialize() != d.Serialize() {
+		t.Fatalf("fields differ:\n%s\n%s", c.Serialize(), d.Serialize())
+	}
+	var (
+		tags []string
+		page int
+	)
+	c = new(Request)
+	c.UnmarshalBinary(b)
+	c.GetTemp("tags", &tags)
+	c.GetTemp("page", &page)
+	if len(tags) != 2 || page != 2 {
+		t.Fatalf("temp: %v %v", tags, page)
+	}
+	if err = c.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Fatal("truncated data accepted")
+	}
+}
+
+func BenchmarkSerializeJSON(b *testing.B) {
+	req := sampleRequest()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnSerialize(req.Serialize()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(req.Serialize())), "bytes/req")
+}
+
+func BenchmarkSerializeProtobuf(b *testing.B) {
+	req := sampleRequest()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := req.MarshalBinary()
+		if err := new(Request).UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	data, _ := req.MarshalBinary()
+	b.ReportMetric(float64(len(data)), "bytes/req")
+}
@@ -0,0 +1,38 @@
+package surfer
+
+import (
+	"net"
+	"time"
+)
+
+// DialOptions Surf内核默认传输层的拨号参数。
+//
+// 默认传输层每次请求新建并附带"Connection: close"，连接不复用，
+// 因此KeepAlive为TCP层的存活探测，用于及时发现长时间下载中失效的连接，而非HTTP连接复用；
+// Spider.Transport指定的自定义传输层自行维护连接池，不受这些参数影响，须在其Dial中自行设置。
+type DialOptions struct {
+	Timeout       time.Duration // 建立TCP连接的超时上限，与Request.DialTimeout取较小者，0为不限
+	KeepAlive     time.Duration // TCP keep-alive探测间隔，0为系统默认（15秒），小于0时关闭
+	HappyEyeballs bool          // 目标主机同时有IPv4与IPv6地址时是否并行尝试（RFC 6555），关闭后按解析顺序依次尝试
+}
+
+// Dial 拨号参数，默认与http.DefaultTransport一致
+var Dial = DialOptions{
+	KeepAlive:     30 * time.Second,
+	HappyEyeballs: true,
+}
+
+// dialer 返回建立连接的net.Dialer，timeout为请求的DialTimeout
+func (self DialOptions) dialer(timeout time.Duration) *net.Dialer {
+	if self.Timeout > 0 && (timeout <= 0 || self.Timeout < timeout) {
+		timeout = self.Timeout
+	}
+	d := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: self.KeepAlive,
+	}
+	if !self.HappyEyeballs {
+		d.FallbackDelay = -1
+	}
+	return d
+}
@@ -0,0 +1,197 @@
+package surfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 按指定顺序发送请求头：net/http按字段名排序写出请求头，且字段名均为规范形式，
+// 部分反爬系统据此识别非浏览器客户端。为此在连接层截获请求头（HTTPS在TLS握手之后），
+// 按顺序重排并改写为指定的大小写后再发送。
+//
+// 仅作用于HTTP/1.1（Surf下载器不协商HTTP/2），经代理访问HTTPS时不生效；
+// 依赖net/http写出请求头的格式，Go版本升级后须复核，且浏览器的顺序随版本变化，预设值需随之维护。
+// 启用后禁止复用连接，每个请求均需新建连接。
+
+var (
+	shuffleRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffleLock sync.Mutex
+)
+
+// 重排请求头的连接
+type orderConn struct {
+	net.Conn
+	order   []string
+	shuffle bool
+	head    []byte // 尚未写出的请求头
+	done    bool   // 请求头是否已写出
+}
+
+func newOrderConn(c net.Conn, order []string, shuffle bool) *orderConn {
+	return &orderConn{Conn: c, order: order, shuffle: shuffle}
+}
+
+func (self *orderConn) Write(p []byte) (int, error) {
+	if self.done {
+		return self.Conn.Write(p)
+	}
+	self.head = append(self.head, p...)
+	i := bytes.Index(self.head, []byte("\r\n\r\n"))
+	if i < 0 {
+		return len(p), nil
+	}
+	self.done = true
+	b := append(reorderHeader(self.head[:i+2], self.order, self.shuffle), self.head[i+2:]...)
+	self.head = nil
+	if _, err := self.Conn.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// 重排以"\r\n"结尾的请求行及请求头：Host保持在首位，其后为order中的字段（按order的大小写），
+// 其余字段保持原有顺序，shuffle为true时随机排列
+func reorderHeader(head []byte, order []string, shuffle bool) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n"), "\r\n")
+	var (
+		fields = lines[1:]
+		sorted = make([]string, 0, len(fields))
+		rest   = make([]string, 0, len(fields))
+		used   = make([]bool, len(fields))
+	)
+	name := func(line string) string {
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			return line[:i]
+		}
+		return line
+	}
+	for i, line := range fields {
+		if strings.EqualFold(name(line), "Host") {
+			sorted = append(sorted, line)
+			used[i] = true
+		}
+	}
+	for _, key := range order {
+		for i, line := range fields {
+			if !used[i] && strings.EqualFold(name(line), key) {
+				sorted = append(sorted, key+line[len(name(line)):])
+				used[i] = true
+			}
+		}
+	}
+	for i, line := range fields {
+		if !used[i] {
+			rest = append(rest, line)
+		}
+	}
+	if shuffle {
+		shuffleLock.Lock()
+		shuffleRand.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+		shuffleLock.Unlock()
+	}
+	var b bytes.Buffer
+	b.WriteString(lines[0])
+	b.WriteString("\r\n")
+	for _, line := range append(sorted, rest...) {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+type dialFunc func(network, addr string) (net.Conn, error)
+
+// 使传输层按param指定的顺序发送请求头，须在设置Dial与TLSClientConfig之后调用。
+// 重排请求头的连接不是*tls.Conn，net/http不会为响应设置TLS，故须使用返回的RoundTripper。
+func orderTransport(transport *http.Transport, param *Param) http.RoundTripper {
+	dial, dialTLS := dialFunc(transport.Dial), dialFunc(transport.DialTLS)
+	if dc := transport.DialContext; dc != nil {
+		dial = func(network, addr string) (net.Conn, error) {
+			return dc(context.Background(), network, addr)
+		}
+	} else if dial == nil {
+		dial = Dial.dialer(param.dialTimeout).Dial
+	}
+	// 自定义传输层已接管TLS握手（如模拟浏览器的TLS指纹）时沿用，否则在此握手
+	if dtc := transport.DialTLSContext; dtc != nil {
+		dialTLS = func(network, addr string) (net.Conn, error) {
+			return dtc(context.Background(), network, addr)
+		}
+	} else if dialTLS == nil {
+		dialTLS = handshakeDial(dial, transport.TLSClientConfig, transport.TLSHandshakeTimeout)
+	}
+	wrap := func(d dialFunc) dialFunc {
+		return func(network, addr string) (net.Conn, error) {
+			c, err := d(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return newOrderConn(c, param.headerOrder, param.shuffleHeader), nil
+		}
+	}
+	transport.DialContext, transport.DialTLSContext = nil, nil
+	transport.Dial, transport.DialTLS = wrap(dial), wrap(dialTLS)
+	transport.DisableKeepAlives = true
+	return orderRoundTripper{transport}
+}
+
+// 为经重排请求头的TLS连接收到的响应补充Response.TLS
+type orderRoundTripper struct {
+	*http.Transport
+}
+
+func (self orderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var state *tls.ConnectionState
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if c, ok := info.Conn.(*orderConn); ok {
+				if tc, ok := c.Conn.(*tls.Conn); ok {
+					cs := tc.ConnectionState()
+					state = &cs
+				}
+			}
+		},
+	}
+	resp, err := self.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil && resp.TLS == nil {
+		resp.TLS = state
+	}
+	return resp, err
+}
+
+// 建立连接后进行TLS握手，timeout为握手的超时时长，为0时不限
+func handshakeDial(dial dialFunc, tlsConfig *tls.Config, timeout time.Duration) dialFunc {
+	return func(network, addr string) (net.Conn, error) {
+		c, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := &tls.Config{InsecureSkipVerify: true}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		tc := tls.Client(c, config)
+		if err = tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
@@ -0,0 +1,125 @@
+package surfer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReorderHeader(t *testing.T) {
+	const head = "GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\nUser-Agent: ua\r\nX-A: 1\r\nX-B: 2\r\n"
+	for _, c := range []struct {
+		name  string
+		head  string
+		order []string
+		want  string
+	}{
+		{
+			name: "no order",
+			head: head,
+			want: head,
+		},
+		{
+			name:  "ordered fields first, with the given case",
+			head:  head,
+			order: []string{"user-agent", "X-B"},
+			want:  "GET / HTTP/1.1\r\nHost: example.com\r\nuser-agent: ua\r\nX-B: 2\r\nAccept: */*\r\nX-A: 1\r\n",
+		},
+		{
+			name:  "host stays first",
+			head:  "GET / HTTP/1.1\r\nAccept: */*\r\nHost: example.com\r\n",
+			order: []string{"Accept"},
+			want:  "GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n",
+		},
+		{
+			name:  "repeated fields keep their order",
+			head:  "GET / HTTP/1.1\r\nHost: example.com\r\nCookie: a=1\r\nAccept: */*\r\nCookie: b=2\r\n",
+			order: []string{"Cookie"},
+			want:  "GET / HTTP/1.1\r\nHost: example.com\r\nCookie: a=1\r\nCookie: b=2\r\nAccept: */*\r\n",
+		},
+		{
+			name:  "unknown fields in order are ignored",
+			head:  head,
+			order: []string{"Referer", "Accept"},
+			want:  "GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\nUser-Agent: ua\r\nX-A: 1\r\nX-B: 2\r\n",
+		},
+	} {
+		if got := string(reorderHeader([]byte(c.head), c.order, false)); got != c.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestReorderHeaderShuffle(t *testing.T) {
+	const head = "GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\nX-A: 1\r\nX-B: 2\r\nX-C: 3\r\n"
+	got := string(reorderHeader([]byte(head), []string{"X-C"}, true))
+	if !strings.HasPrefix(got, "GET / HTTP/1.1\r\nHost: example.com\r\nX-C: 3\r\n") || len(got) != len(head) {
+		t.Errorf("got %q", got)
+	}
+}
+
+type orderedRequest struct {
+	DefaultRequest
+	order []string
+}
+
+func (self *orderedRequest) GetHeaderOrder() ([]string, bool) {
+	return self.order, false
+}
+
+// 重排请求头的HTTPS响应仍应带有TLS连接状态
+func TestOrderedResponseTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-A")))
+	}))
+	defer srv.Close()
+
+	req := &orderedRequest{order: []string{"X-A"}}
+	req.Url = srv.URL
+	req.TryTimes = 1
+	req.Header = http.Header{"X-A": {"1"}}
+	resp, err := New().Download(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.TLS == nil || !resp.TLS.HandshakeComplete {
+		t.Errorf("resp.TLS = %v", resp.TLS)
+	}
+}
+
+// 自行握手时同样受TLSHandshakeTimeout限制
+func TestHandshakeTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// 接受连接但不响应握手
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := handshakeDial(net.Dial, nil, 100*time.Millisecond)("tcp", ln.Addr().String())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("handshake succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake not timed out")
+	}
+}
@@ -35,6 +35,11 @@ type Param struct {
 	body          io.Reader
 	header        http.Header
 	enableCookie  bool
+	session       string
+	noKeepAlive   bool
+	headerOrder   []string
+	shuffleHeader bool
+	transport     *http.Transport
 	dialTimeout   time.Duration
 	connTimeout   time.Duration
 	tryTimes      int
@@ -66,7 +71,9 @@ func NewParam(req Request) (param *Param, err error) {
 		param.method = method
 	case "POST":
 		param.method = method
-		param.header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if param.header.Get("Content-Type") == "" {
+			param.header.Add("Content-Type", "application/x-www-form-urlencoded")
+		}
 		param.body = strings.NewReader(req.GetPostData())
 	case "POST-M":
 		param.method = "POST"
@@ -90,6 +97,18 @@ func NewParam(req Request) (param *Param, err error) {
 	}
 
 	param.enableCookie = req.GetEnableCookie()
+	if sr, ok := req.(SessionRequest); ok {
+		param.session = sr.GetSession()
+	}
+	if kr, ok := req.(KeepAliveRequest); ok {
+		param.noKeepAlive = kr.GetNoKeepAlive()
+	}
+	if hr, ok := req.(HeaderOrderRequest); ok {
+		param.headerOrder, param.shuffleHeader = hr.GetHeaderOrder()
+	}
+	if tr, ok := req.(TransportRequest); ok {
+		param.transport = tr.GetTransport()
+	}
 
 	if len(param.header.Get("User-Agent")) == 0 {
 		if param.enableCookie {
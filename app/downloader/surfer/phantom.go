@@ -134,6 +134,17 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 		strings.ToLower(param.method),
 		fmt.Sprint(int(req.GetDialTimeout() / time.Millisecond)),
 	}
+	if br, ok := req.(BrowserRequest); ok {
+		if a := br.GetBrowserActions(); a != nil {
+			b, _ := json.Marshal(map[string]interface{}{
+				"ScrollTimes":  a.ScrollTimes,
+				"ScrollSettle": int(a.ScrollSettle / time.Millisecond),
+				"WaitSelector": a.WaitSelector,
+				"WaitTimeout":  int(a.WaitTimeout / time.Millisecond),
+			})
+			args = append(args, string(b))
+		}
+	}
 	if req.GetProxy() != "" {
 		args = append([]string{"--proxy=" + req.GetProxy()}, args...)
 	}
@@ -227,6 +238,7 @@ func (self *Phantom) createJsFile(fileName, jsCode string) {
 * system.args[5] == postdata
 * system.args[6] == method
 * system.args[7] == timeout
+* system.args[8] == actions (可选，JSON格式的BrowserActions，时长单位为毫秒)
  */
 const js string = `
 var system = require('system');
@@ -238,6 +250,7 @@ var userAgent = system.args[4];
 var postdata = system.args[5];
 var method = system.args[6];
 var timeout = system.args[7];
+var actions = system.args.length > 8 ? JSON.parse(system.args[8]) : {};
 
 var ret = new Object();
 var exit = function () {
@@ -329,38 +342,79 @@ page.onResourceError = function (e) {
         exit();
     }
 };
+// 依次滚动至页面底部、等待选择器出现，完成后调用done
+var acting = false;
+function runActions(done) {
+    acting = true;
+    var scrolls = actions.ScrollTimes || 0;
+    var deadline = 0;
+    var wait = function () {
+        if (!actions.WaitSelector) {
+            return done();
+        }
+        if (deadline == 0) {
+            deadline = Date.now() + (actions.WaitTimeout || 0);
+        }
+        var found = page.evaluate(function (s) {
+            return document.querySelector(s) != null;
+        }, actions.WaitSelector);
+        if (found || Date.now() >= deadline) {
+            return done();
+        }
+        setTimeout(wait, 100);
+    };
+    var scroll = function () {
+        if (scrolls-- <= 0) {
+            return wait();
+        }
+        page.evaluate(function () {
+            window.scrollTo(0, document.body.scrollHeight);
+        });
+        setTimeout(scroll, actions.ScrollSettle || 0);
+    };
+    scroll();
+}
+
 page.onLoadFinished = function (status) {
+    if (acting) {
+        return;
+    }
     if (status !== 'success') {
         ret["Error"] = "status=" + status;
         exit();
     } else {
-        var cookies = new Array();
-        for (var i in page.cookies) {
-            var cookie = page.cookies[i];
-            var c = cookie["name"] + "=" + cookie["value"];
-            for (var obj in cookie) {
-                if (obj == 'name' || obj == 'value') {
-                    continue;
-                }
-                if (obj == "httponly" || obj == "secure") {
-                    if (cookie[obj] == true) {
-                        c += ";" + obj;
-                    }
-                } else {
-                    c += "; " + obj + "=" + cookie[obj];
+        runActions(finish);
+    }
+};
+
+function finish() {
+    acting = false;
+    var cookies = new Array();
+    for (var i in page.cookies) {
+        var cookie = page.cookies[i];
+        var c = cookie["name"] + "=" + cookie["value"];
+        for (var obj in cookie) {
+            if (obj == 'name' || obj == 'value') {
+                continue;
+            }
+            if (obj == "httponly" || obj == "secure") {
+                if (cookie[obj] == true) {
+                    c += ";" + obj;
                 }
+            } else {
+                c += "; " + obj + "=" + cookie[obj];
             }
-            cookies[i] = c;
         }
-        if (page.content.indexOf("body") != -1) {
-            ret["Cookies"] = cookies;
-            ret["Body"] = page.content;
+        cookies[i] = c;
+    }
+    if (page.content.indexOf("body") != -1) {
+        ret["Cookies"] = cookies;
+        ret["Body"] = page.content;
 
-            // ret = JSON.stringify(resp);
-            exit();
-        }
+        // ret = JSON.stringify(resp);
+        exit();
     }
-};
+}
 
 page.open(url, method, postdata, function (status) {
 });
@@ -49,6 +49,42 @@ type (
 		GetDownloaderID() int
 	}
 
+	// 可选实现，按会话ID隔离cookie，为空时使用默认的cookie容器
+	SessionRequest interface {
+		GetSession() string
+	}
+
+	// 可选实现，返回true时禁止复用连接
+	KeepAliveRequest interface {
+		GetNoKeepAlive() bool
+	}
+
+	// 可选实现，自定义Surf下载器的底层传输层（如SOCKS代理链、自定义TLS握手），返回nil时使用默认传输层；
+	// 每次下载使用其副本，请求指定的代理仍然生效，并经由该传输层的Dial连接代理服务器；
+	// 未设置Dial及DialContext时使用默认的连接方式（DialTimeout、ConnTimeout及DNS缓存均生效）
+	TransportRequest interface {
+		GetTransport() *http.Transport
+	}
+
+	// 可选实现，指定Surf下载器发送请求头的顺序（及字段名的大小写），未列出的字段排在其后，
+	// shuffle为true时未列出的字段随机排列，见headerorder.go
+	HeaderOrderRequest interface {
+		GetHeaderOrder() (order []string, shuffle bool)
+	}
+
+	// 可选实现，指定PhantomJS内核在页面加载完成后、返回内容前执行的操作
+	BrowserRequest interface {
+		GetBrowserActions() *BrowserActions
+	}
+
+	// 浏览器内核的页面操作，先滚动后等待
+	BrowserActions struct {
+		ScrollTimes  int           // 滚动至页面底部的次数，用于触发懒加载
+		ScrollSettle time.Duration // 每次滚动后等待内容加载的时长
+		WaitSelector string        // 等待页面中出现匹配该CSS选择器的元素
+		WaitTimeout  time.Duration // 等待的最长时间，超时后仍返回当前内容
+	}
+
 	// 默认实现的Request
 	DefaultRequest struct {
 		// url (必须填写)
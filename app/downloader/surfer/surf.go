@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/henrylee2cn/goutil"
@@ -34,6 +35,8 @@ import (
 // Surf is the default Download implementation.
 type Surf struct {
 	CookieJar *cookiejar.Jar
+	sessions  map[string]*cookiejar.Jar // 按会话ID隔离的cookie容器
+	lock      sync.Mutex
 }
 
 // New 创建一个Surf下载器
@@ -116,53 +119,108 @@ func (self *Surf) buildClient(param *Param) *http.Client {
 	}
 
 	if param.enableCookie {
-		client.Jar = self.CookieJar
+		client.Jar = self.jar(param.session)
+	}
+
+	if param.transport != nil {
+		client.Transport = self.customTransport(param)
+		return client
 	}
 
 	transport := &http.Transport{
-		Dial: func(network, addr string) (net.Conn, error) {
-			var (
-				c          net.Conn
-				err        error
-				ipPort, ok = dnsCache.Query(addr)
-			)
-			if !ok {
-				ipPort = addr
-				defer func() {
-					if err == nil {
-						dnsCache.Reg(addr, c.RemoteAddr().String())
-					}
-				}()
-			} else {
-				defer func() {
-					if err != nil {
-						dnsCache.Del(addr)
-					}
-				}()
-			}
-			c, err = net.DialTimeout(network, ipPort, param.dialTimeout)
-			if err != nil {
-				return nil, err
-			}
-			if param.connTimeout > 0 {
-				c.SetDeadline(time.Now().Add(param.connTimeout))
-			}
-			return c, nil
-		},
+		Dial: cachedDial(param),
 	}
 
 	if param.proxy != nil {
 		transport.Proxy = http.ProxyURL(param.proxy)
 	}
+	transport.DisableKeepAlives = param.noKeepAlive
 
 	if strings.ToLower(param.url.Scheme) == "https" {
 		transport.TLSClientConfig = &tls.Config{RootCAs: nil, InsecureSkipVerify: true}
 		transport.DisableCompression = true
 	}
 	client.Transport = transport
+	if len(param.headerOrder) > 0 || param.shuffleHeader {
+		client.Transport = orderTransport(transport, param)
+	}
 	return client
 }
 
+// cachedDial returns the default dial function of the request, which applies
+// DialTimeout, ConnTimeout and the DNS cache.
+func cachedDial(param *Param) dialFunc {
+	return func(network, addr string) (net.Conn, error) {
+		var (
+			c          net.Conn
+			err        error
+			ipPort, ok = dnsCache.Query(addr)
+		)
+		if !ok {
+			ipPort = addr
+			defer func() {
+				if err == nil {
+					dnsCache.Reg(addr, c.RemoteAddr().String())
+				}
+			}()
+		} else {
+			defer func() {
+				if err != nil {
+					dnsCache.Del(addr)
+				}
+			}()
+		}
+		c, err = Dial.dialer(param.dialTimeout).Dial(network, ipPort)
+		if err != nil {
+			return nil, err
+		}
+		if param.connTimeout > 0 {
+			c.SetDeadline(time.Now().Add(param.connTimeout))
+		}
+		return c, nil
+	}
+}
+
+// customTransport returns a copy of the custom transport with the proxy of the request.
+// The default dial function is used unless the custom transport sets its own Dial or DialContext.
+func (self *Surf) customTransport(param *Param) http.RoundTripper {
+	transport := param.transport.Clone()
+	if transport.Dial == nil && transport.DialContext == nil {
+		transport.Dial = cachedDial(param)
+	}
+	if param.proxy != nil {
+		transport.Proxy = http.ProxyURL(param.proxy)
+	}
+	if param.noKeepAlive {
+		transport.DisableKeepAlives = true
+	}
+	if transport.TLSClientConfig == nil && strings.ToLower(param.url.Scheme) == "https" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if len(param.headerOrder) > 0 || param.shuffleHeader {
+		return orderTransport(transport, param)
+	}
+	return transport
+}
+
+// jar returns the cookie jar of the session, the default one when session is empty.
+func (self *Surf) jar(session string) *cookiejar.Jar {
+	if session == "" {
+		return self.CookieJar
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.sessions == nil {
+		self.sessions = make(map[string]*cookiejar.Jar)
+	}
+	jar, ok := self.sessions[session]
+	if !ok {
+		jar, _ = cookiejar.New(nil)
+		self.sessions[session] = jar
+	}
+	return jar
+}
+
 // send uses the given *http.Request to make an HTTP request.
 func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 	req, err := http.NewRequest(param.method, param.url.String(), param.body)
@@ -173,8 +231,10 @@ func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 	req.Header = param.header
 
 	if param.tryTimes <= 0 {
-		for {
+		for i := 1; ; i++ {
+			start := time.Now()
 			resp, err = param.client.Do(req)
+			param.trace(start, i, resp, err)
 			if err != nil {
 				if !param.enableCookie {
 					l := len(agent.UserAgents["common"])
@@ -188,7 +248,9 @@ func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 		}
 	} else {
 		for i := 0; i < param.tryTimes; i++ {
+			start := time.Now()
 			resp, err = param.client.Do(req)
+			param.trace(start, i+1, resp, err)
 			if err != nil {
 				if !param.enableCookie {
 					l := len(agent.UserAgents["common"])
@@ -0,0 +1,71 @@
+package surfer
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type transportRequest struct {
+	DefaultRequest
+	transport *http.Transport
+}
+
+func (self *transportRequest) GetTransport() *http.Transport {
+	return self.transport
+}
+
+// 自定义传输层未设置Dial时，请求的ConnTimeout仍然生效
+func TestCustomTransportTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// 接受连接但不响应
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	req := &transportRequest{transport: &http.Transport{}}
+	req.Url = "http://" + ln.Addr().String()
+	req.TryTimes = 1
+	req.RetryPause = time.Millisecond
+	req.ConnTimeout = 100 * time.Millisecond
+	done := make(chan error, 1)
+	go func() {
+		_, err := New().Download(req)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("download succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConnTimeout not applied")
+	}
+}
+
+func TestCustomTransportKeepsDial(t *testing.T) {
+	var dialed bool
+	req := &transportRequest{transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			dialed = true
+			return nil, net.UnknownNetworkError("test")
+		},
+	}}
+	req.Url = "http://example.com/"
+	req.TryTimes = 1
+	req.RetryPause = time.Millisecond
+	if _, err := New().Download(req); err == nil || !dialed {
+		t.Errorf("err = %v, dialed = %v", err, dialed)
+	}
+}
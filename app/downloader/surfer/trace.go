@@ -0,0 +1,45 @@
+package surfer
+
+import (
+	"net/http"
+	"time"
+)
+
+// Trace 单次HTTP请求尝试的记录
+type Trace struct {
+	Time       time.Time     // 发起时刻
+	Method     string        // 请求方法
+	Url        string        // 请求地址
+	StatusCode int           // 响应状态码，请求失败时为0
+	Bytes      int64         // 响应体长度（Content-Length），未知时为-1
+	Duration   time.Duration // 耗时
+	Proxy      string        // 使用的代理
+	Try        int           // 第几次尝试，从1开始
+	Err        error         // 请求错误
+}
+
+// OnTrace 每次HTTP请求尝试完成后调用（Surf内核），为nil时不记录
+var OnTrace func(*Trace)
+
+func (self *Param) trace(start time.Time, try int, resp *http.Response, err error) {
+	if OnTrace == nil {
+		return
+	}
+	t := &Trace{
+		Time:     start,
+		Method:   self.method,
+		Url:      self.url.String(),
+		Bytes:    -1,
+		Duration: time.Since(start),
+		Try:      try,
+		Err:      err,
+	}
+	if self.proxy != nil {
+		t.Proxy = self.proxy.String()
+	}
+	if resp != nil {
+		t.StatusCode = resp.StatusCode
+		t.Bytes = resp.ContentLength
+	}
+	OnTrace(t)
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/scheduler"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 任务停滞时的回调，idle为最近一次请求完成至今的时长
+type StallHandler func(idle time.Duration)
+
+// 设置任务停滞时的回调，设置后停滞时不再自动终止任务，
+// 回调后重新计时，仍停滞时将再次回调
+func (self *Logic) OnStall(fn func(idle time.Duration)) App {
+	self.RWMutex.Lock()
+	self.onStall = fn
+	self.RWMutex.Unlock()
+	return self
+}
+
+// 停滞监控：超过run::idletimeout没有请求完成（成功或失败），且仍有排队或进行中的请求时，
+// 视为任务停滞（如全部协程阻塞于无响应的主机），记录日志并优雅终止任务或执行OnStall()设置的回调；
+// 没有待处理的请求时属于正常结束，不视为停滞。
+func (self *Logic) idleWatch(done <-chan bool) {
+	if config.IDLE_TIMEOUT <= 0 {
+		return
+	}
+	timeout := time.Duration(config.IDLE_TIMEOUT) * time.Second
+	interval := timeout / 4
+	if interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	count, last := cache.GetPageCount(0), time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		if n := cache.GetPageCount(0); n != count || self.IsPause() {
+			count, last = n, time.Now()
+			continue
+		}
+		idle := time.Since(last)
+		if idle < timeout {
+			continue
+		}
+		queued, _ := scheduler.QueueLen()
+		running := scheduler.Running()
+		if queued == 0 && running == 0 {
+			continue
+		}
+		logs.Log.Critical(" *     [停滞监控] 已 %v 没有请求完成，仍有排队请求 %v 个、进行中的请求 %v 个\n", idle.Truncate(time.Second), queued, running)
+
+		self.RWMutex.Lock()
+		fn := self.onStall
+		if fn == nil {
+			self.reason = mergeReason(self.reason, cache.REASON_STALLED)
+		}
+		self.RWMutex.Unlock()
+		if fn != nil {
+			fn(idle)
+			last = time.Now()
+			continue
+		}
+		logs.Log.Critical(" *     [停滞监控] 正在终止任务……\n")
+		go self.GracefulStop(time.Duration(config.GRACE_SECOND) * time.Second)
+		return
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 已收集但尚未输出的文本数据计数：达到output::maxbuffered时CollectData阻塞，
+// 采集协程随之暂停，使采集速度受限于输出速度。
+// 配置了多个输出方式时各输出目标分别计数，以积压最多者为准。
+type buffer struct {
+	sync.Mutex
+	cond    *sync.Cond
+	limit   int  // 上限，0为不限
+	stopped bool // 已停止收集，不再阻塞
+}
+
+func newBuffer() *buffer {
+	b := &buffer{limit: config.OUTPUT_MAX_BUFFERED}
+	// 上限不得小于分批输出的容量，否则缓存永远凑不满一批，导致死锁
+	if b.limit > 0 && b.limit < cache.Task.DockerCap {
+		b.limit = cache.Task.DockerCap
+	}
+	b.cond = sync.NewCond(b)
+	return b
+}
+
+// 等待积压的数据低于上限后计入一条，已停止收集时返回false
+func (self *Collector) acquire() bool {
+	b := self.buf
+	b.Lock()
+	defer b.Unlock()
+	for b.limit > 0 && !b.stopped && self.buffered() >= b.limit {
+		b.cond.Wait()
+	}
+	if b.stopped {
+		return false
+	}
+	if len(self.targets) == 0 {
+		self.pending++
+	}
+	for _, t := range self.targets {
+		t.pending++
+	}
+	return true
+}
+
+// n条数据已输出（或已存入死信文件）
+func (self *Collector) release(n int) {
+	if n == 0 {
+		return
+	}
+	b := self.buf
+	b.Lock()
+	self.pending -= n
+	b.cond.Broadcast()
+	b.Unlock()
+}
+
+// 停止收集，唤醒阻塞中的CollectData
+func (self *Collector) stopBuffer() {
+	b := self.buf
+	b.Lock()
+	b.stopped = true
+	b.cond.Broadcast()
+	b.Unlock()
+}
+
+func (self *Collector) buffered() int {
+	if len(self.targets) == 0 {
+		return self.pending
+	}
+	var n int
+	for _, t := range self.targets {
+		if t.pending > n {
+			n = t.pending
+		}
+	}
+	return n
+}
+
+// 返回已收集但尚未输出的文本数据条数
+func (self *Collector) Buffered() int {
+	self.buf.Lock()
+	defer self.buf.Unlock()
+	return self.buffered()
+}
+
+// 一个蜘蛛的结果缓存统计快照
+type BufferStats struct {
+	Spider   string // 所属Spider
+	Keyin    string // 自定义配置
+	Buffered int    // 已收集但尚未输出的文本数据条数
+	Limit    int    // 上限，达到时阻塞采集，0为不限
+}
+
+var (
+	running     = make(map[*Collector]bool) // 运行中的收集器
+	runningLock sync.RWMutex
+)
+
+// 返回运行中的各收集器的结果缓存统计快照
+func Stats() []BufferStats {
+	runningLock.RLock()
+	defer runningLock.RUnlock()
+	stats := make([]BufferStats, 0, len(running))
+	for c := range running {
+		stats = append(stats, BufferStats{
+			Spider:   c.Spider.GetName(),
+			Keyin:    c.Spider.GetKeyin(),
+			Buffered: c.Buffered(),
+			Limit:    c.buf.limit,
+		})
+	}
+	return stats
+}
+
+func register(c *Collector) {
+	runningLock.Lock()
+	running[c] = true
+	runningLock.Unlock()
+}
+
+func unregister(c *Collector) {
+	runningLock.Lock()
+	delete(running, c)
+	runningLock.Unlock()
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBufferBackpressure(t *testing.T) {
+	b := &buffer{limit: 2}
+	b.cond = sync.NewCond(b)
+	c := &Collector{buf: b}
+	c.targets = []*Collector{{buf: b}, {buf: b}}
+
+	c.acquire()
+	c.acquire()
+	done := make(chan bool)
+	go func() {
+		done <- c.acquire()
+	}()
+	select {
+	case <-done:
+		t.Fatal("acquire did not block at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 以积压最多的输出目标为准
+	c.targets[0].release(1)
+	select {
+	case <-done:
+		t.Fatal("acquire did not wait for the slowest target")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.targets[1].release(1)
+	if ok := <-done; !ok {
+		t.Fatal("acquire failed")
+	}
+	if n := c.Buffered(); n != 2 {
+		t.Errorf("Buffered() = %v, want 2", n)
+	}
+
+	go func() {
+		done <- c.acquire()
+	}()
+	c.stopBuffer()
+	if ok := <-done; ok {
+		t.Error("acquire succeeded after stop")
+	}
+}
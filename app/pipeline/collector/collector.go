@@ -3,10 +3,12 @@ package collector
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/henrylee2cn/pholcus/app/aid/seen"
 	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
 	"github.com/henrylee2cn/pholcus/app/spider"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
@@ -18,7 +20,15 @@ type Collector struct {
 	DataChan       chan data.DataCell //文本数据收集通道
 	FileChan       chan data.FileCell //文件收集通道
 	dataDocker     []data.DataCell    //分批输出结果缓存
+	written        []bool             //本次输出中dataDocker各结果是否已写入，见setWritten()
 	outType        string             //输出方式
+	targets        []*Collector       //配置了多个输出方式时，各输出目标独立分批输出
+	batches        *batchGate         //各输出目标共用，均成功输出同一批次后才保存成功记录，单一输出方式时为nil
+	stat           cache.OutputStat   //本输出目标的统计
+	buf            *buffer            //积压数据计数，与各输出目标共用
+	pending        int                //本输出目标已收集但尚未输出的文本数据条数，由buf的锁保护
+	seen           *seen.Set          //跨任务的结果去重记录，未启用时为nil
+	jsonl          jsonlFiles         //jsonl输出方式下各分类正在写入的文件
 	// size     [2]uint64 //数据总输出流量统计[文本，文件]，文本暂时未统计
 	dataBatch   uint64 //当前文本输出批次
 	fileBatch   uint64 //当前文件输出批次
@@ -29,9 +39,61 @@ type Collector struct {
 }
 
 func NewCollector(sp *spider.Spider) *Collector {
+	outs := cache.OutTypes()
+	self := newCollector(sp, outs[0])
+	self.buf = newBuffer()
+	self.openSeen()
+	if len(outs) > 1 {
+		gate := newBatchGate(len(outs))
+		for _, out := range outs {
+			t := newCollector(sp, out)
+			t.buf = self.buf
+			t.seen = self.seen
+			t.batches = gate
+			self.targets = append(self.targets, t)
+		}
+	}
+	return self
+}
+
+// 各输出目标收到的数据及分批完全相同，同一批次号对应同一批数据
+type batchGate struct {
+	targets int
+	results map[uint64]batchResult
+	sync.Mutex
+}
+
+type batchResult struct {
+	reported int  // 已完成输出的目标数
+	failed   bool // 是否有目标输出失败
+}
+
+func newBatchGate(targets int) *batchGate {
+	return &batchGate{
+		targets: targets,
+		results: make(map[uint64]batchResult),
+	}
+}
+
+// 记录一个目标输出第batch批数据的结果，全部目标均已输出且均成功时返回true
+func (self *batchGate) done(batch uint64, ok bool) bool {
+	self.Lock()
+	defer self.Unlock()
+	r := self.results[batch]
+	r.reported++
+	r.failed = r.failed || !ok
+	if r.reported < self.targets {
+		self.results[batch] = r
+		return false
+	}
+	delete(self.results, batch)
+	return !r.failed
+}
+
+func newCollector(sp *spider.Spider, outType string) *Collector {
 	var self = &Collector{}
 	self.Spider = sp
-	self.outType = cache.Task.OutType
+	self.outType = outType
 	if cache.Task.DockerCap < 1 {
 		cache.Task.DockerCap = 1
 	}
@@ -45,15 +107,24 @@ func NewCollector(sp *spider.Spider) *Collector {
 	return self
 }
 
-func (self *Collector) CollectData(dataCell data.DataCell) error {
-	var err error
+func (self *Collector) CollectData(dataCell data.DataCell) (err error) {
 	defer func() {
 		if recover() != nil {
 			err = fmt.Errorf("输出协程已终止")
 		}
 	}()
+	// 跳过此前已输出过的结果
+	if self.seenBefore(dataCell) {
+		data.PutDataCell(dataCell)
+		return nil
+	}
+	// 积压的数据达到上限时在此阻塞
+	if !self.acquire() {
+		self.doneSeen(dataCell, false)
+		return fmt.Errorf("输出协程已终止")
+	}
 	self.DataChan <- dataCell
-	return err
+	return nil
 }
 
 func (self *Collector) CollectFile(fileCell data.FileCell) error {
@@ -67,8 +138,36 @@ func (self *Collector) CollectFile(fileCell data.FileCell) error {
 	return err
 }
 
+// 立即输出已收集但未达分批量的数据，在此前收集的数据输出完毕后返回，有输出失败时返回错误
+func (self *Collector) Flush() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("输出协程已终止")
+		}
+	}()
+	done := make(chan error, 1)
+	self.DataChan <- data.DataCell{flushKey: done}
+	return <-done
+}
+
+// 返回各输出目标的统计，键为输出方式
+func (self *Collector) OutputStats() map[string]cache.OutputStat {
+	targets := self.targets
+	if len(targets) == 0 {
+		targets = []*Collector{self}
+	}
+	stats := make(map[string]cache.OutputStat, len(targets))
+	for _, t := range targets {
+		t.dataSumLock.RLock()
+		stats[t.outType] = t.stat
+		t.dataSumLock.RUnlock()
+	}
+	return stats
+}
+
 // 停止
 func (self *Collector) Stop() {
+	self.stopBuffer()
 	go func() {
 		defer func() {
 			recover()
@@ -85,6 +184,7 @@ func (self *Collector) Stop() {
 
 // 启动数据收集/输出管道
 func (self *Collector) Start() {
+	register(self)
 	// 启动输出协程
 	go func() {
 		dataStop := make(chan bool)
@@ -95,22 +195,56 @@ func (self *Collector) Start() {
 				recover()
 				// println("DataChanStop$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$")
 			}()
-			for data := range self.DataChan {
-				// 缓存分批数据
-				self.dataDocker = append(self.dataDocker, data)
-
-				// 未达到设定的分批量时继续收集数据
-				if len(self.dataDocker) < cache.Task.DockerCap {
+			// 各输出目标分别收集，一个目标输出失败不影响其他目标
+			var targetWait sync.WaitGroup
+			for _, t := range self.targets {
+				targetWait.Add(1)
+				go func(t *Collector) {
+					defer func() {
+						recover()
+						targetWait.Done()
+					}()
+					for cell := range t.DataChan {
+						if done, ok := cell[flushKey].(chan error); ok {
+							done <- t.flush()
+							continue
+						}
+						t.addData(cell)
+					}
+					t.flushData()
+					t.closeOutput()
+				}(t)
+			}
+			for cell := range self.DataChan {
+				if done, ok := cell[flushKey].(chan error); ok {
+					done <- self.flushTargets()
 					continue
 				}
+				// 按规则的Schema转换字段值
+				self.coerce(cell)
 
-				// 执行输出
-				self.dataBatch++
-				self.outputData()
+				if len(self.targets) == 0 {
+					self.addData(cell)
+					continue
+				}
+				// 每个目标各用一份副本，以免输出时对数据的修改相互影响
+				self.addDataSum(1)
+				for i, t := range self.targets {
+					if i < len(self.targets)-1 {
+						t.DataChan <- data.CloneDataCell(cell)
+					} else {
+						t.DataChan <- cell
+					}
+				}
+			}
+			if len(self.targets) == 0 {
+				self.flushData()
+				self.closeOutput()
 			}
-			// 将剩余收集到但未输出的数据输出
-			self.dataBatch++
-			self.outputData()
+			for _, t := range self.targets {
+				close(t.DataChan)
+			}
+			targetWait.Wait()
 			close(dataStop)
 		}()
 
@@ -136,12 +270,68 @@ func (self *Collector) Start() {
 		self.wait.Wait()
 		// println("OutputStopped$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$")
 
+		unregister(self)
+		self.saveSeen()
+
 		// 返回报告
 		self.Report()
 	}()
 }
 
+// 缓存分批数据，达到设定的分批量时执行输出
+func (self *Collector) addData(cell data.DataCell) {
+	self.dataDocker = append(self.dataDocker, cell)
+	if len(self.dataDocker) < cache.Task.DockerCap {
+		return
+	}
+	self.dataBatch++
+	self.outputData()
+}
+
+// 将剩余收集到但未输出的数据输出
+func (self *Collector) flushData() {
+	self.dataBatch++
+	self.outputData()
+}
+
+// Flush()经DataChan传递的标记的键，其值为接收结果的通道
+const flushKey = "\x00flush"
+
+// 输出缓存的数据，本批输出失败时返回错误
+func (self *Collector) flush() error {
+	self.dataSumLock.RLock()
+	fails := self.stat.FailBatch
+	self.dataSumLock.RUnlock()
+	self.flushData()
+	self.dataSumLock.RLock()
+	defer self.dataSumLock.RUnlock()
+	if self.stat.FailBatch != fails {
+		return fmt.Errorf("%s", self.stat.LastError)
+	}
+	return nil
+}
+
+// 各输出目标分别输出缓存的数据，并等待其完成
+func (self *Collector) flushTargets() error {
+	if len(self.targets) == 0 {
+		return self.flush()
+	}
+	var errs []string
+	for _, t := range self.targets {
+		done := make(chan error, 1)
+		t.DataChan <- data.DataCell{flushKey: done}
+		if err := <-done; err != nil {
+			errs = append(errs, t.outType+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (self *Collector) resetDataDocker() {
+	self.release(len(self.dataDocker))
 	for _, cell := range self.dataDocker {
 		data.PutDataCell(cell)
 	}
@@ -207,6 +397,9 @@ func (self *Collector) Report() {
 		FileNum:    self.fileSum(),
 		// DataSize:   self.dataSize(),
 		// FileSize: self.fileSize(),
-		Time: time.Since(cache.StartTime),
+		Time:   time.Since(cache.StartTime),
+		Reason: self.Spider.StopReason(),
+
+		Outputs: self.OutputStats(),
 	}
 }
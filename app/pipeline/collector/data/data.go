@@ -43,12 +43,37 @@ func GetFileCell(ruleName, name string, bytes []byte) FileCell {
 	return cell
 }
 
+// 返回结果的标识字段，由Context.OutputUpsert()设置，为空时按追加方式输出
+func UpsertKey(cell DataCell) []string {
+	key, _ := cell["Key"].([]string)
+	return key
+}
+
+// 复制数据存储单元，Data字段一并复制，供多个输出目标分别使用
+func CloneDataCell(cell DataCell) DataCell {
+	c := dataCellPool.Get().(DataCell)
+	for k, v := range cell {
+		c[k] = v
+	}
+	if vd, ok := cell["Data"].(map[string]interface{}); ok {
+		d := make(map[string]interface{}, len(vd))
+		for k, v := range vd {
+			d[k] = v
+		}
+		c["Data"] = d
+	}
+	return c
+}
+
 func PutDataCell(cell DataCell) {
 	cell["RuleName"] = nil
 	cell["Data"] = nil
 	cell["Url"] = nil
 	cell["ParentUrl"] = nil
 	cell["DownloadTime"] = nil
+	// 可选字段须删除，以免复用时输出空值
+	delete(cell, "Sequence")
+	delete(cell, "Key")
 	dataCellPool.Put(cell)
 }
 
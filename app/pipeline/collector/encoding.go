@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 将UTF-8文本转换为目标编码，为nil时不转换
+type textEncoder struct {
+	charset string
+	encoder *encoding.Encoder
+	policy  string // 无法表示的字符的处理方式：replace、skip、error
+}
+
+// 返回蜘蛛的输出编码器，目标编码为UTF-8时返回nil
+func (self *Collector) textEncoder() (*textEncoder, error) {
+	charset := self.Spider.OutputEncoding
+	if charset == "" {
+		charset = config.OUTPUT_ENCODING
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的输出编码 %q", charset)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return nil, nil
+	}
+	return &textEncoder{
+		charset: charset,
+		encoder: enc.NewEncoder(),
+		policy:  config.OUTPUT_ENCODING_POLICY,
+	}, nil
+}
+
+func (self *textEncoder) String(s string) (string, error) {
+	if self.policy == "replace" {
+		return encoding.ReplaceUnsupported(self.encoder).String(s)
+	}
+	out, err := self.encoder.String(s)
+	if err == nil {
+		return out, nil
+	}
+	if self.policy == "error" {
+		return "", fmt.Errorf("文本 %q 无法转换为 %s 编码: %v", s, self.charset, err)
+	}
+	// skip：逐字符转换，丢弃无法表示的字符
+	var b strings.Builder
+	for _, r := range s {
+		if c, err := self.encoder.String(string(r)); err == nil {
+			b.WriteString(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func (self *textEncoder) Strings(ss []string) ([]string, error) {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		var err error
+		if out[i], err = self.String(s); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
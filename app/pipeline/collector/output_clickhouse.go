@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/common/clickhouse"
+	"github.com/henrylee2cn/pholcus/common/util"
+)
+
+/************************ ClickHouse 输出 ***************************/
+
+func init() {
+	var (
+		clickhouseTable     = map[string]*clickhouse.Table{}
+		clickhouseTableLock sync.RWMutex
+	)
+
+	var getClickhouseTable = func(name string) (*clickhouse.Table, bool) {
+		clickhouseTableLock.RLock()
+		defer clickhouseTableLock.RUnlock()
+		tab, ok := clickhouseTable[name]
+		return tab, ok
+	}
+
+	var setClickhouseTable = func(name string, tab *clickhouse.Table) {
+		clickhouseTableLock.Lock()
+		clickhouseTable[name] = tab
+		clickhouseTableLock.Unlock()
+	}
+
+	DataOutput["clickhouse"] = func(self *Collector) error {
+		if clickhouse.Error() != nil {
+			clickhouse.Refresh()
+			if clickhouse.Error() != nil { // try again
+				return fmt.Errorf("ClickHouse数据库链接失败: %v", clickhouse.Error())
+			}
+		}
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			tables    = make(map[string]*clickhouse.Table)
+			rows      = make(map[string][]map[string]interface{})
+			indexes   = make(map[string][]int) // [表名]各行对应的结果
+		)
+		for i, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			tName := joinNamespaces(namespace, subNamespace)
+			rule := self.MustGetRule(datacell["RuleName"].(string))
+			fields := rule.GetOutputFields()
+			table, ok := tables[tName]
+			if !ok {
+				table, ok = getClickhouseTable(tName)
+				if !ok {
+					table = clickhouse.New(tName)
+					for _, title := range fields {
+						table.AddTypedColumn(title, clickhouseColumnType(rule.Schema[title]))
+					}
+					if self.Spider.OutDefaultField() {
+						table.AddColumn("Url", "ParentUrl", "DownloadTime")
+					}
+					if err := table.Create(); err != nil {
+						return fmt.Errorf("ClickHouse创建表 %s 失败: %v", tName, err)
+					}
+					setClickhouseTable(tName, table)
+				}
+				tables[tName] = table
+			}
+
+			// 动态新增字段需要ALTER TABLE，代价高昂，因此直接报错
+			row := make(map[string]interface{}, len(fields)+3)
+			vd := datacell["Data"].(map[string]interface{})
+			for _, title := range fields {
+				if !table.HasColumn(title) {
+					return fmt.Errorf("ClickHouse表 %s 不存在字段 %q，请在规则的ItemFields中预先声明全部字段", tName, title)
+				}
+				row[title] = clickhouseValue(vd[title], rule.Schema[title])
+			}
+			if self.Spider.OutDefaultField() {
+				row["Url"] = datacell["Url"].(string)
+				row["ParentUrl"] = datacell["ParentUrl"].(string)
+				row["DownloadTime"] = datacell["DownloadTime"].(string)
+			}
+			rows[tName] = append(rows[tName], row)
+			indexes[tName] = append(indexes[tName], i)
+		}
+		for tName, rs := range rows {
+			n, err := tables[tName].Insert(rs)
+			for _, i := range indexes[tName][:n] {
+				self.setWritten(i)
+			}
+			if err != nil {
+				return fmt.Errorf("ClickHouse写入表 %s 失败: %v", tName, err)
+			}
+		}
+		return nil
+	}
+}
+
+// 按Schema中的字段类型确定ClickHouse字段类型，未声明类型时为String
+func clickhouseColumnType(typ string) string {
+	switch typ {
+	case spider.TYPE_INT:
+		return "Nullable(Int64)"
+	case spider.TYPE_FLOAT:
+		return "Nullable(Float64)"
+	case spider.TYPE_BOOL:
+		return "Nullable(Bool)"
+	case spider.TYPE_TIME:
+		return "Nullable(DateTime)"
+	}
+	return ""
+}
+
+// 声明了类型的字段保留原值（nil即NULL），其余转为字符串
+func clickhouseValue(v interface{}, typ string) interface{} {
+	switch typ {
+	case spider.TYPE_INT, spider.TYPE_FLOAT, spider.TYPE_BOOL:
+		return v
+	case spider.TYPE_TIME:
+		if t, ok := v.(time.Time); ok {
+			return t.Unix()
+		}
+		return nil
+	}
+	return fieldString(v)
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 记录收到的语句，DESCRIBE时按CREATE TABLE声明的字段应答
+type fakeClickhouse struct {
+	sync.Mutex
+	queries []string
+	params  []url.Values
+	rows    []map[string]interface{}
+	columns []string
+	inserts int // 收到的INSERT次数
+	failAt  int // 第几次INSERT失败，为0时不失败
+}
+
+func (self *fakeClickhouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.Lock()
+	defer self.Unlock()
+	q := r.URL.Query()
+	query := q.Get("query")
+	self.queries = append(self.queries, query)
+	self.params = append(self.params, q)
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+		cols := query[strings.Index(query, "(")+1 : strings.LastIndex(query, ")")]
+		for _, col := range strings.Split(cols, ", ") {
+			self.columns = append(self.columns, strings.Trim(strings.SplitN(col, " ", 2)[0], "`"))
+		}
+	case strings.HasPrefix(query, "DESCRIBE"):
+		for _, col := range self.columns {
+			w.Write([]byte(col + "\tString\n"))
+		}
+	case strings.HasPrefix(query, "INSERT"):
+		if self.inserts++; self.inserts == self.failAt {
+			http.Error(w, "too many parts", http.StatusInternalServerError)
+			return
+		}
+		for scanner := bufio.NewScanner(r.Body); scanner.Scan(); {
+			var row map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			self.rows = append(self.rows, row)
+		}
+	}
+}
+
+func TestClickhouseOutput(t *testing.T) {
+	server := &fakeClickhouse{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	conn, db, size := config.CLICKHOUSE_CONN_STR, config.CLICKHOUSE_DB, config.CLICKHOUSE_BATCH_SIZE
+	config.CLICKHOUSE_CONN_STR, config.CLICKHOUSE_DB, config.CLICKHOUSE_BATCH_SIZE = ts.URL, "db", 2
+	defer func() {
+		config.CLICKHOUSE_CONN_STR, config.CLICKHOUSE_DB, config.CLICKHOUSE_BATCH_SIZE = conn, db, size
+	}()
+
+	c := testCollector("clickhouse")
+	rule := c.Spider.RuleTree.Trunk["list"]
+	rule.ItemFields = []string{"title", "n", "at"}
+	rule.Schema = map[string]string{"n": spider.TYPE_INT, "at": spider.TYPE_TIME}
+	at := time.Unix(1500000000, 0)
+	c.dataDocker = append(c.dataDocker, data.GetDataCell("list", map[string]interface{}{
+		"title": []string{"x"}, "n": int64(3), "at": at,
+	}, "http://example.com/c", "", "2006-01-02 15:04:05"))
+	if err := DataOutput["clickhouse"](c); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.queries) != 4 {
+		t.Fatalf("queries = %q", server.queries)
+	}
+	if want := "CREATE TABLE IF NOT EXISTS `db`.`test__list` (`title` String, `n` Nullable(Int64), `at` Nullable(DateTime), `Url` String, `ParentUrl` String, `DownloadTime` String) ENGINE = MergeTree ORDER BY tuple()"; server.queries[0] != want {
+		t.Errorf("create = %q", server.queries[0])
+	}
+	// 3条结果按每批2行分两次异步插入
+	for _, params := range server.params[2:] {
+		if params.Get("query") != "INSERT INTO `db`.`test__list` FORMAT JSONEachRow" || params.Get("async_insert") != "1" || params.Get("wait_for_async_insert") != "0" {
+			t.Errorf("insert params = %v", params)
+		}
+	}
+	if len(server.rows) != 3 {
+		t.Fatalf("rows = %v", server.rows)
+	}
+	last := server.rows[2]
+	if last["title"] != `["x"]` || last["n"] != 3.0 || last["at"] != float64(at.Unix()) || last["Url"] != "http://example.com/c" {
+		t.Errorf("row = %v", last)
+	}
+	if server.rows[0]["n"] != nil || server.rows[0]["at"] != nil {
+		t.Errorf("missing typed fields not NULL: %v", server.rows[0])
+	}
+
+	// 第二批写入失败时，仅第一批的结果记为已写入
+	server.inserts, server.failAt = 0, 2
+	times := config.OUTPUT_RETRY_TIMES
+	config.OUTPUT_RETRY_TIMES = 0
+	written, err := c.tryOutputData()
+	config.OUTPUT_RETRY_TIMES = times
+	if err == nil || written != 2 {
+		t.Errorf("written = %v, err = %v", written, err)
+	}
+
+	// 表结构中不存在的字段直接报错
+	rule.ItemFields = append(rule.ItemFields, "extra")
+	if err := DataOutput["clickhouse"](c); err == nil || !strings.Contains(err.Error(), "extra") {
+		t.Errorf("err = %v", err)
+	}
+}
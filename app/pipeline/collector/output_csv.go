@@ -3,6 +3,7 @@ package collector
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/henrylee2cn/pholcus/common/util"
@@ -11,6 +12,46 @@ import (
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 )
 
+// 一个分类数据正在写入的CSV文件
+type csvSheet struct {
+	file   *os.File
+	writer *csv.Writer
+	size   *countWriter
+	rows   int // 已写入的行数，不含表头
+	part   int // 文件编号，从1开始
+}
+
+// 达到csv::rotaterows或csv::rotatebytes时需另起新文件
+func (self *csvSheet) full() bool {
+	if config.CSV_ROTATE_ROWS > 0 && self.rows >= config.CSV_ROTATE_ROWS {
+		return true
+	}
+	if config.CSV_ROTATE_BYTES > 0 {
+		self.writer.Flush()
+		return self.size.n >= int64(config.CSV_ROTATE_BYTES)<<10
+	}
+	return false
+}
+
+func (self *csvSheet) close() {
+	// 发送缓存数据流
+	self.writer.Flush()
+	// 关闭文件
+	self.file.Close()
+}
+
+// 统计写入的字节数
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (self *countWriter) Write(p []byte) (int, error) {
+	n, err := self.Writer.Write(p)
+	self.n += int64(n)
+	return n, err
+}
+
 /************************ CSV 输出 ***************************/
 func init() {
 	DataOutput["csv"] = func(self *Collector) (err error) {
@@ -21,13 +62,43 @@ func init() {
 		}()
 		var (
 			namespace = util.FileNameReplace(self.namespace())
-			sheets    = make(map[string]*csv.Writer)
+			sheets    = make(map[string]*csvSheet)
 		)
+		defer func() {
+			for _, sheet := range sheets {
+				sheet.close()
+			}
+		}()
+		encoder, err := self.textEncoder()
+		if err != nil {
+			return err
+		}
+		var write = func(w *csv.Writer, record []string) error {
+			if encoder != nil {
+				if record, err = encoder.Strings(record); err != nil {
+					return err
+				}
+			}
+			return w.Write(record)
+		}
 		for _, datacell := range self.dataDocker {
 			var subNamespace = util.FileNameReplace(self.subNamespace(datacell))
-			if _, ok := sheets[subNamespace]; !ok {
+			sheet, ok := sheets[subNamespace]
+			if ok && sheet.full() {
+				sheet.close()
+				delete(sheets, subNamespace)
+				ok = false
+			}
+			if !ok {
+				part := 1
+				if sheet != nil {
+					part = sheet.part + 1
+				}
 				folder := config.TEXT_DIR + "/" + cache.StartTime.Format("2006-01-02 150405") + "/" + joinNamespaces(namespace, subNamespace)
 				filename := fmt.Sprintf("%v/%v-%v.csv", folder, self.sum[0], self.sum[1])
+				if part > 1 {
+					filename = fmt.Sprintf("%v/%v-%v_%v.csv", folder, self.sum[0], self.sum[1], part)
+				}
 
 				// 创建/打开目录
 				f, err := os.Stat(folder)
@@ -44,38 +115,37 @@ func init() {
 					logs.Log.Error("%v", err)
 					continue
 				}
-				defer func() {
-					// 发送缓存数据流
-					sheets[subNamespace].Flush()
-					// 关闭文件
-					file.Close()
-				}()
 
-				file.WriteString("\xEF\xBB\xBF") // 写入UTF-8 BOM
+				if encoder == nil {
+					file.WriteString("\xEF\xBB\xBF") // 写入UTF-8 BOM
+				}
 
-				sheets[subNamespace] = csv.NewWriter(file)
-				th := self.MustGetRule(datacell["RuleName"].(string)).ItemFields
+				size := &countWriter{Writer: file}
+				sheet = &csvSheet{file: file, writer: csv.NewWriter(size), size: size, part: part}
+				sheets[subNamespace] = sheet
+				th := append([]string{}, self.MustGetRule(datacell["RuleName"].(string)).GetOutputFields()...)
 				if self.Spider.OutDefaultField() {
 					th = append(th, "当前链接", "上级链接", "下载时间")
 				}
-				sheets[subNamespace].Write(th)
+				if err = write(sheet.writer, th); err != nil {
+					return err
+				}
 			}
 
 			row := []string{}
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).GetOutputFields() {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					row = append(row, v)
-				} else {
-					row = append(row, util.JsonString(vd[title]))
-				}
+				row = append(row, fieldString(vd[title]))
 			}
 			if self.Spider.OutDefaultField() {
 				row = append(row, datacell["Url"].(string))
 				row = append(row, datacell["ParentUrl"].(string))
 				row = append(row, datacell["DownloadTime"].(string))
 			}
-			sheets[subNamespace].Write(row)
+			if err = write(sheet.writer, row); err != nil {
+				return err
+			}
+			sheet.rows++
 		}
 		return
 	}
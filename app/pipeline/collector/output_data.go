@@ -1,15 +1,41 @@
 package collector
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
 )
 
 var (
 	// 全局支持的输出方式
 	DataOutput = make(map[string]func(self *Collector) error)
 
+	// 跨批次保持状态的输出方式（如保持打开的文件）在任务结束时的收尾
+	DataOutputClose = make(map[string]func(self *Collector) error)
+
 	// 全局支持的文本数据输出方式名称列表
 	DataOutputLib []string
+
+	// 文件结果的附加输出方式，文件始终保存至本地，输出方式中包含该键时另行输出
+	FileOutput = make(map[string]func(self *Collector, file data.FileCell) error)
+
+	// 输出失败时按指数退避重试的输出方式（数据库类）
+	retryOutput = map[string]bool{
+		"mgo":        true,
+		"mysql":      true,
+		"kafka":      true,
+		"clickhouse": true,
+		"nats":       true,
+	}
 )
 
 // 文本数据输出
@@ -36,16 +62,169 @@ func (self *Collector) outputData() {
 	// 输出统计
 	self.addDataSum(dataLen)
 
-	// 执行输出
-	err := DataOutput[self.outType](self)
+	// 开启Ordered的规则的结果按序号排列
+	self.sortDataDocker()
+
+	// 执行输出，dataDocker中前written条为已写入的结果
+	written, err := self.tryOutputData()
+	for i, datacell := range self.dataDocker {
+		self.doneSeen(datacell, i < written)
+	}
+	failed := self.dataDocker[written:]
+
+	self.dataSumLock.Lock()
+	self.stat.DataNum += uint64(written)
+	if err != nil {
+		self.stat.FailNum += uint64(len(failed))
+		self.stat.FailBatch++
+		self.stat.LastError = err.Error()
+	}
+	self.dataSumLock.Unlock()
 
 	logs.Log.Informational(" * ")
 	if err != nil {
-		logs.Log.App(" *     Fail  [数据输出：%v | KEYIN：%v | 批次：%v]   数据 %v 条！ [ERROR]  %v\n",
-			self.Spider.GetName(), self.Spider.GetKeyin(), self.dataBatch, dataLen, err)
+		logs.Log.App(" *     Fail  [数据输出：%v | %v | KEYIN：%v | 批次：%v]   数据 %v 条，其中 %v 条未写入！ [ERROR]  %v\n",
+			self.Spider.GetName(), self.outType, self.Spider.GetKeyin(), self.dataBatch, dataLen, len(failed), err)
+		// 未写入的结果保存至死信文件，以便事后重新导入
+		if name, err := self.writeDeadLetter(failed); err != nil {
+			logs.Log.Error(" *     Fail  [死信文件：%v]   %v\n", name, err)
+		} else {
+			logs.Log.App(" *     [死信文件：%v]   数据 %v 条已保存\n", name, len(failed))
+		}
 	} else {
-		logs.Log.App(" *     [数据输出：%v | KEYIN：%v | 批次：%v]   数据 %v 条！\n",
-			self.Spider.GetName(), self.Spider.GetKeyin(), self.dataBatch, dataLen)
+		logs.Log.App(" *     [数据输出：%v | %v | KEYIN：%v | 批次：%v]   数据 %v 条！\n",
+			self.Spider.GetName(), self.outType, self.Spider.GetKeyin(), self.dataBatch, dataLen)
+	}
+	ok := err == nil
+	if self.batches != nil {
+		// 配置了多个输出方式时，须全部目标均成功输出本批数据
+		ok = self.batches.done(self.dataBatch, ok)
+	}
+	if ok {
 		self.Spider.TryFlushSuccess()
 	}
 }
+
+// 执行输出，数据库类输出方式失败时按指数退避重试，已写入的结果不再重试；
+// 返回时dataDocker中已写入的结果被移至前部，written为其条数
+func (self *Collector) tryOutputData() (written int, err error) {
+	all := self.dataDocker
+	defer func() {
+		self.dataDocker = all
+		self.written = nil
+	}()
+	pause := time.Duration(config.OUTPUT_RETRY_PAUSE) * time.Millisecond
+	for i := 0; ; i++ {
+		self.dataDocker = all[written:]
+		self.written = make([]bool, len(self.dataDocker))
+		if err = self.callOutputData(); err == nil {
+			return len(all), nil
+		}
+		written += self.takeWritten()
+		if !retryOutput[self.outType] || i >= config.OUTPUT_RETRY_TIMES {
+			return
+		}
+		logs.Log.Warning(" *     [数据输出：%v | 批次：%v]   第 %v 次重试剩余 %v 条，等待 %v  [ERROR]  %v\n",
+			self.Spider.GetName(), self.dataBatch, i+1, len(all)-written, pause, err)
+		time.Sleep(pause)
+		pause *= 2
+	}
+}
+
+// 标记dataDocker中第i条结果已写入输出目标。
+// 输出方式在写入可能中途失败时（如逐条或分块写入）应逐一标记，失败后仅重试及保存未标记的结果；
+// 未标记任何结果即失败时视为整批均未写入；不经tryOutputData()调用输出方式时忽略
+func (self *Collector) setWritten(i int) {
+	if self.written != nil {
+		self.written[i] = true
+	}
+}
+
+// 将本次输出中已写入的结果稳定地移至dataDocker前部，返回其条数
+func (self *Collector) takeWritten() int {
+	var done, rest []data.DataCell
+	for i, datacell := range self.dataDocker {
+		if self.written[i] {
+			done = append(done, datacell)
+		} else {
+			rest = append(rest, datacell)
+		}
+	}
+	copy(self.dataDocker, done)
+	copy(self.dataDocker[len(done):], rest)
+	return len(done)
+}
+
+// 任务结束时执行输出方式的收尾
+func (self *Collector) closeOutput() {
+	closeOutput, ok := DataOutputClose[self.outType]
+	if !ok {
+		return
+	}
+	if err := closeOutput(self); err != nil {
+		logs.Log.Error(" *     Fail  [数据输出：%v | %v]   收尾失败  [ERROR]  %v\n", self.Spider.GetName(), self.outType, err)
+	}
+}
+
+func (self *Collector) callOutputData() (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	output, ok := DataOutput[self.outType]
+	if !ok {
+		return fmt.Errorf("不支持的输出方式 %s", self.outType)
+	}
+	return output(self)
+}
+
+// 以JSON Lines格式将未写入的结果追加至死信文件，配置了多个输出方式时各目标分别保存
+func (self *Collector) writeDeadLetter(cells []data.DataCell) (string, error) {
+	base := util.FileNameReplace(self.namespace())
+	if len(cache.OutTypes()) > 1 {
+		base += "__" + self.outType
+	}
+	name := filepath.Join(config.DEAD_LETTER_DIR, base+".jsonl")
+	if err := os.MkdirAll(config.DEAD_LETTER_DIR, 0777); err != nil {
+		return name, err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return name, err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetEscapeHTML(false)
+	for _, datacell := range cells {
+		if err := enc.Encode(datacell); err != nil {
+			return name, err
+		}
+	}
+	return name, nil
+}
+
+// 将开启Ordered的规则的结果按序号稳定排序，并放回它们原先所占的位置，其余结果位置不变
+func (self *Collector) sortDataDocker() {
+	var (
+		idx   []int
+		cells []data.DataCell
+	)
+	for i, datacell := range self.dataDocker {
+		if rule, ok := self.Spider.GetRule(datacell["RuleName"].(string)); ok && rule.Ordered {
+			idx = append(idx, i)
+			cells = append(cells, datacell)
+		}
+	}
+	if len(cells) < 2 {
+		return
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		a, _ := cells[i]["Sequence"].(int64)
+		b, _ := cells[j]["Sequence"].(int64)
+		return a < b
+	})
+	for n, i := range idx {
+		self.dataDocker[i] = cells[n]
+	}
+}
@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/aid/seen"
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+func testCollector(outType string) *Collector {
+	sp := &spider.Spider{
+		Name: "test",
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{
+			"list": {ItemFields: []string{"title"}},
+		}},
+	}
+	c := newCollector(sp, outType)
+	c.buf = newBuffer()
+	c.dataDocker = append(c.dataDocker,
+		data.GetDataCell("list", map[string]interface{}{"title": "a"}, "http://example.com/a", "", "2006-01-02 15:04:05"),
+		data.GetDataCell("list", map[string]interface{}{"title": "b"}, "http://example.com/b", "", "2006-01-02 15:04:05"),
+	)
+	return c
+}
+
+// 数据库类输出失败时按output::retrytimes重试，重试耗尽后完整的结果写入死信文件
+func TestOutputRetryThenDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	times, pause, deadDir := config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR
+	config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR = 2, 1, dir
+	defer func() {
+		config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR = times, pause, deadDir
+		delete(DataOutput, "failing")
+		delete(retryOutput, "failing")
+	}()
+
+	var calls int
+	DataOutput["failing"] = func(self *Collector) error {
+		calls++
+		return errors.New("connection refused")
+	}
+	retryOutput["failing"] = true
+
+	testCollector("failing").outputData()
+
+	if calls != 3 {
+		t.Errorf("calls = %v, want 3", calls)
+	}
+	f, err := os.Open(filepath.Join(dir, "test.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var titles []interface{}
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var cell map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &cell); err != nil {
+			t.Fatal(err)
+		}
+		if cell["RuleName"] != "list" || cell["Url"] == nil {
+			t.Errorf("dead letter = %v", cell)
+		}
+		vd, _ := cell["Data"].(map[string]interface{})
+		titles = append(titles, vd["title"])
+	}
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("dead letter titles = %v, want %v", titles, want)
+	}
+}
+
+// 写入中途失败时，仅重试及保存未写入的结果，已写入的结果计入成功
+func TestOutputPartialRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	times, pause, deadDir := config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR
+	config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR = 2, 1, dir
+	defer func() {
+		config.OUTPUT_RETRY_TIMES, config.OUTPUT_RETRY_PAUSE, config.DEAD_LETTER_DIR = times, pause, deadDir
+		delete(DataOutput, "partial")
+		delete(retryOutput, "partial")
+	}()
+
+	// 每次仅写入首条标题为b或d的结果，随后失败
+	var attempts [][]interface{}
+	DataOutput["partial"] = func(self *Collector) error {
+		var titles []interface{}
+		for _, cell := range self.dataDocker {
+			titles = append(titles, cell["Data"].(map[string]interface{})["title"])
+		}
+		attempts = append(attempts, titles)
+		for i, cell := range self.dataDocker {
+			if title := cell["Data"].(map[string]interface{})["title"]; title == "b" || title == "d" {
+				self.setWritten(i)
+				break
+			}
+		}
+		return errors.New("connection reset")
+	}
+	retryOutput["partial"] = true
+
+	c := testCollector("partial")
+	for _, title := range []string{"c", "d"} {
+		c.dataDocker = append(c.dataDocker, data.GetDataCell("list", map[string]interface{}{"title": title}, "http://example.com/"+title, "", ""))
+	}
+	c.outputData()
+
+	want := [][]interface{}{{"a", "b", "c", "d"}, {"a", "c", "d"}, {"a", "c"}}
+	if !reflect.DeepEqual(attempts, want) {
+		t.Errorf("attempts = %v, want %v", attempts, want)
+	}
+	if s := c.stat; s.DataNum != 2 || s.FailNum != 2 || s.FailBatch != 1 {
+		t.Errorf("stat = %+v", s)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "test.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var cell map[string]interface{}
+		if err := json.Unmarshal(line, &cell); err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, cell["Data"].(map[string]interface{})["title"])
+	}
+	if want := []interface{}{"a", "c"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("dead letter titles = %v, want %v", titles, want)
+	}
+}
+
+func TestOutputNoRetryForFiles(t *testing.T) {
+	var calls int
+	DataOutput["failing"] = func(self *Collector) error {
+		calls++
+		return errors.New("disk full")
+	}
+	defer delete(DataOutput, "failing")
+	if _, err := testCollector("failing").tryOutputData(); err == nil || calls != 1 {
+		t.Errorf("err = %v, calls = %v", err, calls)
+	}
+}
+
+// 构造MongoDB文档不应修改结果本身
+func TestMgoDocKeepsCell(t *testing.T) {
+	c := testCollector("mgo")
+	cell := c.dataDocker[0]
+	cell["Key"] = []string{"title"}
+	doc, selector := c.mgoDoc(cell)
+	if doc["title"] != "a" || doc["Url"] != "http://example.com/a" || doc["RuleName"] != nil {
+		t.Errorf("doc = %v", doc)
+	}
+	if selector["title"] != "a" {
+		t.Errorf("selector = %v", selector)
+	}
+	for _, k := range []string{"Data", "RuleName", "Url", "Key"} {
+		if cell[k] == nil {
+			t.Errorf("cell lost %s: %v", k, cell)
+		}
+	}
+}
+
+// 输出失败的结果不计入跨任务去重记录
+func TestOutputFailureNotSeen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	seenDir, deadDir := config.SEEN_DIR, config.DEAD_LETTER_DIR
+	config.SEEN_DIR, config.DEAD_LETTER_DIR = dir, dir
+	defer func() { config.SEEN_DIR, config.DEAD_LETTER_DIR = seenDir, deadDir }()
+
+	var fail bool
+	DataOutput["flaky"] = func(self *Collector) error {
+		if fail {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	defer delete(DataOutput, "flaky")
+
+	for _, fail = range []bool{true, false} {
+		c := testCollector("flaky")
+		c.Spider.RuleTree.Trunk["list"].ItemKey = []string{"title"}
+		c.seen, _ = seen.Open("test", "")
+		cells := c.dataDocker
+		c.dataDocker = nil
+		for _, cell := range cells {
+			if c.seenBefore(cell) {
+				t.Fatalf("fail=%v: %v seen before output", fail, cell["Data"])
+			}
+			c.dataDocker = append(c.dataDocker, cell)
+		}
+		c.outputData()
+		c.seen.Save()
+	}
+	set, _ := seen.Open("test", "")
+	if !set.Seen("list\x00a") {
+		t.Error("successfully output item not recorded")
+	}
+}
+
+func TestBatchGate(t *testing.T) {
+	gate := newBatchGate(2)
+	steps := []struct {
+		batch uint64
+		ok    bool
+		want  bool
+	}{
+		{1, true, false},
+		{2, false, false}, // 各批次独立计数
+		{1, true, true},
+		{2, true, false}, // 任一目标失败则不保存成功记录
+		{3, true, false},
+		{3, false, false},
+	}
+	for i, s := range steps {
+		if got := gate.done(s.batch, s.ok); got != s.want {
+			t.Errorf("step %d: done(%d, %v) = %v", i, s.batch, s.ok, got)
+		}
+	}
+	if len(gate.results) != 0 {
+		t.Errorf("results = %v", gate.results)
+	}
+}
+
+// 多个输出目标中一个失败时，其余目标照常输出，仅失败目标写入死信文件
+func TestFanOutPartialFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fanout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outType, dockerCap, deadDir := cache.Task.OutType, cache.Task.DockerCap, config.DEAD_LETTER_DIR
+	cache.Task.OutType, cache.Task.DockerCap, config.DEAD_LETTER_DIR = "ok, failing", 2, dir
+	defer func() {
+		cache.Task.OutType, cache.Task.DockerCap, config.DEAD_LETTER_DIR = outType, dockerCap, deadDir
+		delete(DataOutput, "ok")
+		delete(DataOutput, "failing")
+	}()
+
+	var output []interface{}
+	DataOutput["ok"] = func(self *Collector) error {
+		for _, cell := range self.dataDocker {
+			vd := cell["Data"].(map[string]interface{})
+			output = append(output, vd["title"])
+			vd["title"] = "modified"
+		}
+		return nil
+	}
+	DataOutput["failing"] = func(self *Collector) error {
+		return errors.New("connection refused")
+	}
+
+	c := NewCollector(testCollector("").Spider)
+	c.Start()
+	for _, title := range []string{"a", "b", "c"} {
+		c.CollectData(data.GetDataCell("list", map[string]interface{}{"title": title}, "http://example.com/"+title, "", ""))
+	}
+	c.Stop()
+	report := <-cache.ReportChan
+
+	if want := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(output, want) {
+		t.Errorf("ok output = %v, want %v", output, want)
+	}
+	if s := report.Outputs["ok"]; s.DataNum != 3 || s.FailNum != 0 {
+		t.Errorf("ok stat = %+v", s)
+	}
+	if s := report.Outputs["failing"]; s.DataNum != 0 || s.FailNum != 3 || s.FailBatch != 2 || s.LastError != "connection refused" {
+		t.Errorf("failing stat = %+v", s)
+	}
+	if report.DataNum != 3 {
+		t.Errorf("DataNum = %v", report.DataNum)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != "test__failing.jsonl" {
+		t.Fatalf("dead letters = %v", files)
+	}
+	// 其他目标对数据的修改不影响死信文件中的内容
+	b, _ := ioutil.ReadFile(files[0])
+	if bytes.Contains(b, []byte("modified")) {
+		t.Errorf("dead letter = %s", b)
+	}
+}
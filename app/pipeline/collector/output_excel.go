@@ -3,6 +3,8 @@ package collector
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/common/xlsx"
@@ -23,65 +25,150 @@ func init() {
 		var (
 			file   *xlsx.File
 			row    *xlsx.Row
-			cell   *xlsx.Cell
 			sheets = make(map[string]*xlsx.Sheet)
+			names  = make(map[string]bool)       // 已使用的工作表名（小写）
+			widths = make(map[*xlsx.Sheet][]int) // 各列内容的最大显示宽度
+			part   = 1
 		)
 
+		// 记录单元格内容的显示宽度，用于保存前自动调整列宽
+		addCell := func(sheet *xlsx.Sheet, row *xlsx.Row, value string) *xlsx.Cell {
+			cell := row.AddCell()
+			cell.Value = value
+			w, i := widths[sheet], len(row.Cells)-1
+			if i >= len(w) {
+				w = append(w, make([]int, i+1-len(w))...)
+			}
+			if n := displayWidth(value); n > w[i] {
+				w[i] = n
+			}
+			widths[sheet] = w
+			return cell
+		}
+
+		folder := config.TEXT_DIR + "/" + cache.StartTime.Format("2006-01-02 150405")
+
+		// 创建/打开目录
+		f2, err := os.Stat(folder)
+		if err != nil || !f2.IsDir() {
+			if err := os.MkdirAll(folder, 0777); err != nil {
+				logs.Log.Error("Error: %v\n", err)
+			}
+		}
+
+		// 保存文件，达到excel::rotaterows另起新文件时文件名追加编号
+		save := func() error {
+			filename := fmt.Sprintf("%v/%v__%v-%v.xlsx", folder, util.FileNameReplace(self.namespace()), self.sum[0], self.sum[1])
+			if part > 1 {
+				filename = fmt.Sprintf("%v/%v__%v-%v_%v.xlsx", folder, util.FileNameReplace(self.namespace()), self.sum[0], self.sum[1], part)
+			}
+			for sheet, w := range widths {
+				for i, n := range w {
+					sheet.Col(i).Width = excelColWidth(n)
+				}
+			}
+			return file.Save(filename)
+		}
+
 		// 创建文件
 		file = xlsx.NewFile()
 
 		// 添加分类数据工作表
 		for _, datacell := range self.dataDocker {
 			var subNamespace = util.FileNameReplace(self.subNamespace(datacell))
+			// 工作表已满时保存当前文件并另起新文件，表头行不计入行数
+			if sheet, ok := sheets[subNamespace]; ok && config.EXCEL_ROTATE_ROWS > 0 && len(sheet.Rows)-1 >= config.EXCEL_ROTATE_ROWS {
+				if err = save(); err != nil {
+					return
+				}
+				file = xlsx.NewFile()
+				sheets = make(map[string]*xlsx.Sheet)
+				names = make(map[string]bool)
+				widths = make(map[*xlsx.Sheet][]int)
+				part++
+			}
 			if _, ok := sheets[subNamespace]; !ok {
 				// 添加工作表
-				sheet, err := file.AddSheet(subNamespace)
+				sheet, err := file.AddSheet(excelSheetName(subNamespace, names))
 				if err != nil {
 					logs.Log.Error("%v", err)
 					continue
 				}
 				sheets[subNamespace] = sheet
 				// 写入表头
-				row = sheets[subNamespace].AddRow()
-				for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
-					row.AddCell().Value = title
+				row = sheet.AddRow()
+				for _, title := range self.MustGetRule(datacell["RuleName"].(string)).GetOutputFields() {
+					addCell(sheet, row, title)
 				}
 				if self.Spider.OutDefaultField() {
-					row.AddCell().Value = "当前链接"
-					row.AddCell().Value = "上级链接"
-					row.AddCell().Value = "下载时间"
+					addCell(sheet, row, "当前链接")
+					addCell(sheet, row, "上级链接")
+					addCell(sheet, row, "下载时间")
 				}
 			}
 
-			row = sheets[subNamespace].AddRow()
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
-				cell = row.AddCell()
+			sheet := sheets[subNamespace]
+			row = sheet.AddRow()
+			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).GetOutputFields() {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					cell.Value = v
-				} else {
-					cell.Value = util.JsonString(vd[title])
-				}
+				addCell(sheet, row, fieldString(vd[title]))
 			}
 			if self.Spider.OutDefaultField() {
-				row.AddCell().Value = datacell["Url"].(string)
-				row.AddCell().Value = datacell["ParentUrl"].(string)
-				row.AddCell().Value = datacell["DownloadTime"].(string)
-			}
-		}
-		folder := config.TEXT_DIR + "/" + cache.StartTime.Format("2006-01-02 150405")
-		filename := fmt.Sprintf("%v/%v__%v-%v.xlsx", folder, util.FileNameReplace(self.namespace()), self.sum[0], self.sum[1])
-
-		// 创建/打开目录
-		f2, err := os.Stat(folder)
-		if err != nil || !f2.IsDir() {
-			if err := os.MkdirAll(folder, 0777); err != nil {
-				logs.Log.Error("Error: %v\n", err)
+				addCell(sheet, row, datacell["Url"].(string))
+				addCell(sheet, row, datacell["ParentUrl"].(string))
+				addCell(sheet, row, datacell["DownloadTime"].(string))
 			}
 		}
 
 		// 保存文件
-		err = file.Save(filename)
+		err = save()
 		return
 	}
 }
+
+// 返回合法且不重复的工作表名：替换非法字符，截断至31个字符，重名时追加"(2)"等序号
+func excelSheetName(name string, used map[string]bool) string {
+	name = strings.TrimSpace(util.ExcelSheetNameReplace(name))
+	if name == "" {
+		name = "Sheet"
+	}
+	for n := 1; ; n++ {
+		suffix := ""
+		if n > 1 {
+			suffix = "(" + strconv.Itoa(n) + ")"
+		}
+		r := []rune(name)
+		if max := 31 - len(suffix); len(r) > max {
+			r = r[:max]
+		}
+		candidate := string(r) + suffix
+		if key := strings.ToLower(candidate); !used[key] {
+			used[key] = true
+			return candidate
+		}
+	}
+}
+
+// 文本的显示宽度，全角字符计为2
+func displayWidth(s string) int {
+	var n int
+	for _, r := range s {
+		if r > 0x2E80 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// 由内容宽度计算列宽，限定在8~60之间
+func excelColWidth(n int) float64 {
+	w := float64(n) + 2
+	if w < 8 {
+		w = 8
+	} else if w > 60 {
+		w = 60
+	}
+	return w
+}
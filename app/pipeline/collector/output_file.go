@@ -12,7 +12,7 @@ import (
 	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
-	// "github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
 )
 
 // 文件输出
@@ -66,6 +66,18 @@ func (self *Collector) outputFile(file data.FileCell) {
 	// 输出统计
 	self.addFileSum(1)
 
+	// 附加输出
+	for _, out := range cache.OutTypes() {
+		if output, ok := FileOutput[out]; ok {
+			if err := output(self, file); err != nil {
+				logs.Log.Error(
+					" *     Fail  [文件输出：%v | %v | KEYIN：%v | 批次：%v]   %v [ERROR]  %v\n",
+					self.Spider.GetName(), out, self.Spider.GetKeyin(), atomic.LoadUint64(&self.fileBatch), fileName, err,
+				)
+			}
+		}
+	}
+
 	// 打印报告
 	logs.Log.Informational(" * ")
 	logs.Log.App(
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// Spider.ItemFileName为空时的文件名模板
+const defaultItemFileName = "{{.RuleName}}/{{.Index}}.json"
+
+// 文件名中单个字段值的最大字节数，多数文件系统限制文件名不超过255字节
+const itemFieldMaxLen = 200
+
+// 模板中可引用的单条结果
+type itemCell struct {
+	RuleName     string
+	Url          string
+	ParentUrl    string
+	DownloadTime string
+	Index        uint64                 // 本次任务中该结果的序号，从1开始
+	Data         map[string]interface{} // 结果字段
+}
+
+/************************ 单条结果单个文件输出 ***************************/
+func init() {
+	DataOutput["item"] = func(self *Collector) error {
+		nameTpl, err := template.New("filename").Option("missingkey=zero").Parse(itemFileName(self.Spider.ItemFileName))
+		if err != nil {
+			return fmt.Errorf("文件名模板有误: %v", err)
+		}
+		var bodyTpl *template.Template
+		if self.Spider.ItemTemplate != "" {
+			if bodyTpl, err = template.New("item").Parse(self.Spider.ItemTemplate); err != nil {
+				return fmt.Errorf("内容模板有误: %v", err)
+			}
+		}
+		folder := filepath.Join(config.TEXT_DIR, cache.StartTime.Format("2006-01-02 150405"), util.FileNameReplace(self.namespace()))
+
+		for i, datacell := range self.dataDocker {
+			item := &itemCell{
+				RuleName: datacell["RuleName"].(string),
+				Index:    self.sum[0] + uint64(i) + 1,
+				Data:     datacell["Data"].(map[string]interface{}),
+			}
+			if self.Spider.OutDefaultField() {
+				item.Url, _ = datacell["Url"].(string)
+				item.ParentUrl, _ = datacell["ParentUrl"].(string)
+				item.DownloadTime, _ = datacell["DownloadTime"].(string)
+			}
+
+			// 文件名中的字段值须先处理为合法的文件名
+			safe := *item
+			safe.RuleName = itemPathSegment(item.RuleName)
+			safe.Url = itemPathSegment(item.Url)
+			safe.ParentUrl = itemPathSegment(item.ParentUrl)
+			safe.DownloadTime = itemPathSegment(item.DownloadTime)
+			safe.Data = make(map[string]interface{}, len(item.Data))
+			for k, v := range item.Data {
+				safe.Data[k] = itemPathSegment(fieldString(v))
+			}
+			var name bytes.Buffer
+			if err := nameTpl.Execute(&name, &safe); err != nil {
+				return err
+			}
+
+			var body bytes.Buffer
+			if bodyTpl != nil {
+				err = bodyTpl.Execute(&body, item)
+			} else {
+				enc := json.NewEncoder(&body)
+				enc.SetEscapeHTML(false)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(item)
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := writeItemFile(folder, name.String(), body.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func itemFileName(tpl string) string {
+	if tpl == "" {
+		return defaultItemFileName
+	}
+	return tpl
+}
+
+// 将字段值处理为可用作单级路径的字符串
+func itemPathSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, util.FileNameReplace(s))
+	s = strings.TrimSpace(s)
+	for len(s) > itemFieldMaxLen {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	if s == "." || s == ".." {
+		s = "_"
+	}
+	return s
+}
+
+// 在folder下写入文件，name中的"/"表示子目录，文件已存在时在扩展名前追加"_2"、"_3"等序号
+func writeItemFile(folder, name string, body []byte) error {
+	var segs []string
+	for _, seg := range strings.Split(filepath.ToSlash(name), "/") {
+		if seg = strings.TrimSpace(seg); seg != "" && seg != "." && seg != ".." {
+			segs = append(segs, seg)
+		}
+	}
+	if len(segs) == 0 {
+		segs = []string{"_"}
+	}
+	filename := filepath.Join(append([]string{folder}, segs...)...)
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for n := 1; ; n++ {
+		if n > 1 {
+			filename = base + "_" + strconv.Itoa(n) + ext
+		}
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
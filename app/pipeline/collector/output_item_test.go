@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 执行item输出，返回各文件相对于命名空间目录的路径及内容
+func testItemOutput(t *testing.T, c *Collector) map[string]string {
+	dir, err := ioutil.TempDir("", "item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	textDir := config.TEXT_DIR
+	config.TEXT_DIR = dir
+	defer func() {
+		config.TEXT_DIR = textDir
+		os.RemoveAll(dir)
+	}()
+	if err := DataOutput["item"](c); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	folders, _ := filepath.Glob(filepath.Join(dir, "*", "test"))
+	if len(folders) != 1 {
+		t.Fatalf("folders = %v", folders)
+	}
+	filepath.Walk(folders[0], func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			b, _ := ioutil.ReadFile(path)
+			rel, _ := filepath.Rel(folders[0], path)
+			files[filepath.ToSlash(rel)] = string(b)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestItemOutputDefault(t *testing.T) {
+	files := testItemOutput(t, testCollector("item"))
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+	var item itemCell
+	if err := json.Unmarshal([]byte(files["list/2.json"]), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.RuleName != "list" || item.Index != 2 || item.Url != "http://example.com/b" || item.Data["title"] != "b" {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+func TestItemOutputTemplate(t *testing.T) {
+	c := testCollector("item")
+	c.Spider.ItemFileName = "{{.RuleName}}/{{.Data.title}}.html"
+	c.Spider.ItemTemplate = "<h1>{{.Data.title}}</h1>{{.Url}}"
+	c.dataDocker = append(c.dataDocker,
+		data.GetDataCell("list", map[string]interface{}{"title": "a"}, "http://example.com/a2", "", ""),
+		data.GetDataCell("list", map[string]interface{}{"title": "../x/y"}, "http://example.com/c", "", ""),
+		data.GetDataCell("list", map[string]interface{}{"title": ".."}, "http://example.com/d", "", ""),
+		data.GetDataCell("list", map[string]interface{}{"title": strings.Repeat("长", 200)}, "http://example.com/e", "", ""),
+	)
+	files := testItemOutput(t, c)
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// 字段值中的路径分隔符被替换，重名时追加序号，过长时按字节截断
+	want := []string{"list/..／x／y.html", "list/_.html", "list/a.html", "list/a_2.html", "list/b.html", "list/" + strings.Repeat("长", itemFieldMaxLen/3) + ".html"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if got := files["list/a_2.html"]; got != "<h1>a</h1>http://example.com/a2" {
+		t.Errorf("a_2.html = %q", got)
+	}
+	if got := files["list/b.html"]; got != "<h1>b</h1>http://example.com/b" {
+		t.Errorf("b.html = %q", files["list/b.html"])
+	}
+}
@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 一个分类数据正在写入的JSON Lines文件，跨批次保持打开，任务结束时关闭
+type jsonlSegment struct {
+	folder string
+	file   *os.File
+	writer *bufio.Writer
+	size   *countWriter
+}
+
+// [分类]正在写入的文件
+type jsonlFiles map[string]*jsonlSegment
+
+// 正在写入的文件名，写满或任务结束后改为带时间戳的文件名
+const jsonlActive = "current.jsonl"
+
+func openJsonlSegment(folder string) (*jsonlSegment, error) {
+	if err := os.MkdirAll(folder, 0777); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(folder+"/"+jsonlActive, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	size := &countWriter{Writer: file}
+	if info, err := file.Stat(); err == nil {
+		size.n = info.Size()
+	}
+	return &jsonlSegment{folder: folder, file: file, writer: bufio.NewWriter(size), size: size}, nil
+}
+
+// 达到jsonl::maxbytes时需另起新文件
+func (self *jsonlSegment) full() bool {
+	return config.JSONL_MAX_BYTES > 0 && self.size.n >= int64(config.JSONL_MAX_BYTES)
+}
+
+// 关闭并将文件改为带时间戳的文件名，启用jsonl::gzip时压缩之
+func (self *jsonlSegment) close() error {
+	err := self.writer.Flush()
+	if e := self.file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%v/data_%v.jsonl", self.folder, time.Now().Format("20060102-150405.000000"))
+	if err = os.Rename(self.file.Name(), name); err != nil {
+		return err
+	}
+	if config.JSONL_GZIP {
+		return gzipFile(name)
+	}
+	return nil
+}
+
+// 将文件压缩为同名的.gz文件并删除原文件
+func gzipFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+/************************ JSON Lines 输出 ***************************/
+func init() {
+	// 每条结果一行JSON，按分类追加至同一文件，达到jsonl::maxbytes时轮转
+	DataOutput["jsonl"] = func(self *Collector) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("%v", p)
+			}
+		}()
+		if self.jsonl == nil {
+			self.jsonl = make(jsonlFiles)
+		}
+		defer func() {
+			// 每批输出后写入磁盘，以免任务异常终止时丢失
+			for _, seg := range self.jsonl {
+				if e := seg.writer.Flush(); err == nil {
+					err = e
+				}
+			}
+		}()
+		namespace := util.FileNameReplace(self.namespace())
+		for _, datacell := range self.dataDocker {
+			var subNamespace = util.FileNameReplace(self.subNamespace(datacell))
+			seg, ok := self.jsonl[subNamespace]
+			if ok && seg.full() {
+				delete(self.jsonl, subNamespace)
+				if err := seg.close(); err != nil {
+					logs.Log.Error(" *     [JSON Lines] 轮转文件失败: %v\n", err)
+				}
+				ok = false
+			}
+			if !ok {
+				folder := config.TEXT_DIR + "/" + cache.StartTime.Format("2006-01-02 150405") + "/" + joinNamespaces(namespace, subNamespace)
+				if seg, err = openJsonlSegment(folder); err != nil {
+					return err
+				}
+				self.jsonl[subNamespace] = seg
+			}
+
+			ruleName := datacell["RuleName"].(string)
+			line := map[string]interface{}{"RuleName": ruleName}
+			vd := datacell["Data"].(map[string]interface{})
+			for _, title := range self.MustGetRule(ruleName).GetOutputFields() {
+				line[title] = vd[title]
+			}
+			if self.Spider.OutDefaultField() {
+				line["Url"] = datacell["Url"].(string)
+				line["ParentUrl"] = datacell["ParentUrl"].(string)
+				line["DownloadTime"] = datacell["DownloadTime"].(string)
+			}
+			enc := json.NewEncoder(seg.writer)
+			enc.SetEscapeHTML(false)
+			if err = enc.Encode(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	DataOutputClose["jsonl"] = func(self *Collector) error {
+		var errs []string
+		for subNamespace, seg := range self.jsonl {
+			delete(self.jsonl, subNamespace)
+			if err := seg.close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+func TestJsonlSegmentRotate(t *testing.T) {
+	folder, err := ioutil.TempDir("", "jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	maxBytes, gz := config.JSONL_MAX_BYTES, config.JSONL_GZIP
+	config.JSONL_MAX_BYTES, config.JSONL_GZIP = 8, true
+	defer func() { config.JSONL_MAX_BYTES, config.JSONL_GZIP = maxBytes, gz }()
+
+	seg, err := openJsonlSegment(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg.writer.WriteString("{\"a\":1}\n")
+	seg.writer.Flush()
+	if !seg.full() {
+		t.Fatal("segment not full at jsonl::maxbytes")
+	}
+	if err := seg.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, jsonlActive)); !os.IsNotExist(err) {
+		t.Errorf("active file left behind: %v", err)
+	}
+	names, _ := filepath.Glob(filepath.Join(folder, "data_*.jsonl.gz"))
+	if len(names) != 1 {
+		t.Fatalf("rotated files = %v, want one gzip file", names)
+	}
+	f, err := os.Open(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != "{\"a\":1}\n" {
+		t.Errorf("content = %q", b)
+	}
+}
@@ -41,7 +41,7 @@ func init() {
 			kafkas    = make(map[string]*kafka.KafkaSender)
 			namespace = util.FileNameReplace(self.namespace())
 		)
-		for _, datacell := range self.dataDocker {
+		for i, datacell := range self.dataDocker {
 			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
 			topicName := joinNamespaces(namespace, subNamespace)
 			if !topic.MatchString(topicName) {
@@ -61,23 +61,20 @@ func init() {
 				}
 			}
 			data := make(map[string]interface{})
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).GetOutputFields() {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					data[title] = v
-				} else {
-					data[title] = util.JsonString(vd[title])
-				}
+				data[title] = fieldString(vd[title])
 			}
 			if self.Spider.OutDefaultField() {
 				data["url"] = datacell["Url"].(string)
 				data["parent_url"] = datacell["ParentUrl"].(string)
 				data["download_time"] = datacell["DownloadTime"].(string)
 			}
-			err := sender.Push(data)
-			util.CheckErr(err)
+			if err := sender.Push(data); err != nil {
+				return err
+			}
+			self.setWritten(i)
 		}
-		kafkas = nil
 		return nil
 	}
 }
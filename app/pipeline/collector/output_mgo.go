@@ -4,12 +4,13 @@ import (
 	"fmt"
 
 	mgov2 "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
 	"github.com/henrylee2cn/pholcus/common/mgo"
 	"github.com/henrylee2cn/pholcus/common/pool"
 	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/config"
-	"github.com/henrylee2cn/pholcus/logs"
 )
 
 /************************ MongoDB 输出 ***************************/
@@ -29,45 +30,53 @@ func init() {
 				namespace   = util.FileNameReplace(self.namespace())
 				collections = make(map[string]*mgov2.Collection)
 				dataMap     = make(map[string][]interface{})
-				err         error
+				dataIdx     = make(map[string][]int)            // [集合]各文档对应的结果
+				upserts     = make(map[string][][2]interface{}) // [集合][选择器, 文档]
+				upsertIdx   = make(map[string][]int)
 			)
 
-			for _, datacell := range self.dataDocker {
+			for i, datacell := range self.dataDocker {
 				subNamespace := util.FileNameReplace(self.subNamespace(datacell))
 				cName := joinNamespaces(namespace, subNamespace)
 
 				if _, ok := collections[subNamespace]; !ok {
 					collections[subNamespace] = db.C(cName)
 				}
-				for k, v := range datacell["Data"].(map[string]interface{}) {
-					datacell[k] = v
+				doc, selector := self.mgoDoc(datacell)
+				if selector != nil {
+					upserts[subNamespace] = append(upserts[subNamespace], [2]interface{}{selector, doc})
+					upsertIdx[subNamespace] = append(upsertIdx[subNamespace], i)
+					continue
 				}
-				delete(datacell, "Data")
-				delete(datacell, "RuleName")
-				if !self.Spider.OutDefaultField() {
-					delete(datacell, "Url")
-					delete(datacell, "ParentUrl")
-					delete(datacell, "DownloadTime")
+				// 预先生成_id，以便批量插入中途失败时确定已插入的文档
+				doc["_id"] = bson.NewObjectId()
+				dataMap[subNamespace] = append(dataMap[subNamespace], doc)
+				dataIdx[subNamespace] = append(dataIdx[subNamespace], i)
+			}
+
+			// 带标识的结果逐条更新，不存在时插入
+			for collection, docs := range upserts {
+				c := collections[collection]
+				for j, doc := range docs {
+					if _, err := c.Upsert(doc[0], doc[1]); err != nil {
+						return err
+					}
+					self.setWritten(upsertIdx[collection][j])
 				}
-				dataMap[subNamespace] = append(dataMap[subNamespace], datacell)
 			}
 
 			for collection, docs := range dataMap {
 				c := collections[collection]
-				count := len(docs)
-				loop := count / mgo.MaxLen
-				for i := 0; i < loop; i++ {
-					err = c.Insert(docs[i*mgo.MaxLen : (i+1)*mgo.MaxLen]...)
-					if err != nil {
-						logs.Log.Error("%v", err)
+				for start := 0; start < len(docs); start += mgo.MaxLen {
+					end := start + mgo.MaxLen
+					if end > len(docs) {
+						end = len(docs)
+					}
+					if err := mgoInsert(c, docs[start:end], func(j int) {
+						self.setWritten(dataIdx[collection][start+j])
+					}); err != nil {
+						return err
 					}
-				}
-				if count%mgo.MaxLen == 0 {
-					continue
-				}
-				err = c.Insert(docs[loop*mgo.MaxLen:]...)
-				if err != nil {
-					logs.Log.Error("%v", err)
 				}
 			}
 
@@ -75,3 +84,49 @@ func init() {
 		})
 	}
 }
+
+// 批量插入文档，每插入一条即调用written；批量插入失败时部分文档可能已插入，
+// 此时逐条重新插入，_id重复的文档即为已插入的文档
+func mgoInsert(c *mgov2.Collection, docs []interface{}, written func(i int)) error {
+	if err := c.Insert(docs...); err == nil {
+		for i := range docs {
+			written(i)
+		}
+		return nil
+	}
+	for i, doc := range docs {
+		if err := c.Insert(doc); err != nil && !mgov2.IsDup(err) {
+			return err
+		}
+		written(i)
+	}
+	return nil
+}
+
+// 由结果构造MongoDB文档，带标识的结果同时返回其选择器；
+// 结果本身保持不变，以便重试及写入死信文件
+func (self *Collector) mgoDoc(datacell data.DataCell) (doc, selector bson.M) {
+	vd := datacell["Data"].(map[string]interface{})
+	doc = bson.M{}
+	if rule := self.MustGetRule(datacell["RuleName"].(string)); len(rule.OutputFields) > 0 {
+		for _, k := range rule.OutputFields {
+			doc[k] = vd[k]
+		}
+	} else {
+		for k, v := range vd {
+			doc[k] = v
+		}
+	}
+	if self.Spider.OutDefaultField() {
+		doc["Url"] = datacell["Url"]
+		doc["ParentUrl"] = datacell["ParentUrl"]
+		doc["DownloadTime"] = datacell["DownloadTime"]
+	}
+	if key := data.UpsertKey(datacell); len(key) > 0 {
+		selector = bson.M{}
+		for _, k := range key {
+			selector[k] = vd[k]
+		}
+	}
+	return
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/app/spider"
 	"github.com/henrylee2cn/pholcus/common/mysql"
 	"github.com/henrylee2cn/pholcus/common/util"
-	"github.com/henrylee2cn/pholcus/logs"
 )
 
 /************************ Mysql 输出 ***************************/
@@ -34,15 +35,30 @@ func init() {
 	}
 
 	DataOutput["mysql"] = func(self *Collector) error {
-		_, err := mysql.DB()
-		if err != nil {
-			return fmt.Errorf("Mysql数据库链接失败: %v", err)
+		// 连接失败的状态会保留至下次Refresh()，失败时重新连接，以便重试时恢复
+		if _, err := mysql.DB(); err != nil {
+			mysql.Refresh()
+			if _, err = mysql.DB(); err != nil {
+				return fmt.Errorf("Mysql数据库链接失败: %v", err)
+			}
 		}
 		var (
 			mysqls    = make(map[string]*mysql.MyTable)
+			pending   = make(map[string][]int) // [表名]已缓存尚未写入的结果
 			namespace = util.FileNameReplace(self.namespace())
 		)
-		for _, datacell := range self.dataDocker {
+		// 写入表中缓存的数据，成功后标记相应的结果
+		var flush = func(tName string) error {
+			if err := mysqls[tName].FlushInsert(); err != nil {
+				return err
+			}
+			for _, i := range pending[tName] {
+				self.setWritten(i)
+			}
+			pending[tName] = nil
+			return nil
+		}
+		for i, datacell := range self.dataDocker {
 			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
 			tName := joinNamespaces(namespace, subNamespace)
 			table, ok := mysqls[tName]
@@ -53,39 +69,76 @@ func init() {
 				} else {
 					table = mysql.New()
 					table.SetTableName(tName)
-					for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
-						table.AddColumn(title + ` MEDIUMTEXT`)
+					rule := self.MustGetRule(datacell["RuleName"].(string))
+					for _, title := range rule.GetOutputFields() {
+						table.AddColumn(title + ` ` + mysqlColumnType(rule.Schema[title]))
 					}
 					if self.Spider.OutDefaultField() {
 						table.AddColumn(`Url VARCHAR(255)`, `ParentUrl VARCHAR(255)`, `DownloadTime VARCHAR(50)`)
 					}
+					// 由带标识的结果（见Context.OutputUpsert()）创建的表建立唯一索引，此后写入该表的行均按其更新
+					if key := data.UpsertKey(datacell); len(key) > 0 {
+						table.SetUniqueKey(key...)
+					}
 					if err := table.Create(); err != nil {
-						logs.Log.Error("%v", err)
-						continue
-					} else {
-						setMysqlTable(tName, table)
-						mysqls[tName] = table
+						return fmt.Errorf("Mysql创建表 %s 失败: %v", tName, err)
 					}
+					setMysqlTable(tName, table)
+					mysqls[tName] = table
 				}
 			}
-			data := []string{}
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			data := []interface{}{}
+			rule := self.MustGetRule(datacell["RuleName"].(string))
+			for _, title := range rule.GetOutputFields() {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					data = append(data, v)
-				} else {
-					data = append(data, util.JsonString(vd[title]))
-				}
+				data = append(data, mysqlValue(vd[title], rule.Schema[title]))
 			}
 			if self.Spider.OutDefaultField() {
 				data = append(data, datacell["Url"].(string), datacell["ParentUrl"].(string), datacell["DownloadTime"].(string))
 			}
-			table.AutoInsert(data)
+			// 先行写入已缓存的数据，避免AutoInsertRow()自动写入而无法确定哪些行已写入
+			if table.Full(data) {
+				if err := flush(tName); err != nil {
+					return err
+				}
+			}
+			table.AutoInsertRow(data)
+			pending[tName] = append(pending[tName], i)
+		}
+		var err error
+		for tName := range mysqls {
+			if e := flush(tName); e != nil && err == nil {
+				err = e
+			}
 		}
-		for _, tab := range mysqls {
-			util.CheckErr(tab.FlushInsert())
+		return err
+	}
+}
+
+// 按Schema中的字段类型确定Mysql字段类型，未声明类型时为MEDIUMTEXT
+func mysqlColumnType(typ string) string {
+	switch typ {
+	case spider.TYPE_INT:
+		return `BIGINT`
+	case spider.TYPE_FLOAT:
+		return `DOUBLE`
+	case spider.TYPE_BOOL:
+		return `BOOL`
+	case spider.TYPE_TIME:
+		return `DATETIME`
+	}
+	return `MEDIUMTEXT`
+}
+
+// 声明了类型的字段保留原值（nil即NULL），其余转为字符串
+func mysqlValue(v interface{}, typ string) interface{} {
+	switch typ {
+	case spider.TYPE_INT, spider.TYPE_FLOAT, spider.TYPE_BOOL:
+		return v
+	case spider.TYPE_TIME:
+		if v == nil {
+			return nil
 		}
-		mysqls = nil
-		return nil
 	}
+	return fieldString(v)
 }
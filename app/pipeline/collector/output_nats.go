@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/common/nats"
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+/************************ NATS 输出 ***************************/
+func init() {
+	var (
+		subjectTmpl, fileSubjectTmpl *template.Template
+		tmplErr                      error
+		tmplOnce                     sync.Once
+	)
+
+	var parseTemplates = func() error {
+		tmplOnce.Do(func() {
+			if subjectTmpl, tmplErr = template.New("subject").Parse(config.NATS_SUBJECT); tmplErr != nil {
+				tmplErr = fmt.Errorf("nats::subject 模板无效: %v", tmplErr)
+				return
+			}
+			if config.NATS_FILE_SUBJECT != "" {
+				if fileSubjectTmpl, tmplErr = template.New("filesubject").Parse(config.NATS_FILE_SUBJECT); tmplErr != nil {
+					tmplErr = fmt.Errorf("nats::filesubject 模板无效: %v", tmplErr)
+				}
+			}
+		})
+		return tmplErr
+	}
+
+	DataOutput["nats"] = func(self *Collector) error {
+		if err := parseTemplates(); err != nil {
+			return err
+		}
+		if nats.Error() != nil {
+			nats.Refresh()
+			if nats.Error() != nil { // try again
+				return fmt.Errorf("NATS连接失败: %v", nats.Error())
+			}
+		}
+		var (
+			subjects  = make(map[string]string)
+			unflushed []int // 已发布但尚未确认被服务端接收的结果
+		)
+		for i, datacell := range self.dataDocker {
+			ruleName := datacell["RuleName"].(string)
+			subject, ok := subjects[ruleName]
+			if !ok {
+				var err error
+				if subject, err = natsSubject(subjectTmpl, self, ruleName, self.subNamespace(datacell)); err != nil {
+					return err
+				}
+				subjects[ruleName] = subject
+			}
+			msg := map[string]interface{}{"rule": ruleName}
+			vd := datacell["Data"].(map[string]interface{})
+			for _, title := range self.MustGetRule(ruleName).GetOutputFields() {
+				msg[title] = vd[title]
+			}
+			if self.Spider.OutDefaultField() {
+				msg["url"] = datacell["Url"].(string)
+				msg["parent_url"] = datacell["ParentUrl"].(string)
+				msg["download_time"] = datacell["DownloadTime"].(string)
+			}
+			b, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if err := nats.Publish(subject, b); err != nil {
+				return fmt.Errorf("发布至 %s 失败: %v", subject, err)
+			}
+			// JetStream逐条确认，否则须待Flush()确认
+			if config.NATS_JETSTREAM {
+				self.setWritten(i)
+			} else {
+				unflushed = append(unflushed, i)
+			}
+		}
+		if err := nats.Flush(); err != nil {
+			return err
+		}
+		for _, i := range unflushed {
+			self.setWritten(i)
+		}
+		return nil
+	}
+
+	// 配置了nats::filesubject时，文件结果另以JSON消息发布，内容为base64编码
+	FileOutput["nats"] = func(self *Collector, file data.FileCell) error {
+		if err := parseTemplates(); err != nil || fileSubjectTmpl == nil {
+			return err
+		}
+		ruleName := file["RuleName"].(string)
+		subject, err := natsSubject(fileSubjectTmpl, self, ruleName, "")
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(map[string]interface{}{
+			"rule":  ruleName,
+			"name":  file["Name"].(string),
+			"bytes": file["Bytes"].([]byte), // 编码为base64
+		})
+		if err != nil {
+			return err
+		}
+		if err := nats.Publish(subject, b); err != nil {
+			return fmt.Errorf("发布至 %s 失败: %v", subject, err)
+		}
+		return nats.Flush()
+	}
+}
+
+// 按模板生成发布主题，模板中可用Spider、Keyin、Namespace、SubNamespace、Rule，
+// 其中的空白及NATS保留字符（"."、"*"、">"）替换为"_"
+func natsSubject(tmpl *template.Template, self *Collector, ruleName, subNamespace string) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]string{
+		"Spider":       natsToken(self.Spider.GetName()),
+		"Keyin":        natsToken(self.Spider.GetKeyin()),
+		"Namespace":    natsToken(util.FileNameReplace(self.namespace())),
+		"SubNamespace": natsToken(util.FileNameReplace(subNamespace)),
+		"Rule":         natsToken(ruleName),
+	})
+	if err != nil {
+		return "", err
+	}
+	subject := strings.Trim(buf.String(), ".")
+	if subject == "" {
+		return "", fmt.Errorf("NATS发布主题为空")
+	}
+	return subject, nil
+}
+
+var natsTokenReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return natsTokenReplacer.Replace(s)
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/common/xlsx"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 含嵌套字段的结果，输出至临时的文本目录
+func testNestedOutput(t *testing.T, outType string) (c *Collector, dir string) {
+	dir, err := ioutil.TempDir("", outType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textDir, gz := config.TEXT_DIR, config.JSONL_GZIP
+	config.TEXT_DIR, config.JSONL_GZIP = dir, false
+	t.Cleanup(func() {
+		config.TEXT_DIR, config.JSONL_GZIP = textDir, gz
+		os.RemoveAll(dir)
+	})
+
+	c = testCollector(outType)
+	c.Spider.RuleTree.Trunk["list"].ItemFields = []string{"title", "tags", "meta", "at"}
+	c.dataDocker = []data.DataCell{data.GetDataCell("list", map[string]interface{}{
+		"title": "a&b",
+		"tags":  []string{"<x>", "y"},
+		"meta":  map[string]interface{}{"n": 1, "s": "v"},
+		"at":    time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local),
+	}, "http://example.com/a", "", "2006-01-02 15:04:05")}
+	if err := DataOutput[outType](c); err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+// 返回dir下唯一一个扩展名为ext的文件
+func outputFile(t *testing.T, dir, ext string) string {
+	var names []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ext) {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if len(names) != 1 {
+		t.Fatalf("%s files = %v, want one", ext, names)
+	}
+	return names[0]
+}
+
+var nestedRow = []string{"a&b", `["<x>","y"]`, `{"n":1,"s":"v"}`, "2020-01-02 03:04:05"}
+
+func TestCsvNestedFields(t *testing.T) {
+	_, dir := testNestedOutput(t, "csv")
+	b, err := ioutil.ReadFile(outputFile(t, dir, ".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF")))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %v", records)
+	}
+	if got := records[1][:len(nestedRow)]; !reflect.DeepEqual(got, nestedRow) {
+		t.Errorf("row = %q, want %q", got, nestedRow)
+	}
+}
+
+func TestExcelNestedFields(t *testing.T) {
+	_, dir := testNestedOutput(t, "excel")
+	file, err := xlsx.OpenFile(outputFile(t, dir, ".xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Sheets) != 1 || len(file.Sheets[0].Rows) != 2 {
+		t.Fatalf("sheets = %v", file.Sheets)
+	}
+	var got []string
+	for _, cell := range file.Sheets[0].Rows[1].Cells[:len(nestedRow)] {
+		got = append(got, cell.String())
+	}
+	if !reflect.DeepEqual(got, nestedRow) {
+		t.Errorf("row = %q, want %q", got, nestedRow)
+	}
+}
+
+// JSON Lines保留字段的原生结构，而非编码后的文本
+func TestJsonlNestedFields(t *testing.T) {
+	c, dir := testNestedOutput(t, "jsonl")
+	if err := DataOutputClose["jsonl"](c); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(outputFile(t, dir, ".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(`\u003c`)) || bytes.Contains(b, []byte(`\u0026`)) {
+		t.Errorf("HTML characters escaped: %s", b)
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal(b, &line); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title": "a&b",
+		"tags":  []interface{}{"<x>", "y"},
+		"meta":  map[string]interface{}{"n": 1.0, "s": "v"},
+		"at":    time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local).Format(time.RFC3339),
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(line[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, line[k], v)
+		}
+	}
+}
+
+// 仅输出Rule.OutputFields中的字段并按其顺序排列，默认字段仍在最后
+func TestOutputFieldsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fields")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	textDir := config.TEXT_DIR
+	config.TEXT_DIR = dir
+	defer func() { config.TEXT_DIR = textDir }()
+
+	c := testCollector("csv")
+	rule := c.Spider.RuleTree.Trunk["list"]
+	rule.ItemFields = []string{"a", "b", "c"}
+	rule.OutputFields = []string{"c", "a"}
+	c.dataDocker = []data.DataCell{data.GetDataCell("list", map[string]interface{}{
+		"a": "1", "b": "2", "c": "3",
+	}, "http://example.com/a", "", "2006-01-02 15:04:05")}
+	if err := DataOutput["csv"](c); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(outputFile(t, dir, ".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF")))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"c", "a", "当前链接", "上级链接", "下载时间"},
+		{"3", "1", "http://example.com/a", "", "2006-01-02 15:04:05"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+	if copied := c.Spider.Copy().RuleTree.Trunk["list"].GetOutputFields(); !reflect.DeepEqual(copied, rule.OutputFields) {
+		t.Errorf("copied OutputFields = %v", copied)
+	}
+}
@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 解析TYPE_TIME字段时依次尝试的时间格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"2006年01月02日 15:04:05",
+	"2006年01月02日",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// 按规则的Schema转换结果的字段值，转换失败时记录日志并置为nil
+func (self *Collector) coerce(dataCell data.DataCell) {
+	rule, ok := self.Spider.GetRule(dataCell["RuleName"].(string))
+	if !ok || len(rule.Schema) == 0 {
+		return
+	}
+	vd, ok := dataCell["Data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for field, typ := range rule.Schema {
+		v, ok := vd[field]
+		if !ok || v == nil {
+			continue
+		}
+		cv, err := coerceValue(v, typ)
+		if err != nil {
+			logs.Log.Error(" *     [%s] 规则 %s 的字段 %s 无法转换为 %s: %v\n", self.Spider.GetName(), dataCell["RuleName"], field, typ, err)
+		}
+		vd[field] = cv
+	}
+}
+
+func coerceValue(v interface{}, typ string) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if s == "" && typ != spider.TYPE_STRING {
+			return nil, nil
+		}
+		v = s
+	}
+	switch typ {
+	case spider.TYPE_INT:
+		switch x := v.(type) {
+		case string:
+			s := strings.Replace(x, ",", "", -1)
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f != math.Trunc(f) {
+				return nil, fmt.Errorf("%q", x)
+			}
+			return int64(f), nil
+		case float64:
+			if x != math.Trunc(x) {
+				return nil, fmt.Errorf("%v", x)
+			}
+			return int64(x), nil
+		case float32:
+			return coerceValue(float64(x), typ)
+		case bool:
+			if x {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		if i, ok := toInt64(v); ok {
+			return i, nil
+		}
+	case spider.TYPE_FLOAT:
+		switch x := v.(type) {
+		case string:
+			f, err := strconv.ParseFloat(strings.Replace(x, ",", "", -1), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q", x)
+			}
+			return f, nil
+		case float64:
+			return x, nil
+		case float32:
+			return float64(x), nil
+		}
+		if i, ok := toInt64(v); ok {
+			return float64(i), nil
+		}
+	case spider.TYPE_BOOL:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			switch strings.ToLower(x) {
+			case "1", "t", "true", "y", "yes", "on", "是":
+				return true, nil
+			case "0", "f", "false", "n", "no", "off", "否":
+				return false, nil
+			}
+			return nil, fmt.Errorf("%q", x)
+		}
+		if i, ok := toInt64(v); ok {
+			return i != 0, nil
+		}
+	case spider.TYPE_STRING:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return util.JsonString(v), nil
+	case spider.TYPE_TIME:
+		switch x := v.(type) {
+		case time.Time:
+			return x, nil
+		case string:
+			for _, layout := range timeLayouts {
+				if t, err := time.ParseInLocation(layout, x, time.Local); err == nil {
+					return t, nil
+				}
+			}
+			if i, err := strconv.ParseInt(x, 10, 64); err == nil {
+				return unixTime(i), nil
+			}
+			return nil, fmt.Errorf("%q", x)
+		}
+		if i, ok := toInt64(v); ok {
+			return unixTime(i), nil
+		}
+	default:
+		return v, fmt.Errorf("未知的字段类型")
+	}
+	return nil, fmt.Errorf("不支持的值类型 %T", v)
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint:
+		return int64(x), true
+	case uint8:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case uint64:
+		return int64(x), true
+	}
+	return 0, false
+}
+
+// 时间戳大于1e12时视为毫秒
+func unixTime(i int64) time.Time {
+	if i > 1e12 || i < -1e12 {
+		return time.Unix(0, i*int64(time.Millisecond))
+	}
+	return time.Unix(i, 0)
+}
+
+// 将字段值转为文本输出时的字符串形式，供CSV、Excel、SQL等按行输出的方式使用：
+// 嵌套的map、slice、struct等编码为JSON文本（不转义<、>、&），而非"map[a:1]"形式；
+// MongoDB等文档型输出不经此转换，保留原生结构
+func fieldString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
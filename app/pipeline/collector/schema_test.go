@@ -0,0 +1,32 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFieldString(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, ""},
+		{"a<b>&c", "a<b>&c"},
+		{int64(3), "3"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{[]byte("raw"), "raw"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local), "2020-01-02 03:04:05"},
+		{map[string]interface{}{"b": 2, "a": "x&y"}, `{"a":"x&y","b":2}`},
+		{[]string{"<p>", "q"}, `["<p>","q"]`},
+		{[]interface{}{map[string]int{"n": 1}}, `[{"n":1}]`},
+		{struct {
+			Name string `json:"name"`
+		}{"z"}, `{"name":"z"}`},
+	}
+	for _, c := range cases {
+		if got := fieldString(c.v); got != c.want {
+			t.Errorf("fieldString(%#v) = %q, want %q", c.v, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/app/aid/seen"
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 启用seen::enable且有规则设置了Rule.ItemKey时，读取跨任务的结果去重记录
+func (self *Collector) openSeen() {
+	if !config.SEEN_ENABLE {
+		return
+	}
+	var keyed bool
+	for _, rule := range self.Spider.RuleTree.Trunk {
+		if len(rule.ItemKey) > 0 {
+			keyed = true
+			break
+		}
+	}
+	if !keyed {
+		return
+	}
+	set, err := seen.Open(self.Spider.GetName(), self.Spider.GetSubName())
+	if err != nil {
+		logs.Log.Error(" *     [结果去重][%s] 读取记录失败，本次不去重: %v\n", self.Spider.GetName(), err)
+		return
+	}
+	set.SetTargets(len(cache.OutTypes()))
+	self.seen = set
+}
+
+// 经输出管道传递的结果去重键，输出后由doneSeen()确认并移除
+const seenKey = "\x00seen"
+
+// 结果是否已在此前输出过，按其规则的ItemKey字段识别，并发安全；
+// 未输出过的结果记下其去重键，待输出后确认
+func (self *Collector) seenBefore(cell data.DataCell) bool {
+	if self.seen == nil {
+		return false
+	}
+	ruleName, _ := cell["RuleName"].(string)
+	rule, ok := self.Spider.GetRule(ruleName)
+	if !ok || len(rule.ItemKey) == 0 {
+		return false
+	}
+	vd, _ := cell["Data"].(map[string]interface{})
+	var key strings.Builder
+	key.WriteString(ruleName)
+	for _, field := range rule.ItemKey {
+		key.WriteByte(0)
+		key.WriteString(fieldString(vd[field]))
+	}
+	if self.seen.Seen(key.String()) {
+		return true
+	}
+	cell[seenKey] = key.String()
+	return false
+}
+
+// 确认结果的输出情况，仅输出成功的结果计入去重记录
+func (self *Collector) doneSeen(cell data.DataCell, ok bool) {
+	key, _ := cell[seenKey].(string)
+	if key == "" || self.seen == nil {
+		return
+	}
+	delete(cell, seenKey)
+	self.seen.Done(key, ok)
+}
+
+// 保存结果去重记录
+func (self *Collector) saveSeen() {
+	if self.seen == nil {
+		return
+	}
+	if n := self.seen.Skipped(); n > 0 {
+		logs.Log.Informational(" *     [结果去重][%s] 已跳过此前输出过的结果 %v 条\n", self.Spider.GetName(), n)
+	}
+	if err := self.seen.Save(); err != nil {
+		logs.Log.Error(" *     [结果去重][%s] 保存记录失败: %v\n", self.Spider.GetName(), err)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"sort"
 
 	"github.com/henrylee2cn/pholcus/app/pipeline/collector"
+	"github.com/henrylee2cn/pholcus/common/clickhouse"
 	"github.com/henrylee2cn/pholcus/common/kafka"
 	"github.com/henrylee2cn/pholcus/common/mgo"
 	"github.com/henrylee2cn/pholcus/common/mysql"
+	"github.com/henrylee2cn/pholcus/common/nats"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 )
 
@@ -20,12 +22,18 @@ func init() {
 
 // 刷新输出方式的状态
 func RefreshOutput() {
-	switch cache.Task.OutType {
-	case "mgo":
-		mgo.Refresh()
-	case "mysql":
-		mysql.Refresh()
-	case "kafka":
-		kafka.Refresh()
+	for _, out := range cache.OutTypes() {
+		switch out {
+		case "mgo":
+			mgo.Refresh()
+		case "mysql":
+			mysql.Refresh()
+		case "kafka":
+			kafka.Refresh()
+		case "clickhouse":
+			clickhouse.Refresh()
+		case "nats":
+			nats.Refresh()
+		}
 	}
 }
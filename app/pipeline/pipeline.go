@@ -13,6 +13,7 @@ type Pipeline interface {
 	Stop()                           //停止
 	CollectData(data.DataCell) error //收集数据单元
 	CollectFile(data.FileCell) error //收集文件
+	Flush() error                    //立即输出已收集的数据
 }
 
 func New(sp *spider.Spider) Pipeline {
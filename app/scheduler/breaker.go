@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 主机熔断器：连续失败达到breaker::threshold次时熔断（打开），
+// 此后出队的该主机请求暂存而不派发；冷却breaker::cooldown后半开，放出一个探测请求，
+// 探测成功则闭合并将暂存的请求放回队列，失败则再次熔断。
+// 探测请求在一个冷却时长内没有结果（如处理中崩溃）时，再放出下一个探测请求。
+// 主机始终未恢复时，暂存的请求每个冷却时长探测一个，任务将持续至其全部完成或被终止。
+type circuit struct {
+	failures  int                // 连续失败次数
+	openUntil time.Time          // 熔断（或等待探测结果）至该时刻，零值表示闭合
+	probing   bool               // 已放出探测请求
+	parked    []*request.Request // 熔断期间暂存的请求
+	parkedAt  []time.Time        // 与parked一一对应的入队时间
+}
+
+func breakerEnabled() bool {
+	return config.BREAKER_THRESHOLD > 0
+}
+
+// 出队的请求所属主机已熔断时暂存该请求并返回true；冷却已结束时将其作为探测请求放行
+func (self *Matrix) park(req *request.Request, at time.Time) bool {
+	if !breakerEnabled() {
+		return false
+	}
+	host := requestHost(req)
+	c := self.circuits[host]
+	if c == nil || c.openUntil.IsZero() {
+		return false
+	}
+	if time.Now().After(c.openUntil) {
+		self.halfOpen(host, c, req)
+		return false
+	}
+	c.parked = append(c.parked, req)
+	c.parkedAt = append(c.parkedAt, at)
+	return true
+}
+
+// 从冷却已结束的熔断主机的暂存请求中取出一个作为探测请求，不存在时返回nil
+func (self *Matrix) probe() *request.Request {
+	if !breakerEnabled() {
+		return nil
+	}
+	now := time.Now()
+	for host, c := range self.circuits {
+		if c.openUntil.IsZero() || now.Before(c.openUntil) || len(c.parked) == 0 {
+			continue
+		}
+		req := c.parked[0]
+		c.parked, c.parkedAt = c.parked[1:], c.parkedAt[1:]
+		self.halfOpen(host, c, req)
+		return req
+	}
+	return nil
+}
+
+// 半开：放出探测请求，一个冷却时长内等待其结果
+func (self *Matrix) halfOpen(host string, c *circuit, req *request.Request) {
+	c.probing = true
+	c.openUntil = time.Now().Add(time.Duration(config.BREAKER_COOLDOWN) * time.Second)
+	logs.Log.Informational(" *     Circuit [%s][%s]: 半开，发送探测请求 %v\n", self.spiderName, host, req.GetUrl())
+}
+
+// 反馈请求所属主机的访问结果，ok为false表示主机不可用（连接失败或5xx响应），并发安全
+func (self *Matrix) HostFeedback(req *request.Request, ok bool) {
+	if !breakerEnabled() {
+		return
+	}
+	self.Lock()
+	defer self.Unlock()
+	host := requestHost(req)
+	c := self.circuits[host]
+	if ok {
+		if c == nil {
+			return
+		}
+		if !c.openUntil.IsZero() {
+			logs.Log.Informational(" *     Circuit [%s][%s]: 已恢复，闭合并放回暂存的请求 %v 条\n", self.spiderName, host, len(c.parked))
+			for i, req := range c.parked {
+				self.enqueue(req, c.parkedAt[i])
+			}
+		}
+		delete(self.circuits, host)
+		return
+	}
+	if c == nil {
+		if self.circuits == nil {
+			self.circuits = make(map[string]*circuit)
+		}
+		c = new(circuit)
+		self.circuits[host] = c
+	}
+	c.failures++
+	cooldown := time.Duration(config.BREAKER_COOLDOWN) * time.Second
+	switch {
+	case c.probing:
+		c.probing = false
+		c.openUntil = time.Now().Add(cooldown)
+		logs.Log.Warning(" *     Circuit [%s][%s]: 探测失败，再次熔断 %v\n", self.spiderName, host, cooldown)
+	case c.openUntil.IsZero() && c.failures >= config.BREAKER_THRESHOLD:
+		c.openUntil = time.Now().Add(cooldown)
+		logs.Log.Warning(" *     Circuit [%s][%s]: 连续失败 %v 次，熔断 %v\n", self.spiderName, host, c.failures, cooldown)
+	}
+}
+
+// 熔断期间暂存的请求数
+func (self *Matrix) parkedLen() int {
+	var n int
+	for _, c := range self.circuits {
+		n += len(c.parked)
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+func hostRequest(url string) *request.Request {
+	req := &request.Request{Url: url, Rule: "list"}
+	req.Prepare()
+	return req
+}
+
+// 结束主机的冷却期
+func endCooldown(m *Matrix, host string) {
+	m.Lock()
+	m.circuits[host].openUntil = time.Now().Add(-time.Millisecond)
+	m.Unlock()
+}
+
+func TestBreakerParkAndProbe(t *testing.T) {
+	threshold, cooldown := config.BREAKER_THRESHOLD, config.BREAKER_COOLDOWN
+	config.BREAKER_THRESHOLD, config.BREAKER_COOLDOWN = 2, 60
+	defer func() { config.BREAKER_THRESHOLD, config.BREAKER_COOLDOWN = threshold, cooldown }()
+	m := testMatrix(t, 1, 0, "spill")
+
+	pull := func(want string) {
+		t.Helper()
+		var got string
+		if req := m.Pull(); req != nil {
+			got = req.GetUrl()
+		}
+		if got != want {
+			t.Fatalf("Pull: %q, want %q", got, want)
+		}
+	}
+
+	m.HostFeedback(hostRequest("http://a.com/0"), false)
+	for _, url := range []string{"http://a.com/1", "http://a.com/2", "http://a.com/3", "http://b.com/1"} {
+		m.Push(hostRequest(url))
+	}
+	// 未达到阈值时照常派发
+	pull("http://a.com/1")
+	m.HostFeedback(hostRequest("http://a.com/1"), false)
+
+	// 熔断后该主机的请求暂存，其他主机不受影响
+	pull("http://b.com/1")
+	pull("")
+	stats := m.Stats()
+	if stats.Parked != 2 || stats.Total != 2 || stats.OpenHosts["a.com"].IsZero() || m.Len() != 2 {
+		t.Fatalf("stats = %+v, Len = %v", stats, m.Len())
+	}
+
+	// 冷却结束后放出一个探测请求，等待其结果期间不再放出
+	endCooldown(m, "a.com")
+	pull("http://a.com/2")
+	pull("")
+	m.HostFeedback(hostRequest("http://a.com/2"), false)
+	if c := m.circuits["a.com"]; c.probing || !c.openUntil.After(time.Now()) {
+		t.Fatalf("探测失败后未再次熔断: %+v", c)
+	}
+
+	// 探测成功后闭合，暂存的请求放回队列
+	endCooldown(m, "a.com")
+	pull("http://a.com/3")
+	m.Push(hostRequest("http://a.com/4"))
+	pull("")
+	m.HostFeedback(hostRequest("http://a.com/3"), true)
+	if len(m.circuits) != 0 {
+		t.Fatalf("circuits = %v", m.circuits)
+	}
+	pull("http://a.com/4")
+	pull("")
+}
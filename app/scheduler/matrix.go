@@ -8,6 +8,8 @@ import (
 
 	"github.com/henrylee2cn/pholcus/app/aid/history"
 	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/common/bloom"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
@@ -15,32 +17,55 @@ import (
 
 // 一个Spider实例的请求矩阵
 type Matrix struct {
-	maxPage         int64                       // 最大采集页数，以负数形式表示
-	resCount        int32                       // 资源使用情况计数
-	spiderName      string                      // 所属Spider
-	reqs            map[int][]*request.Request  // [优先级]队列，优先级默认为0
-	priorities      []int                       // 优先级顺序，从低到高
-	history         history.Historier           // 历史记录
-	tempHistory     map[string]bool             // 临时记录 [reqUnique(url+method)]true
-	failures        map[string]*request.Request // 历史及本次失败请求
-	tempHistoryLock sync.RWMutex
-	failureLock     sync.Mutex
+	maxPage       int64                       // 最大采集页数，以负数形式表示
+	resCount      int32                       // 资源使用情况计数
+	spiderName    string                      // 所属Spider
+	reqs          map[int][]*request.Request  // [优先级]队列，优先级默认为0
+	priorities    []int                       // 优先级顺序，从低到高
+	enqueued      map[int][]time.Time         // 与reqs一一对应的入队时间
+	hostCount     map[string]int              // 内存队列中[主机]请求数
+	ruleCount     map[string]int              // 内存队列中[规则]请求数
+	history       history.Historier           // 历史记录
+	visited       VisitedStore                // 本次任务的请求去重存储，见SetVisitedStore()
+	failures      map[string]*request.Request // 历史及本次失败请求
+	spill         *spillQueue                 // 内存队列已满时的磁盘队列，按需创建
+	reason        string                      // 结束原因，见cache.REASON_QUEUE_EMPTY等
+	finished      int32                       // 是否已提前结束，见Finish()
+	groups        map[string]int              // [请求组ID]未完成的请求数，见AddGroup()
+	expired       int                         // 因在队列中等待过久而丢弃的请求数，见queue::maxage
+	expiredReqs   []*request.Request          // 已丢弃且属于请求组的请求，见TakeExpired()
+	circuits      map[string]*circuit         // [主机]熔断器，见HostFeedback()
+	weights       map[string]int              // [规则]派发权重，见SetRuleWeights()
+	wrr           map[string]int              // [规则]平滑加权轮询的当前值
+	priorityRules map[int]map[string]int      // 内存队列中[优先级][规则]请求数
+	stalled       int32                       // 阻塞模式下是否已因无法等到队列空位而溢出过，仅用于提示
+	lost          int                         // 因溢出文件损坏而无法读回的请求数
+	failureLock   sync.Mutex
 	sync.Mutex
 }
 
-func newMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
+func newMatrix(spiderName, spiderSubName string, maxPage int64, bloomCount uint64, bloomFP float64) *Matrix {
 	matrix := &Matrix{
-		spiderName:  spiderName,
-		maxPage:     maxPage,
-		reqs:        make(map[int][]*request.Request),
-		priorities:  []int{},
-		history:     history.New(spiderName, spiderSubName),
-		tempHistory: make(map[string]bool),
-		failures:    make(map[string]*request.Request),
+		spiderName:    spiderName,
+		maxPage:       maxPage,
+		reqs:          make(map[int][]*request.Request),
+		priorities:    []int{},
+		enqueued:      make(map[int][]time.Time),
+		hostCount:     make(map[string]int),
+		ruleCount:     make(map[string]int),
+		priorityRules: make(map[int]map[string]int),
+		history:       history.New(spiderName, spiderSubName),
+		visited:       newMemVisited(),
+		failures:      make(map[string]*request.Request),
+	}
+	if bloomCount > 0 {
+		filter := bloom.New(bloomCount, bloomFP)
+		matrix.visited = bloomVisited{filter}
+		logs.Log.Informational(" *     [%s] 使用布隆过滤器去重，预估请求数 %v，占用内存 %v B\n", spiderName, bloomCount, filter.Size())
 	}
 	if cache.Task.Mode != status.SERVER {
-		matrix.history.ReadSuccess(cache.Task.OutType, cache.Task.SuccessInherit)
-		matrix.history.ReadFailure(cache.Task.OutType, cache.Task.FailureInherit)
+		matrix.history.ReadSuccess(cache.OutTypes()[0], cache.Task.SuccessInherit)
+		matrix.history.ReadFailure(cache.OutTypes()[0], cache.Task.FailureInherit)
 		matrix.setFailures(matrix.history.PullFailure())
 	}
 	return matrix
@@ -48,6 +73,17 @@ func newMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
 
 // 添加请求到队列，并发安全
 func (self *Matrix) Push(req *request.Request) {
+	self.push(req, true)
+}
+
+// dedup为false时跳过去重检查，用于重新下载失败请求
+func (self *Matrix) push(req *request.Request, dedup bool) {
+	// 队列已满时阻塞添加请求的协程（背压），重新下载失败请求时不阻塞，无法等到空位时改为溢出至磁盘
+	overflow := spillOverflow()
+	if dedup && !overflow && config.QUEUE_MAX_SIZE > 0 {
+		overflow = !self.waitRoom()
+	}
+
 	// 禁止并发，降低请求积存量
 	self.Lock()
 	defer self.Unlock()
@@ -57,7 +93,7 @@ func (self *Matrix) Push(req *request.Request) {
 	}
 
 	// 达到请求上限，停止该规则运行
-	if self.maxPage >= 0 {
+	if self.maxPage >= 0 || atomic.LoadInt32(&self.finished) == 1 {
 		return
 	}
 
@@ -82,7 +118,7 @@ func (self *Matrix) Push(req *request.Request) {
 	}
 
 	// 不可重复下载的req
-	if !req.IsReloadable() {
+	if !req.IsReloadable() && dedup {
 		// 已存在成功记录时退出
 		if self.hasHistory(req.Unique()) {
 			return
@@ -91,6 +127,47 @@ func (self *Matrix) Push(req *request.Request) {
 		self.insertTempHistory(req.Unique())
 	}
 
+	// 内存队列已满时溢出至磁盘
+	if overflow && self.memLen() >= config.QUEUE_MAX_SIZE && self.spillPush(req, time.Now()) {
+		self.addGroup(req.GetGroup())
+		atomic.AddInt64(&self.maxPage, 1)
+		return
+	}
+
+	self.enqueue(req, time.Now())
+	self.addGroup(req.GetGroup())
+
+	// 大致限制加入队列的请求量，并发情况下应该会比maxPage多
+	atomic.AddInt64(&self.maxPage, 1)
+}
+
+// 等待请求队列腾出空间，返回false表示无法等到。
+// 添加请求的协程通常正占用并发名额，进行中的请求均在此等待时队列无人消费，
+// 继续等待将导致死锁，此时返回false由调用者溢出至磁盘；
+// 不占用并发名额的协程（如入口规则）同样计入等待数，可能因此提前溢出
+func (self *Matrix) waitRoom() bool {
+	if self.Len() < config.QUEUE_MAX_SIZE {
+		return true
+	}
+	atomic.AddInt32(&sdl.blocked, 1)
+	defer atomic.AddInt32(&sdl.blocked, -1)
+	for self.Len() >= config.QUEUE_MAX_SIZE {
+		if sdl.checkStatus(status.STOP) {
+			return true
+		}
+		if len(sdl.count) <= int(atomic.LoadInt32(&sdl.blocked)) {
+			if atomic.CompareAndSwapInt32(&self.stalled, 0, 1) {
+				logs.Log.Warning(" *     [%s] 请求队列已满（%v）且进行中的请求均在等待入队，改为溢出至磁盘\n", self.spiderName, config.QUEUE_MAX_SIZE)
+			}
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+// 添加请求到内存中对应优先级的队列，at为入队时间
+func (self *Matrix) enqueue(req *request.Request, at time.Time) {
 	var priority = req.GetPriority()
 
 	// 初始化该蜘蛛下该优先级队列
@@ -102,39 +179,113 @@ func (self *Matrix) Push(req *request.Request) {
 
 	// 添加请求到队列
 	self.reqs[priority] = append(self.reqs[priority], req)
+	self.enqueued[priority] = append(self.enqueued[priority], at)
+	self.hostCount[requestHost(req)]++
+	self.ruleCount[req.GetRuleName()]++
+	self.countPriorityRule(priority, req.GetRuleName(), 1)
+}
 
-	// 大致限制加入队列的请求量，并发情况下应该会比maxPage多
-	atomic.AddInt64(&self.maxPage, 1)
+// 从内存中对应优先级的队列移除第i个请求并更新统计，i不为0时需移动其后的全部请求
+func (self *Matrix) dequeue(priority, i int) *request.Request {
+	reqs, enqueued := self.reqs[priority], self.enqueued[priority]
+	req := reqs[i]
+	if i == 0 {
+		self.reqs[priority] = reqs[1:]
+		self.enqueued[priority] = enqueued[1:]
+	} else {
+		self.reqs[priority] = append(reqs[:i], reqs[i+1:]...)
+		self.enqueued[priority] = append(enqueued[:i], enqueued[i+1:]...)
+	}
+	decCount(self.hostCount, requestHost(req))
+	decCount(self.ruleCount, req.GetRuleName())
+	self.countPriorityRule(priority, req.GetRuleName(), -1)
+	return req
 }
 
 // 从队列取出请求，不存在时返回nil，并发安全
 func (self *Matrix) Pull() (req *request.Request) {
 	self.Lock()
 	defer self.Unlock()
-	if !sdl.checkStatus(status.RUN) {
+	if !sdl.checkStatus(status.RUN) || sdl.isDraining() || atomic.LoadInt32(&self.finished) == 1 {
 		return
 	}
-	// 按优先级从高到低取出请求
-	for i := len(self.reqs) - 1; i >= 0; i-- {
+	maxAge := time.Duration(config.QUEUE_MAX_AGE) * time.Second
+	for {
+		// 内存队列为空时读回溢出至磁盘的请求
+		if self.spill != nil && self.memLen() == 0 {
+			self.spillRefill()
+		}
+		// 冷却结束的熔断主机优先放出探测请求
+		if req = self.probe(); req == nil {
+			var at time.Time
+			if req, at = self.dequeueFirst(); req == nil {
+				return
+			}
+			// 丢弃在队列中等待过久的请求
+			if wait := time.Since(at); maxAge > 0 && wait > maxAge {
+				self.expire(req, wait)
+				continue
+			}
+			// 暂存已熔断主机的请求
+			if self.park(req, at) {
+				continue
+			}
+		}
+		if sdl.useProxy {
+			req.SetProxy(sdl.proxy.GetOne(req.GetUrl()))
+		} else {
+			req.SetProxy("")
+		}
+		return
+	}
+}
+
+// 按优先级从高到低取出队首（启用规则权重时按权重选出）请求及其入队时间，内存队列为空时返回nil
+func (self *Matrix) dequeueFirst() (*request.Request, time.Time) {
+	for i := len(self.priorities) - 1; i >= 0; i-- {
 		idx := self.priorities[i]
 		if len(self.reqs[idx]) > 0 {
-			req = self.reqs[idx][0]
-			self.reqs[idx] = self.reqs[idx][1:]
-			if sdl.useProxy {
-				req.SetProxy(sdl.proxy.GetOne(req.GetUrl()))
-			} else {
-				req.SetProxy("")
-			}
-			return
+			pos := self.nextIndex(idx)
+			at := self.enqueued[idx][pos]
+			return self.dequeue(idx, pos), at
 		}
 	}
-	return
+	return nil, time.Time{}
+}
+
+// 记录因等待过久而丢弃的请求
+func (self *Matrix) expire(req *request.Request, wait time.Duration) {
+	self.expired++
+	if req.GetGroup() != "" {
+		self.expiredReqs = append(self.expiredReqs, req)
+	}
+	logs.Log.Warning(" *     Expire [%s][%v]: 已在队列中等待 %v，超过 %v 秒\n", self.spiderName, req.GetUrl(), wait, config.QUEUE_MAX_AGE)
+}
+
+// 取出自上次调用以来因等待过久而丢弃的、属于请求组的请求，由调用者结束其请求组计数，并发安全
+func (self *Matrix) TakeExpired() []*request.Request {
+	self.Lock()
+	defer self.Unlock()
+	reqs := self.expiredReqs
+	self.expiredReqs = nil
+	return reqs
 }
 
 func (self *Matrix) Use() {
 	defer func() {
 		recover()
 	}()
+	// 逐步增加并发量期间，等待进行中的请求数低于当前上限
+	if atomic.LoadInt32(&sdl.limit) > 0 {
+		sdl.rampLock.Lock()
+		defer sdl.rampLock.Unlock()
+		for limit := atomic.LoadInt32(&sdl.limit); limit > 0 && len(sdl.count) >= int(limit); limit = atomic.LoadInt32(&sdl.limit) {
+			if sdl.checkStatus(status.STOP) {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
 	sdl.count <- true
 	atomic.AddInt32(&self.resCount, 1)
 }
@@ -147,12 +298,17 @@ func (self *Matrix) Free() {
 // 返回是否作为新的失败请求被添加至队列尾部
 func (self *Matrix) DoHistory(req *request.Request, ok bool) bool {
 	if !req.IsReloadable() {
-		self.tempHistoryLock.Lock()
-		delete(self.tempHistory, req.Unique())
-		self.tempHistoryLock.Unlock()
-
-		if ok {
+		// 非默认去重存储（如布隆过滤器）下仅在需要继承时保存成功记录，避免内存无限增长
+		_, mem := self.visited.(*memVisited)
+		recorded := ok && (mem || cache.Task.SuccessInherit)
+		if recorded {
 			self.history.UpsertSuccess(req.Unique())
+		}
+		// 未保存成功记录时保留指纹，以免再次添加
+		if remover, can := self.visited.(VisitedRemover); can && (recorded || !ok) {
+			remover.Remove(req.Unique())
+		}
+		if recorded {
 			return false
 		}
 	}
@@ -174,16 +330,55 @@ func (self *Matrix) DoHistory(req *request.Request, ok bool) bool {
 	return false
 }
 
+// 请求组增加一个未完成项，并发安全
+func (self *Matrix) AddGroup(group string) {
+	self.Lock()
+	defer self.Unlock()
+	self.addGroup(group)
+}
+
+// 请求组完成一个未完成项，返回该组是否已全部完成，并发安全
+func (self *Matrix) DoneGroup(group string) bool {
+	self.Lock()
+	defer self.Unlock()
+	if n := self.groups[group] - 1; n > 0 {
+		self.groups[group] = n
+		return false
+	}
+	delete(self.groups, group)
+	return true
+}
+
+func (self *Matrix) addGroup(group string) {
+	if group == "" {
+		return
+	}
+	if self.groups == nil {
+		self.groups = make(map[string]int)
+	}
+	self.groups[group]++
+}
+
 func (self *Matrix) CanStop() bool {
 	if sdl.checkStatus(status.STOP) {
-		return true
+		if sdl.isDraining() {
+			return self.stopWith(cache.REASON_SIGNAL)
+		}
+		return self.stopWith(cache.REASON_STOPPED)
 	}
 	if self.maxPage >= 0 {
+		return self.stopWith(cache.REASON_LIMIT)
+	}
+	if atomic.LoadInt32(&self.finished) == 1 {
 		return true
 	}
 	if atomic.LoadInt32(&self.resCount) != 0 {
 		return false
 	}
+	// 优雅终止时不再派发排队中的请求及重试失败请求，失败请求随失败记录保存
+	if sdl.isDraining() {
+		return self.stopWith(cache.REASON_SIGNAL)
+	}
 	if self.Len() > 0 {
 		return false
 	}
@@ -193,33 +388,69 @@ func (self *Matrix) CanStop() bool {
 	if len(self.failures) > 0 {
 		// 重新下载历史记录中失败的请求
 		var goon bool
-		for reqUnique, req := range self.failures {
+		for _, reqUnique := range self.failureKeys() {
+			req := self.failures[reqUnique]
 			if req == nil {
 				continue
 			}
 			self.failures[reqUnique] = nil
 			goon = true
 			logs.Log.Informational(" *     - 失败请求: [%v]\n", req.GetUrl())
-			self.Push(req)
+			self.push(req, false)
 		}
 		if goon {
 			return false
 		}
 	}
+	return self.stopWith(cache.REASON_QUEUE_EMPTY)
+}
+
+// 提前结束：不再接收及派发请求，CanStop()随即返回true，进行中的请求照常完成
+func (self *Matrix) Finish(reason string) {
+	self.stopWith(reason)
+	atomic.StoreInt32(&self.finished, 1)
+}
+
+// 记录首个结束原因
+func (self *Matrix) stopWith(reason string) bool {
+	self.Lock()
+	if self.reason == "" {
+		self.reason = reason
+	}
+	self.Unlock()
 	return true
 }
 
+// 返回结束原因，尚未结束时为空
+func (self *Matrix) Reason() string {
+	self.Lock()
+	defer self.Unlock()
+	return self.reason
+}
+
+// 返回失败记录的键，确定性模式下按字典序排列以保证重试顺序稳定
+func (self *Matrix) failureKeys() []string {
+	keys := make([]string, 0, len(self.failures))
+	for k := range self.failures {
+		keys = append(keys, k)
+	}
+	if cache.Task.Deterministic {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
 // 非服务器模式下保存历史成功记录
 func (self *Matrix) TryFlushSuccess() {
 	if cache.Task.Mode != status.SERVER && cache.Task.SuccessInherit {
-		self.history.FlushSuccess(cache.Task.OutType)
+		self.history.FlushSuccess(cache.OutTypes()[0])
 	}
 }
 
 // 非服务器模式下保存历史失败记录
 func (self *Matrix) TryFlushFailure() {
 	if cache.Task.Mode != status.SERVER && cache.Task.FailureInherit {
-		self.history.FlushFailure(cache.Task.OutType)
+		self.history.FlushFailure(cache.OutTypes()[0])
 	}
 }
 
@@ -235,9 +466,82 @@ func (self *Matrix) Wait() {
 	}
 }
 
+// 返回排队中的请求数，含溢出至磁盘的请求
 func (self *Matrix) Len() int {
 	self.Lock()
 	defer self.Unlock()
+	l := self.memLen() + self.parkedLen()
+	if self.spill != nil {
+		l += self.spill.count
+	}
+	return l
+}
+
+// 返回内存队列与磁盘队列中的请求数
+func (self *Matrix) QueueLen() (mem, spilled int) {
+	self.Lock()
+	defer self.Unlock()
+	mem = self.memLen() + self.parkedLen()
+	if self.spill != nil {
+		spilled = self.spill.count
+	}
+	return
+}
+
+// 返回请求队列的统计快照
+func (self *Matrix) Stats() QueueStats {
+	self.Lock()
+	defer self.Unlock()
+	stats := QueueStats{
+		Spider:     self.spiderName,
+		ByHost:     make(map[string]int, len(self.hostCount)),
+		ByRule:     make(map[string]int, len(self.ruleCount)),
+		ByPriority: make(map[int]int, len(self.priorities)),
+	}
+	for host, n := range self.hostCount {
+		stats.ByHost[host] = n
+	}
+	for rule, n := range self.ruleCount {
+		stats.ByRule[rule] = n
+	}
+	var oldest time.Time
+	for _, priority := range self.priorities {
+		n := len(self.reqs[priority])
+		if n == 0 {
+			continue
+		}
+		stats.Total += n
+		stats.ByPriority[priority] = n
+		// 同一优先级内先进先出，队首即等待最久的请求
+		if at := self.enqueued[priority][0]; oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+			stats.OldestUrl = self.reqs[priority][0].GetUrl()
+		}
+	}
+	if !oldest.IsZero() {
+		stats.OldestWait = time.Since(oldest)
+	}
+	if self.spill != nil {
+		stats.Spilled = self.spill.count
+		stats.Total += stats.Spilled
+	}
+	stats.Expired = self.expired
+	stats.Lost = self.lost
+	for host, c := range self.circuits {
+		if c.openUntil.IsZero() {
+			continue
+		}
+		if stats.OpenHosts == nil {
+			stats.OpenHosts = make(map[string]time.Time)
+		}
+		stats.OpenHosts[host] = c.openUntil
+		stats.Parked += len(c.parked)
+	}
+	stats.Total += stats.Parked
+	return stats
+}
+
+func (self *Matrix) memLen() int {
 	var l int
 	for _, reqs := range self.reqs {
 		l += len(reqs)
@@ -245,20 +549,76 @@ func (self *Matrix) Len() int {
 	return l
 }
 
+// 溢出请求至磁盘，at为入队时间，失败时返回false
+func (self *Matrix) spillPush(req *request.Request, at time.Time) bool {
+	if self.spill == nil {
+		spill, err := newSpillQueue(self.spiderName)
+		if err != nil {
+			logs.Log.Error(" *     [%s] 创建溢出队列失败: %v\n", self.spiderName, err)
+			return false
+		}
+		self.spill = spill
+		logs.Log.Informational(" *     [%s] 请求队列已满（%v），开始溢出至磁盘\n", self.spiderName, config.QUEUE_MAX_SIZE)
+	}
+	if err := self.spill.push(req, at); err != nil {
+		logs.Log.Error(" *     [%s] 溢出请求失败: %v\n", self.spiderName, err)
+		return false
+	}
+	return true
+}
+
+// 从磁盘读回至多半个队列容量的请求，读尽后删除溢出文件
+func (self *Matrix) spillRefill() {
+	n := config.QUEUE_MAX_SIZE / 2
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n && self.spill.count > 0; {
+		// 读取失败的记录跳过并计入丢失数，pull()已将其出队
+		req, at, err := self.spill.pull()
+		if err != nil {
+			self.lost++
+			logs.Log.Error(" *     [%s] 读回溢出请求失败: %v\n", self.spiderName, err)
+			continue
+		}
+		self.enqueue(req, at)
+		i++
+	}
+	if self.spill.count == 0 {
+		self.closeSpill()
+	}
+}
+
+func (self *Matrix) closeSpill() {
+	if self.spill != nil {
+		self.spill.close()
+		self.spill = nil
+	}
+}
+
+// 是否对请求队列限容并在队列已满时溢出至磁盘，确定性模式下不阻塞以免死锁
+func spillOverflow() bool {
+	return config.QUEUE_MAX_SIZE > 0 && (config.QUEUE_OVERFLOW != "block" || cache.Task.Deterministic)
+}
+
+// 返回布隆过滤器的填充率，未启用时返回-1
+func (self *Matrix) BloomFillRatio() float64 {
+	filter, ok := self.visited.(bloomVisited)
+	if !ok {
+		return -1
+	}
+	return filter.FillRatio()
+}
+
 func (self *Matrix) hasHistory(reqUnique string) bool {
 	if self.history.HasSuccess(reqUnique) {
 		return true
 	}
-	self.tempHistoryLock.RLock()
-	has := self.tempHistory[reqUnique]
-	self.tempHistoryLock.RUnlock()
-	return has
+	return self.visited.Has(reqUnique)
 }
 
 func (self *Matrix) insertTempHistory(reqUnique string) {
-	self.tempHistoryLock.Lock()
-	self.tempHistory[reqUnique] = true
-	self.tempHistoryLock.Unlock()
+	self.visited.Add(reqUnique)
 }
 
 func (self *Matrix) setFailures(reqs map[string]*request.Request) {
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+)
+
+// 以threads个并发名额及容量为maxSize的请求队列初始化调度器，返回一个不限页数的请求矩阵
+func testMatrix(t *testing.T, threads, maxSize int, overflow string) *Matrix {
+	cache.Task.Mode = status.SERVER
+	cache.Task.ThreadNum = threads
+	cache.Task.ProxyMinute = 0
+	config.QUEUE_MAX_SIZE = maxSize
+	config.QUEUE_OVERFLOW = overflow
+	Init()
+	t.Cleanup(func() {
+		Stop()
+		config.QUEUE_MAX_SIZE = 0
+		config.QUEUE_OVERFLOW = "spill"
+		config.QUEUE_FORMAT = "json"
+	})
+	return AddMatrix("test", "", math.MinInt64, 0, 0)
+}
+
+func testRequest(i int) *request.Request {
+	req := &request.Request{Url: "http://example.com/" + strconv.Itoa(i), Rule: "list"}
+	req.Prepare()
+	return req
+}
+
+// 在超时前完成fn，否则测试失败
+func within(t *testing.T, d time.Duration, fn func()) {
+	done := make(chan bool)
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("未在 %v 内完成", d)
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	m := testMatrix(t, 2, 2, "block")
+	// 添加请求的协程与另一进行中的请求各占一个并发名额
+	m.Use()
+	m.Use()
+	m.Push(testRequest(0))
+	m.Push(testRequest(1))
+
+	done := make(chan bool)
+	go func() {
+		m.Push(testRequest(2))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("队列已满时未阻塞")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if req := m.Pull(); req == nil || req.GetUrl() != "http://example.com/0" {
+		t.Fatalf("Pull: %v", req)
+	}
+	within(t, time.Second, func() { <-done })
+	if mem, spilled := m.QueueLen(); mem != 2 || spilled != 0 {
+		t.Fatalf("QueueLen: %v, %v", mem, spilled)
+	}
+}
+
+// 唯一的并发名额被等待入队的协程占用时不应死锁
+func TestBlockFallsBackWhenStalled(t *testing.T) {
+	m := testMatrix(t, 1, 2, "block")
+	m.Use()
+	within(t, 5*time.Second, func() {
+		for i := 0; i < 5; i++ {
+			m.Push(testRequest(i))
+		}
+	})
+	if mem, spilled := m.QueueLen(); mem != 2 || spilled != 3 {
+		t.Fatalf("QueueLen: %v, %v", mem, spilled)
+	}
+}
+
+func TestSpillRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "protobuf"} {
+		t.Run(format, func(t *testing.T) {
+			m := testMatrix(t, 1, 2, "spill")
+			config.QUEUE_FORMAT = format
+			for i := 0; i < 5; i++ {
+				m.Push(testRequest(i))
+			}
+			if mem, spilled := m.QueueLen(); mem != 2 || spilled != 3 {
+				t.Fatalf("QueueLen: %v, %v", mem, spilled)
+			}
+			path := m.spill.path
+			for i := 0; i < 5; i++ {
+				req := m.Pull()
+				if req == nil {
+					t.Fatalf("Pull %d: nil", i)
+				}
+				if want := testRequest(i).GetUrl(); req.GetUrl() != want {
+					t.Fatalf("Pull %d: %s, want %s", i, req.GetUrl(), want)
+				}
+			}
+			if req := m.Pull(); req != nil {
+				t.Fatalf("Pull: %v", req.GetUrl())
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("溢出文件未删除: %v", err)
+			}
+		})
+	}
+}
+
+func TestSpillCorruptRecordsAreSkipped(t *testing.T) {
+	m := testMatrix(t, 1, 2, "spill")
+	for i := 0; i < 5; i++ {
+		m.Push(testRequest(i))
+	}
+	if err := os.Truncate(m.spill.path, 10); err != nil {
+		t.Fatal(err)
+	}
+	within(t, time.Second, func() {
+		for m.Pull() != nil {
+		}
+	})
+	if stats := m.Stats(); stats.Lost != 3 || stats.Total != 0 {
+		t.Fatalf("Lost: %v, Total: %v", stats.Lost, stats.Total)
+	}
+}
+
+func TestCanStopWhenQueueEmpty(t *testing.T) {
+	m := testMatrix(t, 1, 0, "spill")
+	m.Push(testRequest(0))
+	if m.CanStop() {
+		t.Fatal("队列非空时结束")
+	}
+	req := m.Pull()
+	m.Use()
+	if m.CanStop() {
+		t.Fatal("请求处理中时结束")
+	}
+	m.DoHistory(req, true)
+	m.Free()
+	if !m.CanStop() {
+		t.Fatal("队列已空时未结束")
+	}
+	if reason := m.Reason(); reason != cache.REASON_QUEUE_EMPTY {
+		t.Fatalf("Reason: %q", reason)
+	}
+}
+
+// 逐步增加并发量期间，进行中的请求数达到当前上限时Use阻塞
+func TestRampLimitsUse(t *testing.T) {
+	second, start := config.RAMP_SECOND, config.RAMP_START
+	config.RAMP_SECOND, config.RAMP_START = 60, 1
+	defer func() { config.RAMP_SECOND, config.RAMP_START = second, start }()
+	m := testMatrix(t, 4, 0, "spill")
+	if limit := atomic.LoadInt32(&sdl.limit); limit != 1 {
+		t.Fatalf("初始并发上限: %v", limit)
+	}
+
+	m.Use()
+	done := make(chan bool)
+	go func() {
+		m.Use()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("达到并发上限时未阻塞")
+	case <-time.After(100 * time.Millisecond):
+	}
+	atomic.StoreInt32(&sdl.limit, 2)
+	within(t, time.Second, func() { <-done })
+	// 上限为0时不再限制
+	atomic.StoreInt32(&sdl.limit, 0)
+	within(t, time.Second, func() { m.Use() })
+	if n := len(sdl.count); n != 3 {
+		t.Fatalf("进行中的请求数: %v", n)
+	}
+}
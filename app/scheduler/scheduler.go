@@ -2,9 +2,11 @@ package scheduler
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/henrylee2cn/pholcus/app/aid/proxy"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
@@ -15,6 +17,11 @@ type scheduler struct {
 	status       int          // 运行状态
 	count        chan bool    // 总并发量计数
 	useProxy     bool         // 标记是否使用代理IP
+	draining     bool         // 标记是否已停止派发新请求
+	limit        int32        // 逐步增加并发量期间的当前并发上限，0为不限
+	rampGen      int32        // 每次Init递增，使上次任务遗留的rampUp协程退出
+	blocked      int32        // 因请求队列已满而等待的协程数，见Matrix.waitRoom()
+	rampLock     sync.Mutex   // 逐步增加并发量期间串行占用并发名额
 	proxy        *proxy.Proxy // 全局代理IP
 	matrices     []*Matrix    // Spider实例的请求矩阵列表
 	sync.RWMutex              // 全局读写锁
@@ -32,7 +39,13 @@ func Init() {
 		time.Sleep(100 * time.Millisecond)
 	}
 	sdl.matrices = []*Matrix{}
-	sdl.count = make(chan bool, cache.Task.ThreadNum)
+	if cache.Task.Deterministic {
+		// 确定性模式下全局仅允许一个请求处理中，保证执行顺序稳定
+		sdl.count = make(chan bool, 1)
+		logs.Log.Informational(" *     确定性模式：单协程按先进先出顺序执行，速度很慢，仅用于开发与测试\n")
+	} else {
+		sdl.count = make(chan bool, cache.Task.ThreadNum)
+	}
 
 	if cache.Task.ProxyMinute > 0 {
 		if sdl.proxy.Count() > 0 {
@@ -48,12 +61,44 @@ func Init() {
 		logs.Log.Informational(" *     不使用代理IP\n")
 	}
 
+	sdl.draining = false
 	sdl.status = status.RUN
+
+	gen := atomic.AddInt32(&sdl.rampGen, 1)
+	atomic.StoreInt32(&sdl.limit, 0)
+	if config.RAMP_SECOND > 0 && config.RAMP_START < cap(sdl.count) {
+		atomic.StoreInt32(&sdl.limit, int32(config.RAMP_START))
+		go sdl.rampUp(gen, int32(config.RAMP_START), int32(cap(sdl.count)), time.Duration(config.RAMP_SECOND)*time.Second)
+	}
+}
+
+// 在duration内将并发上限由start线性增至max，gen为启动时的Init序号
+func (self *scheduler) rampUp(gen, start, max int32, duration time.Duration) {
+	logs.Log.Informational(" *     并发量将在 %v 内由 %v 逐步增至 %v\n", duration, start, max)
+	begin := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if self.checkStatus(status.STOP) || atomic.LoadInt32(&self.rampGen) != gen {
+			return
+		}
+		elapsed := time.Since(begin)
+		if elapsed >= duration {
+			atomic.StoreInt32(&self.limit, 0)
+			logs.Log.Informational(" *     并发量已增至 %v\n", max)
+			return
+		}
+		limit := start + int32(int64(max-start)*int64(elapsed)/int64(duration))
+		if atomic.SwapInt32(&self.limit, limit) != limit {
+			logs.Log.Informational(" *     并发量逐步增加：%v/%v\n", limit, max)
+		}
+	}
 }
 
 // 注册资源队列
-func AddMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
-	matrix := newMatrix(spiderName, spiderSubName, maxPage)
+// bloomCount>0时使用布隆过滤器去重，bloomFP为其目标误判率
+func AddMatrix(spiderName, spiderSubName string, maxPage int64, bloomCount uint64, bloomFP float64) *Matrix {
+	matrix := newMatrix(spiderName, spiderSubName, maxPage, bloomCount, bloomFP)
 	sdl.RLock()
 	defer sdl.RUnlock()
 	sdl.matrices = append(sdl.matrices, matrix)
@@ -72,6 +117,30 @@ func PauseRecover() {
 	}
 }
 
+// 停止派发新请求，进行中的请求不受影响，用于优雅终止
+func Drain() {
+	sdl.Lock()
+	sdl.draining = true
+	sdl.Unlock()
+}
+
+// 返回进行中的请求数
+func Running() int {
+	return len(sdl.count)
+}
+
+// 返回所有请求矩阵中排队的请求数，spilled为其中溢出至磁盘的部分
+func QueueLen() (total, spilled int) {
+	sdl.RLock()
+	defer sdl.RUnlock()
+	for _, matrix := range sdl.matrices {
+		m, s := matrix.QueueLen()
+		total += m + s
+		spilled += s
+	}
+	return
+}
+
 // 终止任务
 func Stop() {
 	// println("scheduler^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^")
@@ -85,6 +154,11 @@ func Stop() {
 	// for _, matrix := range sdl.matrices {
 	// 	matrix.windup()
 	// }
+	for _, matrix := range sdl.matrices {
+		matrix.Lock()
+		matrix.closeSpill()
+		matrix.Unlock()
+	}
 	close(sdl.count)
 	sdl.matrices = []*Matrix{}
 	// println("scheduler$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$")
@@ -99,6 +173,13 @@ func (self *scheduler) avgRes() int32 {
 	return avg
 }
 
+func (self *scheduler) isDraining() bool {
+	self.RLock()
+	b := self.draining
+	self.RUnlock()
+	return b
+}
+
 func (self *scheduler) checkStatus(s int) bool {
 	self.RLock()
 	b := self.status == s
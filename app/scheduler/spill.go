@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 内存队列已满时溢出至磁盘的请求队列，先进先出，非并发安全；
+// 每条记录前保存请求的入队时间（Unix纳秒），读回后据此计算等待时长
+type spillQueue struct {
+	path   string
+	writer *os.File
+	file   *os.File
+	reader *bufio.Reader
+	count  int  // 尚未读回的请求数
+	binary bool // 以protobuf格式保存，每条记录前为varint编码的长度，见queue::format
+}
+
+func newSpillQueue(spiderName string) (*spillQueue, error) {
+	dir := filepath.Join(config.CACHE_DIR, "queue")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	pb := config.QUEUE_FORMAT == "protobuf"
+	ext := ".jsonl"
+	if pb {
+		ext = ".pb"
+	}
+	path := filepath.Join(dir, util.FileNameReplace(spiderName)+"_"+strconv.FormatInt(time.Now().UnixNano(), 10)+ext)
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &spillQueue{
+		path:   path,
+		writer: writer,
+		file:   file,
+		reader: bufio.NewReader(file),
+		binary: pb,
+	}, nil
+}
+
+func (self *spillQueue) push(req *request.Request, at time.Time) error {
+	if self.binary {
+		b, err := req.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		record := make([]byte, 0, len(b)+2*binary.MaxVarintLen64)
+		record = binary.AppendUvarint(record, uint64(at.UnixNano()))
+		record = binary.AppendUvarint(record, uint64(len(b)))
+		if _, err = self.writer.Write(append(record, b...)); err != nil {
+			return err
+		}
+		self.count++
+		return nil
+	}
+	if _, err := self.writer.WriteString(strconv.FormatInt(at.UnixNano(), 10) + " " + req.Serialize() + "\n"); err != nil {
+		return err
+	}
+	self.count++
+	return nil
+}
+
+// 读回最早溢出的请求及其入队时间，无请求时返回nil；
+// 读取失败的记录同样出队，避免损坏的文件被反复读取
+func (self *spillQueue) pull() (*request.Request, time.Time, error) {
+	if self.count == 0 {
+		return nil, time.Time{}, nil
+	}
+	self.count--
+	if self.binary {
+		at, err := binary.ReadUvarint(self.reader)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		n, err := binary.ReadUvarint(self.reader)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		b := make([]byte, n)
+		if _, err = io.ReadFull(self.reader, b); err != nil {
+			return nil, time.Time{}, err
+		}
+		req := new(request.Request)
+		return req, time.Unix(0, int64(at)), req.UnmarshalBinary(b)
+	}
+	line, err := self.reader.ReadString('\n')
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var at int64
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		at, _ = strconv.ParseInt(line[:i], 10, 64)
+		line = line[i+1:]
+	}
+	req, err := request.UnSerialize(line)
+	return req, time.Unix(0, at), err
+}
+
+// 关闭并删除溢出文件
+func (self *spillQueue) close() {
+	self.writer.Close()
+	self.file.Close()
+	os.Remove(self.path)
+}
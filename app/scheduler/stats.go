@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+// 一个请求矩阵的队列统计快照，各项计数随请求入队出队增量维护，获取时无需遍历队列
+type QueueStats struct {
+	Spider     string               // 所属Spider
+	Total      int                  // 排队中的请求数，含溢出至磁盘的请求
+	Spilled    int                  // 其中溢出至磁盘的请求数
+	ByHost     map[string]int       // 内存队列中按主机统计的请求数
+	ByRule     map[string]int       // 内存队列中按规则统计的请求数
+	ByPriority map[int]int          // 内存队列中按优先级统计的请求数
+	OldestWait time.Duration        // 内存队列中等待最久的请求已等待的时长
+	OldestUrl  string               // 内存队列中等待最久的请求的URL
+	Expired    int                  // 因在队列中等待超过queue::maxage而丢弃的请求数
+	Lost       int                  // 因溢出文件损坏而无法读回的请求数
+	Parked     int                  // 因主机熔断而暂存的请求数，计入Total
+	OpenHosts  map[string]time.Time // 熔断中的[主机]恢复探测的时刻，见breaker::threshold
+}
+
+// 返回所有请求矩阵的队列统计快照
+func Stats() []QueueStats {
+	sdl.RLock()
+	defer sdl.RUnlock()
+	stats := make([]QueueStats, 0, len(sdl.matrices))
+	for _, matrix := range sdl.matrices {
+		stats = append(stats, matrix.Stats())
+	}
+	return stats
+}
+
+func requestHost(req *request.Request) string {
+	u, err := url.Parse(req.GetUrl())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func decCount(m map[string]int, key string) {
+	if m[key]--; m[key] <= 0 {
+		delete(m, key)
+	}
+}
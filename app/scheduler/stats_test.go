@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+func TestQueueStats(t *testing.T) {
+	m := testMatrix(t, 1, 0, "spill")
+	for _, r := range []struct {
+		url      string
+		rule     string
+		priority int
+	}{
+		{"http://a.com/1", "list", 0},
+		{"http://a.com/2", "item", 0},
+		{"http://b.com/1", "item", 1},
+		{"http://b.com/2", "item", 1},
+	} {
+		req := &request.Request{Url: r.url, Rule: r.rule, Priority: r.priority}
+		req.Prepare()
+		m.Push(req)
+		time.Sleep(time.Millisecond)
+	}
+	// 高优先级先出队
+	if req := m.Pull(); req.GetUrl() != "http://b.com/1" {
+		t.Fatalf("Pull: %v", req.GetUrl())
+	}
+
+	stats := m.Stats()
+	if stats.Spider != "test" || stats.Total != 3 || stats.Spilled != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if want := map[string]int{"a.com": 2, "b.com": 1}; !reflect.DeepEqual(stats.ByHost, want) {
+		t.Errorf("ByHost = %v, want %v", stats.ByHost, want)
+	}
+	if want := map[string]int{"list": 1, "item": 2}; !reflect.DeepEqual(stats.ByRule, want) {
+		t.Errorf("ByRule = %v, want %v", stats.ByRule, want)
+	}
+	if want := map[int]int{0: 2, 1: 1}; !reflect.DeepEqual(stats.ByPriority, want) {
+		t.Errorf("ByPriority = %v, want %v", stats.ByPriority, want)
+	}
+	if stats.OldestUrl != "http://a.com/1" || stats.OldestWait < 3*time.Millisecond {
+		t.Errorf("oldest = %v, %v", stats.OldestUrl, stats.OldestWait)
+	}
+	if all := Stats(); len(all) != 1 || all[0].Total != 3 {
+		t.Errorf("Stats() = %+v", all)
+	}
+
+	for m.Pull() != nil {
+	}
+	stats = m.Stats()
+	if stats.Total != 0 || len(stats.ByHost) != 0 || len(stats.ByRule) != 0 || stats.OldestUrl != "" {
+		t.Errorf("stats after drain = %+v", stats)
+	}
+}
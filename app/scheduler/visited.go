@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/common/bloom"
+)
+
+// 本次任务的请求去重存储，以请求指纹（Request.Unique()）为键，须并发安全。
+// 默认为内存集合，Spider.BloomCount>0时为布隆过滤器，
+// 也可经Spider.VisitedStore接入其他实现（如Redis以实现分布式去重）。
+// 历史成功记录（history）仍先于其检查。
+type VisitedStore interface {
+	Has(fingerprint string) bool
+	Add(fingerprint string)
+}
+
+// 可选实现，请求失败或其成功记录已保存后移除其指纹（失败者允许重新添加，成功者改由成功记录去重）；
+// 未保存成功记录（非默认存储且未继承成功记录）时保留指纹
+type VisitedRemover interface {
+	Remove(fingerprint string)
+}
+
+// 默认的内存集合
+type memVisited struct {
+	set map[string]bool
+	sync.RWMutex
+}
+
+func newMemVisited() *memVisited {
+	return &memVisited{set: make(map[string]bool)}
+}
+
+func (self *memVisited) Has(fingerprint string) bool {
+	self.RLock()
+	defer self.RUnlock()
+	return self.set[fingerprint]
+}
+
+func (self *memVisited) Add(fingerprint string) {
+	self.Lock()
+	self.set[fingerprint] = true
+	self.Unlock()
+}
+
+func (self *memVisited) Remove(fingerprint string) {
+	self.Lock()
+	delete(self.set, fingerprint)
+	self.Unlock()
+}
+
+// 布隆过滤器，以可控的误判率换取固定的内存占用
+type bloomVisited struct {
+	*bloom.Filter
+}
+
+func (self bloomVisited) Has(fingerprint string) bool {
+	return self.Test(fingerprint)
+}
+
+// 设置请求去重存储，须在添加请求前调用
+func (self *Matrix) SetVisitedStore(store VisitedStore) {
+	if store == nil {
+		return
+	}
+	self.Lock()
+	self.visited = store
+	self.Unlock()
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 仅实现VisitedStore的外部存储
+type setVisited struct {
+	set map[string]bool
+	sync.Mutex
+}
+
+func (self *setVisited) Has(fingerprint string) bool {
+	self.Lock()
+	defer self.Unlock()
+	return self.set[fingerprint]
+}
+
+func (self *setVisited) Add(fingerprint string) {
+	self.Lock()
+	self.set[fingerprint] = true
+	self.Unlock()
+}
+
+// 同时实现VisitedRemover的外部存储
+type removableVisited struct {
+	setVisited
+}
+
+func (self *removableVisited) Remove(fingerprint string) {
+	self.Lock()
+	delete(self.set, fingerprint)
+	self.Unlock()
+}
+
+func TestVisitedStore(t *testing.T) {
+	inherit := cache.Task.SuccessInherit
+	cache.Task.SuccessInherit = false
+	defer func() { cache.Task.SuccessInherit = inherit }()
+
+	cases := []struct {
+		name  string
+		store func() VisitedStore
+		// 请求失败后能否再次添加
+		readdFailed bool
+	}{
+		{"memory", nil, true},
+		{"store", func() VisitedStore { return &setVisited{set: map[string]bool{}} }, false},
+		{"remover", func() VisitedStore { return &removableVisited{setVisited{set: map[string]bool{}}} }, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := testMatrix(t, 1, 0, "spill")
+			if c.store != nil {
+				m.SetVisitedStore(c.store())
+			}
+			push := func(i int) int {
+				before := m.Len()
+				m.Push(testRequest(i))
+				return m.Len() - before
+			}
+			if push(0) != 1 || push(0) != 0 || push(1) != 1 {
+				t.Fatalf("重复的请求未去重: Len = %v", m.Len())
+			}
+			ok, failed := m.Pull(), m.Pull()
+
+			// 成功的请求始终不再添加
+			m.DoHistory(ok, true)
+			if push(0) != 0 {
+				t.Error("成功的请求被再次添加")
+			}
+			m.DoHistory(failed, false)
+			if n := push(1); (n == 1) != c.readdFailed {
+				t.Errorf("失败的请求再次添加: %v, want %v", n == 1, c.readdFailed)
+			}
+		})
+	}
+}
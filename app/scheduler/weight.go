@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"sort"
+)
+
+// 规则权重：同一优先级内有多个规则的请求排队时，按权重以平滑加权轮询选出派发的规则，
+// 取该规则最早入队的请求；未设置权重（均为1）时不启用，整体先进先出。
+// 优先级仍严格优先，权重只在当前最高优先级的请求间起作用。
+// 各规则的请求仍存于同一优先级队列中，选出规则后需从队首查找其最早的请求并从队列中间移除，
+// 每次出队的开销与该优先级队列的长度成正比（未启用时为常数）；
+// 队列很长时可配合queue::maxsize将多余的请求溢出至磁盘，以限制内存队列的长度。
+
+// 设置各规则的派发权重，未列出或不大于1的规则权重为1
+func (self *Matrix) SetRuleWeights(weights map[string]int) {
+	self.Lock()
+	defer self.Unlock()
+	self.weights = nil
+	for rule, w := range weights {
+		if w <= 1 {
+			continue
+		}
+		if self.weights == nil {
+			self.weights = make(map[string]int)
+		}
+		self.weights[rule] = w
+	}
+	self.wrr = make(map[string]int)
+}
+
+func (self *Matrix) ruleWeight(rule string) int {
+	if w, ok := self.weights[rule]; ok {
+		return w
+	}
+	return 1
+}
+
+// 返回该优先级队列中下一个派发的请求的位置，未启用规则权重时为队首；
+// 启用时需顺序查找被选中规则的首个请求，开销为O(n)
+func (self *Matrix) nextIndex(priority int) int {
+	pending := self.priorityRules[priority]
+	if self.weights == nil || len(pending) < 2 {
+		return 0
+	}
+	rules := make([]string, 0, len(pending))
+	for rule := range pending {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules) // 保证确定性模式下的派发顺序
+	var best, total int
+	for i, rule := range rules {
+		w := self.ruleWeight(rule)
+		self.wrr[rule] += w
+		total += w
+		if self.wrr[rule] > self.wrr[rules[best]] {
+			best = i
+		}
+	}
+	self.wrr[rules[best]] -= total
+	for i, req := range self.reqs[priority] {
+		if req.GetRuleName() == rules[best] {
+			return i
+		}
+	}
+	return 0
+}
+
+// 更新[优先级][规则]请求数，add为1或-1
+func (self *Matrix) countPriorityRule(priority int, rule string, add int) {
+	m := self.priorityRules[priority]
+	if m == nil {
+		m = make(map[string]int)
+		self.priorityRules[priority] = m
+	}
+	if m[rule] += add; m[rule] <= 0 {
+		delete(m, rule)
+		// 规则的请求已全部派发，下次参与轮询时重新计算
+		delete(self.wrr, rule)
+	}
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+func TestRuleWeightFairness(t *testing.T) {
+	cases := []struct {
+		name    string
+		weights map[string]int
+		want    []string
+	}{
+		{"fifo", nil, []string{"list0", "item0", "list1", "item1", "list2", "item2", "list3", "item3"}},
+		// 平滑加权轮询：item与list约3:1交错派发，而非连续派发3个item
+		{"weighted", map[string]int{"item": 3}, []string{"item0", "item1", "list0", "item2", "item3", "item4", "list1", "item5"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := testMatrix(t, 1, 0, "spill")
+			if c.weights != nil {
+				m.SetRuleWeights(c.weights)
+			}
+			for i := 0; i < 8; i++ {
+				for _, rule := range []string{"list", "item"} {
+					req := &request.Request{Url: fmt.Sprintf("http://example.com/%s%d", rule, i), Rule: rule}
+					req.Prepare()
+					m.Push(req)
+				}
+			}
+			// 更高优先级的请求不受权重影响，始终先派发
+			high := &request.Request{Url: "http://example.com/high", Rule: "list", Priority: 1}
+			high.Prepare()
+			m.Push(high)
+			if req := m.Pull(); req.GetUrl() != high.GetUrl() {
+				t.Fatalf("Pull: %v", req.GetUrl())
+			}
+
+			var got []string
+			for range c.want {
+				got = append(got, m.Pull().GetUrl()[len("http://example.com/"):])
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("order = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/henrylee2cn/pholcus/app/distribute"
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 主节点同时转交中的请求数上限
+const maxForwarding = 256
+
+// 客户端模式下，向主节点登记本节点的分片序号，以便接收其他节点转交的请求
+func (self *Logic) registerShard() {
+	if config.SHARD_COUNT > 1 {
+		self.Teleport.Request(strconv.Itoa(config.SHARD_INDEX), "shard", "")
+	}
+}
+
+// 客户端模式下，将不属于本节点分片的请求发给主节点转交
+func (self *Logic) routeShard(sp *spider.Spider, req *request.Request) {
+	b, _ := json.Marshal(distribute.Route{
+		Shard:   spider.ShardOf(req.GetUrl(), config.SHARD_COUNT),
+		Spider:  sp.GetName(),
+		Keyin:   sp.GetKeyin(),
+		Request: req.Serialize(),
+	})
+	self.Teleport.Request(string(b), "route", "")
+}
+
+// 主节点登记分片所在的节点，同一分片以最近登记的节点为准
+func (self *Logic) RegisterShard(shard int, nodeUID string) {
+	self.RWMutex.Lock()
+	defer self.RWMutex.Unlock()
+	if self.shards == nil {
+		self.shards = make(map[int]string)
+	}
+	self.shards[shard] = nodeUID
+	logs.Log.Informational(" *     [分片路由] 分片 %v 位于节点 %v\n", shard, nodeUID)
+}
+
+// 主节点将请求转交其所属分片的节点，该分片尚无节点登记时丢弃并记录日志
+func (self *Logic) Forward(route *distribute.Route) {
+	self.RWMutex.RLock()
+	uid, ok := self.shards[route.Shard]
+	self.RWMutex.RUnlock()
+	if !ok {
+		logs.Log.Warning(" *     [分片路由] 分片 %v 没有登记的节点，已丢弃请求\n", route.Shard)
+		return
+	}
+	b, _ := json.Marshal(route)
+	// Request()会等待至连接可用，不能阻塞接收协程；同时转交中的请求数有上限，超出时丢弃
+	select {
+	case self.forwarding <- struct{}{}:
+		go func() {
+			defer func() { <-self.forwarding }()
+			self.Teleport.Request(string(b), "route", "", uid)
+		}()
+	default:
+		logs.Log.Warning(" *     [分片路由] 同时转交的请求已达上限 %v，已丢弃请求\n", cap(self.forwarding))
+	}
+}
+
+// 从节点接收转交的请求，加入正在运行的同名（且Keyin相同）蜘蛛的队列
+func (self *Logic) Accept(route *distribute.Route) {
+	req, err := request.UnSerialize(route.Request)
+	if err != nil {
+		logs.Log.Error(" *     [分片路由]: %v\n", err)
+		return
+	}
+	for _, sp := range self.SpiderQueue.GetAll() {
+		if sp.GetName() == route.Spider && sp.GetKeyin() == route.Keyin && sp.AcceptRouted(req) {
+			return
+		}
+	}
+	logs.Log.Warning(" *     [分片路由] 蜘蛛 %s 未在运行，已丢弃请求 %s\n", route.Spider, req.GetUrl())
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/distribute"
+	"github.com/henrylee2cn/teleport"
+)
+
+// 阻塞至release关闭的Request，模拟连接不可用的节点
+type blockingTeleport struct {
+	teleport.Teleport
+	started chan string
+	release chan struct{}
+}
+
+func (self *blockingTeleport) Request(body interface{}, operation string, flag string, nodeuid ...string) {
+	self.started <- nodeuid[0]
+	<-self.release
+}
+
+// 转交中的请求达到上限时丢弃新请求，不再新建协程
+func TestForwardBounded(t *testing.T) {
+	tp := &blockingTeleport{started: make(chan string, 4), release: make(chan struct{})}
+	logic := &Logic{
+		Teleport:   tp,
+		shards:     map[int]string{1: "node1"},
+		forwarding: make(chan struct{}, 2),
+	}
+	for i := 0; i < 4; i++ {
+		logic.Forward(&distribute.Route{Shard: 1})
+	}
+	logic.Forward(&distribute.Route{Shard: 2}) // 没有登记的节点
+	for i := 0; i < 2; i++ {
+		if uid := <-tp.started; uid != "node1" {
+			t.Errorf("forwarded to %q", uid)
+		}
+	}
+	if n := len(logic.forwarding); n != 2 {
+		t.Errorf("forwarding = %v, want 2", n)
+	}
+	close(tp.release)
+	// 转交完成后释放名额
+	for len(logic.forwarding) > 0 {
+		runtime.Gosched()
+	}
+	logic.Forward(&distribute.Route{Shard: 1})
+	if uid := <-tp.started; uid != "node1" {
+		t.Errorf("forwarded to %q", uid)
+	}
+	if len(tp.started) != 0 {
+		t.Errorf("%v requests forwarded beyond the limit", len(tp.started))
+	}
+}
@@ -0,0 +1,48 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"regexp"
+)
+
+// 输出文件的处理方式，可按位组合，用于Context.FileOutputAs()
+type FileFormat int
+
+const (
+	FILE_RAW  FileFormat = 0         // 原样输出响应内容（下载器已解压Content-Encoding）
+	FILE_UTF8 FileFormat = 1 << iota // 与GetText()相同地转码为UTF-8，并将HTML中声明的charset改为utf-8，仅适用于文本
+	FILE_GZIP                        // gzip压缩后输出，文件名追加".gz"
+)
+
+// HTML中声明编码的meta标签
+var metaCharset = regexp.MustCompile(`(?i)(<meta[^>]*charset\s*=\s*["']?)[\w:.-]+`)
+
+// 按format处理文件内容
+func (self *Context) formatFile(body []byte, format FileFormat) ([]byte, error) {
+	if format&FILE_UTF8 != 0 {
+		r, err := self.decodeBody(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+		if loc := metaCharset.FindSubmatchIndex(body); loc != nil {
+			body = append(body[:loc[3]:loc[3]], append([]byte("utf-8"), body[loc[1]:]...)...)
+		}
+	}
+	if format&FILE_GZIP != 0 {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	return body, nil
+}
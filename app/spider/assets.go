@@ -0,0 +1,125 @@
+package spider
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/common/goquery"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 下载静态资源的内置规则名，见Spider.MirrorAssets
+const ASSET_RULE = "Asset"
+
+// Spider.MirrorAssets的取值
+const (
+	ASSET_SAME_HOST   = "host"   // 仅下载与页面主机名相同的资源
+	ASSET_SAME_DOMAIN = "domain" // 下载与页面注册域名相同的资源，如static.example.com之于www.example.com
+)
+
+// Spider.AssetTypes为空时允许下载的资源扩展名
+var DefaultAssetTypes = []string{
+	".css", ".js",
+	".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".ico", ".bmp",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+}
+
+// 内置规则：以"主机名/路径"为文件名保存资源
+var assetRule = &Rule{
+	ParseFunc: func(ctx *Context) {
+		u, err := url.Parse(ctx.GetUrl())
+		if err != nil {
+			logs.Log.Error(" *     [%s] 资源地址有误: %v\n", ctx.spider.GetName(), err)
+			return
+		}
+		ctx.FileOutput(u.Host + u.Path)
+	},
+}
+
+// 将页面引用的同源静态资源（样式表、脚本、图片、图标、字体）添加至队列，由内置规则ASSET_RULE保存为文件，
+// 返回添加的数量。同源范围由Spider.MirrorAssets指定，资源类型由Spider.AssetTypes限定。
+func (self *Context) AddAssets() int {
+	scope := self.spider.MirrorAssets
+	if scope == "" {
+		logs.Log.Warning(" *     蜘蛛 %s 调用AddAssets()时未设置MirrorAssets，已忽略\n", self.spider.GetName())
+		return 0
+	}
+	page, err := url.Parse(self.GetUrl())
+	if err != nil {
+		return 0
+	}
+	types := self.spider.AssetTypes
+	if len(types) == 0 {
+		types = DefaultAssetTypes
+	}
+
+	var refs []string
+	self.Each("link[href]", func(i int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		rel = strings.ToLower(rel)
+		if strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") {
+			href, _ := s.Attr("href")
+			refs = append(refs, self.AbsURL(href))
+		}
+	})
+	self.Each("script[src], source[src]", func(i int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		refs = append(refs, self.AbsURL(src))
+	})
+	refs = append(refs, self.Images(true)...)
+
+	var n int
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		u, err := url.Parse(ref)
+		if err != nil || seen[ref] || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		seen[ref] = true
+		if !sameOrigin(page, u, scope) || !hasAssetType(u.Path, types) {
+			continue
+		}
+		self.AddQueue(&request.Request{Url: ref, Rule: ASSET_RULE})
+		n++
+	}
+	return n
+}
+
+func sameOrigin(page, asset *url.URL, scope string) bool {
+	a, b := strings.ToLower(page.Hostname()), strings.ToLower(asset.Hostname())
+	if scope == ASSET_SAME_DOMAIN {
+		return registeredDomain(a) == registeredDomain(b)
+	}
+	return a == b
+}
+
+func hasAssetType(p string, types []string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	for _, t := range types {
+		if strings.ToLower(t) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// 常见的二级公共后缀，如.com.cn、.co.uk
+var secondLevelSuffix = map[string]bool{
+	"com": true, "net": true, "org": true, "gov": true, "edu": true,
+	"ac": true, "co": true, "or": true, "ne": true, "go": true,
+}
+
+// 返回主机名的注册域名（近似），如www.example.com.cn返回example.com.cn，IP地址原样返回
+func registeredDomain(host string) string {
+	labels := strings.Split(host, ".")
+	n := len(labels)
+	if n <= 2 || strings.Trim(host, "0123456789.") == "" {
+		return host
+	}
+	if len(labels[n-1]) == 2 && secondLevelSuffix[labels[n-2]] {
+		return strings.Join(labels[n-3:], ".")
+	}
+	return strings.Join(labels[n-2:], ".")
+}
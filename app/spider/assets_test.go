@@ -0,0 +1,33 @@
+package spider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddAssets(t *testing.T) {
+	sp := testSpider()
+	sp.MirrorAssets = ASSET_SAME_DOMAIN
+	sp = sp.Copy()
+	pull := captureRequests(sp)
+	ctx := testContext(t, sp, "list", testPage{
+		url: "http://www.example.com/a/page.html",
+		body: `<link rel="stylesheet" href="style.css"><link rel="canonical" href="/x.css">
+			<script src="https://cdn.other.com/lib.js"></script><script src="//static.example.com/app.js"></script>
+			<img src="/img/a.png"><img src="/img/a.png"><img src="/api/pic?id=1">`,
+	})
+	if n := ctx.AddAssets(); n != 3 {
+		t.Fatalf("AddAssets: %v", n)
+	}
+	var urls []string
+	for _, req := range pull() {
+		if req.GetRuleName() != ASSET_RULE {
+			t.Errorf("rule: %v", req.GetRuleName())
+		}
+		urls = append(urls, req.GetUrl())
+	}
+	if strings.Join(urls, " ") != "http://www.example.com/a/style.css http://static.example.com/app.js http://www.example.com/img/a.png" {
+		t.Fatalf("urls: %v", urls)
+	}
+	PutContext(ctx)
+}
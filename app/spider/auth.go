@@ -0,0 +1,73 @@
+package spider
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// 为匹配的请求设置HTTP Basic认证，请求中已指定Authorization时不覆盖。
+// host为主机名（可含端口），或以http://、https://开头的URL前缀。
+func (self *Spider) SetBasicAuth(host, username, password string) {
+	self.setAuthority(host, "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// 为匹配的请求设置Bearer令牌，规则同SetBasicAuth()。
+func (self *Spider) SetBearerToken(host, token string) {
+	self.setAuthority(host, "Bearer "+token)
+}
+
+// 获取请求地址匹配的Authorization请求头，URL前缀优先于主机名，较长的前缀优先。
+func (self *Spider) GetAuthorization(rawurl string) string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if len(self.authority) == 0 {
+		return ""
+	}
+	var auth, prefix string
+	for k, v := range self.authority {
+		if isURLPrefix(k) && strings.HasPrefix(rawurl, k) && len(k) > len(prefix) {
+			auth, prefix = v, k
+		}
+	}
+	if prefix != "" {
+		return auth
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	if auth, ok := self.authority[strings.ToLower(u.Host)]; ok {
+		return auth
+	}
+	return self.authority[strings.ToLower(u.Hostname())]
+}
+
+func (self *Spider) setAuthority(host, auth string) {
+	if !isURLPrefix(host) {
+		host = strings.ToLower(host)
+	}
+	self.lock.Lock()
+	if self.authority == nil {
+		self.authority = make(map[string]string)
+	}
+	self.authority[host] = auth
+	self.lock.Unlock()
+}
+
+func (self *Spider) copyAuthority() map[string]string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.authority == nil {
+		return nil
+	}
+	m := make(map[string]string, len(self.authority))
+	for k, v := range self.authority {
+		m[k] = v
+	}
+	return m
+}
+
+func isURLPrefix(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
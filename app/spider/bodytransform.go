@@ -0,0 +1,65 @@
+package spider
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// 当前规则的Rule.BodyTransform，未设置时返回nil
+func (self *Context) bodyTransform() func([]byte) []byte {
+	if self.spider == nil || self.Request == nil {
+		return nil
+	}
+	rule, ok := self.spider.GetRule(self.GetRuleName())
+	if !ok {
+		return nil
+	}
+	return rule.BodyTransform
+}
+
+// 按规则的BodyTransform清理已读取的内容
+func (self *Context) transformText() {
+	if fn := self.bodyTransform(); fn != nil && self.text != nil {
+		self.text = fn(self.text)
+	}
+}
+
+// 依次执行多个内容清理函数，用于Rule.BodyTransform
+func ChainTransform(fns ...func([]byte) []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		for _, fn := range fns {
+			b = fn(b)
+		}
+		return b
+	}
+}
+
+var jsonpRegexp = regexp.MustCompile(`^\s*(?:/\*\*/\s*)?[\w$.]+\s*\(([\s\S]*)\)\s*;?\s*$`)
+
+// 去除JSONP的回调函数包装，如"cb({...});"得到"{...}"，不是JSONP时原样返回，用于Rule.BodyTransform
+func StripJSONP(b []byte) []byte {
+	if m := jsonpRegexp.FindSubmatch(b); m != nil {
+		return m[1]
+	}
+	return b
+}
+
+// 常见的防JSON劫持(XSSI)前缀
+var xssiPrefixes = [][]byte{
+	[]byte(")]}',"),
+	[]byte(")]}'"),
+	[]byte("while(1);"),
+	[]byte("for(;;);"),
+	[]byte("{}&&"),
+}
+
+// 去除防JSON劫持(XSSI)前缀，如")]}'"、"while(1);"，无前缀时原样返回，用于Rule.BodyTransform
+func StripXSSI(b []byte) []byte {
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	for _, prefix := range xssiPrefixes {
+		if bytes.HasPrefix(trimmed, prefix) {
+			return bytes.TrimLeft(trimmed[len(prefix):], " \t\r\n")
+		}
+	}
+	return b
+}
@@ -0,0 +1,33 @@
+package spider
+
+import (
+	"testing"
+)
+
+func TestBodyTransform(t *testing.T) {
+	cases := []struct {
+		fn       func([]byte) []byte
+		in, want string
+	}{
+		{StripJSONP, `jQuery123_456({"a":[1,2]});`, `{"a":[1,2]}`},
+		{StripJSONP, " /**/ cb.done ( [1] ) \n", " [1] "},
+		{StripJSONP, `{"a":"f(x)"}`, `{"a":"f(x)"}`},
+		{StripXSSI, ")]}'\n{\"a\":1}", `{"a":1}`},
+		{StripXSSI, ")]}',\n[1]", `[1]`},
+		{StripXSSI, "while(1);[1]", `[1]`},
+		{StripXSSI, `{"a":1}`, `{"a":1}`},
+	}
+	for _, c := range cases {
+		if got := string(c.fn([]byte(c.in))); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+
+	sp := testSpider()
+	sp.RuleTree.Trunk["list"].BodyTransform = ChainTransform(StripXSSI, StripJSONP)
+	ctx := testContext(t, sp, "list", testPage{body: ")]}'\ncb({\"a\":1})"})
+	if s := ctx.GetText(); s != `{"a":1}` {
+		t.Fatalf("transformed: %q", s)
+	}
+	PutContext(ctx)
+}
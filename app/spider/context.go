@@ -2,34 +2,63 @@ package spider
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
 	"sync"
 	"time"
 	"unsafe"
 
+	"github.com/antchfx/xmlquery"
+	"golang.org/x/net/html"
 	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
 
 	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
 	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
 	"github.com/henrylee2cn/pholcus/common/goquery"
 	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
 )
 
+// 以PhantomJS内核下载请求并执行页面操作，由下载器注册
+var BrowserDownload func(*request.Request, *surfer.BrowserActions) (*http.Response, error)
+
+// 不经过调度队列立即下载请求，由下载器注册
+var SyncDownload func(*Spider, *request.Request) *Context
+
 type Context struct {
 	spider   *Spider           // 规则
 	Request  *request.Request  // 原始请求
 	Response *http.Response    // 响应流，其中URL拷贝自*request.Request
 	text     []byte            // 下载内容Body的字节流格式
+	raw      []byte            // 转码前的下载内容，见ReinterpretAs()
 	dom      *goquery.Document // 下载内容Body为html时，可转换为Dom的对象
+	jsonRaw  json.RawMessage   // 缓存的GetJsonRaw()结果
+	xmlDoc   *xmlquery.Node    // 缓存的GetXml()结果
+	hashes   [2]string         // 缓存的BodyHash()与ContentHash()结果
+	finds    findCache         // 缓存的Find()结果
 	items    []data.DataCell   // 存放以文本形式输出的结果数据
 	files    []data.FileCell   // 存放欲直接输出的文件("Name": string; "Body": io.ReadCloser)
 	err      error             // 错误标记
+	sequence int64             // 输出结果的序号，见Rule.Ordered
+	charset  string            // 读取响应时采用的页面编码，见GetCharset()
+	served   int               // 实际下载当前响应的下载器ID
+	proxy    string            // 实际下载当前响应所用的代理，见GetProxy()
+	executed string            // Parse()实际执行的规则名，见GetExecutedRule()
+	// 仅作用于当前页面处理过程的临时数据，不随子请求传递，Context回收时清空；
+	// 与之相对，Request.Temp会随请求持久化并可传递给子请求
+	Meta map[string]interface{}
 	sync.Mutex
 }
 
@@ -50,6 +79,10 @@ func GetContext(sp *Spider, req *request.Request) *Context {
 	ctx := contextPool.Get().(*Context)
 	ctx.spider = sp
 	ctx.Request = req
+	if req != nil {
+		ctx.served = req.GetDownloaderID()
+		ctx.proxy = req.GetProxy()
+	}
 	return ctx
 }
 
@@ -63,8 +96,15 @@ func PutContext(ctx *Context) {
 	ctx.spider = nil
 	ctx.Request = nil
 	ctx.text = nil
-	ctx.dom = nil
+	ctx.raw = nil
+	ctx.resetCaches()
 	ctx.err = nil
+	ctx.sequence = 0
+	ctx.served = 0
+	ctx.proxy = ""
+	ctx.executed = ""
+	ctx.charset = ""
+	ctx.Meta = nil
 	contextPool.Put(ctx)
 }
 
@@ -73,6 +113,18 @@ func (self *Context) SetResponse(resp *http.Response) *Context {
 	return self
 }
 
+// 记录实际下载当前响应的下载器ID，由下载器在发生降级或切换内核时调用。
+func (self *Context) SetDownloaderID(id int) *Context {
+	self.served = id
+	return self
+}
+
+// 记录实际下载当前响应所用的代理，由下载器调用。
+func (self *Context) SetProxyUsed(proxy string) *Context {
+	self.proxy = proxy
+	return self
+}
+
 // 标记下载错误。
 func (self *Context) SetError(err error) {
 	self.err = err
@@ -112,10 +164,142 @@ func (self *Context) AddQueue(req *request.Request) *Context {
 		req.SetReferer(self.GetUrl())
 	}
 
-	self.spider.RequestPush(req)
+	// 继承当前请求的会话
+	if req.GetSession() == "" && self.Request != nil {
+		req.SetSession(self.Request.GetSession())
+	}
+
+	// 继承当前请求的请求组
+	if req.GetGroup() == "" && self.Request != nil {
+		req.SetGroup(self.Request.GetGroup())
+	}
+
+	self.pushRequest(req)
 	return self
 }
 
+// 将url作为新的种子添加至队列，下载后交由RuleTree.Root处理，用于从首页等页面发现新的入口。
+// 与AddQueue指定规则不同，该请求的规则名为ROOT_RULE，Parse找不到同名规则时即执行Root，
+// 且此时的Context带有该页面的响应（Root可据ctx.Response是否为nil区分任务启动与重新播种）；
+// 与AddQueue相同地继承当前请求的会话并补填Referer。
+func (self *Context) EnqueueSeed(url string) *Context {
+	return self.AddQueue(&request.Request{
+		Url:  url,
+		Rule: ROOT_RULE,
+	})
+}
+
+// 跟随当前重定向响应的Location添加请求至队列，用于禁止自动重定向(RedirectTimes<0)以逐跳处理的场景。
+// 由ruleName指定的规则解析，默认为当前规则；以当前请求为模板生成（见NewRequest），并沿用Temp，
+// 307/308时沿用请求方法与请求体。当前响应不是3xx或缺少Location时返回错误。
+func (self *Context) FollowRedirect(ruleName ...string) error {
+	if self.Response == nil || !self.IsRedirect() {
+		return fmt.Errorf("FollowRedirect: 响应状态码 %v 不是重定向", self.GetStatusCode())
+	}
+	loc, err := self.Response.Location()
+	if err != nil {
+		return fmt.Errorf("FollowRedirect: %v", err)
+	}
+	rule := self.GetRuleName()
+	if len(ruleName) > 0 && ruleName[0] != "" {
+		rule = ruleName[0]
+	}
+	req := self.NewRequest(loc.String(), rule)
+	req.Temp = self.CopyTemps()
+	if code := self.GetStatusCode(); code == http.StatusTemporaryRedirect || code == http.StatusPermanentRedirect {
+		req.Method = self.Request.GetMethod()
+		req.PostData = self.Request.GetPostData()
+		if ct := self.Request.GetHeader().Get("Content-Type"); ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+	self.AddQueue(req)
+	return nil
+}
+
+// 生成表单编码的POST请求并添加至队列，与AddQueue相同地继承当前请求的会话并补填Referer。
+func (self *Context) PostForm(url, ruleName string, values url.Values) *Context {
+	return self.AddQueue((&request.Request{
+		Url:    url,
+		Rule:   ruleName,
+		Method: "POST",
+	}).SetForm(values))
+}
+
+// 立即提交表单并返回响应的Context，用于登录等须等待结果的流程，用毕应调用PutContext回收。
+// 不经过调度队列，不受并发数限制，也不记录成功或失败历史；下载错误见返回值的GetError()。
+func (self *Context) PostFormSync(url string, values url.Values) *Context {
+	// 若已主动终止任务，则崩溃爬虫协程
+	self.spider.tryPanic()
+
+	req := (&request.Request{
+		Url:    url,
+		Rule:   self.GetRuleName(),
+		Method: "POST",
+	}).SetForm(values)
+	err := req.
+		SetSpiderName(self.spider.GetName()).
+		SetEnableCookie(self.spider.GetEnableCookie()).
+		Prepare()
+	if err == nil && SyncDownload == nil {
+		err = fmt.Errorf("未注册下载器")
+	}
+	if err != nil {
+		ctx := GetContext(self.spider, req)
+		ctx.SetError(err)
+		return ctx
+	}
+	if self.Response != nil {
+		req.SetReferer(self.GetUrl())
+	}
+	if self.Request != nil {
+		req.SetSession(self.Request.GetSession())
+	}
+	return SyncDownload(self.spider, req)
+}
+
+// 立即下载req并返回带响应的Context，用于在同一规则中合并多个页面的内容（如列表页引用的详情JSON）后一并输出，
+// 用毕应调用PutContext回收；下载出错时同时返回Context（可查看响应状态）与错误。
+// 沿用当前请求的会话（cookie）与代理并补填Referer；下载前与队列中的请求相同地随机暂停（含自适应限速的间隔），
+// 结果计入自适应限速的失败率，任务被终止时与Sleep()相同地崩溃爬虫协程。
+// 不经过调度队列，不去重，不记录成功或失败历史，也不执行req.Rule的ParseFunc。
+// 注意：下载完成前阻塞当前爬虫协程（占用并发名额），不宜用于大量请求。
+func (self *Context) Fetch(req *request.Request) (*Context, error) {
+	// 若已主动终止任务，则崩溃爬虫协程
+	self.spider.tryPanic()
+
+	err := req.
+		SetSpiderName(self.spider.GetName()).
+		SetEnableCookie(self.spider.GetEnableCookie()).
+		Prepare()
+	if err == nil && SyncDownload == nil {
+		err = fmt.Errorf("未注册下载器")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.GetReferer() == "" && self.Response != nil {
+		req.SetReferer(self.GetUrl())
+	}
+	if self.Request != nil {
+		if req.GetSession() == "" {
+			req.SetSession(self.Request.GetSession())
+		}
+		if req.GetProxy() == "" {
+			req.SetProxy(self.Request.GetProxy())
+		}
+	}
+
+	pause := time.Duration(self.spider.Pausetime) * time.Millisecond
+	self.RandomDelay(pause/2, pause*2)
+	self.Sleep(self.spider.ThrottlePause())
+
+	ctx := SyncDownload(self.spider, req)
+	err = ctx.GetError()
+	self.spider.ThrottleFeedback(err == nil)
+	return ctx, err
+}
+
 // 用于动态规则添加请求。
 func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 	// 若已主动终止任务，则崩溃爬虫协程
@@ -139,8 +323,32 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 			}
 		}
 	}
+	if lang, ok := jreq["AcceptLanguage"].(string); ok {
+		req.SetAcceptLanguage(lang)
+	}
 	req.PostData, _ = jreq["PostData"].(string)
+	req.Session, _ = jreq["Session"].(string)
+	if body, ok := jreq["JSONBody"].(map[string]interface{}); ok {
+		req.SetJSONBody(body)
+	}
+	if form, ok := jreq["Form"].(map[string]interface{}); ok {
+		values := url.Values{}
+		for k, v := range form {
+			switch vals := v.(type) {
+			case []interface{}:
+				for _, val := range vals {
+					values.Add(k, fmt.Sprint(val))
+				}
+			case []string:
+				values[k] = vals
+			default:
+				values.Set(k, fmt.Sprint(v))
+			}
+		}
+		req.SetForm(values)
+	}
 	req.Reloadable, _ = jreq["Reloadable"].(bool)
+	req.NoKeepAlive, _ = jreq["NoKeepAlive"].(bool)
 	if t, ok := jreq["DialTimeout"].(int64); ok {
 		req.DialTimeout = time.Duration(t)
 	}
@@ -180,7 +388,11 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 		req.SetReferer(self.GetUrl())
 	}
 
-	self.spider.RequestPush(req)
+	if req.GetSession() == "" && self.Request != nil {
+		req.SetSession(self.Request.GetSession())
+	}
+
+	self.pushRequest(req)
 	return self
 }
 
@@ -194,36 +406,64 @@ func (self *Context) Output(item interface{}, ruleName ...string) {
 		logs.Log.Error("蜘蛛 %s 调用Output()时，指定的规则名不存在！", self.spider.GetName())
 		return
 	}
-	var _item map[string]interface{}
-	switch item2 := item.(type) {
-	case map[int]interface{}:
-		_item = self.CreatItem(item2, _ruleName)
-	case request.Temp:
-		for k := range item2 {
-			self.spider.UpsertItemField(rule, k)
-		}
-		_item = item2
-	case map[string]interface{}:
-		for k := range item2 {
-			self.spider.UpsertItemField(rule, k)
-		}
-		_item = item2
+	_item := self.toItem(item, _ruleName, rule)
+	self.Lock()
+	self.items = append(self.items, self.newDataCell(_ruleName, rule, _item))
+	self.Unlock()
+}
+
+// 以keyFields为标识输出文本结果，支持更新的输出方式（mgo、mysql）据此更新已存在的同一结果，
+// 其余输出方式仍按追加输出；keyFields为空时同Output()，其余参数同Output()。
+func (self *Context) OutputUpsert(item interface{}, keyFields []string, ruleName ...string) {
+	_ruleName, rule, found := self.getRule(ruleName...)
+	if !found {
+		logs.Log.Error("蜘蛛 %s 调用OutputUpsert()时，指定的规则名不存在！", self.spider.GetName())
+		return
+	}
+	cell := self.newDataCell(_ruleName, rule, self.toItem(item, _ruleName, rule))
+	if len(keyFields) > 0 {
+		cell["Key"] = append([]string(nil), keyFields...)
 	}
 	self.Lock()
-	if self.spider.NotDefaultField {
-		self.items = append(self.items, data.GetDataCell(_ruleName, _item, "", "", ""))
-	} else {
-		self.items = append(self.items, data.GetDataCell(_ruleName, _item, self.GetUrl(), self.GetReferer(), time.Now().Format("2006-01-02 15:04:05")))
+	self.items = append(self.items, cell)
+	self.Unlock()
+}
+
+// 批量输出文本结果，所有数据在同一次加锁中追加。
+// items中每个元素的类型要求与Output()相同，
+// ruleName为空时默认当前规则。
+func (self *Context) OutputMany(items []interface{}, ruleName ...string) {
+	_ruleName, rule, found := self.getRule(ruleName...)
+	if !found {
+		logs.Log.Error("蜘蛛 %s 调用OutputMany()时，指定的规则名不存在！", self.spider.GetName())
+		return
+	}
+	cells := make([]data.DataCell, len(items))
+	for i, item := range items {
+		cells[i] = self.newDataCell(_ruleName, rule, self.toItem(item, _ruleName, rule))
 	}
+	self.Lock()
+	self.items = append(self.items, cells...)
 	self.Unlock()
 }
 
 // 输出文件。
 // nameOrExt指定文件名或仅扩展名，为空时默认保持原文件名（包括扩展名）不变。
 func (self *Context) FileOutput(nameOrExt ...string) {
+	self.FileOutputAs(FILE_RAW, nameOrExt...)
+}
+
+// 按format（见FileFormat）处理后输出文件，如FILE_UTF8|FILE_GZIP用于归档文本语料，其余同FileOutput()。
+func (self *Context) FileOutputAs(format FileFormat, nameOrExt ...string) {
 	// 读取完整文件流
-	bytes, err := ioutil.ReadAll(self.Response.Body)
-	self.Response.Body.Close()
+	var bytes []byte
+	var err error
+	if self.spider.ResumeFile {
+		bytes, err = self.resumeFileBody()
+	} else {
+		bytes, err = ioutil.ReadAll(self.Response.Body)
+		self.Response.Body.Close()
+	}
 	if err != nil {
 		panic(err.Error())
 		return
@@ -252,12 +492,27 @@ func (self *Context) FileOutput(nameOrExt ...string) {
 		ext = ".html"
 	}
 
+	if bytes, err = self.formatFile(bytes, format); err != nil {
+		logs.Log.Error(" *     [FileOutput][%v]: %v\n", self.GetUrl(), err)
+		return
+	}
+	if format&FILE_GZIP != 0 {
+		ext += ".gz"
+	}
+
 	// 保存到文件临时队列
 	self.Lock()
 	self.files = append(self.files, data.GetFileCell(self.GetRuleName(), baseName+ext, bytes))
 	self.Unlock()
 }
 
+// 输出规则中生成的文件结果，与响应内容无关，name为含扩展名的文件名。
+func (self *Context) OutputFile(name string, body []byte) {
+	self.Lock()
+	self.files = append(self.files, data.GetFileCell(self.GetRuleName(), name, body))
+	self.Unlock()
+}
+
 // 生成文本结果。
 // 用ruleName指定匹配的ItemFields字段，为空时默认当前规则。
 func (self *Context) CreatItem(item map[int]interface{}, ruleName ...string) map[string]interface{} {
@@ -281,6 +536,33 @@ func (self *Context) SetTemp(key string, value interface{}) *Context {
 	return self
 }
 
+// 在当前Context中保存临时数据，不会传递给子请求，
+// 需传递给子请求时请使用SetTemp。
+func (self *Context) SetMeta(key string, value interface{}) *Context {
+	if self.Meta == nil {
+		self.Meta = make(map[string]interface{})
+	}
+	self.Meta[key] = value
+	return self
+}
+
+// 设置当前请求的调度优先级（数值越大越优先，最小为0），此后由NewRequest生成的后续请求沿用该值，
+// 亦可对生成的请求调用SetPriority单独调整，如令“下一页”先于详情页执行。
+// 调度严格按优先级从高到低出队，不做老化处理，持续产生的高优先级请求会使低优先级请求一直等待。
+func (self *Context) SetPriority(priority int) *Context {
+	self.Request.SetPriority(priority)
+	return self
+}
+
+// 设置当前请求的会话ID，此后添加的请求未指定会话时沿用该会话。
+// 仅在Spider.EnableCookie为true时生效，不同会话使用相互隔离的cookie容器，
+// 容器只保存于内存中，不随成功/失败记录持久化。
+func (self *Context) SetSession(session string) *Context {
+	// 不重置当前请求的唯一识别码，以免影响其去重记录
+	self.Request.Session = session
+	return self
+}
+
 func (self *Context) SetUrl(url string) *Context {
 	self.Request.Url = url
 	return self
@@ -291,6 +573,25 @@ func (self *Context) SetReferer(referer string) *Context {
 	return self
 }
 
+// 预先按顺序登记指定Rule的全部结果字段名，使输出的表头在任何结果出现之前即完整、稳定，
+// 通常在入口规则中调用；已存在的字段保持原有索引位置，重复调用无副作用。
+// 若ruleName为空，默认为当前规则。
+func (self *Context) RegisterItemFields(ruleName string, fields ...string) *Context {
+	var names []string
+	if ruleName != "" {
+		names = append(names, ruleName)
+	}
+	_, rule, found := self.getRule(names...)
+	if !found {
+		logs.Log.Error("蜘蛛 %s 调用RegisterItemFields()时，指定的规则名不存在！", self.spider.GetName())
+		return self
+	}
+	for _, field := range fields {
+		self.spider.UpsertItemField(rule, field)
+	}
+	return self
+}
+
 // 为指定Rule动态追加结果字段名，并获取索引位置，
 // 已存在时获取原来索引位置，
 // 若ruleName为空，默认为当前规则。
@@ -336,14 +637,153 @@ func (self *Context) Parse(ruleName ...string) *Context {
 		self.Request.SetRuleName(_ruleName)
 	}
 	if !found {
+		self.executed = ROOT_RULE
 		self.spider.RuleTree.Root(self)
 		return self
 	}
+	// 响应媒体类型不符时改由备用规则处理，无备用规则时记为错误
+	if self.IsContentTypeMismatch() {
+		fallback, ok := self.spider.GetRule(rule.ContentTypeFallback)
+		if !ok {
+			self.SetError(fmt.Errorf("响应类型 %s 不符合规则 %s 的要求 %s", self.mediaType(), _ruleName, rule.ContentType))
+			return self
+		}
+		_ruleName, rule = rule.ContentTypeFallback, fallback
+		self.Request.SetRuleName(_ruleName)
+	}
 	if rule.ParseFunc == nil {
-		logs.Log.Error("蜘蛛 %s 的规则 %s 未定义ParseFunc", self.spider.GetName(), ruleName[0])
+		logs.Log.Error("蜘蛛 %s 的规则 %s 未定义ParseFunc", self.spider.GetName(), _ruleName)
 		return self
 	}
+	self.executed = _ruleName
 	rule.ParseFunc(self)
+	if rule.FollowNext {
+		self.followNext(_ruleName)
+	}
+	return self
+}
+
+// 返回Parse()为当前响应实际执行了ParseFunc的规则名（含ContentTypeFallback备用规则），
+// 规则名不存在而执行RuleTree.Root时返回ROOT_RULE；Parse()调用前或未执行任何规则时返回空字符串。
+func (self *Context) GetExecutedRule() string {
+	if self == nil {
+		return ""
+	}
+	return self.executed
+}
+
+// 以body为页面文本执行指定规则的ParseFunc，不发起网络请求，用于处理页面中内嵌的子文档。
+// 执行完毕后恢复原有文本及DOM。
+func (self *Context) ParseWith(ruleName, body string) error {
+	// 若已主动终止任务，则崩溃爬虫协程
+	self.spider.tryPanic()
+
+	rule, found := self.spider.GetRule(ruleName)
+	if !found {
+		return fmt.Errorf("蜘蛛 %s 不存在规则 %s", self.spider.GetName(), ruleName)
+	}
+	if rule.ParseFunc == nil {
+		return fmt.Errorf("蜘蛛 %s 的规则 %s 未定义ParseFunc", self.spider.GetName(), ruleName)
+	}
+	// 期间Output等方法默认归属于该规则
+	text, dom, jsonRaw, xmlDoc, hashes, current := self.text, self.dom, self.jsonRaw, self.xmlDoc, self.hashes, self.Request.GetRuleName()
+	defer func() {
+		self.text, self.dom, self.jsonRaw, self.xmlDoc, self.hashes = text, dom, jsonRaw, xmlDoc, hashes
+		self.Request.SetRuleName(current)
+	}()
+	self.Request.SetRuleName(ruleName)
+	self.ResetText(body)
+	rule.ParseFunc(self)
+	return nil
+}
+
+// 暂停当前协程d时长，期间若任务被终止则立即唤醒并崩溃爬虫协程。
+// 规则中需要等待时（如轮询状态接口）应代替time.Sleep()使用，以免拖延任务的终止。
+func (self *Context) Sleep(d time.Duration) {
+	self.spider.tryPanic()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-self.spider.stopping():
+	}
+	self.spider.tryPanic()
+}
+
+// 暂停当前协程min~max之间的随机时长，与Sleep()相同地响应任务终止，
+// 用于规则中同步执行的多步操作（如登录后连续请求）之间模拟人工操作的间隔，与请求调度间的Pausetime无关。
+// 等待期间占用该爬虫协程（并发名额），应谨慎使用。
+func (self *Context) RandomDelay(min, max time.Duration) {
+	if max < min {
+		min, max = max, min
+	}
+	d := min
+	if max > min {
+		delayRand.Lock()
+		d += time.Duration(delayRand.Int63n(int64(max-min) + 1))
+		delayRand.Unlock()
+	}
+	self.Sleep(d)
+}
+
+// RandomDelay()使用的随机数生成器，以启动时刻为种子
+var delayRand = struct {
+	*rand.Rand
+	sync.Mutex
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// 以浏览器内核重新渲染当前页面，等待匹配selector的元素出现（至多timeout）后替换页面内容，
+// 用于异步加载的内容。仅对PhantomJS下载器的GET请求有效。
+//
+// 注意：重新渲染会再次下载当前页面，非GET请求（如POST表单提交）为避免重复提交一律忽略。
+func (self *Context) WaitForSelector(selector string, timeout time.Duration) *Context {
+	return self.browse("WaitForSelector", &surfer.BrowserActions{
+		WaitSelector: selector,
+		WaitTimeout:  timeout,
+	})
+}
+
+// 以浏览器内核重新渲染当前页面，多次滚动至页面底部以触发懒加载后替换页面内容，
+// 滚动次数及每次滚动后的等待时长见配置项browser::scrolltimes与browser::scrollsettle。
+// 仅对PhantomJS下载器的GET请求有效，同样会再次下载当前页面，见WaitForSelector()。
+func (self *Context) ScrollToBottom() *Context {
+	return self.browse("ScrollToBottom", &surfer.BrowserActions{
+		ScrollTimes:  config.BROWSER_SCROLL_TIMES,
+		ScrollSettle: time.Duration(config.BROWSER_SCROLL_SETTLE) * time.Millisecond,
+	})
+}
+
+func (self *Context) browse(method string, actions *surfer.BrowserActions) *Context {
+	// 若已主动终止任务，则崩溃爬虫协程
+	self.spider.tryPanic()
+
+	if self.Request.GetDownloaderID() != request.PHANTOM_ID || BrowserDownload == nil {
+		logs.Log.Warning(" *     蜘蛛 %s 调用%s()时，请求未使用PhantomJS下载器，已忽略\n", self.spider.GetName(), method)
+		return self
+	}
+	if m := self.Request.GetMethod(); m != "GET" {
+		logs.Log.Warning(" *     蜘蛛 %s 调用%s()时，请求方法为%s，重新下载将重复提交，已忽略\n", self.spider.GetName(), method, m)
+		return self
+	}
+	resp, err := BrowserDownload(self.Request, actions)
+	if err != nil {
+		logs.Log.Error(" *     蜘蛛 %s 调用%s()失败: %v\n", self.spider.GetName(), method, err)
+		return self
+	}
+	if self.Response != nil && self.Response.Body != nil {
+		self.Response.Body.Close()
+	}
+	self.Response = resp
+	self.served = request.PHANTOM_ID
+	self.text = nil
+	self.resetCaches()
+	return self
+}
+
+// 设置此后输出结果的序号，如页码或楼层号。
+// 规则开启Ordered时，同批输出的结果按序号从小到大排列。
+func (self *Context) SetSequence(seq int64) *Context {
+	self.sequence = seq
 	return self
 }
 
@@ -379,17 +819,110 @@ func (self *Context) RunTimer(id string) bool {
 	return self.spider.RunTimer(id)
 }
 
+// 以b替换响应内容（视为UTF-8文本，不再转码），并清除文本、DOM等缓存，
+// 之后的GetText()、GetDom()及FileOutput()均基于新内容。
+// 是在规则中变换响应（如去除JSONP回调、解密混淆内容）的推荐方式。
+func (self *Context) SetResponseBody(b []byte) *Context {
+	if b == nil {
+		b = []byte{}
+	}
+	if self.Response != nil {
+		if self.Response.Body != nil {
+			self.Response.Body.Close()
+		}
+		self.Response.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+	self.text = b
+	self.resetCaches()
+	return self
+}
+
 // 重置下载的文本内容，
 func (self *Context) ResetText(body string) *Context {
 	x := (*[2]uintptr)(unsafe.Pointer(&body))
 	h := [3]uintptr{x[0], x[1], x[1]}
 	self.text = *(*[]byte)(unsafe.Pointer(&h))
+	self.resetCaches()
+	return self
+}
+
+// 清除由响应内容派生的缓存，替换响应内容时调用；新增此类缓存时须在此一并清除。
+func (self *Context) resetCaches() {
 	self.dom = nil
+	self.jsonRaw = nil
+	self.xmlDoc = nil
+	self.hashes = [2]string{}
+	self.finds = findCache{}
+}
+
+// 以指定编码重新转码已下载的内容并替换GetText()的结果，无需重新下载，
+// 用于GetCharset()所示的编码有误时，如cs为"big5"、"gbk"；编码无法识别时记录日志后不做修改。
+func (self *Context) ReinterpretAs(cs string) *Context {
+	if self.text == nil && self.Response != nil {
+		self.initText()
+	}
+	if self.raw == nil {
+		logs.Log.Warning(" *     [ReinterpretAs]: 无已下载的内容\n")
+		return self
+	}
+	e, name := charset.Lookup(cs)
+	if e == nil {
+		logs.Log.Warning(" *     [ReinterpretAs][%v]: unsupported charset: %q\n", self.GetUrl(), cs)
+		return self
+	}
+	text, err := e.NewDecoder().Bytes(self.raw)
+	if err != nil {
+		logs.Log.Warning(" *     [ReinterpretAs][%v]: %v\n", self.GetUrl(), err)
+		return self
+	}
+	self.text = text
+	self.charset = name
+	self.transformText()
+	self.resetCaches()
 	return self
 }
 
 //**************************************** Get 类公开方法 *******************************************\\
 
+// 响应是否为HTML，可在调用GetDom()前判断。依据Content-Type，未指定时根据内容推测。
+func (self *Context) IsHTML() bool {
+	switch self.mediaType() {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// 响应是否为JSON，依据同IsHTML()。
+func (self *Context) IsJSON() bool {
+	mt := self.mediaType()
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// 响应是否为XML，依据同IsHTML()。
+func (self *Context) IsXML() bool {
+	mt := self.mediaType()
+	return mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml")
+}
+
+// 响应的媒体类型是否与当前规则声明的Rule.ContentType不符，未声明时返回false。依据同IsHTML()。
+func (self *Context) IsContentTypeMismatch() bool {
+	if self.Response == nil {
+		return false
+	}
+	rule, ok := self.spider.GetRule(self.GetRuleName())
+	if !ok || rule.ContentType == "" {
+		return false
+	}
+	mt := self.mediaType()
+	for _, prefix := range strings.Split(rule.ContentType, ",") {
+		if prefix = strings.ToLower(strings.TrimSpace(prefix)); prefix != "" && strings.HasPrefix(mt, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
 // 获取下载错误。
 func (self *Context) GetError() error {
 	// 若已主动终止任务，则崩溃爬虫协程
@@ -412,11 +945,138 @@ func (self *Context) GetResponse() *http.Response {
 	return self.Response
 }
 
-// 获取响应状态码。
+// 获取响应状态码，无响应时返回0。
 func (self *Context) GetStatusCode() int {
+	if self.Response == nil {
+		return 0
+	}
 	return self.Response.StatusCode
 }
 
+// 返回实际下载当前响应的下载器ID（request.SURF_ID或request.PHANTOM_ID），
+// 发生降级时可能与请求指定的不同；Context为nil时返回-1。
+func (self *Context) GetDownloaderID() int {
+	if self == nil {
+		return -1
+	}
+	return self.served
+}
+
+// 返回实际下载当前响应所用的代理（如"http://1.2.3.4:8080"），直连时返回空字符串，
+// 可用于找出被目标站点封禁的代理；Context为nil时返回空字符串。
+func (self *Context) GetProxy() string {
+	if self == nil {
+		return ""
+	}
+	return self.proxy
+}
+
+// 返回读取响应时采用的页面编码（规范名称，如"gbk"、"windows-1252"），
+// 无需转码时为"utf-8"，尚未读取响应、未采用surf内核或转码失败时为空。
+func (self *Context) GetCharset() string {
+	if self == nil {
+		return ""
+	}
+	return self.charset
+}
+
+// 读取响应时是否由其他编码转码为utf-8。
+func (self *Context) IsTranscoded() bool {
+	cs := self.GetCharset()
+	return cs != "" && cs != "utf-8"
+}
+
+// 当前响应是否经浏览器内核执行JS渲染。
+func (self *Context) IsRendered() bool {
+	return self.GetDownloaderID() == request.PHANTOM_ID
+}
+
+// 响应状态码是否为2xx。
+func (self *Context) IsSuccess() bool {
+	return self.GetStatusCode()/100 == 2
+}
+
+// 响应状态码是否为3xx。
+func (self *Context) IsRedirect() bool {
+	return self.GetStatusCode()/100 == 3
+}
+
+// 响应状态码是否为4xx。
+func (self *Context) IsClientError() bool {
+	return self.GetStatusCode()/100 == 4
+}
+
+// 响应状态码是否为5xx。
+func (self *Context) IsServerError() bool {
+	return self.GetStatusCode()/100 == 5
+}
+
+// 响应内容（解压后）是否小于Spider.MinBodySize，常见于封禁或错误页面。
+// 读取响应内容时会将其缓存，不影响之后的GetText()与FileOutput()。
+func (self *Context) IsThin() bool {
+	min := self.spider.MinBodySize
+	return min > 0 && self.bodyLen() < min
+}
+
+// 返回响应内容的字节数
+func (self *Context) bodyLen() int {
+	return len(self.rawBody())
+}
+
+// 返回响应内容（解压后、转码前），已调用GetText()时返回转码后的内容；
+// 读取后将其缓存回Response.Body，不影响之后的GetText()与FileOutput()
+func (self *Context) rawBody() []byte {
+	if self.text != nil {
+		return self.text
+	}
+	if self.Response == nil || self.Response.Body == nil {
+		return nil
+	}
+	raw, err := ioutil.ReadAll(self.Response.Body)
+	self.Response.Body.Close()
+	var body io.Reader = bytes.NewReader(raw)
+	if err != nil {
+		// 保留读取错误，交由之后的读取者处理
+		body = io.MultiReader(body, &errReader{err})
+	}
+	self.Response.Body = ioutil.NopCloser(body)
+	return raw
+}
+
+// 响应内容是否符合Spider.SetRetryOnBody()设置的重试条件，如HTTP 200的封禁或维护页面，
+// 未设置时返回false。读取响应内容时会将其缓存，不影响之后的GetText()与FileOutput()。
+func (self *Context) IsSoftFailure() bool {
+	if self.spider == nil || self.Response == nil {
+		return false
+	}
+	match := self.spider.GetRetryOnBody()
+	return match != nil && match(self.rawBody())
+}
+
+type errReader struct{ err error }
+
+func (self *errReader) Read([]byte) (int, error) {
+	return 0, self.err
+}
+
+// 响应状态码是否表示已被目标站点封禁，状态码集合由Spider.BannedStatus指定。
+func (self *Context) IsBanned() bool {
+	code := self.GetStatusCode()
+	if code == 0 {
+		return false
+	}
+	banned := DefaultBannedStatus
+	if self.spider != nil && len(self.spider.BannedStatus) > 0 {
+		banned = self.spider.BannedStatus
+	}
+	for _, c := range banned {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
 // 获取原始请求。
 func (self *Context) GetRequest() *request.Request {
 	return self.Request
@@ -427,6 +1087,12 @@ func (self *Context) CopyRequest() *request.Request {
 	return self.Request.Copy()
 }
 
+// 以当前请求为模板生成后续请求，沿用请求头、超时、代理等设置，可直接用于AddQueue，
+// 具体沿用与重置的字段见request.Request.Clone。
+func (self *Context) NewRequest(url, rule string) *request.Request {
+	return self.Request.Clone(url, rule)
+}
+
 // 获取结果字段名列表。
 func (self *Context) GetItemFields(ruleName ...string) []string {
 	_, rule, found := self.getRule(ruleName...)
@@ -467,6 +1133,29 @@ func (self *Context) PullItems() (ds []data.DataCell) {
 	return
 }
 
+// 返回当前已输出的文本结果的快照，不清空缓存，可用于规则中按已输出的结果去重或追加汇总结果。
+// 返回的切片为副本，其中的DataCell与缓存共享，不应修改。
+func (self *Context) PeekItems() []data.DataCell {
+	self.Lock()
+	defer self.Unlock()
+	return append([]data.DataCell(nil), self.items...)
+}
+
+// 将当前已输出的文本结果（见PeekItems()）序列化为JSON数组，不清空缓存，用于调试与测试中检查规则的全部输出。
+func (self *Context) ItemsJSON() (string, error) {
+	items := self.PeekItems()
+	if items == nil {
+		items = []data.DataCell{}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(items); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
 func (self *Context) PullFiles() (fs []data.FileCell) {
 	self.Lock()
 	fs = self.files
@@ -490,6 +1179,17 @@ func (self *Context) GetName() string {
 	return self.spider.GetName()
 }
 
+// 获取蜘蛛名称，同GetName()。
+func (self *Context) SpiderName() string {
+	return self.spider.GetName()
+}
+
+// 获取本次任务的ID（如"20060102-150405-1a2b3c"），用于区分多次运行的结果与日志；
+// 配置项output::taskid为true时，同时作为字段TaskID添加至每条文本结果。
+func (self *Context) GetTaskID() string {
+	return self.spider.GetTaskID()
+}
+
 // 获取规则树。
 func (self *Context) GetRules() map[string]*Rule {
 	return self.spider.GetRules()
@@ -500,6 +1200,11 @@ func (self *Context) GetRule(ruleName string) (*Rule, bool) {
 	return self.spider.GetRule(ruleName)
 }
 
+// 获取当前请求的调度优先级。
+func (self *Context) GetPriority() int {
+	return self.Request.GetPriority()
+}
+
 // 获取当前规则名。
 func (self *Context) GetRuleName() string {
 	return self.Request.GetRuleName()
@@ -525,6 +1230,23 @@ func (self *Context) CopyTemps() request.Temp {
 	return temps
 }
 
+// 获取当前Context中的临时数据，不存在时返回defaultValue
+func (self *Context) GetMeta(key string, defaultValue interface{}) interface{} {
+	if v, ok := self.Meta[key]; ok {
+		return v
+	}
+	return defaultValue
+}
+
+// 获得当前Context临时数据的副本，可用于显式传递给子请求。
+func (self *Context) CopyMeta() map[string]interface{} {
+	meta := make(map[string]interface{}, len(self.Meta))
+	for k, v := range self.Meta {
+		meta[k] = v
+	}
+	return meta
+}
+
 // 从原始请求获取Url，从而保证请求前后的Url完全相等，且中文未被编码。
 func (self *Context) GetUrl() string {
 	return self.Request.Url
@@ -549,14 +1271,94 @@ func (self *Context) GetRequestHeader() http.Header {
 }
 
 func (self *Context) GetReferer() string {
+	if self.Response == nil {
+		return self.Request.GetReferer()
+	}
 	return self.Response.Request.Header.Get("Referer")
 }
 
-// 获取响应的Cookie。
+// 获取响应头中某字段的全部值，如Set-Cookie、Link等可重复出现的字段。
+func (self *Context) GetHeaders(key string) []string {
+	return self.Response.Header[http.CanonicalHeaderKey(key)]
+}
+
+// 获取响应的Cookie（首个Set-Cookie），需要全部Cookie时使用GetCookies()。
 func (self *Context) GetCookie() string {
 	return self.Response.Header.Get("Set-Cookie")
 }
 
+// 解析响应头中的全部Set-Cookie。
+func (self *Context) GetCookies() []*http.Cookie {
+	return self.Response.Cookies()
+}
+
+// 解析响应头中的Link字段（RFC5988），返回[rel]绝对URL，如分页接口的"next"。
+func (self *Context) GetLinkHeaders() map[string]string {
+	links := map[string]string{}
+	for _, value := range self.GetHeaders("Link") {
+		for _, link := range splitLinkHeader(value) {
+			i := strings.Index(link, ">")
+			if !strings.HasPrefix(link, "<") || i < 0 {
+				continue
+			}
+			u := link[1:i]
+			if ref, err := self.Response.Request.URL.Parse(u); err == nil {
+				u = ref.String()
+			}
+			for _, param := range strings.Split(link[i+1:], ";") {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "rel" {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					rel = strings.ToLower(rel)
+					if _, ok := links[rel]; !ok {
+						links[rel] = u
+					}
+				}
+			}
+		}
+	}
+	return links
+}
+
+// 将响应头Link字段中rel="next"的链接添加至队列，由ruleName解析，见Rule.FollowNext
+func (self *Context) followNext(ruleName string) {
+	if self.Response == nil {
+		return
+	}
+	next := self.GetLinkHeaders()["next"]
+	if next == "" || next == self.GetUrl() {
+		return
+	}
+	req := self.NewRequest(next, ruleName)
+	req.Temp = self.CopyTemps()
+	self.AddQueue(req)
+}
+
+// 按逗号拆分Link字段，忽略URL与引号内的逗号
+func splitLinkHeader(value string) []string {
+	var (
+		parts         []string
+		start         int
+		inURL, quoted bool
+	)
+	for i, c := range value {
+		switch {
+		case c == '<' && !quoted:
+			inURL = true
+		case c == '>' && !quoted:
+			inURL = false
+		case c == '"' && !inURL:
+			quoted = !quoted
+		case c == ',' && !inURL && !quoted:
+			parts = append(parts, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(value[start:]))
+}
+
 // GetHtmlParser returns goquery object binded to target crawl result.
 func (self *Context) GetDom() *goquery.Document {
 	if self.dom == nil {
@@ -573,8 +1375,185 @@ func (self *Context) GetText() string {
 	return util.Bytes2String(self.text)
 }
 
+// 将响应内容（与GetText()相同地转码）作为JSON解析至v，解析结果缓存，同一页面多次调用不会重复读取响应。
+func (self *Context) GetJson(v interface{}) error {
+	raw, err := self.GetJsonRaw()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// 返回响应内容中的JSON文本（已转码并去除首尾空白及BOM），供延迟或部分解码，结果缓存，不应修改；
+// 内容不是合法的JSON时返回错误。
+func (self *Context) GetJsonRaw() (json.RawMessage, error) {
+	if self.jsonRaw != nil {
+		return self.jsonRaw, nil
+	}
+	if self.text == nil {
+		self.initText()
+	}
+	raw := bytes.TrimSpace(bytes.TrimPrefix(self.text, []byte("\ufeff")))
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("GetJson: 响应内容不是合法的JSON: %.64q", raw)
+	}
+	self.jsonRaw = raw
+	return raw, nil
+}
+
+// 遍历当前页面中匹配selector的元素，无响应内容时不执行fn。
+func (self *Context) Each(selector string, fn func(i int, s *goquery.Selection)) *Context {
+	self.Find(selector).Each(fn)
+	return self
+}
+
+// 返回当前页面中第一个匹配selector的元素，无响应内容或无匹配时返回空的Selection。
+func (self *Context) First(selector string) *goquery.Selection {
+	return self.Find(selector).First()
+}
+
+// 返回当前页面中第一个匹配selector的元素的内部HTML，无响应内容或无匹配时返回空字符串。
+func (self *Context) Html(selector string) string {
+	s, err := self.First(selector).Html()
+	if err != nil {
+		logs.Log.Error(" *     Html [%s]: %v\n", selector, err)
+	}
+	return s
+}
+
+// 返回当前页面中第一个匹配selector的元素的HTML（包含元素自身的标签），无响应内容或无匹配时返回空字符串。
+func (self *Context) OuterHtml(selector string) string {
+	s, err := goquery.OuterHtml(self.First(selector))
+	if err != nil {
+		logs.Log.Error(" *     OuterHtml [%s]: %v\n", selector, err)
+	}
+	return s
+}
+
+// 返回当前页面中匹配selector的元素，无响应内容时返回空的Selection。
+// 结果按selector缓存，重复查询无需再次遍历DOM；页面被替换（如ResetText、SetResponseBody、
+// ReinterpretAs、WaitForSelector）时缓存随之清除，规则修改了DOM（如Remove、Append）后应调用ResetFind()。
+func (self *Context) Find(selector string) *goquery.Selection {
+	dom := self.tryDom()
+	if dom == nil {
+		return &goquery.Selection{}
+	}
+	if self.finds.dom != dom {
+		self.finds = findCache{dom: dom, sels: make(map[string]*goquery.Selection)}
+	}
+	sel, ok := self.finds.sels[selector]
+	if !ok {
+		sel = dom.Find(selector)
+		self.finds.sels[selector] = sel
+	}
+	return sel
+}
+
+// 清除Find()的缓存。
+func (self *Context) ResetFind() *Context {
+	self.finds = findCache{}
+	return self
+}
+
+// Find()的结果，仅对查询时的DOM有效
+type findCache struct {
+	dom  *goquery.Document
+	sels map[string]*goquery.Selection
+}
+
+// 逐条解码响应中的JSON对象（如换行分隔的JSON流）并调用fn，fn返回false时停止。
+// 响应体按需读取而不整体缓存，已读取过文本或规则设置了BodyTransform时则从文本解码；
+// 响应体读取后不能再通过GetText、GetDom获取内容；无响应内容时返回错误。
+func (self *Context) EachJSON(fn func(obj map[string]interface{}) bool) error {
+	if self.text == nil && (self.Response == nil || self.Response.Body == nil) {
+		return fmt.Errorf("EachJSON: 无响应内容")
+	}
+	// 规则设置了BodyTransform时须整体读取后清理
+	if self.text == nil && self.bodyTransform() != nil {
+		self.initText()
+	}
+	var r io.Reader
+	if self.text != nil {
+		r = bytes.NewReader(self.text)
+	} else {
+		defer self.Response.Body.Close()
+		r = self.Response.Body
+		// 采用surf内核下载时，尝试自动转码
+		if self.Request.DownloaderID == request.SURF_ID {
+			if destReader, err := self.decodeBody(r); err != nil {
+				self.charset = ""
+				logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
+			} else {
+				r = destReader
+			}
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		obj := map[string]interface{}{}
+		if err := dec.Decode(&obj); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fn(obj) {
+			return nil
+		}
+	}
+}
+
 //**************************************** 私有方法 *******************************************\\
 
+// 记录上级页面后将请求加入队列，开启Spider.LinkGraph时同时输出链接关系。
+func (self *Context) pushRequest(req *request.Request) {
+	if self.Response != nil {
+		req.ParentUrl = self.GetUrl()
+		if self.spider.LinkGraph {
+			self.Output(map[string]interface{}{"From": req.ParentUrl, "To": req.GetUrl()}, LINK_GRAPH)
+		}
+	}
+	self.spider.RequestPush(req)
+}
+
+// 将Output()支持的数据类型统一转换为map[string]interface{}，并注册新字段。
+func (self *Context) toItem(item interface{}, ruleName string, rule *Rule) (m map[string]interface{}) {
+	switch item2 := item.(type) {
+	case map[int]interface{}:
+		m = self.CreatItem(item2, ruleName)
+	case request.Temp:
+		for k := range item2 {
+			self.spider.UpsertItemField(rule, k)
+		}
+		m = item2
+	case map[string]interface{}:
+		for k := range item2 {
+			self.spider.UpsertItemField(rule, k)
+		}
+		m = item2
+	}
+	// 添加任务ID字段
+	if m != nil && config.OUTPUT_TASK_ID {
+		self.spider.UpsertItemField(rule, TASK_ID_FIELD)
+		m[TASK_ID_FIELD] = self.GetTaskID()
+	}
+	return
+}
+
+// 生成数据存储单元，按需填充默认字段，规则开启Ordered时附带序号。
+func (self *Context) newDataCell(ruleName string, rule *Rule, item map[string]interface{}) data.DataCell {
+	var cell data.DataCell
+	if self.spider.NotDefaultField {
+		cell = data.GetDataCell(ruleName, item, "", "", "")
+	} else {
+		cell = data.GetDataCell(ruleName, item, self.GetUrl(), self.GetReferer(), time.Now().Format("2006-01-02 15:04:05"))
+	}
+	if rule.Ordered {
+		cell["Sequence"] = self.sequence
+	}
+	return cell
+}
+
 // 获取规则。
 func (self *Context) getRule(ruleName ...string) (name string, rule *Rule, found bool) {
 	if len(ruleName) == 0 {
@@ -595,74 +1574,146 @@ func (self *Context) initDom() *goquery.Document {
 		self.initText()
 	}
 	var err error
-	self.dom, err = goquery.NewDocumentFromReader(bytes.NewReader(self.text))
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("%v", p)
+			}
+		}()
+		self.dom, err = goquery.NewDocumentFromReader(bytes.NewReader(self.text))
+	}()
 	if err != nil {
-		panic(err.Error())
+		// 无法解析的内容返回空文档，避免崩溃爬虫协程
+		logs.Log.Error(" *     [%s] 解析Dom失败: %v\n", self.GetUrl(), err)
+		self.dom = goquery.NewDocumentFromNode(&html.Node{Type: html.DocumentNode})
 	}
 	return self.dom
 }
 
-// GetBodyStr returns plain string crawled.
-func (self *Context) initText() {
-	var err error
+// 获取响应的媒体类型（小写，不含参数），响应头未指定时根据内容推测。
+func (self *Context) mediaType() string {
+	if self.Response != nil {
+		if mt, _, err := mime.ParseMediaType(self.Response.Header.Get("Content-Type")); err == nil && mt != "" {
+			return strings.ToLower(mt)
+		}
+	}
+	if self.text == nil && self.Response == nil {
+		return ""
+	}
+	text := self.GetText()
+	if t := strings.TrimLeft(text, " \t\r\n"); strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+		return "application/json"
+	}
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType([]byte(text)))
+	return mt
+}
 
-	// 采用surf内核下载时，尝试自动转码
-	if self.Request.DownloaderID == request.SURF_ID {
-		var contentType, pageEncode string
-		// 优先从响应头读取编码类型
-		contentType = self.Response.Header.Get("Content-Type")
+// 获取Dom，无响应内容时返回nil。
+func (self *Context) tryDom() *goquery.Document {
+	if self.dom == nil && self.text == nil && self.Response == nil {
+		return nil
+	}
+	return self.GetDom()
+}
+
+// 获取页面编码类型，优先从响应头读取，其次从请求头读取。
+func (self *Context) pageEncode() (pageEncode string) {
+	contentType := self.Response.Header.Get("Content-Type")
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs, ok := params["charset"]; ok {
+			pageEncode = strings.ToLower(strings.TrimSpace(cs))
+		}
+	}
+	if len(pageEncode) == 0 {
+		contentType = self.Request.Header.Get("Content-Type")
 		if _, params, err := mime.ParseMediaType(contentType); err == nil {
 			if cs, ok := params["charset"]; ok {
 				pageEncode = strings.ToLower(strings.TrimSpace(cs))
 			}
 		}
-		// 响应头未指定编码类型时，从请求头读取
-		if len(pageEncode) == 0 {
-			contentType = self.Request.Header.Get("Content-Type")
-			if _, params, err := mime.ParseMediaType(contentType); err == nil {
-				if cs, ok := params["charset"]; ok {
-					pageEncode = strings.ToLower(strings.TrimSpace(cs))
-				}
-			}
-		}
+	}
+	return
+}
 
-		switch pageEncode {
-		// 不做转码处理
-		case "utf8", "utf-8", "unicode-1-1-utf-8":
+// 将响应体转码为utf-8，并记录采用的编码：响应或请求的Content-Type指定了编码时采用之，
+// 否则根据BOM及前1024字节的<meta>声明嗅探（同charset.NewReader）；已是utf-8时不转码
+func (self *Context) decodeBody(r io.Reader) (io.Reader, error) {
+	switch pageEncode := self.pageEncode(); pageEncode {
+	// 不做转码处理
+	case "utf8", "utf-8", "unicode-1-1-utf-8":
+		self.charset = "utf-8"
+		return r, nil
+
+	// Charset auto determine. Use golang.org/x/net/html/charset. Get response body and change it to utf-8
+	case "":
+		preview := make([]byte, 1024)
+		n, err := io.ReadFull(r, preview)
+		switch {
+		case err == io.ErrUnexpectedEOF, err == io.EOF:
+			preview = preview[:n]
+			r = bytes.NewReader(preview)
+		case err != nil:
+			return nil, err
 		default:
-			// 指定了编码类型，但不是utf8时，自动转码为utf8
-			// get converter to utf-8
-			// Charset auto determine. Use golang.org/x/net/html/charset. Get response body and change it to utf-8
-			var destReader io.Reader
-
-			if len(pageEncode) == 0 {
-				destReader, err = charset.NewReader(self.Response.Body, "")
-			} else {
-				destReader, err = charset.NewReaderLabel(pageEncode, self.Response.Body)
-			}
+			r = io.MultiReader(bytes.NewReader(preview), r)
+		}
+		e, name, _ := charset.DetermineEncoding(preview, "")
+		self.charset = name
+		if e == encoding.Nop {
+			return r, nil
+		}
+		return transform.NewReader(r, e.NewDecoder()), nil
 
-			if err == nil {
-				self.text, err = ioutil.ReadAll(destReader)
-				if err == nil {
-					self.Response.Body.Close()
-					return
-				} else {
-					logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
-				}
-			} else {
-				logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
-			}
+	// 指定了编码类型，但不是utf8时，自动转码为utf8
+	default:
+		e, name := charset.Lookup(pageEncode)
+		if e == nil {
+			return nil, fmt.Errorf("unsupported charset: %q", pageEncode)
 		}
+		self.charset = name
+		return transform.NewReader(r, e.NewDecoder()), nil
 	}
+}
 
-	// 不做转码处理
-	self.text, err = ioutil.ReadAll(self.Response.Body)
+// GetBodyStr returns plain string crawled.
+func (self *Context) initText() {
+	// 保留转码前的内容，以便ReinterpretAs()重新转码
+	raw, err := ioutil.ReadAll(self.Response.Body)
 	self.Response.Body.Close()
 	if err != nil {
 		panic(err.Error())
 		return
 	}
+	self.raw = raw
+	self.text = raw
 
+	// 采用surf内核下载时，尝试自动转码
+	if self.Request.DownloaderID == request.SURF_ID {
+		if err = self.decodeText(raw); err != nil {
+			logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
+			self.charset = ""
+		}
+	}
+
+	// 按规则的BodyTransform清理内容
+	self.transformText()
+}
+
+// 将转码前的内容转码为utf-8后存入text，已是utf-8时不复制
+func (self *Context) decodeText(raw []byte) error {
+	destReader, err := self.decodeBody(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if self.charset == "utf-8" {
+		return nil
+	}
+	text, err := ioutil.ReadAll(destReader)
+	if err != nil {
+		return err
+	}
+	self.text = text
+	return nil
 }
 
 /**
@@ -0,0 +1,834 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/downloader/surfer"
+	"github.com/henrylee2cn/pholcus/app/pipeline/collector/data"
+	"github.com/henrylee2cn/pholcus/common/goquery"
+)
+
+// 预置的响应
+type testPage struct {
+	url          string      // 默认为http://example.com/
+	downloaderID int         // 请求指定的下载器
+	code         int         // 默认为200
+	header       http.Header // 为nil时视为utf-8编码的HTML
+	body         string
+}
+
+// 测试用规则：list输出各链接的文本，并将链接交由detail解析
+func testSpider() *Spider {
+	return &Spider{
+		Name: "test",
+		RuleTree: &RuleTree{
+			Root: func(ctx *Context) {
+				ctx.AddQueue(&request.Request{Url: "http://example.com/list", Rule: "list"})
+			},
+			Trunk: map[string]*Rule{
+				"list": {
+					ItemFields: []string{"title"},
+					ParseFunc: func(ctx *Context) {
+						ctx.GetDom().Find("a").Each(func(i int, s *goquery.Selection) {
+							href, _ := s.Attr("href")
+							ctx.AddQueue(&request.Request{Url: href, Rule: "detail"})
+							ctx.Output(map[int]interface{}{0: s.Text()})
+						})
+					},
+				},
+			},
+		},
+	}
+}
+
+// 使sp添加的请求不进入调度队列，返回的函数取出并清空已添加的请求
+func captureRequests(sp *Spider) func() []*request.Request {
+	var reqs []*request.Request
+	sp.SetRequestSink(func(req *request.Request) { reqs = append(reqs, req) })
+	return func() []*request.Request {
+		pulled := reqs
+		reqs = nil
+		return pulled
+	}
+}
+
+// 以预置的响应构造ruleName规则下的Context，sp为nil时使用testSpider()
+func testContext(t testing.TB, sp *Spider, ruleName string, page testPage) *Context {
+	if sp == nil {
+		sp = testSpider()
+	}
+	if sp.reqSink == nil {
+		// 丢弃规则中添加的请求，并使蜘蛛处于运行状态
+		sp.SetRequestSink(func(*request.Request) {})
+	}
+	if page.url == "" {
+		page.url = "http://example.com/"
+	}
+	if page.code == 0 {
+		page.code = http.StatusOK
+	}
+	if page.header == nil {
+		page.header = http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	}
+	req := &request.Request{Url: page.url, Rule: ruleName, DownloaderID: page.downloaderID}
+	req.SetSpiderName(sp.GetName())
+	if err := req.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(req.GetUrl())
+	return GetContext(sp, req).SetResponse(&http.Response{
+		StatusCode: page.code,
+		Header:     page.header,
+		Body:       ioutil.NopCloser(strings.NewReader(page.body)),
+		Request:    &http.Request{Method: req.GetMethod(), URL: u, Header: req.GetHeader()},
+	})
+}
+
+func TestXPath(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{body: `<a href="http://example.com/1">one</a><a href="http://example.com/2">two</a>`})
+	if ctx.XPathText("//a[2]") != "two" || ctx.XPathAttr("//a[1]", "href") != "http://example.com/1" || ctx.XPath("//a[") != nil {
+		t.Fatal("xpath")
+	}
+	PutContext(ctx)
+}
+
+func TestOutputFile(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{url: "http://example.com/report"})
+	ctx.OutputFile("report/summary.txt", []byte("2 links"))
+	files := ctx.PullFiles()
+	if len(files) != 1 || files[0]["Name"] != "report/summary.txt" || string(files[0]["Bytes"].([]byte)) != "2 links" || files[0]["RuleName"] != "list" {
+		t.Fatalf("files: %v", files)
+	}
+	PutContext(ctx)
+}
+
+func TestHeaders(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{
+		url: "http://example.com/api?page=2",
+		header: http.Header{
+			"Set-Cookie": {"a=1; Path=/", "b=2"},
+			"Link":       {`</api?page=3>; rel="next", <http://example.com/api?page=1,x>; rel="prev first"`},
+		},
+	})
+	if v := ctx.GetHeaders("set-cookie"); len(v) != 2 || ctx.GetCookie() != "a=1; Path=/" {
+		t.Fatalf("cookies: %v", v)
+	}
+	if cookies := ctx.GetCookies(); len(cookies) != 2 || cookies[0].Name != "a" || cookies[0].Path != "/" || cookies[1].Value != "2" {
+		t.Fatalf("GetCookies: %v", cookies)
+	}
+	links := ctx.GetLinkHeaders()
+	if links["next"] != "http://example.com/api?page=3" || links["prev"] != "http://example.com/api?page=1,x" || links["first"] != links["prev"] {
+		t.Fatalf("links: %v", links)
+	}
+	PutContext(ctx)
+}
+
+func TestParseWith(t *testing.T) {
+	ctx := testContext(t, nil, "detail", testPage{url: "http://example.com/1", body: "<p>outer</p>"})
+	if err := ctx.ParseWith("list", `<a href="http://example.com/3">three</a>`); err != nil {
+		t.Fatal(err)
+	}
+	if items := ctx.PullItems(); len(items) != 1 || items[0]["RuleName"] != "list" {
+		t.Fatalf("items: %v", items)
+	}
+	if ctx.GetRuleName() != "detail" || ctx.GetText() != "<p>outer</p>" {
+		t.Fatalf("state not restored: %s %s", ctx.GetRuleName(), ctx.GetText())
+	}
+	if ctx.ParseWith("missing", "") == nil {
+		t.Fatal("expected error for missing rule")
+	}
+	PutContext(ctx)
+}
+
+func TestContentType(t *testing.T) {
+	for _, c := range []struct {
+		header, body          string
+		isHTML, isJSON, isXML bool
+	}{
+		{"text/html; charset=utf-8", "<p>x</p>", true, false, false},
+		{"application/vnd.api+json", `{"a":1}`, false, true, false},
+		{"", ` [1,2]`, false, true, false},
+		{"", `<?xml version="1.0"?><a/>`, false, false, true},
+		{"application/pdf", "%PDF-1.4\x00\xff", false, false, false},
+	} {
+		header := http.Header{}
+		if c.header != "" {
+			header.Set("Content-Type", c.header)
+		}
+		ctx := testContext(t, nil, "list", testPage{header: header, body: c.body})
+		if ctx.IsHTML() != c.isHTML || ctx.IsJSON() != c.isJSON || ctx.IsXML() != c.isXML {
+			t.Errorf("%q %q: html=%v json=%v xml=%v", c.header, c.body, ctx.IsHTML(), ctx.IsJSON(), ctx.IsXML())
+		}
+		if ctx.GetDom() == nil {
+			t.Errorf("%q: nil dom", c.header)
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestSleepStop(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ctx.GetSpider().Stop()
+	}()
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != FORCED_STOP {
+			t.Fatalf("recover: %v", p)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Sleep was not interrupted")
+		}
+	}()
+	ctx.Sleep(time.Hour)
+}
+
+func TestPostForm(t *testing.T) {
+	sp := testSpider()
+	pull := captureRequests(sp)
+	ctx := testContext(t, sp, "list", testPage{url: "http://example.com/search"})
+	ctx.PostForm("http://example.com/search", "detail", url.Values{"q": {"go"}, "tag": {"a", "b"}, "page": {"2"}})
+	ctx.JsAddQueue(map[string]interface{}{
+		"Url":  "http://example.com/search",
+		"Rule": "detail",
+		"Form": map[string]interface{}{"q": "js", "page": int64(3)},
+	})
+	reqs := pull()
+	if len(reqs) != 2 {
+		t.Fatalf("requests: %v", reqs)
+	}
+	for i, want := range []string{"page=2&q=go&tag=a&tag=b", "page=3&q=js"} {
+		req := reqs[i]
+		if req.GetMethod() != "POST" || req.GetPostData() != want ||
+			req.GetHeader().Get("Content-Type") != "application/x-www-form-urlencoded" ||
+			req.GetReferer() != "http://example.com/search" {
+			t.Errorf("request %d: %s %q %v", i, req.GetMethod(), req.GetPostData(), req.GetHeader())
+		}
+	}
+	PutContext(ctx)
+}
+
+func TestIsThin(t *testing.T) {
+	sp := testSpider()
+	sp.MinBodySize = 10
+	for body, thin := range map[string]bool{
+		"blocked":               true,
+		"<p>enough content</p>": false,
+	} {
+		ctx := testContext(t, sp, "list", testPage{body: body})
+		// 检测后响应内容仍可读取
+		if ctx.IsThin() != thin || ctx.GetText() != body {
+			t.Errorf("%q: thin %v, text %q", body, ctx.IsThin(), ctx.GetText())
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{body: `<p>a</p><p>b</p>`})
+	if ctx.Find("p").Length() != 2 || ctx.Find("p") != ctx.Find("p") {
+		t.Fatal("Find cache")
+	}
+	ctx.ResetText(`<p>c</p>`)
+	if ctx.Find("p").Text() != "c" {
+		t.Fatal("Find cache not invalidated by ResetText")
+	}
+	PutContext(ctx)
+}
+
+func benchmarkTable(b *testing.B, find func(ctx *Context, selector string) *goquery.Selection) {
+	var body strings.Builder
+	body.WriteString("<table>")
+	for i := 0; i < 2000; i++ {
+		body.WriteString(`<tr><td class="name">x</td><td class="price">1</td></tr>`)
+	}
+	body.WriteString("</table>")
+	ctx := testContext(b, nil, "list", testPage{body: body.String()})
+	ctx.GetDom()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for row := 0; row < 10; row++ {
+			find(ctx, "td.price").Eq(row).Text()
+		}
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	benchmarkTable(b, func(ctx *Context, selector string) *goquery.Selection {
+		return ctx.Find(selector)
+	})
+}
+
+func BenchmarkDomFind(b *testing.B) {
+	benchmarkTable(b, func(ctx *Context, selector string) *goquery.Selection {
+		return ctx.GetDom().Find(selector)
+	})
+}
+
+func TestSetResponseBody(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{header: http.Header{}, body: `cb({"a":1})`})
+	if ctx.GetText() != `cb({"a":1})` {
+		t.Fatal(ctx.GetText())
+	}
+	text := ctx.GetText()
+	ctx.SetResponseBody([]byte(text[3 : len(text)-1]))
+	if ctx.GetText() != `{"a":1}` || !ctx.IsJSON() {
+		t.Fatalf("rewritten: %q", ctx.GetText())
+	}
+	ctx.FileOutput("a.json")
+	if files := ctx.PullFiles(); len(files) != 1 || string(files[0]["Bytes"].([]byte)) != `{"a":1}` {
+		t.Fatalf("files: %v", files)
+	}
+	PutContext(ctx)
+}
+
+func TestGetDownloaderID(t *testing.T) {
+	var nilCtx *Context
+	if nilCtx.GetDownloaderID() != -1 || nilCtx.IsRendered() {
+		t.Fatal("nil context")
+	}
+	ctx := testContext(t, nil, "list", testPage{body: "<html></html>"})
+	if ctx.GetDownloaderID() != request.SURF_ID || ctx.IsRendered() {
+		t.Fatalf("requested: %d", ctx.GetDownloaderID())
+	}
+	// 降级至浏览器内核后，请求中的ID保持不变
+	ctx.SetDownloaderID(request.PHANTOM_ID)
+	if !ctx.IsRendered() || ctx.Request.GetDownloaderID() != request.SURF_ID {
+		t.Fatalf("served: %d", ctx.GetDownloaderID())
+	}
+	PutContext(ctx)
+}
+
+func TestGetCharset(t *testing.T) {
+	// GBK编码的"中文"
+	gbk := "\xd6\xd0\xce\xc4"
+	for _, c := range []struct {
+		header, body, charset, text string
+	}{
+		{"text/html; charset=GB2312", gbk, "gbk", "中文"},
+		{"text/html", `<meta charset="gbk">` + gbk, "gbk", `<meta charset="gbk">中文`},
+		{"text/html; charset=utf-8", "中文", "utf-8", "中文"},
+	} {
+		ctx := testContext(t, nil, "list", testPage{header: http.Header{"Content-Type": {c.header}}, body: c.body})
+		if text := ctx.GetText(); text != c.text || ctx.GetCharset() != c.charset {
+			t.Errorf("%s: %q %q", c.header, ctx.GetCharset(), text)
+		}
+		if ctx.IsTranscoded() != (c.charset != "utf-8") {
+			t.Errorf("%s: transcoded %v", c.header, ctx.IsTranscoded())
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestRegisterItemFields(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{body: "<html></html>"})
+	ctx.RegisterItemFields("list", "title", "price", "stock")
+	ctx.RegisterItemFields("", "stock", "price", "seller")
+	if got := strings.Join(ctx.GetItemFields(), ","); got != "title,price,stock,seller" {
+		t.Fatalf("fields: %s", got)
+	}
+	PutContext(ctx)
+}
+
+func TestEnqueueSeed(t *testing.T) {
+	sp := testSpider()
+	pull := captureRequests(sp)
+	ctx := testContext(t, sp, "list", testPage{})
+	ctx.Request.SetSession("s1")
+	ctx.EnqueueSeed("http://example.com/sports")
+	PutContext(ctx)
+	reqs := pull()
+	if len(reqs) != 1 || reqs[0].GetRuleName() != ROOT_RULE || reqs[0].GetSession() != "s1" || reqs[0].GetReferer() != "http://example.com/" {
+		t.Fatalf("seed requests: %v", reqs)
+	}
+
+	// 保留规则名不在Trunk中，Parse转由Root处理
+	ctx = testContext(t, sp, ROOT_RULE, testPage{url: reqs[0].GetUrl()}).Parse(ROOT_RULE)
+	if ctx.Response == nil {
+		t.Fatal("root context without response")
+	}
+	PutContext(ctx)
+	if reqs := pull(); len(reqs) != 1 || reqs[0].GetRuleName() != "list" {
+		t.Fatalf("root requests: %v", reqs)
+	}
+}
+
+func TestPeekItems(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{url: "http://example.com/list"})
+	ctx.Output(map[string]interface{}{"title": "one"})
+	peeked := ctx.PeekItems()
+	ctx.Output(map[string]interface{}{"title": "two"})
+	if len(peeked) != 1 || len(ctx.PeekItems()) != 2 {
+		t.Fatalf("peeked: %v", peeked)
+	}
+	if items := ctx.PullItems(); len(items) != 2 || len(ctx.PeekItems()) != 0 {
+		t.Fatalf("pulled: %v", items)
+	}
+	PutContext(ctx)
+}
+
+func TestRuleContentType(t *testing.T) {
+	var parsed []string
+	parse := func(name string) func(*Context) {
+		return func(ctx *Context) { parsed = append(parsed, name+":"+ctx.GetRuleName()) }
+	}
+	sp := &Spider{
+		Name: "contenttype",
+		RuleTree: &RuleTree{
+			Root: func(*Context) {},
+			Trunk: map[string]*Rule{
+				"api":    {ContentType: "application/json", ParseFunc: parse("api")},
+				"feed":   {ContentType: "text/xml, application/json", ContentTypeFallback: "html", ParseFunc: parse("feed")},
+				"html":   {ParseFunc: parse("html")},
+				"strict": {ContentType: "application/json", ContentTypeFallback: "api", ParseFunc: parse("strict")},
+			},
+		},
+	}
+	jsonPage := testPage{url: "http://example.com/api", header: http.Header{"Content-Type": {"application/json; charset=utf-8"}}, body: `{}`}
+	htmlPage := testPage{url: "http://example.com/page", header: http.Header{"Content-Type": {"text/html"}}, body: `<html></html>`}
+
+	for page, mismatch := range map[*testPage]bool{&jsonPage: false, &htmlPage: true} {
+		ctx := testContext(t, sp, "api", *page)
+		if ctx.IsContentTypeMismatch() != mismatch || ctx.GetExecutedRule() != "" {
+			t.Errorf("%s: mismatch %v, executed %q before Parse", page.url, ctx.IsContentTypeMismatch(), ctx.GetExecutedRule())
+		}
+		PutContext(ctx)
+	}
+	for _, c := range []struct {
+		ruleName string
+		page     testPage
+		executed string
+		err      bool
+	}{
+		{"api", jsonPage, "api", false},
+		{"api", htmlPage, "", true},
+		{"feed", htmlPage, "html", false},
+		{"missing", htmlPage, ROOT_RULE, false},
+		// 备用规则自身的ContentType不再检查
+		{"strict", htmlPage, "api", false},
+	} {
+		ctx := testContext(t, sp, c.ruleName, c.page).Parse(c.ruleName)
+		if ctx.GetExecutedRule() != c.executed || (ctx.GetError() != nil) != c.err {
+			t.Errorf("%s %s: executed %q, err %v", c.ruleName, c.page.url, ctx.GetExecutedRule(), ctx.GetError())
+		}
+		PutContext(ctx)
+	}
+	if strings.Join(parsed, " ") != "api:api html:html api:api" {
+		t.Fatalf("parsed: %v", parsed)
+	}
+}
+
+func TestRandomDelay(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{})
+	start := time.Now()
+	ctx.RandomDelay(20*time.Millisecond, 10*time.Millisecond)
+	if d := time.Since(start); d < 10*time.Millisecond || d > time.Second {
+		t.Fatalf("delay: %v", d)
+	}
+	PutContext(ctx)
+}
+
+func TestHtml(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{body: `<div class="a" id="x"><p>1<b>2</b></p><div class="a">3</div></div>`})
+	for _, c := range []struct {
+		selector, html, outer string
+	}{
+		{"div.a", `<p>1<b>2</b></p><div class="a">3</div>`, `<div class="a" id="x"><p>1<b>2</b></p><div class="a">3</div></div>`},
+		{"div.a div.a", "3", `<div class="a">3</div>`},
+		{"p", "1<b>2</b>", `<p>1<b>2</b></p>`},
+		{"span", "", ""},
+	} {
+		if s := ctx.Html(c.selector); s != c.html {
+			t.Errorf("Html(%q) = %q", c.selector, s)
+		}
+		if s := ctx.OuterHtml(c.selector); s != c.outer {
+			t.Errorf("OuterHtml(%q) = %q", c.selector, s)
+		}
+	}
+	PutContext(ctx)
+}
+
+func TestIsSoftFailure(t *testing.T) {
+	for _, c := range []struct {
+		match bool
+		body  string
+		soft  bool
+	}{
+		{false, "<h1>Access Denied</h1>", false},
+		{true, "<h1>Access Denied</h1>", true},
+		{true, "<p>ok</p>", false},
+	} {
+		sp := testSpider()
+		if c.match {
+			sp.SetRetryOnBody(BodyMatches(`Access Denied`, `^\[\]$`))
+		}
+		ctx := testContext(t, sp, "list", testPage{body: c.body})
+		// 检测后响应内容仍可读取
+		if ctx.IsSoftFailure() != c.soft || ctx.GetText() != c.body {
+			t.Errorf("%v %q: soft failure %v, text %q", c.match, c.body, ctx.IsSoftFailure(), ctx.GetText())
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	download := SyncDownload
+	defer func() { SyncDownload = download }()
+	SyncDownload = func(sp *Spider, req *request.Request) *Context {
+		if req.GetReferer() != "http://example.com/list" || req.GetSession() != "s1" {
+			t.Errorf("referer %q session %q", req.GetReferer(), req.GetSession())
+		}
+		return testContext(t, sp, req.GetRuleName(), testPage{url: req.GetUrl(), body: `{"price":3}`})
+	}
+	ctx := testContext(t, nil, "list", testPage{url: "http://example.com/list", body: `<a href="/1">1</a>`})
+	ctx.Request.SetSession("s1")
+	child, err := ctx.Fetch(&request.Request{Url: "http://example.com/api/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.GetText() != `{"price":3}` || ctx.GetText() != `<a href="/1">1</a>` {
+		t.Fatalf("%q %q", child.GetText(), ctx.GetText())
+	}
+	PutContext(child)
+	PutContext(ctx)
+}
+
+func TestItemsJSON(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{url: "http://example.com/list"})
+	if s, err := ctx.ItemsJSON(); err != nil || s != "[]" {
+		t.Fatalf("%q %v", s, err)
+	}
+	ctx.Output(map[string]interface{}{"title": "<one>"})
+	s, err := ctx.ItemsJSON()
+	if err != nil || !strings.HasPrefix(s, "[{") || !strings.Contains(s, `"title":"<one>"`) || len(ctx.PeekItems()) != 1 {
+		t.Fatalf("%q %v", s, err)
+	}
+	PutContext(ctx)
+}
+
+func TestReinterpretAs(t *testing.T) {
+	// 声明为utf-8，实为GBK编码的"中文"
+	ctx := testContext(t, nil, "list", testPage{body: "<p>\xd6\xd0\xce\xc4</p>"})
+	if ctx.Find("p").Text() == "中文" {
+		t.Fatal("decoded before reinterpretation")
+	}
+	ctx.ReinterpretAs("gbk")
+	if ctx.GetText() != "<p>中文</p>" || ctx.GetCharset() != "gbk" || ctx.Find("p").Text() != "中文" {
+		t.Fatalf("reinterpreted: %q %q", ctx.GetCharset(), ctx.GetText())
+	}
+	ctx.ReinterpretAs("no-such-charset")
+	if ctx.GetText() != "<p>中文</p>" || ctx.GetCharset() != "gbk" {
+		t.Fatalf("unknown charset: %q %q", ctx.GetCharset(), ctx.GetText())
+	}
+	PutContext(ctx)
+}
+
+func TestFollowRedirect(t *testing.T) {
+	sp := testSpider()
+	pull := captureRequests(sp)
+	for _, c := range []struct {
+		page     testPage
+		follow   []string
+		url      string // 为空时应返回错误且不添加请求
+		ruleName string
+	}{
+		// 302 -> 301 -> 200，逐跳处理
+		{testPage{url: "http://example.com/go?id=1", code: http.StatusFound, header: http.Header{"Location": {"/out/1"}}},
+			nil, "http://example.com/out/1", "list"},
+		{testPage{url: "http://example.com/out/1", code: http.StatusMovedPermanently, header: http.Header{"Location": {"https://shop.example.org/item"}}},
+			[]string{"detail"}, "https://shop.example.org/item", "detail"},
+		{testPage{url: "https://shop.example.org/item", body: "<p>item</p>"}, nil, "", ""},
+		{testPage{url: "http://example.com/go", code: http.StatusFound}, nil, "", ""},
+	} {
+		ctx := testContext(t, sp, "list", c.page)
+		err := ctx.FollowRedirect(c.follow...)
+		PutContext(ctx)
+		reqs := pull()
+		if c.url == "" {
+			if err == nil || len(reqs) != 0 {
+				t.Errorf("%s: followed %v", c.page.url, reqs)
+			}
+			continue
+		}
+		if err != nil || len(reqs) != 1 || reqs[0].GetUrl() != c.url || reqs[0].GetRuleName() != c.ruleName ||
+			reqs[0].GetReferer() != c.page.url {
+			t.Errorf("%s: %v %+v", c.page.url, err, reqs)
+		}
+	}
+}
+
+func TestFollowNext(t *testing.T) {
+	var ids []string
+	sp := &Spider{
+		Name: "follownext",
+		RuleTree: &RuleTree{
+			Root: func(*Context) {},
+			Trunk: map[string]*Rule{
+				"api": {FollowNext: true, ParseFunc: func(ctx *Context) {
+					ids = append(ids, ctx.GetText())
+				}},
+			},
+		},
+	}
+	pull := captureRequests(sp)
+	pages := map[string]string{
+		"http://api.example.com/items?page=1": `</items?page=2>; rel="next", </items?page=3>; rel="last"`,
+		"http://api.example.com/items?page=2": `</items?page=1>; rel="prev", </items?page=3>; rel="next"`,
+		"http://api.example.com/items?page=3": `</items?page=3>; rel="next"`,
+	}
+	next := "http://api.example.com/items?page=1"
+	for i := 0; next != ""; i++ {
+		if i == len(pages) {
+			t.Fatalf("next link after the last page: %v", next)
+		}
+		ctx := testContext(t, sp, "api", testPage{url: next, header: http.Header{"Link": {pages[next]}}, body: next[len(next)-1:]})
+		ctx.Request.SetSession("s1")
+		ctx.Request.SetTemp("q", "go")
+		ctx.Parse("api")
+		PutContext(ctx)
+		next = ""
+		for _, req := range pull() {
+			if req.GetRuleName() != "api" || req.GetSession() != "s1" || req.GetTemp("q", "") != "go" {
+				t.Fatalf("next request: %+v", req)
+			}
+			next = req.GetUrl()
+		}
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Fatalf("pages: %v", ids)
+	}
+}
+
+func TestOutputUpsert(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{url: "http://example.com/list"})
+	key := []string{"title"}
+	ctx.OutputUpsert(map[string]interface{}{"title": "one", "price": 1}, key)
+	key[0] = "price"
+	ctx.OutputUpsert(map[string]interface{}{"title": "two"}, nil)
+	items := ctx.PullItems()
+	if len(items) != 2 {
+		t.Fatalf("items: %v", items)
+	}
+	if k := data.UpsertKey(items[0]); len(k) != 1 || k[0] != "title" || items[0]["RuleName"] != "list" {
+		t.Fatalf("keyed item: %v", items[0])
+	}
+	// 无标识字段时按追加输出
+	if k := data.UpsertKey(items[1]); k != nil {
+		t.Fatalf("unkeyed item: %v", items[1])
+	}
+	PutContext(ctx)
+}
+
+func TestFileOutputAs(t *testing.T) {
+	body := `<meta charset="gbk">` + "\xd6\xd0\xce\xc4"
+	for _, c := range []struct {
+		format     FileFormat
+		name, want string
+	}{
+		{FILE_RAW, "a.html", body},
+		{FILE_UTF8 | FILE_GZIP, "a.html.gz", `<meta charset="utf-8">中文`},
+	} {
+		ctx := testContext(t, nil, "list", testPage{url: "http://example.com/a.html", header: http.Header{"Content-Type": {"text/html"}}, body: body})
+		ctx.FileOutputAs(c.format)
+		files := ctx.PullFiles()
+		if len(files) != 1 || files[0]["Name"] != c.name {
+			t.Fatalf("%v: files %v", c.format, files)
+		}
+		b := files[0]["Bytes"].([]byte)
+		if c.format&FILE_GZIP != 0 {
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ = ioutil.ReadAll(r)
+		}
+		if string(b) != c.want {
+			t.Errorf("%v: body %q", c.format, b)
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestGetJson(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{
+		url:    "http://example.com/api",
+		header: http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+		body:   "\ufeff {\"items\": [{\"id\": 1}, {\"id\": 2}]}\n",
+	})
+	var v struct {
+		Items []struct{ Id int }
+	}
+	if err := ctx.GetJson(&v); err != nil || len(v.Items) != 2 || v.Items[1].Id != 2 {
+		t.Fatalf("GetJson: %v %+v", err, v)
+	}
+	// 再次调用使用缓存，响应体已关闭
+	var m map[string]json.RawMessage
+	if err := ctx.GetJson(&m); err != nil || string(m["items"]) != `[{"id": 1}, {"id": 2}]` {
+		t.Fatalf("GetJson again: %v %v", err, m)
+	}
+	if raw, err := ctx.GetJsonRaw(); err != nil || raw[0] != '{' {
+		t.Fatalf("GetJsonRaw: %v %q", err, raw)
+	}
+	ctx.SetResponseBody([]byte("callback({})"))
+	if _, err := ctx.GetJsonRaw(); err == nil {
+		t.Fatal("invalid JSON accepted")
+	}
+	PutContext(ctx)
+}
+
+// 替换响应内容后，由旧内容派生的缓存均须失效
+func TestReplaceBodyResetsCaches(t *testing.T) {
+	browse := BrowserDownload
+	defer func() { BrowserDownload = browse }()
+	BrowserDownload = func(*request.Request, *surfer.BrowserActions) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       ioutil.NopCloser(strings.NewReader("<p>new</p>")),
+		}, nil
+	}
+
+	for name, replace := range map[string]func(*Context){
+		"browse":          func(ctx *Context) { ctx.ScrollToBottom() },
+		"SetResponseBody": func(ctx *Context) { ctx.SetResponseBody([]byte("<p>new</p>")) },
+		"ResetText":       func(ctx *Context) { ctx.ResetText("<p>new</p>") },
+		"ReinterpretAs":   func(ctx *Context) { ctx.ReinterpretAs("gbk") },
+	} {
+		ctx := testContext(t, nil, "list", testPage{downloaderID: request.PHANTOM_ID, body: "<p>old\xa1\xa1</p>"})
+		hash, content := ctx.BodyHash(), ctx.ContentHash()
+		old := ctx.GetDom()
+		ctx.Find("p")
+		replace(ctx)
+		if ctx.finds.sels != nil {
+			t.Errorf("%s: Find()缓存未清除", name)
+		}
+		if ctx.BodyHash() == hash || ctx.ContentHash() == content {
+			t.Errorf("%s: 摘要未更新", name)
+		}
+		if ctx.GetDom() == old {
+			t.Errorf("%s: DOM未更新", name)
+		}
+		if text := ctx.Find("p").Text(); text != "new" && name != "ReinterpretAs" {
+			t.Errorf("%s: Find() = %q", name, text)
+		}
+		if want := sha256Hex([]byte(ctx.GetText())); ctx.BodyHash() != want {
+			t.Errorf("%s: BodyHash() = %s, want %s", name, ctx.BodyHash(), want)
+		}
+	}
+}
+
+// 重新渲染会再次下载页面，非GET请求不得重复提交
+func TestBrowseRefusesNonGet(t *testing.T) {
+	browse := BrowserDownload
+	defer func() { BrowserDownload = browse }()
+	var calls int
+	BrowserDownload = func(*request.Request, *surfer.BrowserActions) (*http.Response, error) {
+		calls++
+		return nil, errors.New("unexpected download")
+	}
+
+	ctx := testContext(t, nil, "list", testPage{downloaderID: request.PHANTOM_ID, body: "<p>old</p>"})
+	ctx.Request.SetMethod("POST")
+	ctx.WaitForSelector("p", time.Second).ScrollToBottom()
+	if calls != 0 {
+		t.Errorf("POST请求重新下载了 %d 次", calls)
+	}
+	if text := ctx.GetText(); text != "<p>old</p>" {
+		t.Errorf("GetText() = %q", text)
+	}
+}
+
+// 空响应同样按自动识别的编码读取，不应视为转码失败
+func TestEmptyBodyCharset(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{header: http.Header{"Content-Type": {"text/html"}}})
+	if text := ctx.GetText(); text != "" {
+		t.Errorf("GetText() = %q", text)
+	}
+	if cs := ctx.GetCharset(); cs == "" {
+		t.Error("GetCharset() is empty")
+	}
+}
+
+func TestEachJSONWithoutResponse(t *testing.T) {
+	ctx := GetContext(&Spider{Name: "test"}, &request.Request{Url: "http://example.com/", Rule: "list"})
+	var calls int
+	err := ctx.EachJSON(func(map[string]interface{}) bool {
+		calls++
+		return true
+	})
+	if err == nil || calls != 0 {
+		t.Errorf("err = %v, calls = %v", err, calls)
+	}
+}
+
+func TestOutputMany(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{})
+	ctx.Output(map[string]interface{}{"title": "first"})
+	ctx.OutputMany([]interface{}{
+		map[string]interface{}{"title": "a"},
+		request.Temp{"title": "b"},
+		map[int]interface{}{0: "c"},
+	})
+	ctx.OutputMany(nil, "missing")
+	items := ctx.PullItems()
+	var titles []interface{}
+	for _, item := range items {
+		if item["RuleName"] != "list" || item["Url"] != "http://example.com/" {
+			t.Errorf("item = %v", item)
+		}
+		titles = append(titles, item["Data"].(map[string]interface{})["title"])
+	}
+	if want := []interface{}{"first", "a", "b", "c"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+// Meta仅作用于当前页面，不随子请求传递，回收后清空
+func TestMetaReset(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{})
+	if v := ctx.GetMeta("k", "default"); v != "default" {
+		t.Fatalf("GetMeta() = %v", v)
+	}
+	ctx.SetMeta("k", 1).SetTemp("t", 2)
+	copied := ctx.CopyMeta()
+	ctx.SetMeta("k", 3)
+	if copied["k"] != 1 || ctx.GetMeta("k", nil) != 3 {
+		t.Errorf("CopyMeta() = %v, Meta = %v", copied, ctx.Meta)
+	}
+	if _, ok := ctx.CopyTemps()["k"]; ok {
+		t.Error("Meta leaked into request temps")
+	}
+	PutContext(ctx)
+	if ctx.Meta != nil || ctx.GetMeta("k", nil) != nil {
+		t.Errorf("Meta after PutContext = %v", ctx.Meta)
+	}
+}
+
+// 仅开启Ordered的规则的结果附带序号，以免序号混入其他输出
+func TestSequenceOnlyWhenOrdered(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		sp := testSpider()
+		sp.RuleTree.Trunk["list"].Ordered = ordered
+		ctx := testContext(t, sp, "list", testPage{})
+		ctx.SetSequence(3).Output(map[string]interface{}{"title": "a"})
+		items := ctx.PullItems()
+		seq, ok := items[0]["Sequence"]
+		if ok != ordered || (ordered && seq != int64(3)) {
+			t.Errorf("ordered=%v: item = %v", ordered, items[0])
+		}
+		data.PutDataCell(items[0])
+		PutContext(ctx)
+	}
+}
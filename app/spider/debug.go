@@ -0,0 +1,105 @@
+package spider
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 已转储的响应数
+var debugSaved int64
+
+// 调试转储的响应元数据
+type debugMeta struct {
+	Url        string      `json:"url"`
+	Method     string      `json:"method"`
+	Rule       string      `json:"rule"`
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Charset    string      `json:"charset,omitempty"`
+	Items      int         `json:"items"`
+	Error      string      `json:"error,omitempty"`
+	Time       string      `json:"time"`
+}
+
+// 按配置项debug::mode将响应内容及元数据保存至debug::dir，用于离线排查未能提取到数据的页面，
+// 由采集引擎在解析后调用。保存的内容为转码后的页面文本，未读取过的响应体在此读取，已被FileOutput()等读取完毕时仅保存元数据。
+// 同一URL的转储相互覆盖，总数达到debug::maxfiles后不再保存。
+func (self *Context) TeeDebug() {
+	if config.DEBUG_MODE == "" || self.Response == nil {
+		return
+	}
+	items := len(self.PeekItems())
+	if config.DEBUG_MODE == "failing" && items > 0 && self.err == nil &&
+		(self.spider.DebugDetector == nil || !self.spider.DebugDetector(self)) {
+		return
+	}
+	if n := atomic.AddInt64(&debugSaved, 1); config.DEBUG_MAX_FILES > 0 && n > int64(config.DEBUG_MAX_FILES) {
+		return
+	}
+
+	sum := sha1.Sum([]byte(self.GetUrl()))
+	dir := filepath.Join(config.DEBUG_DIR, util.FileNameReplace(self.spider.GetName()), hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		logs.Log.Error(" *     [debug][%s]: %v\n", self.GetUrl(), err)
+		return
+	}
+	meta := &debugMeta{
+		Url:        self.GetUrl(),
+		Method:     self.GetMethod(),
+		Rule:       self.GetRuleName(),
+		StatusCode: self.GetStatusCode(),
+		Header:     self.Response.Header,
+		Items:      items,
+		Time:       time.Now().Format(time.RFC3339),
+	}
+	if self.err != nil {
+		meta.Error = self.err.Error()
+	}
+	if body, ok := self.debugBody(); ok {
+		meta.Charset = self.charset
+		if err := ioutil.WriteFile(filepath.Join(dir, "body"+debugExt(self.mediaType())), body, 0666); err != nil {
+			logs.Log.Error(" *     [debug][%s]: %v\n", self.GetUrl(), err)
+		}
+	}
+	b, _ := json.MarshalIndent(meta, "", "  ")
+	if err := ioutil.WriteFile(filepath.Join(dir, "meta.json"), b, 0666); err != nil {
+		logs.Log.Error(" *     [debug][%s]: %v\n", self.GetUrl(), err)
+	}
+}
+
+// 获取页面文本，响应体已被读取完毕而无法获取时返回false
+func (self *Context) debugBody() (body []byte, ok bool) {
+	if self.text != nil {
+		return self.text, true
+	}
+	defer func() {
+		if recover() != nil {
+			body, ok = nil, false
+		}
+	}()
+	self.initText()
+	return self.text, true
+}
+
+func debugExt(mediaType string) string {
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return ".html"
+	case mediaType == "application/json" || mediaType == "text/json":
+		return ".json"
+	case mediaType == "application/xml" || mediaType == "text/xml":
+		return ".xml"
+	}
+	return ".txt"
+}
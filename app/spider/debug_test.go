@@ -0,0 +1,42 @@
+package spider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+func TestTeeDebug(t *testing.T) {
+	mode, dir := config.DEBUG_MODE, config.DEBUG_DIR
+	defer func() { config.DEBUG_MODE, config.DEBUG_DIR = mode, dir }()
+	config.DEBUG_MODE, config.DEBUG_DIR = "failing", t.TempDir()
+
+	sp := testSpider()
+	for _, page := range []testPage{
+		{url: "http://example.com/found", body: `<a href="http://example.com/1">one</a>`},
+		{url: "http://example.com/empty", header: http.Header{"Content-Type": {"text/html"}}, body: `<p>blocked</p>`},
+	} {
+		ctx := testContext(t, sp, "list", page).Parse("list")
+		ctx.TeeDebug()
+		PutContext(ctx)
+	}
+
+	// 仅保存未产出结果的页面
+	saved := filepath.Join(config.DEBUG_DIR, "test")
+	dirs, _ := ioutil.ReadDir(saved)
+	if len(dirs) != 1 {
+		t.Fatalf("saved: %d", len(dirs))
+	}
+	body, err := ioutil.ReadFile(filepath.Join(saved, dirs[0].Name(), "body.html"))
+	if err != nil || string(body) != `<p>blocked</p>` {
+		t.Fatalf("body: %q %v", body, err)
+	}
+	meta, _ := ioutil.ReadFile(filepath.Join(saved, dirs[0].Name(), "meta.json"))
+	if !strings.Contains(string(meta), `"url": "http://example.com/empty"`) || !strings.Contains(string(meta), `"rule": "list"`) {
+		t.Fatalf("meta: %s", meta)
+	}
+}
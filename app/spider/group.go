@@ -0,0 +1,152 @@
+package spider
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 请求组，见Context.NewGroup()
+type group struct {
+	fn     func(*Context)
+	req    *request.Request // 创建该组的请求，在Root中创建时为nil
+	parent string           // 创建该组的请求所属的请求组
+}
+
+type groupSet struct {
+	seq     int
+	groups  map[string]*group
+	created map[*request.Request][]string // [创建者请求]其创建的请求组
+	pending map[string]int                // 设置了请求接收器时代替请求矩阵的计数
+	sync.Mutex
+}
+
+// 创建请求组，组内请求（包括其后代请求）全部处理完毕后执行fn，返回请求组ID，用于设置Request.Group。
+//
+// 并发语义：
+//   - 组内请求在被调度队列接受时计数，因去重等原因未入队的请求不计入；
+//   - 请求在下载、解析（含失败）处理完毕时计为完成，首次失败后于队列末尾重新执行的请求不再计入该组；
+//   - 通过AddQueue()添加的子请求自动继承当前请求的请求组，因此后代请求均计入该组，如需排除可将其Group设为其他值；
+//   - 当前请求处理完毕前该组不会结束，因此在添加请求的过程中不会提前触发fn；
+//   - 在组内请求的规则中创建的请求组视为外层组的一员，内层组结束后外层组才可能结束；
+//   - fn在完成该组最后一个请求的协程中执行，与其他规则并发，访问共享数据时须自行加锁；
+//   - fn中的ctx以创建该组的请求构造（在Root中创建时为nil），不含响应，Output()等须指定规则名；
+//   - 任务被终止时未结束的请求组不再触发。
+func (self *Context) NewGroup(fn func(ctx *Context)) string {
+	return self.spider.newGroup(self.Request, fn)
+}
+
+func (self *Spider) newGroup(req *request.Request, fn func(*Context)) string {
+	self.lock.Lock()
+	if self.groups == nil {
+		self.groups = &groupSet{
+			groups:  make(map[string]*group),
+			created: make(map[*request.Request][]string),
+			pending: make(map[string]int),
+		}
+	}
+	set := self.groups
+	self.lock.Unlock()
+
+	g := &group{fn: fn, req: req}
+	if req != nil {
+		g.parent = req.GetGroup()
+	}
+	set.Lock()
+	set.seq++
+	id := strconv.Itoa(set.seq)
+	set.groups[id] = g
+	set.created[req] = append(set.created[req], id)
+	set.Unlock()
+
+	// 创建者请求处理完毕前保持该组，内层组计入外层组
+	self.addGroup(id)
+	self.addGroup(g.parent)
+	return id
+}
+
+// 请求处理完毕后调用（Root中创建的请求组以nil调用），依次结束该请求创建的请求组及其所属请求组的计数，
+// 返回已全部完成的请求组执行回调后的Context，由调用者收集结果并回收
+func (self *Spider) DoneGroups(req *request.Request) []*Context {
+	self.lock.RLock()
+	set := self.groups
+	self.lock.RUnlock()
+	if set == nil {
+		return nil
+	}
+	set.Lock()
+	ids := set.created[req]
+	delete(set.created, req)
+	set.Unlock()
+
+	var ctxs []*Context
+	for _, id := range ids {
+		ctxs = self.doneGroup(set, id, ctxs)
+	}
+	if req != nil && req.GetGroup() != "" {
+		ctxs = self.doneGroup(set, req.GetGroup(), ctxs)
+	}
+	return ctxs
+}
+
+func (self *Spider) doneGroup(set *groupSet, id string, ctxs []*Context) []*Context {
+	if !self.groupDone(set, id) {
+		return ctxs
+	}
+	set.Lock()
+	g := set.groups[id]
+	delete(set.groups, id)
+	set.Unlock()
+	if g == nil {
+		return ctxs
+	}
+	ctx := GetContext(self, g.req)
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logs.Log.Error(" *     Panic  [group][%s]: %v\n", self.GetName(), p)
+			}
+		}()
+		g.fn(ctx)
+	}()
+	ctxs = append(ctxs, ctx)
+	if g.parent != "" {
+		ctxs = self.doneGroup(set, g.parent, ctxs)
+	}
+	return ctxs
+}
+
+func (self *Spider) addGroup(id string) {
+	if id == "" {
+		return
+	}
+	if self.reqSink == nil {
+		self.reqMatrix.AddGroup(id)
+		return
+	}
+	self.lock.RLock()
+	set := self.groups
+	self.lock.RUnlock()
+	if set == nil {
+		return
+	}
+	set.Lock()
+	set.pending[id]++
+	set.Unlock()
+}
+
+func (self *Spider) groupDone(set *groupSet, id string) bool {
+	if self.reqSink == nil {
+		return self.reqMatrix.DoneGroup(id)
+	}
+	set.Lock()
+	defer set.Unlock()
+	if n := set.pending[id] - 1; n > 0 {
+		set.pending[id] = n
+		return false
+	}
+	delete(set.pending, id)
+	return true
+}
@@ -0,0 +1,59 @@
+package spider
+
+import (
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+func TestNewGroup(t *testing.T) {
+	sp := testSpider()
+	pull := captureRequests(sp)
+	ctx := testContext(t, sp, "list", testPage{url: "http://example.com/product"})
+	var summary int
+	group := ctx.NewGroup(func(ctx *Context) {
+		summary++
+		ctx.Output(map[string]interface{}{"title": ctx.GetUrl()}, "list")
+	})
+	ctx.AddQueue(&request.Request{Url: "http://example.com/reviews?page=1", Rule: "list", Group: group})
+	ctx.AddQueue(&request.Request{Url: "http://example.com/reviews?page=2", Rule: "list", Group: group})
+	parent := ctx.Request
+	PutContext(ctx)
+
+	// 创建者请求处理完毕，组内仍有未完成的请求
+	if ctxs := sp.DoneGroups(parent); len(ctxs) != 0 {
+		t.Fatalf("group finished early: %d", len(ctxs))
+	}
+	reqs := pull()
+	if len(reqs) != 2 || reqs[0].GetGroup() != group {
+		t.Fatalf("group requests: %v", reqs)
+	}
+
+	// 子请求中添加的后代请求自动计入该组
+	child := testContext(t, sp, "list", testPage{url: reqs[0].GetUrl()})
+	child.Request.SetGroup(group)
+	child.AddQueue(&request.Request{Url: "http://example.com/reviews/1", Rule: "list"})
+	PutContext(child)
+	reqs = append(reqs, pull()...)
+	if len(reqs) != 3 || reqs[2].GetGroup() != group {
+		t.Fatalf("descendant requests: %v", reqs)
+	}
+
+	for i, req := range reqs {
+		ctxs := sp.DoneGroups(req)
+		if i < len(reqs)-1 {
+			if len(ctxs) != 0 {
+				t.Fatalf("group finished after %d requests", i+1)
+			}
+			continue
+		}
+		if len(ctxs) != 1 || summary != 1 {
+			t.Fatalf("group callbacks: %d, %d", len(ctxs), summary)
+		}
+		items := ctxs[0].PullItems()
+		if len(items) != 1 || items[0]["Data"].(map[string]interface{})["title"] != "http://example.com/product" {
+			t.Fatalf("summary items: %v", items)
+		}
+		PutContext(ctxs[0])
+	}
+}
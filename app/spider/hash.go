@@ -0,0 +1,58 @@
+package spider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 已编译的Spider.VolatileContent正则表达式
+var volatileRegexps sync.Map
+
+// 返回页面文本的SHA-256摘要（十六进制），用于判断页面是否变化，结果已缓存。
+func (self *Context) BodyHash() string {
+	if self.hashes[0] == "" {
+		self.hashes[0] = sha256Hex([]byte(self.GetText()))
+	}
+	return self.hashes[0]
+}
+
+// 返回剔除Spider.VolatileContent所匹配的易变内容后的页面文本摘要，
+// 未设置VolatileContent时同BodyHash()，结果已缓存。
+func (self *Context) ContentHash() string {
+	if self.hashes[1] != "" {
+		return self.hashes[1]
+	}
+	if len(self.spider.VolatileContent) == 0 {
+		self.hashes[1] = self.BodyHash()
+		return self.hashes[1]
+	}
+	text := []byte(self.GetText())
+	for _, expr := range self.spider.VolatileContent {
+		if re := volatileRegexp(expr); re != nil {
+			text = re.ReplaceAll(text, nil)
+		}
+	}
+	self.hashes[1] = sha256Hex(text)
+	return self.hashes[1]
+}
+
+func volatileRegexp(expr string) *regexp.Regexp {
+	if re, ok := volatileRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		logs.Log.Error(" *     VolatileContent正则表达式 %q 有误: %v\n", expr, err)
+	}
+	volatileRegexps.Store(expr, re)
+	return re
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
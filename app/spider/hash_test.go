@@ -0,0 +1,23 @@
+package spider
+
+import (
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	sp := testSpider()
+	sp.VolatileContent = []string{`token="\w+"`}
+	a := testContext(t, sp, "list", testPage{body: `<p token="abc">x</p>`})
+	b := testContext(t, sp, "list", testPage{body: `<p token="xyz">x</p>`})
+	if a.BodyHash() == b.BodyHash() || a.BodyHash() != a.BodyHash() {
+		t.Fatal("BodyHash")
+	}
+	if a.ContentHash() != b.ContentHash() {
+		t.Fatal("ContentHash should ignore volatile content")
+	}
+	if b.ResetText(`<p>y</p>`).ContentHash() == a.ContentHash() {
+		t.Fatal("ContentHash not reset with text")
+	}
+	PutContext(a)
+	PutContext(b)
+}
@@ -0,0 +1,101 @@
+package spider
+
+import (
+	"net/http"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+// 返回模拟常见浏览器打开页面时的请求头，可用于SetDefaultHeaders()。
+// 不含User-Agent、Accept-Language（分别由下载器与Spider.AcceptLanguage设置），
+// 也不含Accept-Encoding，以免服务器返回下载器无法解压的编码。
+func BrowserHeaders() http.Header {
+	return http.Header{
+		"Accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Cache-Control":             {"max-age=0"},
+		"Sec-Fetch-Dest":            {"document"},
+		"Sec-Fetch-Mode":            {"navigate"},
+		"Sec-Fetch-Site":            {"none"},
+		"Sec-Fetch-User":            {"?1"},
+		"Upgrade-Insecure-Requests": {"1"},
+	}
+}
+
+// 返回常见浏览器（Chrome）以HTTP/1.1打开页面时发送请求头的顺序，可用于Spider.HeaderOrder。
+// 浏览器升级时其顺序可能变化，需随之维护。
+func BrowserHeaderOrder() []string {
+	return []string{
+		"Connection",
+		"Cache-Control",
+		"sec-ch-ua",
+		"sec-ch-ua-mobile",
+		"sec-ch-ua-platform",
+		"Upgrade-Insecure-Requests",
+		"User-Agent",
+		"Accept",
+		"Sec-Fetch-Site",
+		"Sec-Fetch-Mode",
+		"Sec-Fetch-User",
+		"Sec-Fetch-Dest",
+		"Referer",
+		"Accept-Encoding",
+		"Accept-Language",
+		"Cookie",
+	}
+}
+
+// 模拟浏览器：以BrowserHeaders()为默认请求头，并按BrowserHeaderOrder()的顺序发送。
+// 仅用于对请求头顺序敏感的目标，按顺序发送时每个请求均需新建连接，见Spider.HeaderOrder。
+func (self *Spider) UseBrowserProfile() {
+	self.SetDefaultHeaders(BrowserHeaders())
+	self.HeaderOrder = BrowserHeaderOrder()
+}
+
+// 设置所有请求默认附加的请求头（包括动态规则JsAddQueue()添加的请求），由下载器在发送前合并，
+// 请求中已指定的字段不覆盖。字段名按net/http的规范形式（如"Sec-Fetch-Mode"）保存，与请求中的同名字段视为相同。
+func (self *Spider) SetDefaultHeaders(header http.Header) {
+	h := make(http.Header, len(header))
+	for k, vs := range header {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	self.lock.Lock()
+	self.headers = h
+	self.lock.Unlock()
+}
+
+// 获取所有请求默认附加的请求头的副本
+func (self *Spider) GetDefaultHeaders() http.Header {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return copyHeader(self.headers)
+}
+
+// 将默认请求头中请求未指定的字段合并至req
+func (self *Spider) MergeDefaultHeaders(req *request.Request) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if len(self.headers) == 0 {
+		return
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header, len(self.headers))
+	}
+	for k, vs := range self.headers {
+		if len(req.Header.Values(k)) == 0 {
+			req.Header[k] = append([]string(nil), vs...)
+		}
+	}
+}
+
+func copyHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	h := make(http.Header, len(header))
+	for k, vs := range header {
+		h[k] = append([]string(nil), vs...)
+	}
+	return h
+}
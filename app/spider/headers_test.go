@@ -0,0 +1,22 @@
+package spider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+func TestDefaultHeaders(t *testing.T) {
+	sp := testSpider()
+	header := BrowserHeaders()
+	header.Add("dnt", "1")
+	sp.SetDefaultHeaders(header)
+	header.Set("DNT", "0")
+
+	req := &request.Request{Url: "http://example.com/", Rule: "list", Header: http.Header{"Accept": {"application/json"}}}
+	sp.Copy().MergeDefaultHeaders(req)
+	if req.Header.Get("Accept") != "application/json" || req.Header.Get("Dnt") != "1" || req.Header.Get("Sec-Fetch-Mode") != "navigate" {
+		t.Fatalf("header: %v", req.Header)
+	}
+}
@@ -0,0 +1,146 @@
+package spider
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/common/goquery"
+)
+
+// 页面中的超链接
+type Link struct {
+	Url  string // 绝对地址
+	Text string // 链接文本
+	Rel  string // rel属性
+}
+
+// 将页面中的相对地址转换为绝对地址，优先以<base href>为基准，无法解析时原样返回。
+func (self *Context) AbsURL(ref string) string {
+	ref = strings.TrimSpace(ref)
+	base := self.baseURL()
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// 返回页面中全部带href的<a>链接，地址已转为绝对地址，忽略javascript:链接，无链接时返回空切片。
+func (self *Context) Links() []Link {
+	links := []Link{}
+	self.Each("a[href]", func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		rel, _ := s.Attr("rel")
+		links = append(links, Link{
+			Url:  self.AbsURL(href),
+			Text: strings.TrimSpace(s.Text()),
+			Rel:  rel,
+		})
+	})
+	return links
+}
+
+// 返回页面中<img>的图片绝对地址（已去重），无图片时返回空切片。
+// 含srcset时默认只取分辨率最高的候选地址，srcsetAll为true时返回全部候选地址。
+func (self *Context) Images(srcsetAll ...bool) []string {
+	all := len(srcsetAll) > 0 && srcsetAll[0]
+	images := []string{}
+	seen := map[string]bool{}
+	add := func(src string) {
+		if src = strings.TrimSpace(src); src == "" || strings.HasPrefix(src, "data:") {
+			return
+		}
+		if src = self.AbsURL(src); !seen[src] {
+			seen[src] = true
+			images = append(images, src)
+		}
+	}
+	self.Each("img", func(i int, s *goquery.Selection) {
+		if srcset, ok := s.Attr("srcset"); ok && strings.TrimSpace(srcset) != "" {
+			candidates := parseSrcset(srcset)
+			if all {
+				for _, c := range candidates {
+					add(c.url)
+				}
+				return
+			}
+			var best srcsetCandidate
+			for _, c := range candidates {
+				if best.url == "" || c.size > best.size {
+					best = c
+				}
+			}
+			add(best.url)
+			return
+		}
+		src, _ := s.Attr("src")
+		add(src)
+	})
+	return images
+}
+
+// 返回<base href>与页面地址共同决定的基准地址
+func (self *Context) baseURL() *url.URL {
+	if self.Request == nil {
+		return nil
+	}
+	base, err := url.Parse(self.GetUrl())
+	if err != nil {
+		return nil
+	}
+	if href, ok := self.First("base[href]").Attr("href"); ok {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+		}
+	}
+	return base
+}
+
+type srcsetCandidate struct {
+	url  string
+	size float64 // 宽度描述符(w)或像素密度描述符(x)，缺省为1x
+}
+
+// 解析srcset属性，如"a.jpg 1x, b.jpg 2x"或"a.jpg 480w, b.jpg 800w"。
+// 按HTML规范，URL以空白结束且可含逗号（如"w_400,h_300/a.jpg"），紧接URL的逗号或描述符之后的逗号分隔候选项。
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	for s := srcset; ; {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return candidates
+		}
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		c := srcsetCandidate{url: s[:end], size: 1}
+		s = s[end:]
+		if u := strings.TrimRight(c.url, ","); u != c.url {
+			// URL末尾的逗号结束该候选项，无描述符
+			c.url = u
+		} else {
+			desc := s
+			if i := strings.IndexByte(s, ','); i >= 0 {
+				desc, s = s[:i], s[i+1:]
+			} else {
+				s = ""
+			}
+			if fields := strings.Fields(desc); len(fields) > 0 {
+				d := strings.ToLower(fields[0])
+				if n, err := strconv.ParseFloat(strings.TrimRight(d, "wx"), 64); err == nil {
+					c.size = n
+				}
+			}
+		}
+		candidates = append(candidates, c)
+	}
+}
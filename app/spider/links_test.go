@@ -0,0 +1,47 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinksImages(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{
+		url: "http://example.com/a/page.html",
+		body: `<base href="http://cdn.example.com/b/">
+<a href="next.html" rel="next"> Next </a><a href="javascript:void(0)">x</a>
+<img src="s.jpg" srcset="s.jpg 1x, l.jpg 2x"><img src="/p.png"><img src="s.jpg">`,
+	})
+	links := ctx.Links()
+	if len(links) != 1 || links[0] != (Link{Url: "http://cdn.example.com/b/next.html", Text: "Next", Rel: "next"}) {
+		t.Fatalf("links: %v", links)
+	}
+	for all, want := range map[bool][]string{
+		false: {"http://cdn.example.com/b/l.jpg", "http://cdn.example.com/p.png", "http://cdn.example.com/b/s.jpg"},
+		true:  {"http://cdn.example.com/b/s.jpg", "http://cdn.example.com/b/l.jpg", "http://cdn.example.com/p.png"},
+	} {
+		if imgs := ctx.Images(all); !reflect.DeepEqual(imgs, want) {
+			t.Errorf("Images(%v) = %v", all, imgs)
+		}
+	}
+	PutContext(ctx)
+}
+
+func TestParseSrcset(t *testing.T) {
+	for srcset, want := range map[string][]srcsetCandidate{
+		"":                        nil,
+		"a.jpg":                   {{"a.jpg", 1}},
+		"a.jpg 1x, b.jpg 2x":      {{"a.jpg", 1}, {"b.jpg", 2}},
+		"a.jpg 480w,b.jpg 800w":   {{"a.jpg", 480}, {"b.jpg", 800}},
+		"a.jpg, b.jpg 2x":         {{"a.jpg", 1}, {"b.jpg", 2}},
+		" a.jpg  1.5x ,, b.jpg  ": {{"a.jpg", 1.5}, {"b.jpg", 1}},
+		"/c/w_400,h_300/a.jpg 400w, /c/w_800,h_600/a.jpg 800w": {
+			{"/c/w_400,h_300/a.jpg", 400}, {"/c/w_800,h_600/a.jpg", 800},
+		},
+		"/c/w_400,h_300/a.jpg,/c/w_800,h_600/a.jpg,": {{"/c/w_400,h_300/a.jpg,/c/w_800,h_600/a.jpg", 1}},
+	} {
+		if got := parseSrcset(srcset); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseSrcset(%q) = %v, want %v", srcset, got, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package spider
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+// 表单登录配置，见Spider.Login。
+// 下载器发现响应为未登录页面时，以请求所属的会话执行登录（cookie存入该会话的cookie容器），
+// 然后重新下载原请求；同一会话并发检测到未登录时只登录一次。
+type Login struct {
+	Url       string              // 登录地址
+	Method    string              // 请求方法，默认为POST
+	Form      url.Values          // 登录表单字段
+	Header    http.Header         // 附加的请求头
+	Status    []int               // 视为未登录的响应状态码，如401
+	Contains  string              // 响应内容包含该文本（如登录表单的特征）时视为未登录
+	LoggedOut func(*Context) bool // 自定义的未登录判断，与Status、Contains任一满足即视为未登录
+	MaxTimes  int                 // 每个请求最多重新登录的次数，防止登录无效时循环登录，默认为1
+
+	lock     sync.Mutex
+	loggedIn map[string]time.Time // [会话ID]最近一次登录完成的时刻
+}
+
+func (self *Login) copy() *Login {
+	if self == nil {
+		return nil
+	}
+	return &Login{
+		Url:       self.Url,
+		Method:    self.Method,
+		Form:      self.Form,
+		Header:    self.Header,
+		Status:    append([]int(nil), self.Status...),
+		Contains:  self.Contains,
+		LoggedOut: self.LoggedOut,
+		MaxTimes:  self.MaxTimes,
+	}
+}
+
+// 获取每个请求最多重新登录的次数
+func (self *Login) GetMaxTimes() int {
+	if self.MaxTimes <= 0 {
+		return 1
+	}
+	return self.MaxTimes
+}
+
+// 响应是否为未登录页面
+func (self *Login) IsLoggedOut(ctx *Context) bool {
+	if ctx.Response == nil {
+		return false
+	}
+	code := ctx.GetStatusCode()
+	for _, c := range self.Status {
+		if c == code {
+			return true
+		}
+	}
+	if self.Contains != "" && strings.Contains(ctx.GetText(), self.Contains) {
+		return true
+	}
+	return self.LoggedOut != nil && self.LoggedOut(ctx)
+}
+
+// 生成req所属会话的登录请求
+func (self *Login) Request(sp *Spider, req *request.Request) *request.Request {
+	header := make(http.Header, len(self.Header))
+	for k, v := range self.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	login := &request.Request{
+		Spider:       sp.GetName(),
+		Url:          self.Url,
+		Rule:         req.GetRuleName(),
+		Method:       self.Method,
+		Header:       header,
+		EnableCookie: true,
+		Session:      req.GetSession(),
+		Reloadable:   true,
+	}
+	if self.Form != nil {
+		login.SetForm(self.Form)
+	}
+	if login.Method == "" {
+		login.Method = "POST"
+	}
+	login.Prepare()
+	return login
+}
+
+// 为req所属会话重新登录，since为检测到未登录的响应开始下载的时刻：
+// 若此后该会话已由其他请求完成登录，则不再登录而直接返回nil。
+func (self *Login) Relogin(req *request.Request, since time.Time, login func() error) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	session := req.GetSession()
+	if self.loggedIn[session].After(since) {
+		return nil
+	}
+	if err := login(); err != nil {
+		return err
+	}
+	if self.loggedIn == nil {
+		self.loggedIn = make(map[string]time.Time)
+	}
+	self.loggedIn[session] = time.Now()
+	return nil
+}
@@ -0,0 +1,49 @@
+package spider
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	login := &Login{
+		Url:      "http://example.com/login",
+		Form:     url.Values{"user": {"alice"}},
+		Status:   []int{401},
+		Contains: `name="password"`,
+	}
+	for _, c := range []struct {
+		page testPage
+		want bool
+	}{
+		{testPage{body: `<form><input name="password"></form>`}, true},
+		{testPage{body: `<p>welcome</p>`}, false},
+		{testPage{code: 401}, true},
+	} {
+		ctx := testContext(t, nil, "list", c.page)
+		if login.IsLoggedOut(ctx) != c.want {
+			t.Errorf("%d %s: want %v", c.page.code, c.page.body, c.want)
+		}
+		PutContext(ctx)
+	}
+
+	ctx := testContext(t, nil, "list", testPage{code: 401})
+	req := login.Request(ctx.GetSpider(), ctx.Request)
+	if req.GetMethod() != "POST" || req.GetPostData() != "user=alice" || !req.GetEnableCookie() {
+		t.Fatalf("login request: %v %v", req.GetMethod(), req.GetPostData())
+	}
+	PutContext(ctx)
+
+	// 同一会话并发检测到未登录时只登录一次
+	var n int
+	since := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := login.Relogin(req, since, func() error { n++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != 1 {
+		t.Fatalf("logged in %d times", n)
+	}
+}
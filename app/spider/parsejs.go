@@ -2,10 +2,15 @@ package spider
 
 import (
 	"encoding/xml"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/robertkrimen/otto"
 
@@ -16,108 +21,247 @@ import (
 // 蜘蛛规则解释器模型
 type (
 	SpiderModle struct {
-		Name            string      `xml:"Name"`
-		Description     string      `xml:"Description"`
-		Pausetime       int64       `xml:"Pausetime"`
-		EnableLimit     bool        `xml:"EnableLimit"`
-		EnableKeyin     bool        `xml:"EnableKeyin"`
-		EnableCookie    bool        `xml:"EnableCookie"`
-		NotDefaultField bool        `xml:"NotDefaultField"`
-		Namespace       string      `xml:"Namespace>Script"`
-		SubNamespace    string      `xml:"SubNamespace>Script"`
-		Root            string      `xml:"Root>Script"`
-		Trunk           []RuleModle `xml:"Rule"`
+		XMLName         xml.Name     `xml:"Spider"`
+		Name            string       `xml:"Name"`
+		Description     string       `xml:"Description"`
+		Pausetime       int64        `xml:"Pausetime"`
+		EnableLimit     bool         `xml:"EnableLimit"`
+		EnableKeyin     bool         `xml:"EnableKeyin"`
+		EnableCookie    bool         `xml:"EnableCookie"`
+		NotDefaultField bool         `xml:"NotDefaultField"`
+		Limit           int64        `xml:"Limit,omitempty"`          // EnableLimit为false时的默认限制请求数
+		AcceptLanguage  string       `xml:"AcceptLanguage,omitempty"` // 默认的Accept-Language请求头
+		LinkGraph       bool         `xml:"LinkGraph,omitempty"`      // 是否输出链接关系
+		Timers          []TimerModle `xml:"Timer,omitempty"`          // 定时器，执行Root前设置，规则中以ctx.RunTimer(id)使用
+		Namespace       string       `xml:"Namespace>Script"`
+		SubNamespace    string       `xml:"SubNamespace>Script"`
+		Root            string       `xml:"Root>Script"`
+		Trunk           []RuleModle  `xml:"Rule"`
+	}
+	TimerModle struct {
+		Id   string `xml:"id,attr"`
+		Tol  string `xml:"tol,attr"`            // 倒计时器的睡眠时长（如"30m"），闹铃为醒来于第几个bell时刻
+		Bell string `xml:"bell,attr,omitempty"` // 闹铃时刻（如"08:30:00"），为空时为倒计时器
 	}
 	RuleModle struct {
-		Name      string `xml:"name,attr"`
-		ParseFunc string `xml:"ParseFunc>Script"`
-		AidFunc   string `xml:"AidFunc>Script"`
+		Name       string       `xml:"name,attr"`
+		ItemFields []FieldModle `xml:"ItemFields>Field,omitempty"`
+		ParseFunc  string       `xml:"ParseFunc>Script"`
+		AidFunc    string       `xml:"AidFunc>Script"`
+	}
+	FieldModle struct {
+		Name string `xml:",chardata"`
+		Type string `xml:"type,attr,omitempty"` // Rule.Schema中的字段类型
 	}
 )
 
 func init() {
-	for _, _m := range getSpiderModles() {
-		m := _m //保证闭包变量
-		var sp = &Spider{
-			Name:            m.Name,
-			Description:     m.Description,
-			Pausetime:       m.Pausetime,
-			EnableCookie:    m.EnableCookie,
-			NotDefaultField: m.NotDefaultField,
-			RuleTree:        &RuleTree{Trunk: map[string]*Rule{}},
+	for _, m := range getSpiderModles() {
+		m.Spider().Register()
+	}
+}
+
+// 从动态规则文件内容解析出蜘蛛，未注册，可通过Register()添加至蜘蛛菜单
+func ImportSpider(r io.Reader) (*Spider, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var m SpiderModle
+	if err = xml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m.Spider(), nil
+}
+
+// 以动态规则文件格式导出蜘蛛的静态定义。
+// 编译型蜘蛛的Namespace、Root、ParseFunc等函数无法导出，对应脚本为空，
+// 导入后得到仅含名称、规则名、结果字段、定时器等元数据的蜘蛛骨架；
+// 定时器取自动态规则的定义或已通过SetTimer()设置的定时器。
+func (self *Spider) Export(w io.Writer) error {
+	b, err := xml.MarshalIndent(self.Modle(), "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// 返回蜘蛛的解释器模型，动态规则蜘蛛保留其脚本
+func (self *Spider) Modle() *SpiderModle {
+	m := &SpiderModle{
+		Name:            self.Name,
+		Description:     self.Description,
+		Pausetime:       self.Pausetime,
+		EnableLimit:     self.Limit == LIMIT,
+		EnableKeyin:     self.Keyin == KEYIN,
+		EnableCookie:    self.EnableCookie,
+		NotDefaultField: self.NotDefaultField,
+		AcceptLanguage:  self.AcceptLanguage,
+		LinkGraph:       self.LinkGraph,
+	}
+	if self.Limit != LIMIT {
+		m.Limit = self.Limit
+	}
+	if self.timer != nil {
+		m.Timers = self.timer.modles()
+	} else if self.modle != nil {
+		m.Timers = self.modle.Timers
+	}
+	var scripts = map[string]RuleModle{}
+	if self.modle != nil {
+		m.Namespace, m.SubNamespace, m.Root = self.modle.Namespace, self.modle.SubNamespace, self.modle.Root
+		for _, r := range self.modle.Trunk {
+			scripts[r.Name] = r
 		}
-		if m.EnableLimit {
-			sp.Limit = LIMIT
+	}
+	if self.RuleTree == nil {
+		return m
+	}
+	names := make([]string, 0, len(self.RuleTree.Trunk))
+	for name := range self.RuleTree.Trunk {
+		if name != LINK_GRAPH && name != ASSET_RULE {
+			names = append(names, name)
 		}
-		if m.EnableKeyin {
-			sp.Keyin = KEYIN
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rule := self.RuleTree.Trunk[name]
+		r := RuleModle{
+			Name:      name,
+			ParseFunc: scripts[name].ParseFunc,
+			AidFunc:   scripts[name].AidFunc,
 		}
-
-		if m.Namespace != "" {
-			sp.Namespace = func(self *Spider) string {
-				vm := otto.New()
-				vm.Set("self", self)
-				val, err := vm.Eval(m.Namespace)
-				if err != nil {
-					logs.Log.Error(" *     动态规则  [Namespace]: %v\n", err)
-				}
-				s, _ := val.ToString()
-				return s
-			}
+		for _, field := range rule.ItemFields {
+			r.ItemFields = append(r.ItemFields, FieldModle{Name: field, Type: rule.Schema[field]})
 		}
+		m.Trunk = append(m.Trunk, r)
+	}
+	return m
+}
 
-		if m.SubNamespace != "" {
-			sp.SubNamespace = func(self *Spider, dataCell map[string]interface{}) string {
-				vm := otto.New()
-				vm.Set("self", self)
-				vm.Set("dataCell", dataCell)
-				val, err := vm.Eval(m.SubNamespace)
-				if err != nil {
-					logs.Log.Error(" *     动态规则  [SubNamespace]: %v\n", err)
-				}
-				s, _ := val.ToString()
-				return s
+// 根据解释器模型生成蜘蛛，各函数由JS脚本解释执行
+func (self *SpiderModle) Spider() *Spider {
+	m := self
+	var sp = &Spider{
+		Name:            m.Name,
+		Description:     m.Description,
+		Pausetime:       m.Pausetime,
+		Limit:           m.Limit,
+		EnableCookie:    m.EnableCookie,
+		NotDefaultField: m.NotDefaultField,
+		AcceptLanguage:  m.AcceptLanguage,
+		LinkGraph:       m.LinkGraph,
+		RuleTree:        &RuleTree{Trunk: map[string]*Rule{}},
+		modle:           m,
+	}
+	if m.EnableLimit {
+		sp.Limit = LIMIT
+	}
+	if m.EnableKeyin {
+		sp.Keyin = KEYIN
+	}
+
+	if m.Namespace != "" {
+		sp.Namespace = func(self *Spider) string {
+			vm := otto.New()
+			vm.Set("self", self)
+			val, err := vm.Eval(m.Namespace)
+			if err != nil {
+				logs.Log.Error(" *     动态规则  [Namespace]: %v\n", err)
 			}
+			s, _ := val.ToString()
+			return s
 		}
+	}
 
-		sp.RuleTree.Root = func(ctx *Context) {
+	if m.SubNamespace != "" {
+		sp.SubNamespace = func(self *Spider, dataCell map[string]interface{}) string {
 			vm := otto.New()
-			vm.Set("ctx", ctx)
-			_, err := vm.Eval(m.Root)
+			vm.Set("self", self)
+			vm.Set("dataCell", dataCell)
+			val, err := vm.Eval(m.SubNamespace)
 			if err != nil {
-				logs.Log.Error(" *     动态规则  [Root]: %v\n", err)
+				logs.Log.Error(" *     动态规则  [SubNamespace]: %v\n", err)
 			}
+			s, _ := val.ToString()
+			return s
 		}
+	}
 
-		for _, rule := range m.Trunk {
-			r := new(Rule)
-			r.ParseFunc = func(parse string) func(*Context) {
-				return func(ctx *Context) {
-					vm := otto.New()
-					vm.Set("ctx", ctx)
-					_, err := vm.Eval(parse)
-					if err != nil {
-						logs.Log.Error(" *     动态规则  [ParseFunc]: %v\n", err)
-					}
+	sp.RuleTree.Root = func(ctx *Context) {
+		for _, t := range m.Timers {
+			t.set(ctx.spider)
+		}
+		vm := otto.New()
+		vm.Set("ctx", ctx)
+		_, err := vm.Eval(m.Root)
+		if err != nil {
+			logs.Log.Error(" *     动态规则  [Root]: %v\n", err)
+		}
+	}
+
+	for _, rule := range m.Trunk {
+		r := new(Rule)
+		for _, field := range rule.ItemFields {
+			r.ItemFields = append(r.ItemFields, field.Name)
+			if field.Type != "" {
+				if r.Schema == nil {
+					r.Schema = map[string]string{}
 				}
-			}(rule.ParseFunc)
-
-			r.AidFunc = func(parse string) func(*Context, map[string]interface{}) interface{} {
-				return func(ctx *Context, aid map[string]interface{}) interface{} {
-					vm := otto.New()
-					vm.Set("ctx", ctx)
-					vm.Set("aid", aid)
-					val, err := vm.Eval(parse)
-					if err != nil {
-						logs.Log.Error(" *     动态规则  [AidFunc]: %v\n", err)
-					}
-					return val
+				r.Schema[field.Name] = field.Type
+			}
+		}
+		r.ParseFunc = func(parse string) func(*Context) {
+			return func(ctx *Context) {
+				vm := otto.New()
+				vm.Set("ctx", ctx)
+				_, err := vm.Eval(parse)
+				if err != nil {
+					logs.Log.Error(" *     动态规则  [ParseFunc]: %v\n", err)
 				}
-			}(rule.ParseFunc)
-			sp.RuleTree.Trunk[rule.Name] = r
+			}
+		}(rule.ParseFunc)
+
+		r.AidFunc = func(parse string) func(*Context, map[string]interface{}) interface{} {
+			return func(ctx *Context, aid map[string]interface{}) interface{} {
+				vm := otto.New()
+				vm.Set("ctx", ctx)
+				vm.Set("aid", aid)
+				val, err := vm.Eval(parse)
+				if err != nil {
+					logs.Log.Error(" *     动态规则  [AidFunc]: %v\n", err)
+				}
+				return val
+			}
+		}(rule.AidFunc)
+		sp.RuleTree.Trunk[rule.Name] = r
+	}
+	return sp
+}
+
+// 为蜘蛛设置该定时器，定义有误时记录日志
+func (self TimerModle) set(sp *Spider) {
+	var (
+		tol  time.Duration
+		bell *Bell
+		err  error
+	)
+	if self.Bell == "" {
+		tol, err = time.ParseDuration(self.Tol)
+	} else {
+		bell = new(Bell)
+		if _, err = fmt.Sscanf(self.Bell, "%d:%d:%d", &bell.Hour, &bell.Min, &bell.Sec); err == nil {
+			var n int
+			n, err = strconv.Atoi(self.Tol)
+			tol = time.Duration(n)
 		}
-		sp.Register()
 	}
+	if err != nil {
+		logs.Log.Error(" *     动态规则  [Timer %s]: %v\n", self.Id, err)
+		return
+	}
+	sp.SetTimer(self.Id, tol, bell)
 }
 
 func getSpiderModles() (ms []*SpiderModle) {
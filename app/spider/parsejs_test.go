@@ -0,0 +1,70 @@
+package spider
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	f, err := os.Open("../../pholcus_pkg/spiders/test.pholcus.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err := ImportSpider(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.RuleTree.Trunk["登录后"].ItemFields = []string{"全部", "时间"}
+	sp.RuleTree.Trunk["登录后"].Schema = map[string]string{"时间": TYPE_TIME}
+
+	var buf bytes.Buffer
+	if err = sp.Copy().Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sp2, err := ImportSpider(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := sp2.RuleTree.Trunk["登录后"]
+	if sp2.Name != sp.Name || !sp2.EnableCookie || len(sp2.RuleTree.Trunk) != len(sp.RuleTree.Trunk) ||
+		len(rule.ItemFields) != 2 || rule.Schema["时间"] != TYPE_TIME || !strings.Contains(sp2.modle.Root, "JsAddQueue") {
+		t.Fatalf("round trip: %#v", sp2.Modle())
+	}
+}
+
+// 动态规则中定义的定时器在执行Root前设置，并随Export()导出
+func TestImportTimers(t *testing.T) {
+	sp, err := ImportSpider(strings.NewReader(`<Spider>
+	<Name>timers</Name>
+	<Timer id="wait" tol="90s"/>
+	<Timer id="daily" tol="1" bell="08:30:00"/>
+	<Timer id="bad" tol="x"/>
+	<Root><Script></Script></Root>
+</Spider>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := GetContext(sp, nil)
+	sp.RuleTree.Root(ctx)
+	PutContext(ctx)
+
+	want := []TimerModle{{Id: "daily", Tol: "1", Bell: "08:30:00"}, {Id: "wait", Tol: "1m30s"}}
+	if got := sp.Modle().Timers; !reflect.DeepEqual(got, want) {
+		t.Fatalf("timers = %v, want %v", got, want)
+	}
+	var buf bytes.Buffer
+	if err = sp.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sp2, err := ImportSpider(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sp2.Modle().Timers; !reflect.DeepEqual(got, want) {
+		t.Errorf("timers after round trip = %v, want %v", got, want)
+	}
+}
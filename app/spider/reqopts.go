@@ -0,0 +1,74 @@
+package spider
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+// AddQueueOpts()的请求选项，依次作用于新建的请求
+type RequestOption func(*request.Request)
+
+// 以url与规则名新建请求并依次应用opts，然后同AddQueue()添加至队列，未设置的字段取默认值（见AddQueue）
+func (self *Context) AddQueueOpts(url, rule string, opts ...RequestOption) *Context {
+	req := &request.Request{
+		Url:    url,
+		Rule:   rule,
+		Header: make(http.Header),
+		Temp:   make(request.Temp),
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return self.AddQueue(req)
+}
+
+// 设置请求方法，如POST
+func WithMethod(method string) RequestOption {
+	return func(req *request.Request) {
+		req.SetMethod(method)
+	}
+}
+
+// 设置请求头，可多次使用
+func WithHeader(key, value string) RequestOption {
+	return func(req *request.Request) {
+		req.SetHeader(key, value)
+	}
+}
+
+// 设置请求体
+func WithPostData(postData string) RequestOption {
+	return func(req *request.Request) {
+		req.PostData = postData
+	}
+}
+
+// 设置调度优先级
+func WithPriority(priority int) RequestOption {
+	return func(req *request.Request) {
+		req.SetPriority(priority)
+	}
+}
+
+// 设置尝试下载的最大次数，小于0时不限
+func WithTryTimes(tryTimes int) RequestOption {
+	return func(req *request.Request) {
+		req.TryTimes = tryTimes
+	}
+}
+
+// 设置创建连接的超时，小于0时不限
+func WithDialTimeout(timeout time.Duration) RequestOption {
+	return func(req *request.Request) {
+		req.DialTimeout = timeout
+	}
+}
+
+// 设置一项临时数据，可多次使用
+func WithTemp(key string, value interface{}) RequestOption {
+	return func(req *request.Request) {
+		req.SetTemp(key, value)
+	}
+}
@@ -0,0 +1,38 @@
+package spider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+)
+
+func TestAddQueueOpts(t *testing.T) {
+	sp := testSpider()
+	pull := captureRequests(sp)
+	ctx := testContext(t, sp, "list", testPage{url: "http://example.com/list"})
+	ctx.AddQueueOpts("http://example.com/api", "detail",
+		WithMethod("post"),
+		WithHeader("X-Token", "t"),
+		WithPostData("a=1"),
+		WithPriority(2),
+		WithTryTimes(5),
+		WithDialTimeout(time.Second),
+		WithTemp("id", 7),
+	)
+	ctx.AddQueueOpts("http://example.com/plain", "detail")
+	reqs := pull()
+	if len(reqs) != 2 {
+		t.Fatalf("requests: %v", reqs)
+	}
+	req := reqs[0]
+	if req.GetMethod() != "POST" || req.GetHeader().Get("X-Token") != "t" || req.GetPostData() != "a=1" ||
+		req.GetPriority() != 2 || req.GetTryTimes() != 5 || req.GetDialTimeout() != time.Second ||
+		req.GetTemp("id", 0) != 7 || req.GetReferer() != "http://example.com/list" {
+		t.Errorf("request with options: %+v", req)
+	}
+	if req := reqs[1]; req.GetMethod() != "GET" || req.GetTryTimes() != request.DefaultTryTimes {
+		t.Errorf("request without options: %+v", req)
+	}
+	PutContext(ctx)
+}
@@ -0,0 +1,117 @@
+package spider
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 断点续传的未完成文件，meta文件记录用于If-Range校验的ETag或Last-Modified
+func partialPath(url string) (part, meta string) {
+	sum := sha1.Sum([]byte(url))
+	part = filepath.Join(config.CACHE_DIR, "partial", hex.EncodeToString(sum[:])+".part")
+	return part, part + ".meta"
+}
+
+// 由下载器在下载前调用：蜘蛛开启ResumeFile且该地址存在未完成的文件下载时，
+// 为请求设置Range及If-Range请求头，否则清除二者。
+func PrepareResume(sp *Spider, req *request.Request) {
+	if !sp.ResumeFile || req.GetMethod() != "GET" {
+		return
+	}
+	header := req.GetHeader()
+	header.Del("Range")
+	header.Del("If-Range")
+	part, meta := partialPath(req.GetUrl())
+	info, err := os.Stat(part)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	validator, err := ioutil.ReadFile(meta)
+	if err != nil || len(validator) == 0 {
+		return
+	}
+	req.SetHeader("Range", "bytes="+strconv.FormatInt(info.Size(), 10)+"-")
+	req.SetHeader("If-Range", string(validator))
+}
+
+// 删除该地址未完成的文件，用于服务器拒绝续传(416)时
+func DiscardPartial(url string) {
+	part, meta := partialPath(url)
+	os.Remove(part)
+	os.Remove(meta)
+}
+
+// 可续传地读取文件响应：206响应追加至未完成的文件，其他响应从头写入；
+// 读取中断时保留未完成的文件，待请求重试时续传。
+func (self *Context) resumeFileBody() ([]byte, error) {
+	part, meta := partialPath(self.GetUrl())
+	if err := os.MkdirAll(filepath.Dir(part), 0777); err != nil {
+		return nil, err
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if self.Response.StatusCode == http.StatusPartialContent {
+		info, err := os.Stat(part)
+		if err != nil || contentRangeStart(self.Response.Header.Get("Content-Range")) != info.Size() {
+			DiscardPartial(self.GetUrl())
+			return nil, fmt.Errorf("续传的响应与未完成的文件不一致，将重新下载")
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+	} else {
+		validator := self.Response.Header.Get("ETag")
+		if validator == "" {
+			validator = self.Response.Header.Get("Last-Modified")
+		}
+		// 压缩传输的内容无法按字节续传
+		if encoding := self.Response.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+			validator = ""
+		}
+		if validator == "" {
+			os.Remove(meta)
+		} else if err := ioutil.WriteFile(meta, []byte(validator), 0666); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(part, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, self.Response.Body)
+	self.Response.Body.Close()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := ioutil.ReadFile(part)
+	if err != nil {
+		return nil, err
+	}
+	DiscardPartial(self.GetUrl())
+	return bytes, nil
+}
+
+// 解析形如"bytes 100-199/1000"的Content-Range，返回起始位置，无法解析时返回-1
+func contentRangeStart(contentRange string) int64 {
+	s := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(contentRange), "bytes"))
+	if i := strings.Index(s, "-"); i > 0 {
+		if n, err := strconv.ParseInt(s[:i], 10, 64); err == nil {
+			return n
+		}
+	}
+	return -1
+}
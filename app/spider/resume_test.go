@@ -0,0 +1,64 @@
+package spider
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 读完后返回io.ErrUnexpectedEOF，模拟下载中断
+type brokenReader struct{ io.Reader }
+
+func (self brokenReader) Read(p []byte) (int, error) {
+	n, err := self.Reader.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestResumeFile(t *testing.T) {
+	// 未完成的文件保存在相对路径config.CACHE_DIR下
+	dir, _ := ioutil.TempDir("", "resume")
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	sp := testSpider()
+	sp.ResumeFile = true
+
+	// 首次下载在读取5字节后中断
+	ctx := testContext(t, sp, "list", testPage{url: "http://example.com/a.zip", header: http.Header{"Etag": {`"v1"`}}})
+	ctx.Response.Body = ioutil.NopCloser(brokenReader{strings.NewReader("01234")})
+	func() {
+		defer func() { recover() }()
+		ctx.FileOutput()
+	}()
+	req := ctx.GetRequest()
+	PrepareResume(sp, req)
+	if req.GetHeader().Get("Range") != "bytes=5-" || req.GetHeader().Get("If-Range") != `"v1"` {
+		t.Fatalf("resume header: %v", req.GetHeader())
+	}
+	PutContext(ctx)
+
+	// 续传剩余部分
+	ctx = testContext(t, sp, "list", testPage{
+		url:    "http://example.com/a.zip",
+		code:   http.StatusPartialContent,
+		header: http.Header{"Content-Range": {"bytes 5-9/10"}},
+		body:   "56789",
+	})
+	ctx.FileOutput()
+	if files := ctx.PullFiles(); len(files) != 1 || string(files[0]["Bytes"].([]byte)) != "0123456789" {
+		t.Fatalf("files: %v", files)
+	}
+	PrepareResume(sp, ctx.GetRequest())
+	if ctx.GetRequest().GetHeader().Get("Range") != "" {
+		t.Fatal("partial file not removed")
+	}
+	PutContext(ctx)
+}
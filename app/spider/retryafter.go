@@ -0,0 +1,83 @@
+package spider
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 返回429或503响应的Retry-After头（秒数或HTTP日期）所指示的等待时长，
+// 其他响应、无此头或无法解析时返回false
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// 暂停该地址所属主机的请求至until，见Spider.RetryAfterHost
+func (self *Spider) HoldHost(rawurl string, until time.Time) {
+	host := hostOf(rawurl)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.holds == nil {
+		self.holds = make(map[string]time.Time)
+	}
+	if self.holds[host].Before(until) {
+		self.holds[host] = until
+	}
+}
+
+// 等待该地址所属主机的暂停结束，任务终止时立即返回false
+func (self *Spider) WaitHost(rawurl string) bool {
+	self.lock.RLock()
+	until, ok := self.holds[hostOf(rawurl)]
+	self.lock.RUnlock()
+	if !ok {
+		return true
+	}
+	return self.Sleep(time.Until(until))
+}
+
+// 暂停当前协程d时长，任务终止时立即返回false
+func (self *Spider) Sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !self.IsStopping()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-self.stopping():
+		return false
+	}
+}
+
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,25 @@
+package spider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	resp := func(code int, v string) *http.Response {
+		return &http.Response{StatusCode: code, Header: http.Header{"Retry-After": {v}}}
+	}
+	if d, ok := RetryAfter(resp(429, "120")); !ok || d != 2*time.Minute {
+		t.Fatalf("seconds: %v %v", d, ok)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d, ok := RetryAfter(resp(503, date)); !ok || d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("http-date: %v %v", d, ok)
+	}
+	for _, r := range []*http.Response{nil, resp(200, "5"), resp(429, ""), resp(429, "soon")} {
+		if _, ok := RetryAfter(r); ok {
+			t.Fatalf("unexpected Retry-After: %#v", r)
+		}
+	}
+}
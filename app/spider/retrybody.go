@@ -0,0 +1,38 @@
+package spider
+
+import (
+	"regexp"
+)
+
+// 设置响应内容的重试条件：下载成功后match返回true时视为软失败（如HTTP 200的封禁、维护页面或空结果），
+// 在Request.TryTimes限定的次数内重新下载，次数用尽时视为下载失败；match为nil时取消。
+// match须可并发调用，不得修改传入的内容。
+func (self *Spider) SetRetryOnBody(match func(body []byte) bool) {
+	self.lock.Lock()
+	self.retryBody = match
+	self.lock.Unlock()
+}
+
+// 获取响应内容的重试条件
+func (self *Spider) GetRetryOnBody() func(body []byte) bool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.retryBody
+}
+
+// 返回响应内容匹配任一正则表达式时为true的重试条件，用于SetRetryOnBody()，
+// 表达式无效时panic
+func BodyMatches(patterns ...string) func(body []byte) bool {
+	regs := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		regs[i] = regexp.MustCompile(p)
+	}
+	return func(body []byte) bool {
+		for _, reg := range regs {
+			if reg.Match(body) {
+				return true
+			}
+		}
+		return false
+	}
+}
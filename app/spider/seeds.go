@@ -0,0 +1,117 @@
+package spider
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 从文件读取的种子URL，见LoadSeeds()
+type Seed struct {
+	Url      string
+	Rule     string
+	Priority int
+}
+
+// 读取种子URL文件，path为"-"时读取标准输入。
+// 每行一个URL，或CSV格式的"URL,规则名,优先级"（后两项可省略），空行及#开头的行被忽略；
+// 未指定规则名时采用rule（可为ROOT_RULE，交由RuleTree.Root处理），无法解析的行记录日志后跳过。
+func LoadSeeds(path, rule string) ([]*Seed, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return ReadSeeds(r, rule)
+}
+
+// 从r读取种子URL，格式见LoadSeeds()
+func ReadSeeds(r io.Reader, rule string) ([]*Seed, error) {
+	var seeds []*Seed
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seed, err := parseSeed(line, rule)
+		if err != nil {
+			logs.Log.Warning(" *     [种子URL] 第 %v 行无效，已跳过: %v\n", n, err)
+			continue
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, scanner.Err()
+}
+
+func parseSeed(line, rule string) (*Seed, error) {
+	fields := []string{line}
+	if strings.Contains(line, ",") {
+		var err error
+		if fields, err = csv.NewReader(strings.NewReader(line)).Read(); err != nil {
+			return nil, err
+		}
+	}
+	seed := &Seed{Url: strings.TrimSpace(fields[0]), Rule: rule}
+	u, err := url.Parse(seed.Url)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("无效的URL %q", seed.Url)
+	}
+	if len(fields) > 1 {
+		if r := strings.TrimSpace(fields[1]); r != "" {
+			seed.Rule = r
+		}
+	}
+	if len(fields) > 2 {
+		if p := strings.TrimSpace(fields[2]); p != "" {
+			if seed.Priority, err = strconv.Atoi(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if seed.Rule == "" {
+		return nil, fmt.Errorf("URL %q 未指定规则名", seed.Url)
+	}
+	return seed, nil
+}
+
+// 设置任务启动时（Root执行完毕后）添加至队列的种子URL
+func (self *Spider) SetSeeds(seeds []*Seed) {
+	self.seeds = seeds
+}
+
+// 将种子URL添加至队列，跳过该蜘蛛中不存在的规则
+func (self *Spider) pushSeeds(ctx *Context) {
+	var n int
+	for _, seed := range self.seeds {
+		if _, ok := self.RuleTree.Trunk[seed.Rule]; !ok && seed.Rule != ROOT_RULE {
+			logs.Log.Warning(" *     [种子URL][%s] 规则 %q 不存在，已跳过: %s\n", self.GetName(), seed.Rule, seed.Url)
+			continue
+		}
+		ctx.AddQueue(&request.Request{
+			Url:      seed.Url,
+			Rule:     seed.Rule,
+			Priority: seed.Priority,
+		})
+		n++
+	}
+	if n > 0 {
+		logs.Log.Informational(" *     [%s] 已添加种子URL %v 条\n", self.GetName(), n)
+	}
+}
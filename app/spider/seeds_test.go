@@ -0,0 +1,37 @@
+package spider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSeeds(t *testing.T) {
+	for _, c := range []struct {
+		input, defaultRule string
+		want               []*Seed
+	}{
+		{`
+# comment
+http://a.com/1
+"http://a.com/2?x=1,2",detail,3
+ftp://a.com/3
+http://a.com/4,list,x
+  https://b.com/5 ,
+`, "list", []*Seed{
+			{Url: "http://a.com/1", Rule: "list"},
+			{Url: "http://a.com/2?x=1,2", Rule: "detail", Priority: 3},
+			{Url: "https://b.com/5", Rule: "list"},
+		}},
+		// 未指定规则时忽略
+		{"http://a.com/1\n", "", nil},
+	} {
+		seeds, err := ReadSeeds(strings.NewReader(c.input), c.defaultRule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(seeds, c.want) {
+			t.Errorf("%q: seeds %+v", c.input, seeds)
+		}
+	}
+}
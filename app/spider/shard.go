@@ -0,0 +1,84 @@
+package spider
+
+import (
+	"hash/fnv"
+	"net/url"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+)
+
+// 将不属于本节点分片的请求转交其所属分片的节点，由客户端模式注册；未注册时（如单机模式）丢弃此类请求
+var ShardRoute func(*Spider, *request.Request)
+
+// 返回请求是否属于本节点的分片，仅对开启Rule.Sharded的规则生效
+func (self *Spider) ownShard(req *request.Request) bool {
+	if config.SHARD_COUNT <= 1 {
+		return true
+	}
+	rule, ok := self.GetRule(req.GetRuleName())
+	if !ok || !rule.Sharded {
+		return true
+	}
+	return ShardOf(req.GetUrl(), config.SHARD_COUNT) == config.SHARD_INDEX
+}
+
+// 记录请求已转交，返回是否为首次转交；允许重复下载的请求每次均转交
+func (self *Spider) markRouted(req *request.Request) bool {
+	if req.IsReloadable() {
+		return true
+	}
+	unique := req.Unique()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.routed[unique] {
+		return false
+	}
+	if self.routed == nil {
+		self.routed = make(map[string]bool)
+	}
+	self.routed[unique] = true
+	return true
+}
+
+// 接收由其他节点转交的、属于本节点分片的请求，蜘蛛未在运行时返回false
+func (self *Spider) AcceptRouted(req *request.Request) bool {
+	self.lock.RLock()
+	running := self.status == status.RUN
+	self.lock.RUnlock()
+	if !running {
+		return false
+	}
+	// 请求组属于转出请求的节点
+	req.SetGroup("")
+	self.RequestPush(req)
+	return true
+}
+
+// 返回url所属的分片序号(0~n-1)，对url规范化后取哈希，
+// 使仅大小写、默认端口或锚点不同的url归属于同一分片
+func ShardOf(rawurl string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(normalizeShardURL(rawurl)))
+	return int(h.Sum32() % uint32(n))
+}
+
+func normalizeShardURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
@@ -0,0 +1,65 @@
+package spider
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+// 不属于本节点分片的请求交由ShardRoute转交，属于本分片的请求入队
+func TestShardRouting(t *testing.T) {
+	count, index, route := config.SHARD_COUNT, config.SHARD_INDEX, ShardRoute
+	defer func() { config.SHARD_COUNT, config.SHARD_INDEX, ShardRoute = count, index, route }()
+	config.SHARD_COUNT, config.SHARD_INDEX = 3, 1
+
+	var routed, pushed []string
+	ShardRoute = func(sp *Spider, req *request.Request) { routed = append(routed, req.GetUrl()) }
+	sp := &Spider{Name: "test", RuleTree: &RuleTree{Trunk: map[string]*Rule{
+		"detail": {Sharded: true},
+		"list":   {},
+	}}}
+	sp.SetRequestSink(func(req *request.Request) { pushed = append(pushed, req.GetUrl()) })
+
+	var own, other int
+	for i := 0; i < 30; i++ {
+		url := "http://example.com/item/" + strconv.Itoa(i)
+		sp.RequestPush(&request.Request{Url: url, Rule: "detail"})
+		if ShardOf(url, 3) == 1 {
+			own++
+		} else {
+			other++
+		}
+	}
+	sp.RequestPush(&request.Request{Url: "http://example.com/list", Rule: "list"})
+	if len(pushed) != own+1 || len(routed) != other {
+		t.Fatalf("pushed %v, routed %v (own %v, other %v)", len(pushed), len(routed), own, other)
+	}
+	for _, url := range routed {
+		if ShardOf(url, 3) == 1 {
+			t.Errorf("own request routed: %s", url)
+		}
+	}
+
+	// 同一请求只转交一次，允许重复下载的请求每次均转交
+	sp.RequestPush(&request.Request{Url: routed[0], Rule: "detail"})
+	if len(routed) != other {
+		t.Errorf("duplicate request routed again: %v", routed[other:])
+	}
+	for i := 0; i < 2; i++ {
+		sp.RequestPush(&request.Request{Url: routed[0], Rule: "detail", Reloadable: true})
+	}
+	if len(routed) != other+2 {
+		t.Errorf("reloadable request routed %v times", len(routed)-other)
+	}
+
+	// 转交来的请求进入运行中蜘蛛的队列，并脱离原节点的请求组
+	req := &request.Request{Url: pushed[0], Rule: "detail", Group: "g"}
+	if !sp.AcceptRouted(req) || len(pushed) != own+2 || req.GetGroup() != "" {
+		t.Errorf("AcceptRouted: pushed %v, group %q", len(pushed), req.GetGroup())
+	}
+	if (&Spider{Name: "idle"}).AcceptRouted(req) {
+		t.Error("idle spider accepted a routed request")
+	}
+}
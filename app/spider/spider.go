@@ -2,13 +2,18 @@ package spider
 
 import (
 	"math"
+	"net"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/henrylee2cn/pholcus/app/downloader/request"
 	"github.com/henrylee2cn/pholcus/app/scheduler"
 	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
 )
 
@@ -18,6 +23,34 @@ const (
 	FORCED_STOP = "——主动终止Spider——"
 )
 
+// 开启Spider.LinkGraph时，链接关系结果所属的规则名
+const LINK_GRAPH = "LinkGraph"
+
+// Context.EnqueueSeed添加的请求所属的保留规则名，不应用作Trunk中的规则名
+const ROOT_RULE = "__root__"
+
+// 配置项output::taskid为true时，添加至每条文本结果的任务ID字段名
+const TASK_ID_FIELD = "TaskID"
+
+// Rule.Schema中可用的字段类型
+const (
+	TYPE_INT    = "int"    // 转换为int64
+	TYPE_FLOAT  = "float"  // 转换为float64
+	TYPE_BOOL   = "bool"   // 转换为bool
+	TYPE_STRING = "string" // 转换为string
+	TYPE_TIME   = "time"   // 转换为time.Time
+)
+
+// Spider.ThinPolicy的取值
+const (
+	THIN_PARSE = ""      // 照常解析，由规则通过Context.IsThin()自行判断
+	THIN_RETRY = "retry" // 视为下载失败，稍后重试
+	THIN_DROP  = "drop"  // 丢弃，不解析也不记录成功
+)
+
+// Spider.BannedStatus为空时视为被封禁的响应状态码
+var DefaultBannedStatus = []int{403, 429, 503}
+
 type (
 	// 蜘蛛规则
 	Spider struct {
@@ -32,13 +65,51 @@ type (
 		Namespace       func(self *Spider) string                                  // 命名空间，用于输出文件、路径的命名
 		SubNamespace    func(self *Spider, dataCell map[string]interface{}) string // 次级命名，用于输出文件、路径的命名，可依赖具体数据内容
 		RuleTree        *RuleTree                                                  // 定义具体的采集规则树
+		BloomCount      uint64                                                     // 预估请求总数，大于0时以布隆过滤器代替精确集合去重（可能偶尔漏采新链接），默认为0
+		BloomFP         float64                                                    // 布隆过滤器的目标误判率，默认为0.001
+		AcceptLanguage  string                                                     // 所有请求默认的Accept-Language请求头，请求中已指定时不覆盖
+		LinkGraph       bool                                                       // 是否将页面间的链接关系（From→To）作为规则LINK_GRAPH的结果输出
+		OutputEncoding  string                                                     // CSV输出的字符编码，如GBK、Shift_JIS，为空时采用配置项output::encoding
+		MinBodySize     int                                                        // 响应内容（解压后）小于该字节数时视为内容过少的可疑页面，见Context.IsThin()，0为不检查
+		ThinPolicy      string                                                     // 可疑页面的处理方式：THIN_PARSE、THIN_RETRY或THIN_DROP
+		BannedStatus    []int                                                      // 视为被封禁的响应状态码，供Context.IsBanned()判断，为空时采用DefaultBannedStatus
+		ItemFileName    string                                                     // item输出方式下每条结果的文件名模板(text/template)，如"{{.RuleName}}/{{.Data.标题}}.html"，"/"表示子目录
+		ItemTemplate    string                                                     // item输出方式下每条结果的内容模板(text/template)，为空时输出JSON
+		VolatileContent []string                                                   // 计算Context.ContentHash()前从页面中剔除的易变内容（正则表达式），如时间戳、CSRF令牌
+		MirrorAssets    string                                                     // 为ASSET_SAME_HOST或ASSET_SAME_DOMAIN时启用内置规则ASSET_RULE，供Context.AddAssets()下载页面引用的同源静态资源
+		AssetTypes      []string                                                   // Context.AddAssets()允许下载的资源扩展名，如".css"，为空时采用DefaultAssetTypes
+		ResumeFile      bool                                                       // FileOutput()读取中断时是否保留已下载部分，并在请求重试时以Range请求续传（服务器不支持时重新下载）
+		RetryAfterHost  bool                                                       // 按429/503响应的Retry-After等待时，是否同时暂停同一主机的其他请求
+		Login           *Login                                                     // 表单登录配置，设置后会话失效（响应为未登录页面）时自动重新登录并重试请求
+		DebugDetector   func(*Context) bool                                        // 配置项debug::mode为failing时，判定已输出结果的响应是否仍为异常（如缺少预期内容）而需转储，见Context.TeeDebug()
+		Transport       *http.Transport                                            // Surf下载器使用的自定义传输层（如自定义Dial、TLS配置），为nil时使用默认传输层；请求指定的代理仍然生效
+		TextNorm        TextNorm                                                   // Context.Text()、Texts()默认的文本规范化方式，如NORM_ALL，为0时仅去除首尾空白
+		VisitedStore    func(self *Spider) scheduler.VisitedStore                  // 创建本次任务的请求去重存储（如接入Redis实现分布式去重），为nil或返回nil时采用内存集合或布隆过滤器（见BloomCount）
+		HeaderOrder     []string                                                   // Surf下载器发送请求头的顺序及字段名的大小写（如"sec-ch-ua"），未列出的字段排在其后，见BrowserHeaderOrder()
+		ShuffleHeaders  bool                                                       // 是否每个请求随机排列HeaderOrder未列出的请求头（HeaderOrder为空时为全部），与HeaderOrder均会禁止复用连接
+		StickyHosts     []string                                                   // 按连接绑定会话（粘性会话）的主机，如"example.com"或"example.com:8080"，其请求均禁止复用连接，见Request.SetNoKeepAlive()
 
 		// 以下字段系统自动赋值
-		id        int               // 自动分配的SpiderQueue中的索引
-		subName   string            // 由Keyin转换为的二级标识名
-		reqMatrix *scheduler.Matrix // 请求矩阵
-		timer     *Timer            // 定时器
-		status    int               // 执行状态
+		id        int                    // 自动分配的SpiderQueue中的索引
+		subName   string                 // 由Keyin转换为的二级标识名
+		reqMatrix *scheduler.Matrix      // 请求矩阵
+		reqSink   func(*request.Request) // 请求接收器，不为nil时代替请求矩阵接收新请求
+		throttle  *throttle              // 自适应限速器
+		modle     *SpiderModle           // 动态规则的解释器模型，编译型蜘蛛为nil
+		authority map[string]string      // [主机或URL前缀]Authorization请求头
+		dedupFn   FingerprintFunc        // 自定义去重指纹函数
+		timer     *Timer                 // 定时器
+		status    int                    // 执行状态
+		stopCh    chan bool              // 主动终止时关闭，用于唤醒Context.Sleep()
+		preview   int                    // 预览数量，成功解析该数量的页面后结束，见SetPreview()
+		previewed int64                  // 预览模式下已成功解析的页面数
+		holds     map[string]time.Time   // [主机]暂停请求至该时刻，见HoldHost()
+		groups    *groupSet              // 请求组，见Context.NewGroup()
+		headers   http.Header            // 所有请求默认附加的请求头，见SetDefaultHeaders()
+		seeds     []*Seed                // 任务启动时添加的种子URL，见SetSeeds()
+		retryBody func([]byte) bool      // 响应内容的重试条件，见SetRetryOnBody()
+		taskID    string                 // 所属任务的ID，见GetTaskID()
+		routed    map[string]bool        // 已转交其他节点的请求，避免重复转交，见ShardRoute
 		lock      sync.RWMutex
 		once      sync.Once
 	}
@@ -52,9 +123,51 @@ type (
 		ItemFields []string                                           // 结果字段列表(选填，写上可保证字段顺序)
 		ParseFunc  func(*Context)                                     // 内容解析函数
 		AidFunc    func(*Context, map[string]interface{}) interface{} // 通用辅助函数
+
+		// 字段类型(选填)，[字段名]TYPE_INT等，输出前按此转换结果的值，数据库输出据此建立相应类型的字段
+		Schema map[string]string
+		// 是否按Context.SetSequence()设置的序号排列输出结果；
+		// 并发下无法保证全局有序，仅在每批输出（见dockercap）内排序，默认不排序以保证吞吐量
+		Ordered bool
+		// 输出字段及其顺序(选填)，表格及数据库类输出仅输出其中的字段，为空时输出全部ItemFields；
+		// 默认字段Url/ParentUrl/DownloadTime不受影响，仍由NotDefaultField控制并排在最后
+		OutputFields []string
+		// 是否按URL分片：配置项shard::count大于1时，该规则的请求只由哈希到本节点分片(shard::index)的节点采集，
+		// 各节点仅对本分片去重；其他分片的请求在客户端模式下经主节点转交所属节点，单机模式下丢弃。
+		// 通常用于详情页，列表页仍由各节点采集以发现链接
+		Sharded bool
+		// 期望的响应媒体类型前缀(选填)，如"application/json"，多个以逗号分隔，为空时不检查；
+		// 不符时（见Context.IsContentTypeMismatch()）不执行ParseFunc，视为下载失败，或改由ContentTypeFallback处理
+		ContentType string
+		// 响应媒体类型与ContentType不符时改由该规则处理(选填)，该规则自身的ContentType不再检查
+		ContentTypeFallback string
+		// 派发权重(选填)，默认为1：同一优先级内有多个规则的请求排队时按权重比例轮流派发，
+		// 如详情页为3、列表页为默认值时约3:1，各规则内部仍先进先出；所有规则均未设置时整体先进先出。
+		// 优先级(Request.Priority)仍严格优先，权重只在当前最高优先级的请求间起作用；
+		// 因主机熔断(见breaker::threshold)暂存的请求不会派发，其规则的份额在此期间由其他规则分享；
+		// 启用后每次出队需在同一优先级队列中查找并移除被选中规则的请求，开销与内存队列长度成正比
+		Weight int
+		// 标识同一结果的字段(选填)：启用seen::enable时按这些字段的值识别结果，
+		// 已在此前的任务（或本次任务）中输出过的结果不再输出，为空时不去重
+		ItemKey []string
+		// 响应内容的清理函数(选填)：读取内容（转码后）时执行，GetText()、GetDom()等得到清理后的内容，
+		// 如内置的StripJSONP、StripXSSI，多个可用ChainTransform组合
+		BodyTransform func([]byte) []byte
+		// 是否自动翻页(选填)：ParseFunc执行后，若响应头Link字段含rel="next"（见Context.GetLinkHeaders()），
+		// 则以当前请求为模板（沿用会话、请求头及Temp）将其添加至队列并由该规则解析，直至响应中不再有next链接；
+		// next指向当前页面时忽略，其余循环依靠请求去重避免
+		FollowNext bool
 	}
 )
 
+// 返回需输出的结果字段及其顺序
+func (self *Rule) GetOutputFields() []string {
+	if len(self.OutputFields) > 0 {
+		return self.OutputFields
+	}
+	return self.ItemFields
+}
+
 // 添加自身到蜘蛛菜单
 func (self Spider) Register() *Spider {
 	self.status = status.STOPPED
@@ -104,6 +217,11 @@ func (self *Spider) GetName() string {
 }
 
 // 获取蜘蛛二级标识名
+// 返回所属任务的ID，任务开始时生成，同一任务中的各蜘蛛相同
+func (self *Spider) GetTaskID() string {
+	return self.taskID
+}
+
 func (self *Spider) GetSubName() string {
 	self.once.Do(func() {
 		self.subName = self.GetKeyin()
@@ -169,11 +287,78 @@ func (self *Spider) SetLimit(max int64) {
 	self.Limit = max
 }
 
+// 设置预览数量：成功解析n个页面后即停止派发请求并结束任务，用于快速抽样查看结果，
+// 与限制结果数或请求数的Limit不同，n<=0时不限
+func (self *Spider) SetPreview(n int) {
+	self.preview = n
+}
+
+// 获取预览数量
+func (self *Spider) GetPreview() int {
+	return self.preview
+}
+
+// 预览模式下记录一个成功解析的页面，返回其结果是否应输出；
+// 达到预览数量时结束任务，此后完成解析的并发请求的结果将被丢弃
+func (self *Spider) CountPreview() bool {
+	if self.preview <= 0 {
+		return true
+	}
+	n := atomic.AddInt64(&self.previewed, 1)
+	if n == int64(self.preview) {
+		logs.Log.Informational(" *     [%s] 预览模式：已成功解析 %d 个页面，结束任务\n", self.GetName(), n)
+		self.reqMatrix.Finish(cache.REASON_PREVIEW)
+	}
+	return n <= int64(self.preview)
+}
+
 // 控制所有请求是否使用cookie
 func (self *Spider) GetEnableCookie() bool {
 	return self.EnableCookie
 }
 
+// 设置所有请求默认的Accept-Language请求头
+func (self *Spider) SetAcceptLanguage(lang string) {
+	self.AcceptLanguage = lang
+}
+
+// 获取所有请求默认的Accept-Language请求头
+func (self *Spider) GetAcceptLanguage() string {
+	return self.AcceptLanguage
+}
+
+// 自定义去重指纹函数，返回空字符串时该请求不去重
+type FingerprintFunc func(*request.Request) string
+
+// 设置自定义去重指纹函数，代替默认的依据（规则、URL、方法、JSON请求体及会话）计算请求的去重键，
+// 返回空字符串时该请求不去重。
+func (self *Spider) SetFingerprintFunc(fn FingerprintFunc) {
+	self.dedupFn = fn
+}
+
+// 返回Surf下载器使用的自定义传输层
+func (self *Spider) GetTransport() *http.Transport {
+	return self.Transport
+}
+
+// 该地址所属主机是否禁止复用连接（按连接绑定会话），见StickyHosts
+func (self *Spider) IsStickyHost(rawurl string) bool {
+	if len(self.StickyHosts) == 0 {
+		return false
+	}
+	host := hostOf(rawurl)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, h := range self.StickyHosts {
+		if h = strings.ToLower(h); h == host || h == hostname {
+			return true
+		}
+	}
+	return false
+}
+
 // 自定义暂停时间 pause[0]~(pause[0]+pause[1])，优先级高于外部传参
 // 当且仅当runtime[0]为true时可覆盖现有值
 func (self *Spider) SetPausetime(pause int64, runtime ...bool) {
@@ -219,6 +404,22 @@ func (self *Spider) Copy() *Spider {
 
 		ghost.RuleTree.Trunk[k].ParseFunc = v.ParseFunc
 		ghost.RuleTree.Trunk[k].AidFunc = v.AidFunc
+		ghost.RuleTree.Trunk[k].Schema = v.Schema
+		ghost.RuleTree.Trunk[k].Ordered = v.Ordered
+		ghost.RuleTree.Trunk[k].OutputFields = append([]string(nil), v.OutputFields...)
+		ghost.RuleTree.Trunk[k].Sharded = v.Sharded
+		ghost.RuleTree.Trunk[k].ContentType = v.ContentType
+		ghost.RuleTree.Trunk[k].ContentTypeFallback = v.ContentTypeFallback
+		ghost.RuleTree.Trunk[k].Weight = v.Weight
+		ghost.RuleTree.Trunk[k].ItemKey = append([]string(nil), v.ItemKey...)
+		ghost.RuleTree.Trunk[k].BodyTransform = v.BodyTransform
+		ghost.RuleTree.Trunk[k].FollowNext = v.FollowNext
+	}
+	if self.LinkGraph {
+		ghost.RuleTree.Trunk[LINK_GRAPH] = &Rule{ItemFields: []string{"From", "To"}}
+	}
+	if self.MirrorAssets != "" {
+		ghost.RuleTree.Trunk[ASSET_RULE] = assetRule
 	}
 
 	ghost.Description = self.Description
@@ -230,6 +431,40 @@ func (self *Spider) Copy() *Spider {
 	ghost.NotDefaultField = self.NotDefaultField
 	ghost.Namespace = self.Namespace
 	ghost.SubNamespace = self.SubNamespace
+	ghost.BloomCount = self.BloomCount
+	ghost.BloomFP = self.BloomFP
+	ghost.AcceptLanguage = self.AcceptLanguage
+	ghost.LinkGraph = self.LinkGraph
+	ghost.OutputEncoding = self.OutputEncoding
+	ghost.BannedStatus = append([]int(nil), self.BannedStatus...)
+	ghost.MinBodySize = self.MinBodySize
+	ghost.ThinPolicy = self.ThinPolicy
+	ghost.ItemFileName = self.ItemFileName
+	ghost.ItemTemplate = self.ItemTemplate
+	ghost.Transport = self.Transport
+	ghost.VisitedStore = self.VisitedStore
+	ghost.HeaderOrder = append([]string(nil), self.HeaderOrder...)
+	ghost.ShuffleHeaders = self.ShuffleHeaders
+	ghost.StickyHosts = append([]string(nil), self.StickyHosts...)
+	ghost.ResumeFile = self.ResumeFile
+	ghost.MirrorAssets = self.MirrorAssets
+	ghost.AssetTypes = append([]string(nil), self.AssetTypes...)
+	ghost.VolatileContent = append([]string(nil), self.VolatileContent...)
+	ghost.authority = self.copyAuthority()
+	ghost.headers = self.GetDefaultHeaders()
+	ghost.seeds = self.seeds
+	ghost.retryBody = self.GetRetryOnBody()
+	ghost.dedupFn = self.dedupFn
+	ghost.preview = self.preview
+	ghost.Login = self.Login.copy()
+	ghost.RetryAfterHost = self.RetryAfterHost
+	ghost.DebugDetector = self.DebugDetector
+	ghost.TextNorm = self.TextNorm
+	ghost.modle = self.modle
+
+	if self.throttle != nil {
+		ghost.throttle = newThrottle(self.throttle.AutoThrottle)
+	}
 
 	ghost.timer = self.timer
 	ghost.status = self.status
@@ -238,11 +473,24 @@ func (self *Spider) Copy() *Spider {
 }
 
 func (self *Spider) ReqmatrixInit() *Spider {
+	self.taskID = cache.TaskID
 	if self.Limit < 0 {
-		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), self.Limit)
+		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), self.Limit, self.BloomCount, self.BloomFP)
 		self.SetLimit(0)
 	} else {
-		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), math.MinInt64)
+		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), math.MinInt64, self.BloomCount, self.BloomFP)
+	}
+	if self.VisitedStore != nil {
+		self.reqMatrix.SetVisitedStore(self.VisitedStore(self))
+	}
+	weights := make(map[string]int)
+	for name, rule := range self.RuleTree.Trunk {
+		if rule.Weight > 1 {
+			weights[name] = rule.Weight
+		}
+	}
+	if len(weights) > 0 {
+		self.reqMatrix.SetRuleWeights(weights)
 	}
 	return self
 }
@@ -253,13 +501,53 @@ func (self *Spider) DoHistory(req *request.Request, ok bool) bool {
 }
 
 func (self *Spider) RequestPush(req *request.Request) {
+	if self.dedupFn != nil && req.Fingerprint == "" {
+		if fp := self.dedupFn(req); fp == "" {
+			req.SetReloadable(true)
+		} else {
+			req.SetFingerprint(fp)
+		}
+	}
+	// 不属于本节点分片的请求转交其他节点采集，同一请求只转交一次
+	if !self.ownShard(req) {
+		if ShardRoute != nil && self.markRouted(req) {
+			ShardRoute(self, req)
+		}
+		return
+	}
+	if self.reqSink != nil {
+		self.addGroup(req.GetGroup())
+		self.reqSink(req)
+		return
+	}
 	self.reqMatrix.Push(req)
 }
 
+// 设置请求接收器，设置后新请求不再进入调度队列，且蜘蛛脱离调度直接标记为运行状态，
+// 主要用于规则的单元测试
+func (self *Spider) SetRequestSink(sink func(*request.Request)) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.reqSink = sink
+	self.status = status.RUN
+}
+
 func (self *Spider) RequestPull() *request.Request {
 	return self.reqMatrix.Pull()
 }
 
+// 反馈请求所属主机是否可用，用于主机熔断，见配置项breaker::threshold
+func (self *Spider) HostFeedback(req *request.Request, ok bool) {
+	if self.reqMatrix != nil {
+		self.reqMatrix.HostFeedback(req, ok)
+	}
+}
+
+// 取出因在队列中等待过久而丢弃的、属于请求组的请求
+func (self *Spider) RequestExpired() []*request.Request {
+	return self.reqMatrix.TakeExpired()
+}
+
 func (self *Spider) RequestUse() {
 	self.reqMatrix.Use()
 }
@@ -272,6 +560,11 @@ func (self *Spider) RequestLen() int {
 	return self.reqMatrix.Len()
 }
 
+// 返回布隆过滤器的填充率，未启用时返回-1
+func (self *Spider) BloomFillRatio() float64 {
+	return self.reqMatrix.BloomFillRatio()
+}
+
 func (self *Spider) TryFlushSuccess() {
 	self.reqMatrix.TryFlushSuccess()
 }
@@ -280,6 +573,41 @@ func (self *Spider) TryFlushFailure() {
 	self.reqMatrix.TryFlushFailure()
 }
 
+// 开启自适应限速，根据最近请求的失败率自动调整并发量与请求间隔
+func (self *Spider) SetAutoThrottle(opts AutoThrottle) {
+	self.throttle = newThrottle(opts)
+}
+
+// 占用一个并发名额，自适应限速已达当前并发量时返回false
+func (self *Spider) ThrottleAcquire() bool {
+	if self.throttle == nil {
+		return true
+	}
+	return self.throttle.acquire()
+}
+
+// 释放并发名额
+func (self *Spider) ThrottleRelease() {
+	if self.throttle != nil {
+		self.throttle.release()
+	}
+}
+
+// 反馈请求结果，用于计算失败率
+func (self *Spider) ThrottleFeedback(ok bool) {
+	if self.throttle != nil {
+		self.throttle.feedback(self.GetName(), ok)
+	}
+}
+
+// 返回自适应限速附加的请求间隔
+func (self *Spider) ThrottlePause() time.Duration {
+	if self.throttle == nil {
+		return 0
+	}
+	return self.throttle.getPause()
+}
+
 // 开始执行蜘蛛
 func (self *Spider) Start() {
 	defer func() {
@@ -290,7 +618,9 @@ func (self *Spider) Start() {
 		self.status = status.RUN
 		self.lock.Unlock()
 	}()
-	self.RuleTree.Root(GetContext(self, nil))
+	ctx := GetContext(self, nil)
+	self.RuleTree.Root(ctx)
+	self.pushSeeds(ctx)
 }
 
 // 主动崩溃爬虫运行协程
@@ -301,6 +631,9 @@ func (self *Spider) Stop() {
 		return
 	}
 	self.status = status.STOP
+	if self.stopCh != nil {
+		close(self.stopCh)
+	}
 	// 取消所有定时器
 	if self.timer != nil {
 		self.timer.drop()
@@ -308,12 +641,36 @@ func (self *Spider) Stop() {
 	}
 }
 
+// 返回主动终止时关闭的通道
+func (self *Spider) stopping() <-chan bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.stopCh == nil {
+		self.stopCh = make(chan bool)
+		if self.status == status.STOP {
+			close(self.stopCh)
+		}
+	}
+	return self.stopCh
+}
+
 func (self *Spider) CanStop() bool {
 	self.lock.RLock()
 	defer self.lock.RUnlock()
 	return self.status != status.STOPPED && self.reqMatrix.CanStop()
 }
 
+// 返回结束原因，见cache.REASON_QUEUE_EMPTY等
+func (self *Spider) StopReason() string {
+	if self.reqMatrix == nil {
+		return cache.REASON_STOPPED
+	}
+	if reason := self.reqMatrix.Reason(); reason != "" {
+		return reason
+	}
+	return cache.REASON_STOPPED
+}
+
 func (self *Spider) IsStopping() bool {
 	self.lock.RLock()
 	defer self.lock.RUnlock()
@@ -338,6 +695,10 @@ func (self *Spider) Defer() {
 	self.reqMatrix.Wait()
 	// 更新失败记录
 	self.reqMatrix.TryFlushFailure()
+	// 报告布隆过滤器填充率，便于判断是否需要增大BloomCount
+	if ratio := self.reqMatrix.BloomFillRatio(); ratio >= 0 {
+		logs.Log.Informational(" *     [%s] 布隆过滤器填充率: %.2f%%\n", self.GetName(), ratio*100)
+	}
 }
 
 // 是否输出默认添加的字段 Url/ParentUrl/DownloadTime
@@ -0,0 +1,96 @@
+// 规则单元测试辅助工具，以预置的响应代替真实下载，
+// 并捕获规则中添加的请求，无需联网即可测试ParseFunc。
+package spidertest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/spider"
+)
+
+// 预置的HTTP响应
+type Response struct {
+	Url        string      // 请求地址
+	StatusCode int         // 响应状态码，默认为200
+	Header     http.Header // 响应头
+	Body       string      // 响应内容
+}
+
+type Harness struct {
+	Spider   *spider.Spider     // 被测试的蜘蛛副本
+	requests []*request.Request // 规则中添加的请求
+	lock     sync.Mutex
+}
+
+// 创建测试工具，sp为待测试的蜘蛛规则（不会被修改）
+func New(sp *spider.Spider) *Harness {
+	self := &Harness{Spider: sp.Copy()}
+	self.Spider.SetRequestSink(func(req *request.Request) {
+		self.lock.Lock()
+		self.requests = append(self.requests, req)
+		self.lock.Unlock()
+	})
+	return self
+}
+
+// 执行Root规则
+func (self *Harness) Root() *spider.Context {
+	ctx := spider.GetContext(self.Spider, nil)
+	self.Spider.RuleTree.Root(ctx)
+	return ctx
+}
+
+// 以预置响应构造Context，可用于自行调用Parse
+func (self *Harness) Context(ruleName string, resp *Response) *spider.Context {
+	req := &request.Request{
+		Url:  resp.Url,
+		Rule: ruleName,
+	}
+	req.SetSpiderName(self.Spider.GetName())
+	if err := req.Prepare(); err != nil {
+		panic(err)
+	}
+
+	u, err := url.Parse(req.GetUrl())
+	if err != nil {
+		panic(err)
+	}
+	code := resp.StatusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	header := resp.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return spider.GetContext(self.Spider, req).SetResponse(&http.Response{
+		Status:     http.StatusText(code),
+		StatusCode: code,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(resp.Body)),
+		Request: &http.Request{
+			Method: req.GetMethod(),
+			URL:    u,
+			Header: req.GetHeader(),
+		},
+	})
+}
+
+// 以预置响应执行指定规则的ParseFunc，返回的Context可用于获取PullItems、PullFiles
+func (self *Harness) Parse(ruleName string, resp *Response) *spider.Context {
+	return self.Context(ruleName, resp).Parse(ruleName)
+}
+
+// 取出并清空已捕获的请求
+func (self *Harness) PullRequests() []*request.Request {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	reqs := self.requests
+	self.requests = nil
+	return reqs
+}
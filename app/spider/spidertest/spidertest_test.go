@@ -0,0 +1,55 @@
+package spidertest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/app/downloader/request"
+	"github.com/henrylee2cn/pholcus/app/spider"
+	"github.com/henrylee2cn/pholcus/common/goquery"
+)
+
+var testSpider = &spider.Spider{
+	Name: "spidertest",
+	RuleTree: &spider.RuleTree{
+		Root: func(ctx *spider.Context) {
+			ctx.AddQueue(&request.Request{Url: "http://example.com/list", Rule: "list"})
+		},
+		Trunk: map[string]*spider.Rule{
+			"list": {
+				ItemFields: []string{"title"},
+				ParseFunc: func(ctx *spider.Context) {
+					ctx.GetDom().Find("a").Each(func(i int, s *goquery.Selection) {
+						href, _ := s.Attr("href")
+						ctx.AddQueue(&request.Request{Url: href, Rule: "detail"})
+						ctx.Output(map[int]interface{}{0: s.Text()})
+					})
+				},
+			},
+		},
+	},
+}
+
+func TestHarness(t *testing.T) {
+	h := New(testSpider)
+
+	h.Root()
+	if reqs := h.PullRequests(); len(reqs) != 1 || reqs[0].GetUrl() != "http://example.com/list" {
+		t.Fatalf("root requests: %v", reqs)
+	}
+
+	ctx := h.Parse("list", &Response{
+		Url:    "http://example.com/list",
+		Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:   `<a href="http://example.com/1">one</a><a href="http://example.com/2">two</a>`,
+	})
+	items := ctx.PullItems()
+	if len(items) != 2 || items[1]["Data"].(map[string]interface{})["title"] != "two" {
+		t.Fatalf("items: %v", items)
+	}
+	reqs := h.PullRequests()
+	if len(reqs) != 2 || reqs[0].GetRuleName() != "detail" || reqs[0].GetReferer() != "http://example.com/list" {
+		t.Fatalf("requests: %v", reqs)
+	}
+	spider.PutContext(ctx)
+}
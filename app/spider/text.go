@@ -0,0 +1,83 @@
+package spider
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"github.com/henrylee2cn/pholcus/common/goquery"
+)
+
+// 文本规范化方式，可按位组合，用于Context.Text()、Context.Texts()及NormalizeText()
+type TextNorm int
+
+const (
+	NORM_NONE   TextNorm = 0         // 不做处理
+	NORM_TRIM   TextNorm = 1 << iota // 去除首尾空白（含\u00a0）
+	NORM_ENTITY                      // 解码文本中残留的HTML实体，如双重转义的"&amp;nbsp;"
+	NORM_SPACE                       // 将连续的空白（含换行、制表符及\u00a0）合并为一个空格
+
+	NORM_ALL = NORM_TRIM | NORM_ENTITY | NORM_SPACE
+)
+
+// 按norm规范化文本，依次解码HTML实体、合并空白、去除首尾空白
+func NormalizeText(s string, norm TextNorm) string {
+	if norm&NORM_ENTITY != 0 && strings.IndexByte(s, '&') >= 0 {
+		s = html.UnescapeString(s)
+	}
+	if norm&NORM_SPACE != 0 {
+		s = collapseSpace(s)
+	}
+	if norm&NORM_TRIM != 0 {
+		s = strings.TrimSpace(s)
+	}
+	return s
+}
+
+func collapseSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 未指定规范化方式时采用Spider.TextNorm，其为0时仅去除首尾空白
+func (self *Context) textNorm(norm []TextNorm) TextNorm {
+	if len(norm) > 0 {
+		return norm[0]
+	}
+	if self.spider != nil && self.spider.TextNorm != 0 {
+		return self.spider.TextNorm
+	}
+	return NORM_TRIM
+}
+
+// 返回当前页面中第一个匹配selector的元素的文本，按norm规范化（见TextNorm，未指定时采用Spider.TextNorm），
+// 无响应内容或无匹配时返回空字符串。
+func (self *Context) Text(selector string, norm ...TextNorm) string {
+	return NormalizeText(self.First(selector).Text(), self.textNorm(norm))
+}
+
+// 返回当前页面中所有匹配selector的元素各自的文本，规范化同Text()，规范化后为空的文本被忽略。
+func (self *Context) Texts(selector string, norm ...TextNorm) []string {
+	n := self.textNorm(norm)
+	var texts []string
+	self.Each(selector, func(i int, s *goquery.Selection) {
+		if text := NormalizeText(s.Text(), n); text != "" {
+			texts = append(texts, text)
+		}
+	})
+	return texts
+}
@@ -0,0 +1,35 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	body := "<li> 价格&nbsp;:\n\t 3&amp;nbsp;元 </li><li>  </li><li>b</li>"
+	for _, c := range []struct {
+		spiderNorm TextNorm
+		norm       []TextNorm
+		want       string
+	}{
+		{0, nil, "价格\u00a0:\n\t 3&nbsp;元"},
+		{0, []TextNorm{NORM_ALL}, "价格 : 3 元"},
+		{0, []TextNorm{NORM_NONE}, " 价格\u00a0:\n\t 3&nbsp;元 "},
+		// 未指定时采用Spider.TextNorm
+		{NORM_TRIM | NORM_SPACE, nil, "价格 : 3&nbsp;元"},
+	} {
+		sp := testSpider()
+		sp.TextNorm = c.spiderNorm
+		ctx := testContext(t, sp, "list", testPage{body: body})
+		if s := ctx.Text("li", c.norm...); s != c.want {
+			t.Errorf("spider %v, norm %v: %q", c.spiderNorm, c.norm, s)
+		}
+		PutContext(ctx)
+	}
+
+	ctx := testContext(t, nil, "list", testPage{body: body})
+	if s := ctx.Texts("li"); !reflect.DeepEqual(s, []string{"价格\u00a0:\n\t 3&nbsp;元", "b"}) {
+		t.Fatalf("texts: %q", s)
+	}
+	PutContext(ctx)
+}
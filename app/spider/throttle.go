@@ -0,0 +1,143 @@
+package spider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+)
+
+// 自适应限速配置，根据最近请求的失败率（含被封禁导致的4xx/5xx响应）自动调整并发量与请求间隔：
+// 失败率高于HighErrorRate时并发量减半、额外间隔加倍，低于LowErrorRate时并发量加1、额外间隔减半。
+type AutoThrottle struct {
+	MinConcurrency int           // 并发量下限，默认为1
+	MaxConcurrency int           // 并发量上限，默认为全局并发量
+	HighErrorRate  float64       // 降速阈值，默认为0.2
+	LowErrorRate   float64       // 提速阈值，默认为0.05
+	Window         int           // 统计失败率的最近请求数，默认为50
+	PauseStep      time.Duration // 降速时额外间隔的初始增量，默认为500ms
+	MaxPause       time.Duration // 额外间隔的上限，默认为30s
+}
+
+type throttle struct {
+	AutoThrottle
+	limit   int           // 当前并发量
+	active  int           // 处理中的请求数
+	pause   time.Duration // 当前额外间隔
+	results []bool        // 最近请求的结果环
+	next    int           // 结果环的写入位置
+	samples int           // 上次调整后的新样本数
+	sync.Mutex
+}
+
+func newThrottle(opts AutoThrottle) *throttle {
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = cache.Task.ThreadNum
+	}
+	if opts.MinConcurrency <= 0 {
+		opts.MinConcurrency = 1
+	}
+	if opts.MinConcurrency > opts.MaxConcurrency {
+		opts.MinConcurrency = opts.MaxConcurrency
+	}
+	if opts.HighErrorRate <= 0 {
+		opts.HighErrorRate = 0.2
+	}
+	if opts.LowErrorRate <= 0 || opts.LowErrorRate > opts.HighErrorRate {
+		opts.LowErrorRate = opts.HighErrorRate / 4
+	}
+	if opts.Window <= 0 {
+		opts.Window = 50
+	}
+	if opts.PauseStep <= 0 {
+		opts.PauseStep = 500 * time.Millisecond
+	}
+	if opts.MaxPause <= 0 {
+		opts.MaxPause = 30 * time.Second
+	}
+	return &throttle{
+		AutoThrottle: opts,
+		limit:        opts.MaxConcurrency,
+		results:      make([]bool, 0, opts.Window),
+	}
+}
+
+// 占用一个并发名额，已达当前并发量时返回false
+func (self *throttle) acquire() bool {
+	self.Lock()
+	defer self.Unlock()
+	if self.active >= self.limit {
+		return false
+	}
+	self.active++
+	return true
+}
+
+func (self *throttle) release() {
+	self.Lock()
+	self.active--
+	self.Unlock()
+}
+
+func (self *throttle) getPause() time.Duration {
+	self.Lock()
+	defer self.Unlock()
+	return self.pause
+}
+
+// 记录请求结果，每积累1/4窗口的新样本评估一次失败率
+func (self *throttle) feedback(spiderName string, ok bool) {
+	self.Lock()
+	defer self.Unlock()
+	if len(self.results) < self.Window {
+		self.results = append(self.results, ok)
+	} else {
+		self.results[self.next] = ok
+	}
+	self.next = (self.next + 1) % self.Window
+	self.samples++
+	if len(self.results) < self.Window || self.samples*4 < self.Window {
+		return
+	}
+	self.samples = 0
+
+	var fails int
+	for _, ok := range self.results {
+		if !ok {
+			fails++
+		}
+	}
+	rate := float64(fails) / float64(len(self.results))
+	limit, pause := self.limit, self.pause
+	switch {
+	case rate > self.HighErrorRate:
+		limit /= 2
+		if limit < self.MinConcurrency {
+			limit = self.MinConcurrency
+		}
+		if pause == 0 {
+			pause = self.PauseStep
+		} else {
+			pause *= 2
+		}
+		if pause > self.MaxPause {
+			pause = self.MaxPause
+		}
+		if limit != self.limit || pause != self.pause {
+			logs.Log.Warning(" *     [%s] 失败率 %.1f%%，降速：并发量 %d -> %d，额外间隔 %v -> %v\n", spiderName, rate*100, self.limit, limit, self.pause, pause)
+		}
+	case rate < self.LowErrorRate:
+		if limit < self.MaxConcurrency {
+			limit++
+		}
+		pause /= 2
+		if pause < self.PauseStep/8 {
+			pause = 0
+		}
+		if limit != self.limit || pause != self.pause {
+			logs.Log.Informational(" *     [%s] 失败率 %.1f%%，提速：并发量 %d -> %d，额外间隔 %v -> %v\n", spiderName, rate*100, self.limit, limit, self.pause, pause)
+		}
+	}
+	self.limit, self.pause = limit, pause
+}
@@ -0,0 +1,57 @@
+package spider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoThrottle(t *testing.T) {
+	th := newThrottle(AutoThrottle{MaxConcurrency: 8, MinConcurrency: 2, HighErrorRate: 0.6, LowErrorRate: 0.1, Window: 4, PauseStep: time.Second, MaxPause: 3 * time.Second})
+	feed := func(ok bool, n int) {
+		for i := 0; i < n; i++ {
+			th.feedback("test", ok)
+		}
+	}
+
+	// 样本未满一个窗口时不调整
+	feed(false, 3)
+	if th.limit != 8 || th.getPause() != 0 {
+		t.Fatalf("adjusted before window filled: limit %d, pause %v", th.limit, th.getPause())
+	}
+	steps := []struct {
+		ok    bool
+		limit int
+		pause time.Duration
+	}{
+		{false, 4, time.Second},
+		{false, 2, 2 * time.Second},
+		{false, 2, 3 * time.Second}, // 并发量与间隔均已到限
+		{true, 2, 3 * time.Second},
+		{true, 2, 3 * time.Second}, // 失败率介于两阈值之间时保持
+		{true, 2, 3 * time.Second},
+		{true, 3, 1500 * time.Millisecond},
+		{true, 4, 750 * time.Millisecond},
+		{true, 5, 375 * time.Millisecond},
+		{true, 6, 187500 * time.Microsecond},
+		{true, 7, 0}, // 低于PauseStep/8时取消额外间隔
+	}
+	for i, step := range steps {
+		feed(step.ok, 1)
+		if th.limit != step.limit || th.getPause() != step.pause {
+			t.Fatalf("step %d: limit %d, pause %v, want %d, %v", i, th.limit, th.getPause(), step.limit, step.pause)
+		}
+	}
+
+	for i := 0; i < 7; i++ {
+		if !th.acquire() {
+			t.Fatalf("acquire %d failed", i)
+		}
+	}
+	if th.acquire() {
+		t.Fatal("acquired beyond limit")
+	}
+	th.release()
+	if !th.acquire() {
+		t.Fatal("released slot not reusable")
+	}
+}
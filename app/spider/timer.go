@@ -1,6 +1,9 @@
 package spider
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -64,6 +67,25 @@ func (self *Timer) set(id string, tol time.Duration, bell *Bell) bool {
 	return ok
 }
 
+// 返回已设置的定时器的解释器模型，按id排序
+func (self *Timer) modles() []TimerModle {
+	self.RLock()
+	defer self.RUnlock()
+	ms := make([]TimerModle, 0, len(self.setting))
+	for id, c := range self.setting {
+		m := TimerModle{Id: id}
+		if c.typ == A {
+			m.Tol = strconv.Itoa(int(c.tol))
+			m.Bell = fmt.Sprintf("%02d:%02d:%02d", c.bell.Hour, c.bell.Min, c.bell.Sec)
+		} else {
+			m.Tol = c.tol.String()
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Id < ms[j].Id })
+	return ms
+}
+
 func (self *Timer) drop() {
 	self.Lock()
 	defer self.Unlock()
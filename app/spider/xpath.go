@@ -0,0 +1,124 @@
+package spider
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// XPath查询分为两组：GetXPath()、QueryXPath()返回表达式错误，
+// XPath()、XPathText()、XPathAttr()是其简便形式，出错时记录日志并返回空值。
+
+// 以XPath表达式查询当前页面，与GetDom()共用同一棵解析树，表达式错误时返回错误。
+func (self *Context) GetXPath(expr string) (nodes []*html.Node, err error) {
+	dom := self.tryDom()
+	if dom == nil || len(dom.Nodes) == 0 {
+		return nil, nil
+	}
+	// 部分表达式（如函数参数类型有误）在求值时才会panic
+	defer func() {
+		if p := recover(); p != nil {
+			nodes, err = nil, fmt.Errorf("xpath: %q %v", expr, p)
+		}
+	}()
+	return htmlquery.QueryAll(dom.Nodes[0], expr)
+}
+
+// 以XPath表达式从当前页面提取单个值，与GetDom()共用同一棵解析树：
+// 表达式结果为节点集时返回第一个节点的文本（属性节点为其值），无匹配时返回空字符串；
+// 为字符串、数值或布尔值（如"count(//a)"、"string(//a/@href)"）时返回其字符串形式。
+func (self *Context) QueryXPath(expr string) (string, error) {
+	dom := self.tryDom()
+	if dom == nil || len(dom.Nodes) == 0 {
+		return "", nil
+	}
+	return evaluateXPath(htmlquery.CreateXPathNavigator(dom.Nodes[0]), expr)
+}
+
+// 以XPath表达式查询当前页面，无匹配时返回空切片，表达式错误时记录日志并返回空切片。
+func (self *Context) XPath(expr string) []*html.Node {
+	nodes, err := self.GetXPath(expr)
+	if err != nil {
+		logs.Log.Error(" *     [xpath][%v]: %q %v\n", self.GetUrl(), expr, err)
+		return nil
+	}
+	return nodes
+}
+
+// 以XPath表达式提取单个值，规则同QueryXPath()，表达式错误时记录日志并返回空字符串。
+func (self *Context) XPathText(expr string) string {
+	value, err := self.QueryXPath(expr)
+	if err != nil {
+		logs.Log.Error(" *     [xpath][%v]: %q %v\n", self.GetUrl(), expr, err)
+	}
+	return value
+}
+
+// 返回XPath匹配的第一个节点的指定属性值，无匹配时返回空字符串。
+func (self *Context) XPathAttr(expr, attr string) string {
+	if nodes := self.XPath(expr); len(nodes) > 0 {
+		return htmlquery.SelectAttr(nodes[0], attr)
+	}
+	return ""
+}
+
+// 解析为XML文档（如带名称空间的RSS、Atom、SOAP响应），结果缓存，
+// 以xmlquery.QueryAll()等查询，名称空间前缀按文档中所写（如"//media:thumbnail"），默认名称空间的元素无前缀；
+// 内容与GetText()相同，已转码为UTF-8，文档声明的编码被忽略。
+func (self *Context) GetXml() (*xmlquery.Node, error) {
+	if self.xmlDoc != nil {
+		return self.xmlDoc, nil
+	}
+	if self.text == nil {
+		self.initText()
+	}
+	doc, err := xmlquery.Parse(bytes.NewReader(xmlEncodingDecl.ReplaceAll(self.text, []byte("$1"))))
+	if err != nil {
+		return nil, err
+	}
+	self.xmlDoc = doc
+	return doc, nil
+}
+
+// XML声明中的编码
+var xmlEncodingDecl = regexp.MustCompile(`^(\s*<\?xml[^>]*?)\s+encoding\s*=\s*["'][^"']*["']`)
+
+// 以XPath表达式从XML节点提取单个值，规则同Context.QueryXPath()
+func QueryXml(node *xmlquery.Node, expr string) (string, error) {
+	return evaluateXPath(xmlquery.CreateXPathNavigator(node), expr)
+}
+
+func evaluateXPath(nav xpath.NodeNavigator, expr string) (value string, err error) {
+	exp, err := xpath.Compile(expr)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("xpath: %q %v", expr, p)
+		}
+	}()
+	switch v := exp.Evaluate(nav).(type) {
+	case *xpath.NodeIterator:
+		if v.MoveNext() {
+			return v.Current().Value(), nil
+		}
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,103 @@
+package spider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+func TestQueryXPath(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{
+		url:  "http://example.com/item",
+		body: `<div class="price">Price</div><span>9.90</span><span>USD</span><a href="/1">one</a><a href="/2">two</a>`,
+	})
+	for expr, want := range map[string]string{
+		`//div[@class="price"]/following-sibling::span[1]`: "9.90",
+		`//a[2]/@href`:      "/2",
+		`count(//a)`:        "2",
+		`string(//a/@href)`: "/1",
+		`//p`:               "",
+	} {
+		if got, err := ctx.QueryXPath(expr); err != nil || got != want {
+			t.Errorf("%s: %q %v", expr, got, err)
+		}
+	}
+	if nodes, err := ctx.GetXPath("//span"); err != nil || len(nodes) != 2 {
+		t.Fatalf("GetXPath: %v %v", nodes, err)
+	}
+	if _, err := ctx.GetXPath("//a["); err == nil {
+		t.Fatal("malformed expression accepted")
+	}
+	if _, err := ctx.QueryXPath("//a[@"); err == nil {
+		t.Fatal("malformed expression accepted")
+	}
+	// XPathText()同QueryXPath()，出错时返回空字符串
+	if ctx.XPathText("count(//a)") != "2" || ctx.XPathText("//a[2]/@href") != "/2" || ctx.XPathText("//a[@") != "" {
+		t.Fatal("XPathText() differs from QueryXPath()")
+	}
+	PutContext(ctx)
+
+	ctx = testContext(t, nil, "list", testPage{
+		url:    "http://example.com/feed",
+		header: http.Header{"Content-Type": {"application/atom+xml"}},
+		body: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+	<entry><title>one &amp; only</title><media:thumbnail url="http://example.com/1.jpg"/></entry>
+	<entry><title>two</title></entry>
+</feed>`,
+	})
+	doc, err := ctx.GetXml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := xmlquery.QueryAll(doc, "//entry")
+	if err != nil || len(entries) != 2 || entries[0].NamespaceURI != "http://www.w3.org/2005/Atom" {
+		t.Fatalf("entries: %v %v", entries, err)
+	}
+	if title, _ := QueryXml(entries[0], "title"); title != "one & only" {
+		t.Fatalf("title: %q", title)
+	}
+	thumbs, _ := xmlquery.QueryAll(doc, "//media:thumbnail")
+	if len(thumbs) != 1 || thumbs[0].SelectAttr("url") != "http://example.com/1.jpg" || thumbs[0].NamespaceURI != "http://search.yahoo.com/mrss/" {
+		t.Fatalf("thumbnails: %v", thumbs)
+	}
+	if again, _ := ctx.GetXml(); again != doc {
+		t.Fatal("xml document not cached")
+	}
+	PutContext(ctx)
+}
+
+// 内容已转码为UTF-8，忽略文档声明的编码
+func TestGetXmlEncoding(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{
+		header: http.Header{"Content-Type": {"application/xml; charset=utf-8"}},
+		body:   `<?xml version="1.0" encoding="gbk"?><feed><link rel="self" href="/a"/><link href="/b"/><title>中文</title></feed>`,
+	})
+	defer PutContext(ctx)
+	doc, err := ctx.GetXml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expr, want := range map[string]string{
+		"//title":             "中文",
+		"//link[2]/@href":     "/b",
+		"count(//link/@href)": "2",
+		"//link[@rel]/@href":  "/a",
+	} {
+		if got, err := QueryXml(doc, expr); err != nil || got != want {
+			t.Errorf("%s: %q %v", expr, got, err)
+		}
+	}
+}
+
+// 求值时panic的表达式返回错误
+func TestGetXPathRecover(t *testing.T) {
+	ctx := testContext(t, nil, "list", testPage{body: `<a>1</a>`})
+	if nodes, err := ctx.GetXPath("//a[starts-with(., 1)]"); err == nil || nodes != nil {
+		t.Errorf("nodes = %v, err = %v", nodes, err)
+	}
+	if nodes := ctx.XPath("//a[starts-with(., 1)]"); len(nodes) != 0 {
+		t.Errorf("XPath() = %v", nodes)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"io/ioutil"
+	"runtime"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+// 资源监控：按间隔采样堆内存、协程数及打开的文件描述符数并打印，
+// 任一项超过配置的上限时优雅终止任务，用于无人值守的长时间采集。
+func (self *Logic) watchdog(done <-chan bool) {
+	if config.WATCHDOG_INTERVAL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(config.WATCHDOG_INTERVAL) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		heap := int(mem.HeapAlloc >> 20)
+		goroutines := runtime.NumGoroutine()
+		fds := openFDs()
+		logs.Log.Informational(" *     [资源监控] 堆内存 %v MB，协程 %v 个，文件描述符 %v 个\n", heap, goroutines, fds)
+
+		reason := overLimit(heap, goroutines, fds)
+		if reason == "" {
+			continue
+		}
+		logs.Log.Critical(" *     [资源监控] %s超过上限，正在终止任务……\n", reason)
+		go self.GracefulStop(time.Duration(config.GRACE_SECOND) * time.Second)
+		return
+	}
+}
+
+// 返回超过上限的资源项名称，均未超过时返回空字符串
+func overLimit(heap, goroutines, fds int) string {
+	switch {
+	case config.WATCHDOG_MAX_HEAP > 0 && heap > config.WATCHDOG_MAX_HEAP:
+		return "堆内存"
+	case config.WATCHDOG_MAX_GOROUTINE > 0 && goroutines > config.WATCHDOG_MAX_GOROUTINE:
+		return "协程数"
+	case config.WATCHDOG_MAX_FD > 0 && fds > config.WATCHDOG_MAX_FD:
+		return "文件描述符数"
+	}
+	return ""
+}
+
+// 返回本进程打开的文件描述符数，非Linux系统返回-1
+func openFDs() int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(fds)
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+func TestWatchdogOverLimit(t *testing.T) {
+	heap, goroutines, fd := config.WATCHDOG_MAX_HEAP, config.WATCHDOG_MAX_GOROUTINE, config.WATCHDOG_MAX_FD
+	config.WATCHDOG_MAX_HEAP, config.WATCHDOG_MAX_GOROUTINE, config.WATCHDOG_MAX_FD = 100, 50, 0
+	defer func() {
+		config.WATCHDOG_MAX_HEAP, config.WATCHDOG_MAX_GOROUTINE, config.WATCHDOG_MAX_FD = heap, goroutines, fd
+	}()
+
+	cases := []struct {
+		heap, goroutines, fds int
+		want                  string
+	}{
+		{100, 50, 1 << 20, ""}, // 上限为0时不检查
+		{101, 50, 10, "堆内存"},
+		{10, 51, 10, "协程数"},
+		{101, 51, 10, "堆内存"},
+		{10, 10, -1, ""}, // 无法获取文件描述符数
+	}
+	for _, c := range cases {
+		if got := overLimit(c.heap, c.goroutines, c.fds); got != c.want {
+			t.Errorf("overLimit(%d, %d, %d) = %q, want %q", c.heap, c.goroutines, c.fds, got, c.want)
+		}
+	}
+	config.WATCHDOG_MAX_FD = 5
+	if got := overLimit(10, 10, 6); got != "文件描述符数" {
+		t.Errorf("overLimit fds = %q", got)
+	}
+}
+
+func TestOpenFDs(t *testing.T) {
+	if n := openFDs(); n == 0 {
+		t.Errorf("openFDs() = %d", n)
+	}
+}
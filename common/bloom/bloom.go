@@ -0,0 +1,107 @@
+// 布隆过滤器，以可控的误判率换取固定的内存占用，适用于海量URL去重。
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+type Filter struct {
+	bits []uint64 // 位数组
+	m    uint64   // 位数
+	k    uint64   // 哈希函数个数
+	set  uint64   // 已置为1的位数
+	sync.RWMutex
+}
+
+// 根据预估元素总数n与目标误判率fp创建布隆过滤器
+func New(n uint64, fp float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.001
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// 添加元素
+func (self *Filter) Add(s string) {
+	self.Lock()
+	self.add(s)
+	self.Unlock()
+}
+
+// 检查元素是否可能存在，返回false时一定不存在
+func (self *Filter) Test(s string) bool {
+	self.RLock()
+	defer self.RUnlock()
+	return self.test(s)
+}
+
+// 检查元素是否可能存在，不存在时添加，并发安全
+func (self *Filter) TestAndAdd(s string) bool {
+	self.Lock()
+	defer self.Unlock()
+	if self.test(s) {
+		return true
+	}
+	self.add(s)
+	return false
+}
+
+// 返回已置位比例，超过0.5时误判率将高于预期，应增大预估元素总数
+func (self *Filter) FillRatio() float64 {
+	self.RLock()
+	defer self.RUnlock()
+	return float64(self.set) / float64(self.m)
+}
+
+// 返回位数组占用的字节数
+func (self *Filter) Size() uint64 {
+	return uint64(len(self.bits)) * 8
+}
+
+func (self *Filter) add(s string) {
+	h1, h2 := hash(s)
+	for i := uint64(0); i < self.k; i++ {
+		idx := (h1 + i*h2) % self.m
+		mask := uint64(1) << (idx % 64)
+		if self.bits[idx/64]&mask == 0 {
+			self.bits[idx/64] |= mask
+			self.set++
+		}
+	}
+}
+
+func (self *Filter) test(s string) bool {
+	h1, h2 := hash(s)
+	for i := uint64(0); i < self.k; i++ {
+		idx := (h1 + i*h2) % self.m
+		if self.bits[idx/64]&(uint64(1)<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 双重哈希，由两个基础哈希值模拟k个哈希函数
+func hash(s string) (uint64, uint64) {
+	a, b := fnv.New64a(), fnv.New64()
+	a.Write([]byte(s))
+	b.Write([]byte(s))
+	return a.Sum64(), b.Sum64() | 1
+}
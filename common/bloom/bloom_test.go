@@ -0,0 +1,31 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		if f.TestAndAdd(strconv.Itoa(i)) {
+			t.Logf("误判: %d", i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if !f.Test(strconv.Itoa(i)) {
+			t.Fatalf("已添加元素 %d 未被识别", i)
+		}
+	}
+	var fp int
+	for i := n; i < 2*n; i++ {
+		if f.Test(strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Fatalf("误判率过高: %v", rate)
+	}
+	t.Logf("填充率: %.4f, 内存: %d B", f.FillRatio(), f.Size())
+}
@@ -0,0 +1,177 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+/************************ ClickHouse 输出 ***************************/
+// 通过HTTP接口写入，使用服务端异步插入(async_insert)合并小批次，以提升吞吐量
+
+var (
+	err    error
+	client = &http.Client{Timeout: 5 * time.Minute}
+)
+
+func Error() error {
+	return err
+}
+
+// 检查连接并确保数据库存在
+func Refresh() {
+	if _, err = exec("CREATE DATABASE IF NOT EXISTS "+quote(config.CLICKHOUSE_DB), nil, false); err != nil {
+		logs.Log.Error("ClickHouse：%v\n", err)
+	}
+}
+
+type Table struct {
+	name    string
+	columns []string
+	known   map[string]bool
+	types   map[string]string // 非String类型的字段
+}
+
+func New(name string) *Table {
+	return &Table{
+		name:  name,
+		known: make(map[string]bool),
+		types: make(map[string]string),
+	}
+}
+
+// 添加指定类型的字段，如Int64、Float64、Bool、DateTime
+func (self *Table) AddTypedColumn(name, typ string) *Table {
+	self.AddColumn(name)
+	self.types[name] = typ
+	return self
+}
+
+// 添加字段，字段类型统一为String
+func (self *Table) AddColumn(names ...string) *Table {
+	for _, name := range names {
+		if self.known[name] {
+			continue
+		}
+		self.columns = append(self.columns, name)
+		self.known[name] = true
+	}
+	return self
+}
+
+// 创建表（已存在时不改变表结构），并以服务端实际的表结构为准更新已知字段
+func (self *Table) Create() error {
+	if len(self.columns) == 0 {
+		return fmt.Errorf("ClickHouse表 %s 的字段不能为空", self.name)
+	}
+	cols := make([]string, len(self.columns))
+	for i, c := range self.columns {
+		typ := self.types[c]
+		if typ == "" {
+			typ = "String"
+		}
+		cols[i] = quote(c) + " " + typ
+	}
+	sql := "CREATE TABLE IF NOT EXISTS " + self.fullName() + " (" + strings.Join(cols, ", ") + ") ENGINE = MergeTree ORDER BY tuple()"
+	if _, err := exec(sql, nil, false); err != nil {
+		return err
+	}
+
+	b, err := exec("DESCRIBE TABLE "+self.fullName()+" FORMAT TabSeparated", nil, false)
+	if err != nil {
+		return err
+	}
+	self.columns = self.columns[:0]
+	self.known = make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if name := strings.SplitN(line, "\t", 2)[0]; name != "" {
+			self.AddColumn(name)
+		}
+	}
+	return nil
+}
+
+// 检查字段是否存在于表结构中
+func (self *Table) HasColumn(name string) bool {
+	return self.known[name]
+}
+
+// 按批次写入数据，每行的键必须是已存在的字段；失败时返回此前各批次已写入的行数
+func (self *Table) Insert(rows []map[string]interface{}) (int, error) {
+	size := config.CLICKHOUSE_BATCH_SIZE
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		enc.SetEscapeHTML(false)
+		for _, row := range rows[start:end] {
+			if err := enc.Encode(row); err != nil {
+				return start, err
+			}
+		}
+		if _, err := exec("INSERT INTO "+self.fullName()+" FORMAT JSONEachRow", &body, true); err != nil {
+			return start, err
+		}
+	}
+	return len(rows), nil
+}
+
+func (self *Table) fullName() string {
+	return quote(config.CLICKHOUSE_DB) + "." + quote(self.name)
+}
+
+// 执行一条语句，async为true时启用服务端异步插入
+func exec(query string, body *bytes.Buffer, async bool) ([]byte, error) {
+	u, err := url.Parse(config.CLICKHOUSE_CONN_STR)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("query", query)
+	if async {
+		q.Set("async_insert", "1")
+		q.Set("wait_for_async_insert", "0")
+		q.Set("async_insert_busy_timeout_ms", strconv.Itoa(config.CLICKHOUSE_FLUSH_INTERVAL))
+	}
+	u.RawQuery = q.Encode()
+
+	var req *http.Request
+	if body == nil {
+		req, err = http.NewRequest("POST", u.String(), nil)
+	} else {
+		req, err = http.NewRequest("POST", u.String(), body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ClickHouse响应 %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+// 以反引号包裹标识符
+func quote(name string) string {
+	return "`" + strings.Replace(name, "`", "\\`", -1) + "`"
+}
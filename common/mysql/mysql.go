@@ -3,12 +3,12 @@ package mysql
 import (
 	"database/sql"
 	"errors"
+	"strconv"
 	"strings"
 	"sync"
 
 	_ "github.com/go-sql-driver/mysql"
 
-	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
 )
@@ -22,7 +22,9 @@ type MyTable struct {
 	args             []interface{} // 数据
 	sqlCode          string
 	customPrimaryKey bool
-	size             int // 内容大小的近似值
+	uniqueKey        []string // 唯一索引的列，非空时按其更新已存在的行
+	size             int      // 内容大小的近似值
+	flushErr         error    // AutoInsertRow()中自动写入失败的首个错误，由下次FlushInsert()返回
 }
 
 var (
@@ -47,6 +49,9 @@ func Refresh() {
 		db.SetMaxOpenConns(config.MYSQL_CONN_CAP)
 		db.SetMaxIdleConns(config.MYSQL_CONN_CAP)
 	})
+	if db == nil {
+		return
+	}
 	if err = db.Ping(); err != nil {
 		logs.Log.Error("Mysql：%v\n", err)
 	}
@@ -61,6 +66,7 @@ func (m *MyTable) Clone() *MyTable {
 		tableName:        m.tableName,
 		columnNames:      m.columnNames,
 		customPrimaryKey: m.customPrimaryKey,
+		uniqueKey:        m.uniqueKey,
 	}
 }
 
@@ -87,6 +93,16 @@ func (self *MyTable) CustomPrimaryKey(primaryKeyCode string) *MyTable {
 	return self
 }
 
+//设置唯一索引的列（可选），须在Create()前设置；
+//设置后插入的行与已存在的行唯一索引相同时更新该行（ON DUPLICATE KEY UPDATE），对已存在的表不补建索引
+func (self *MyTable) SetUniqueKey(columns ...string) *MyTable {
+	self.uniqueKey = nil
+	for _, col := range columns {
+		self.uniqueKey = append(self.uniqueKey, wrapSqlKey(col))
+	}
+	return self
+}
+
 //生成"创建表单"的语句，执行前须保证SetTableName()、AddColumn()已经执行
 func (self *MyTable) Create() error {
 	if len(self.columnNames) == 0 {
@@ -99,6 +115,9 @@ func (self *MyTable) Create() error {
 	for _, title := range self.columnNames {
 		self.sqlCode += title[0] + ` ` + title[1] + `,`
 	}
+	if len(self.uniqueKey) > 0 {
+		self.sqlCode += `UNIQUE KEY ` + wrapSqlKey("upsert_key") + ` (` + strings.Join(self.keyParts(), ",") + `),`
+	}
 	self.sqlCode = self.sqlCode[:len(self.sqlCode)-1] + `) ENGINE=MyISAM DEFAULT CHARSET=utf8;`
 
 	maxConnChan <- true
@@ -114,6 +133,21 @@ func (self *MyTable) Create() error {
 	return err
 }
 
+// 唯一索引的各列，TEXT类型的列按前缀建立索引，以免超出MyISAM索引长度上限（1000字节，utf8每字符3字节）
+func (self *MyTable) keyParts() []string {
+	prefix := "(" + strconv.Itoa(333/len(self.uniqueKey)) + ")"
+	parts := make([]string, len(self.uniqueKey))
+	for i, col := range self.uniqueKey {
+		parts[i] = col
+		for _, title := range self.columnNames {
+			if title[0] == col && strings.Contains(strings.ToUpper(title[1]), "TEXT") {
+				parts[i] += prefix
+			}
+		}
+	}
+	return parts
+}
+
 //清空表单，执行前须保证SetTableName()已经执行
 func (self *MyTable) Truncate() error {
 	maxConnChan <- true
@@ -125,38 +159,79 @@ func (self *MyTable) Truncate() error {
 }
 
 //设置插入的1行数据
-func (self *MyTable) addRow(value []string) *MyTable {
-	for i, count := 0, len(value); i < count; i++ {
-		self.args = append(self.args, value[i])
-	}
+func (self *MyTable) addRow(value []interface{}) *MyTable {
+	self.args = append(self.args, value...)
 	self.rowsCount++
 	return self
 }
 
 //智能插入数据，每次1行
 func (self *MyTable) AutoInsert(value []string) *MyTable {
-	if self.rowsCount > 100 {
-		util.CheckErr(self.FlushInsert())
-		return self.AutoInsert(value)
+	row := make([]interface{}, len(value))
+	for i, v := range value {
+		row[i] = v
 	}
-	var nsize int
-	for _, v := range value {
-		nsize += len(v)
+	return self.AutoInsertRow(row)
+}
+
+//智能插入数据，每次1行，值可为nil（NULL）及数值、时间等类型
+func (self *MyTable) AutoInsertRow(value []interface{}) *MyTable {
+	if self.rowsCount > 100 {
+		self.autoFlush()
+		return self.AutoInsertRow(value)
 	}
+	nsize := rowSize(value)
 	if nsize > max_allowed_packet {
 		logs.Log.Error("%v", "packet for query is too large. Try adjusting the 'maxallowedpacket'variable in the 'config.ini'")
 		return self
 	}
 	self.size += nsize
 	if self.size > max_allowed_packet {
-		util.CheckErr(self.FlushInsert())
-		return self.AutoInsert(value)
+		self.autoFlush()
+		return self.AutoInsertRow(value)
 	}
 	return self.addRow(value)
 }
 
-//向sqlCode添加"插入数据"的语句，执行前须保证Create()、AutoInsert()已经执行
+// 返回插入该行时AutoInsertRow()是否会先自动写入已缓存的数据，
+// 调用方可据此先行FlushInsert()，以确定各行是否已写入
+func (self *MyTable) Full(value []interface{}) bool {
+	if self.rowsCount > 100 {
+		return true
+	}
+	nsize := rowSize(value)
+	return nsize <= max_allowed_packet && self.size+nsize > max_allowed_packet
+}
+
+func rowSize(value []interface{}) int {
+	var nsize int
+	for _, v := range value {
+		if s, ok := v.(string); ok {
+			nsize += len(s)
+		} else {
+			nsize += 8
+		}
+	}
+	return nsize
+}
+
+// 缓存的数据过多时提前写入，记录首个错误
+func (self *MyTable) autoFlush() {
+	if err := self.FlushInsert(); err != nil && self.flushErr == nil {
+		self.flushErr = err
+	}
+}
+
+//向sqlCode添加"插入数据"的语句，执行前须保证Create()、AutoInsert()已经执行；
+//此前AutoInsert()中自动写入失败时丢弃缓存的数据并返回其错误
 func (self *MyTable) FlushInsert() error {
+	if err := self.flushErr; err != nil {
+		self.flushErr = nil
+		self.args = []interface{}{}
+		self.rowsCount = 0
+		self.size = 0
+		return err
+	}
 	if self.rowsCount == 0 {
 		return nil
 	}
@@ -175,7 +250,15 @@ func (self *MyTable) FlushInsert() error {
 	self.sqlCode = self.sqlCode[:len(self.sqlCode)-1] + `) VALUES `
 
 	blank := ",(" + strings.Repeat(",?", colCount)[1:] + ")"
-	self.sqlCode += strings.Repeat(blank, self.rowsCount)[1:] + `;`
+	self.sqlCode += strings.Repeat(blank, self.rowsCount)[1:]
+	if len(self.uniqueKey) > 0 {
+		var update []string
+		for _, v := range self.columnNames {
+			update = append(update, v[0]+`=VALUES(`+v[0]+`)`)
+		}
+		self.sqlCode += ` ON DUPLICATE KEY UPDATE ` + strings.Join(update, ",")
+	}
+	self.sqlCode += `;`
 
 	defer func() {
 		// 清空临时数据
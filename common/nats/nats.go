@@ -0,0 +1,306 @@
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+/************************ NATS 输出 ***************************/
+// 直接实现NATS客户端文本协议的发布部分（CONNECT/PUB/SUB/PING），
+// 启用JetStream时每条消息以请求-响应方式发布，并等待服务端的确认(PubAck)；
+// 地址为tls://或服务端要求TLS时以TLS连接
+
+var (
+	err  error
+	conn *client
+	lock sync.Mutex
+
+	// 建立TCP连接，测试时替换
+	dialConn = func(host string) (net.Conn, error) {
+		return net.DialTimeout("tcp", host, 10*time.Second)
+	}
+)
+
+// 连接中断时仍有已写入但未经Flush()确认的消息，这些消息可能已丢失
+var ErrUnflushed = errors.New("连接中断，此前未确认的消息可能已丢失")
+
+func Error() error {
+	lock.Lock()
+	defer lock.Unlock()
+	return err
+}
+
+// 重新建立连接
+func Refresh() {
+	lock.Lock()
+	defer lock.Unlock()
+	if conn != nil {
+		conn.close()
+		conn = nil
+	}
+	if conn, err = dial(config.NATS_URL); err != nil {
+		logs.Log.Error("NATS：%v\n", err)
+	}
+}
+
+// 发布一条消息，启用JetStream时等待确认；连接中断时重新连接并重试一次，
+// 但此前尚有未经Flush()确认的消息时返回ErrUnflushed，由调用方重新发布这些消息
+func Publish(subject string, payload []byte) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for i := 0; ; i++ {
+		if conn == nil {
+			if conn, err = dial(config.NATS_URL); err != nil {
+				return err
+			}
+		}
+		e := conn.publish(subject, payload)
+		if _, ok := e.(ackError); e == nil || ok {
+			return e
+		}
+		err = e
+		unflushed := conn.unflushed
+		conn.close()
+		conn = nil
+		if unflushed > 0 {
+			err = fmt.Errorf("%v: %v", ErrUnflushed, err)
+			return err
+		}
+		if i > 0 {
+			return err
+		}
+		logs.Log.Warning("NATS：发布至 %s 失败，重新连接后重试：%v\n", subject, err)
+	}
+}
+
+// 等待已发布的消息被服务端接收（未启用JetStream时使用）
+func Flush() error {
+	lock.Lock()
+	defer lock.Unlock()
+	if conn == nil {
+		return err
+	}
+	if err = conn.ping(); err != nil {
+		if conn.unflushed > 0 {
+			err = fmt.Errorf("%v: %v", ErrUnflushed, err)
+		}
+		conn.close()
+		conn = nil
+	}
+	return err
+}
+
+type client struct {
+	net.Conn
+	r         *bufio.Reader
+	w         *bufio.Writer
+	inbox     string
+	seq       uint64
+	unflushed int // 未启用JetStream时，已写入但尚未经PING确认的消息数
+}
+
+// 服务端的INFO中与连接相关的部分
+type serverInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// JetStream拒绝了消息，连接仍然可用
+type ackError string
+
+func (e ackError) Error() string {
+	return string(e)
+}
+
+// JetStream的发布确认
+type pubAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func dial(rawurl string) (*client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	c, err := dialConn(host)
+	if err != nil {
+		return nil, err
+	}
+	self := &client{
+		Conn:  c,
+		r:     bufio.NewReader(c),
+		w:     bufio.NewWriter(c),
+		inbox: "_INBOX.pholcus." + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	self.SetDeadline(time.Now().Add(10 * time.Second))
+	line, err := self.readLine()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	var info serverInfo
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(line[5:]), &info) != nil {
+		c.Close()
+		return nil, fmt.Errorf("无效的服务端响应: %s", line)
+	}
+	// 服务端以明文发送INFO后，双方在同一连接上进行TLS握手
+	if u.Scheme == "tls" || info.TLSRequired {
+		tc := tls.Client(c, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.Handshake(); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("TLS握手失败: %v", err)
+		}
+		self.Conn, self.r, self.w = tc, bufio.NewReader(tc), bufio.NewWriter(tc)
+	}
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "pholcus",
+		"lang":     "go",
+		"version":  config.VERSION,
+		"protocol": 1,
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	b, _ := json.Marshal(opts)
+	fmt.Fprintf(self.w, "CONNECT %s\r\nSUB %s.* 1\r\n", b, self.inbox)
+	if err := self.ping(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *client) close() {
+	self.Conn.Close()
+}
+
+func (self *client) publish(subject string, payload []byte) error {
+	if !config.NATS_JETSTREAM {
+		self.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		fmt.Fprintf(self.w, "PUB %s %d\r\n", subject, len(payload))
+		self.w.Write(payload)
+		if _, err := self.w.WriteString("\r\n"); err != nil {
+			return err
+		}
+		self.unflushed++
+		return nil
+	}
+	self.seq++
+	reply := self.inbox + "." + strconv.FormatUint(self.seq, 10)
+	fmt.Fprintf(self.w, "PUB %s %s %d\r\n", subject, reply, len(payload))
+	self.w.Write(payload)
+	self.w.WriteString("\r\n")
+	self.SetDeadline(time.Now().Add(time.Duration(config.NATS_ACK_TIMEOUT) * time.Millisecond))
+	if err := self.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		subj, data, err := self.read()
+		if err != nil {
+			return err
+		}
+		if subj != reply {
+			continue // 超时后迟到的确认
+		}
+		var ack pubAck
+		if err := json.Unmarshal(data, &ack); err != nil {
+			return ackError(fmt.Sprintf("无效的JetStream确认: %s", data))
+		}
+		if ack.Error != nil {
+			return ackError(fmt.Sprintf("JetStream: %s (%d)", ack.Error.Description, ack.Error.Code))
+		}
+		return nil
+	}
+}
+
+// 发送PING并等待PONG，确认此前的命令均已被服务端处理
+func (self *client) ping() error {
+	self.SetDeadline(time.Now().Add(10 * time.Second))
+	self.w.WriteString("PING\r\n")
+	if err := self.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		if _, _, err := self.read(); err != nil {
+			if err == errPong {
+				self.unflushed = 0
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var errPong = errors.New("PONG")
+
+// 读取下一条消息，返回其主题与内容；服务端的PING在此应答，PONG以errPong返回
+func (self *client) read() (string, []byte, error) {
+	for {
+		line, err := self.readLine()
+		if err != nil {
+			return "", nil, err
+		}
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			args := strings.Fields(line[4:])
+			if len(args) < 3 {
+				return "", nil, fmt.Errorf("无效的服务端消息: %s", line)
+			}
+			n, err := strconv.Atoi(args[len(args)-1])
+			if err != nil {
+				return "", nil, fmt.Errorf("无效的服务端消息: %s", line)
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(self.r, data); err != nil {
+				return "", nil, err
+			}
+			return args[0], data[:n], nil
+		case line == "PING":
+			self.w.WriteString("PONG\r\n")
+			if err := self.w.Flush(); err != nil {
+				return "", nil, err
+			}
+		case line == "PONG":
+			return "", nil, errPong
+		case strings.HasPrefix(line, "-ERR"):
+			return "", nil, errors.New(strings.TrimSpace(line[4:]))
+		}
+		// +OK、INFO等忽略
+	}
+}
+
+func (self *client) readLine() (string, error) {
+	line, err := self.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -49,6 +49,87 @@ var (
 
 	KAFKA_BORKERS string = setting.DefaultString("kafka::brokers", kafkabrokers) //kafka brokers
 
+	CLICKHOUSE_CONN_STR       string = setting.DefaultString("clickhouse::connstring", clickhouseconnstring)    // clickhouse HTTP接口地址
+	CLICKHOUSE_DB             string = setting.DefaultString("clickhouse::database", dbname)                    // clickhouse数据库名称
+	CLICKHOUSE_BATCH_SIZE     int    = setting.DefaultInt("clickhouse::batchsize", clickhousebatchsize)         // clickhouse单次插入的最大行数
+	CLICKHOUSE_FLUSH_INTERVAL int    = setting.DefaultInt("clickhouse::flushinterval", clickhouseflushinterval) // clickhouse服务端异步插入的刷新间隔，单位毫秒
+
+	NATS_URL          string = setting.DefaultString("nats::url", natsurl)                 // nats服务地址
+	NATS_SUBJECT      string = setting.DefaultString("nats::subject", natssubject)         // 文本结果的发布主题模板
+	NATS_FILE_SUBJECT string = setting.DefaultString("nats::filesubject", natsfilesubject) // 文件结果的发布主题模板，为空时不发布文件
+	NATS_JETSTREAM    bool   = setting.DefaultBool("nats::jetstream", natsjetstream)       // 是否以JetStream发布并等待确认
+	NATS_ACK_TIMEOUT  int    = setting.DefaultInt("nats::acktimeout", natsacktimeout)      // 等待JetStream确认的超时时长，单位毫秒
+
+	OUTPUT_RETRY_TIMES int    = setting.DefaultInt("output::retrytimes", outputretrytimes)    // 数据库类输出失败时的重试次数
+	OUTPUT_RETRY_PAUSE int    = setting.DefaultInt("output::retrypause", outputretrypause)    // 首次重试前的等待时长，单位毫秒，此后每次加倍
+	DEAD_LETTER_DIR    string = setting.DefaultString("output::deadletterdir", deadletterdir) // 重试耗尽后仍未能输出的数据的保存目录
+
+	OUTPUT_ENCODING        string = setting.DefaultString("output::encoding", outputencoding)             // CSV输出的字符编码，如GBK、Shift_JIS
+	OUTPUT_ENCODING_POLICY string = setting.DefaultString("output::encodingpolicy", outputencodingpolicy) // 目标编码无法表示的字符的处理方式：replace替换，skip丢弃，error报错
+
+	OUTPUT_MAX_BUFFERED int = setting.DefaultInt("output::maxbuffered", outputmaxbuffered) // 每个蜘蛛已收集但尚未输出的文本数据的上限，达到时阻塞采集，0为不限
+
+	OUTPUT_TASK_ID bool = setting.DefaultBool("output::taskid", outputtaskid) // 是否在每条文本结果中添加字段TaskID
+
+	ACCESS_LOG_PATH     string = setting.DefaultString("accesslog::path", accesslogpath)    // 访问日志文件路径，为空时不记录
+	ACCESS_LOG_MAX_SIZE int    = setting.DefaultInt("accesslog::maxsize", accesslogmaxsize) // 访问日志文件的大小上限，超过时轮转，单位MB
+
+	QUEUE_MAX_SIZE int    = setting.DefaultInt("queue::maxsize", queuemaxsize)      // 每个蜘蛛内存中请求队列的容量，0为不限
+	QUEUE_OVERFLOW string = setting.DefaultString("queue::overflow", queueoverflow) // 队列已满时的处理方式：spill溢出至磁盘，block阻塞添加请求的协程
+	QUEUE_FORMAT   string = setting.DefaultString("queue::format", queueformat)     // 溢出至磁盘的请求的序列化格式：json或protobuf
+
+	QUEUE_MAX_AGE int64 = setting.DefaultInt64("queue::maxage", queuemaxage) // 请求在队列中等待超过该时长时出队即丢弃，单位秒，0为不限
+
+	WATCHDOG_INTERVAL      int = setting.DefaultInt("watchdog::interval", watchdoginterval)         // 资源监控的采样间隔，单位秒，0为不监控
+	WATCHDOG_MAX_HEAP      int = setting.DefaultInt("watchdog::maxheap", watchdogmaxheap)           // 堆内存上限，单位MB，超过时优雅终止任务，0为不限
+	WATCHDOG_MAX_GOROUTINE int = setting.DefaultInt("watchdog::maxgoroutine", watchdogmaxgoroutine) // 协程数上限，超过时优雅终止任务，0为不限
+	WATCHDOG_MAX_FD        int = setting.DefaultInt("watchdog::maxfd", watchdogmaxfd)               // 打开的文件描述符数上限（仅Linux），超过时优雅终止任务，0为不限
+
+	BROWSER_SCROLL_TIMES  int = setting.DefaultInt("browser::scrolltimes", browserscrolltimes)   // Context.ScrollToBottom()滚动至页面底部的次数
+	BROWSER_SCROLL_SETTLE int = setting.DefaultInt("browser::scrollsettle", browserscrollsettle) // Context.ScrollToBottom()每次滚动后等待内容加载的时长，单位毫秒
+
+	CSV_ROTATE_ROWS   int = setting.DefaultInt("csv::rotaterows", csvrotaterows)     // 单个CSV文件的行数上限（不含表头），0为不限
+	CSV_ROTATE_BYTES  int = setting.DefaultInt("csv::rotatebytes", csvrotatebytes)   // 单个CSV文件的大小上限，单位KB，0为不限
+	EXCEL_ROTATE_ROWS int = setting.DefaultInt("excel::rotaterows", excelrotaterows) // Excel文件中单个工作表的行数上限（不含表头），0为不限
+
+	JSONL_MAX_BYTES int  = setting.DefaultInt("jsonl::maxbytes", jsonlmaxbytes) // jsonl输出方式下单个文件的大小上限，单位字节，0为不限
+	JSONL_GZIP      bool = setting.DefaultBool("jsonl::gzip", jsonlgzip)        // jsonl输出方式下是否以gzip压缩写完的文件
+
+	SHARD_COUNT int = setting.DefaultInt("shard::count", shardcount) // 分片数，大于1时各节点只采集属于本分片的请求
+	SHARD_INDEX int = setting.DefaultInt("shard::index", shardindex) // 本节点的分片序号
+
+	DIAL_TIMEOUT        int  = setting.DefaultInt("dial::timeout", dialtimeout)              // 建立TCP连接的超时上限，单位毫秒，0为不限
+	DIAL_KEEP_ALIVE     int  = setting.DefaultInt("dial::keepalive", dialkeepalive)          // TCP keep-alive探测间隔，单位秒，0为系统默认，-1为关闭
+	DIAL_HAPPY_EYEBALLS bool = setting.DefaultBool("dial::happyeyeballs", dialhappyeyeballs) // 双栈主机是否并行尝试IPv4与IPv6
+
+	DEBUG_MODE      string = setting.DefaultString("debug::mode", debugmode)      // 响应内容调试转储：空为关闭，all保存全部响应，failing仅保存异常响应
+	DEBUG_DIR       string = setting.DefaultString("debug::dir", debugdir)        // 调试转储目录
+	DEBUG_MAX_FILES int    = setting.DefaultInt("debug::maxfiles", debugmaxfiles) // 调试转储的响应数上限，0为不限
+
+	SEEN_ENABLE bool   = setting.DefaultBool("seen::enable", seenenable) // 是否启用跨任务的结果去重
+	SEEN_DIR    string = setting.DefaultString("seen::dir", seendir)     // 结果去重记录目录
+	SEEN_TTL    int    = setting.DefaultInt("seen::ttl", seenttl)        // 结果去重记录的保留天数，0为永久保留
+
+	FAILED_PATH   string = setting.DefaultString("failed::path", failedpath)     // 最终失败的请求的保存文件（JSON Lines），为空时不保存
+	FAILED_REPLAY string = setting.DefaultString("failed::replay", failedreplay) // 任务开始时重新加入队列的失败请求文件，为空时不启用
+
+	TOR_SOCKS      string = setting.DefaultString("tor::socks", torsocks)       // Tor的SOCKS5代理地址，为空时不启用
+	TOR_CONTROL    string = setting.DefaultString("tor::control", torcontrol)   // Tor控制端口地址，为空时不切换线路
+	TOR_PASSWORD   string = setting.DefaultString("tor::password", torpassword) // Tor控制端口的密码
+	TOR_INTERVAL   int    = setting.DefaultInt("tor::interval", torinterval)    // 两次切换线路的最短间隔，单位秒
+	TOR_MAX_ROTATE int    = setting.DefaultInt("tor::maxrotate", tormaxrotate)  // 每个请求最多切换线路的次数
+
+	BREAKER_THRESHOLD int   = setting.DefaultInt("breaker::threshold", breakerthreshold) // 同一主机连续失败达到该次数时熔断，0为不启用
+	BREAKER_COOLDOWN  int64 = setting.DefaultInt64("breaker::cooldown", breakercooldown) // 熔断后的冷却时长，单位秒
+
+	GRACE_SECOND int64 = setting.DefaultInt64("run::gracesecond", gracesecond) // 收到终止信号后等待进行中的请求完成的最长时间，单位秒
+	IDLE_TIMEOUT int64 = setting.DefaultInt64("run::idletimeout", idletimeout) // 超过该时长没有请求完成且仍有待处理的请求时视为停滞并优雅终止任务，单位秒，0为不监控
+
+	RAMP_SECOND int64 = setting.DefaultInt64("run::rampsecond", rampsecond) // 任务开始后并发量由RAMP_START逐步增至全局并发量所用的时长，单位秒，0为不启用
+	RAMP_START  int   = setting.DefaultInt("run::rampstart", rampstart)     // 逐步增加并发量时的初始并发量
+
+	RETRY_AFTER_MAX int64 = setting.DefaultInt64("run::retryaftermax", retryaftermax) // 按响应的Retry-After等待后重试时的最长等待时长，单位秒，0为忽略Retry-After
+
 	LOG_CAP            int64 = setting.DefaultInt64("log::cap", logcap)          // 日志缓存的容量
 	LOG_LEVEL          int   = logLevel(setting.String("log::level"))            // 全局日志打印级别（亦是日志文件输出级别）
 	LOG_CONSOLE_LEVEL  int   = logLevel(setting.String("log::consolelevel"))     // 日志在控制台的显示级别
@@ -71,6 +152,12 @@ func init() {
 		ProxyMinute:    setting.DefaultInt64("run::proxyminute", proxyminute), // 代理IP更换的间隔分钟数
 		SuccessInherit: setting.DefaultBool("run::success", success),          // 继承历史成功记录
 		FailureInherit: setting.DefaultBool("run::failure", failure),          // 继承历史失败记录
+
+		Deterministic: setting.DefaultBool("run::deterministic", deterministic), // 确定性模式，仅用于开发与测试
+		Preview:       setting.DefaultInt("run::preview", preview),              // 预览模式，每个蜘蛛成功解析该数量的页面后即结束
+
+		Seeds:    setting.DefaultString("run::seeds", seeds),       // 种子URL文件，"-"为标准输入
+		SeedRule: setting.DefaultString("run::seedrule", seedrule), // 种子URL未指定规则名时绑定的规则
 	}
 }
 
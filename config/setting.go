@@ -34,6 +34,86 @@ const (
 	mysqlmaxallowedpacket int    = 1048576                     //mysql通信缓冲区的最大长度，单位B，默认1MB
 	kafkabrokers          string = "127.0.0.1:9092"            //kafka broker字符串,逗号分割
 
+	clickhouseconnstring    string = "http://127.0.0.1:8123" // clickhouse HTTP接口地址
+	clickhousebatchsize     int    = 100000                  // clickhouse单次插入的最大行数
+	clickhouseflushinterval int    = 1000                    // clickhouse服务端异步插入的刷新间隔，单位毫秒
+
+	natsurl         string = "nats://127.0.0.1:4222"            // nats服务地址，可含用户名与密码（或令牌）
+	natssubject     string = "pholcus.{{.Namespace}}.{{.Rule}}" // 文本结果的发布主题模板(text/template)
+	natsfilesubject string = ""                                 // 文件结果（内容为base64）的发布主题模板，为空时不发布文件
+	natsjetstream   bool   = false                              // 是否以JetStream发布并等待确认
+	natsacktimeout  int    = 5000                               // 等待JetStream确认的超时时长，单位毫秒
+
+	gracesecond int64 = 30 // 收到终止信号后等待进行中的请求完成的最长时间，单位秒
+	idletimeout int64 = 0  // 超过该时长没有请求完成且仍有待处理的请求时视为停滞并优雅终止任务，单位秒，0为不监控
+
+	rampsecond int64 = 0 // 任务开始后并发量由rampstart逐步增至全局并发量所用的时长，单位秒，0为不启用
+	rampstart  int   = 1 // 逐步增加并发量时的初始并发量
+
+	retryaftermax int64 = 300 // 按响应的Retry-After等待后重试时的最长等待时长，单位秒，0为忽略Retry-After
+
+	outputretrytimes int    = 3                          // 数据库类输出失败时的重试次数
+	outputretrypause int    = 1000                       // 首次重试前的等待时长，单位毫秒，此后每次加倍
+	deadletterdir    string = WORK_ROOT + "/dead_letter" // 重试耗尽后仍未能输出的数据的保存目录
+
+	outputencoding       string = "utf-8"   // CSV输出的字符编码，如GBK、Shift_JIS
+	outputencodingpolicy string = "replace" // 目标编码无法表示的字符的处理方式：replace替换，skip丢弃，error报错
+
+	outputmaxbuffered int = 100000 // 每个蜘蛛已收集但尚未输出的文本数据的上限，达到时阻塞采集，0为不限
+
+	outputtaskid bool = false // 是否在每条文本结果中添加字段TaskID，记录产生该结果的任务ID
+
+	accesslogpath    string = ""  // 访问日志文件路径，为空时不记录
+	accesslogmaxsize int    = 100 // 访问日志文件的大小上限，超过时轮转，单位MB
+
+	queuemaxsize  int    = 0       // 每个蜘蛛内存中请求队列的容量，0为不限
+	queueoverflow string = "spill" // 队列已满时的处理方式：spill溢出至磁盘，block阻塞添加请求的协程
+	queueformat   string = "json"  // 溢出至磁盘的请求的序列化格式：json或protobuf
+
+	queuemaxage int64 = 0 // 请求在队列中等待超过该时长时，出队时丢弃而不再下载，单位秒，0为不限
+
+	watchdoginterval     int = 0 // 资源监控的采样间隔，单位秒，0为不监控
+	watchdogmaxheap      int = 0 // 堆内存上限，单位MB，超过时优雅终止任务，0为不限
+	watchdogmaxgoroutine int = 0 // 协程数上限，超过时优雅终止任务，0为不限
+	watchdogmaxfd        int = 0 // 打开的文件描述符数上限（仅Linux），超过时优雅终止任务，0为不限
+
+	browserscrolltimes  int = 5    // Context.ScrollToBottom()滚动至页面底部的次数
+	browserscrollsettle int = 1000 // Context.ScrollToBottom()每次滚动后等待内容加载的时长，单位毫秒
+
+	csvrotaterows   int = 0 // 单个CSV文件的行数上限（不含表头），达到时另起编号递增的新文件，0为不限
+	csvrotatebytes  int = 0 // 单个CSV文件的大小上限，单位KB，达到时另起编号递增的新文件，0为不限
+	excelrotaterows int = 0 // Excel文件中单个工作表的行数上限（不含表头），达到时另起编号递增的新文件，0为不限
+
+	jsonlmaxbytes int  = 0     // jsonl输出方式下单个文件的大小上限，单位字节，达到时另起新文件，写满的文件以时间戳命名，0为不限
+	jsonlgzip     bool = false // jsonl输出方式下是否以gzip压缩写完的文件
+
+	shardcount int = 1 // 分片数，即协同采集的节点数，大于1时各节点只采集属于本分片的请求，其他分片的请求在客户端模式下经主节点转交（见Rule.Sharded）
+	shardindex int = 0 // 本节点的分片序号，取值0~shardcount-1
+
+	dialtimeout       int  = 0    // 建立TCP连接的超时上限，单位毫秒，与Request.DialTimeout取较小者，0为不限
+	dialkeepalive     int  = 30   // TCP keep-alive探测间隔，单位秒，0为系统默认（15秒），-1为关闭
+	dialhappyeyeballs bool = true // 目标主机同时有IPv4与IPv6地址时是否并行尝试（happy eyeballs），关闭后按解析顺序依次尝试
+
+	debugmode     string = ""                   // 响应内容调试转储：空为关闭，all保存全部响应，failing仅保存未输出结果或被Spider.DebugDetector判定为异常的响应
+	debugdir      string = WORK_ROOT + "/debug" // 调试转储目录，每个响应保存于以URL哈希命名的子目录
+	debugmaxfiles int    = 1000                 // 调试转储的响应数上限，达到后不再保存，0为不限
+
+	seenenable bool   = false               // 是否启用跨任务的结果去重，按Rule.ItemKey跳过此前已输出过的结果
+	seendir    string = WORK_ROOT + "/seen" // 结果去重记录目录，每个蜘蛛一个文件
+	seenttl    int    = 0                   // 结果去重记录的保留天数，超过该时长未再出现的结果将被再次输出，0为永久保留
+
+	failedpath   string = "" // 最终失败的请求以JSON Lines格式追加保存的文件路径，为空时不保存
+	failedreplay string = "" // 任务开始时将该文件（格式同failedpath）中属于各蜘蛛的失败请求重新加入队列，为空时不启用
+
+	torsocks     string = "" // Tor的SOCKS5代理地址，如socks5://127.0.0.1:9050，未指定代理的请求经此访问，为空时不启用；仅限合法用途
+	torcontrol   string = "" // Tor控制端口地址，如127.0.0.1:9051，设置后响应为封禁状态时切换线路（出口IP）并重试，为空时不切换
+	torpassword  string = "" // Tor控制端口的密码（HashedControlPassword），为空时不认证
+	torinterval  int    = 10 // 两次切换线路的最短间隔，单位秒
+	tormaxrotate int    = 3  // 每个请求最多切换线路的次数
+
+	breakerthreshold int   = 0  // 同一主机连续失败（连接失败或5xx响应）达到该次数时熔断，暂停派发其请求，0为不启用
+	breakercooldown  int64 = 60 // 熔断后的冷却时长，此后放出一个探测请求，成功则恢复，单位秒
+
 	mode        int    = status.UNSET // 节点角色
 	port        int    = 2015         // 主节点端口
 	master      string = "127.0.0.1"  // 服务器(主节点)地址，不含端口
@@ -45,6 +125,12 @@ const (
 	proxyminute int64  = 0            // 代理IP更换的间隔分钟数
 	success     bool   = true         // 继承历史成功记录
 	failure     bool   = true         // 继承历史失败记录
+
+	deterministic bool = false // 确定性模式：单协程、按先进先出顺序执行，仅用于开发与测试
+	preview       int  = 0     // 预览模式：每个蜘蛛成功解析该数量的页面后即结束，0为不限
+
+	seeds    string = "" // 种子URL文件，每行一个URL或"URL,规则名,优先级"，"-"为标准输入，为空时不启用
+	seedrule string = "" // 种子URL未指定规则名时绑定的规则
 )
 
 var setting = func() config.Configer {
@@ -95,6 +181,59 @@ func defaultConfig(iniconf config.Configer) {
 	iniconf.Set("mysql::conncap", strconv.Itoa(mysqlconncap))
 	iniconf.Set("mysql::maxallowedpacket", strconv.Itoa(mysqlmaxallowedpacket))
 	iniconf.Set("kafka::brokers", kafkabrokers)
+	iniconf.Set("clickhouse::connstring", clickhouseconnstring)
+	iniconf.Set("clickhouse::database", dbname)
+	iniconf.Set("clickhouse::batchsize", strconv.Itoa(clickhousebatchsize))
+	iniconf.Set("clickhouse::flushinterval", strconv.Itoa(clickhouseflushinterval))
+	iniconf.Set("nats::url", natsurl)
+	iniconf.Set("nats::subject", natssubject)
+	iniconf.Set("nats::filesubject", natsfilesubject)
+	iniconf.Set("nats::jetstream", fmt.Sprint(natsjetstream))
+	iniconf.Set("nats::acktimeout", strconv.Itoa(natsacktimeout))
+	iniconf.Set("output::retrytimes", strconv.Itoa(outputretrytimes))
+	iniconf.Set("output::retrypause", strconv.Itoa(outputretrypause))
+	iniconf.Set("output::deadletterdir", deadletterdir)
+	iniconf.Set("output::encoding", outputencoding)
+	iniconf.Set("output::encodingpolicy", outputencodingpolicy)
+	iniconf.Set("output::maxbuffered", strconv.Itoa(outputmaxbuffered))
+	iniconf.Set("output::taskid", fmt.Sprint(outputtaskid))
+	iniconf.Set("accesslog::path", accesslogpath)
+	iniconf.Set("accesslog::maxsize", strconv.Itoa(accesslogmaxsize))
+	iniconf.Set("queue::maxsize", strconv.Itoa(queuemaxsize))
+	iniconf.Set("queue::overflow", queueoverflow)
+	iniconf.Set("queue::format", queueformat)
+	iniconf.Set("queue::maxage", strconv.FormatInt(queuemaxage, 10))
+	iniconf.Set("watchdog::interval", strconv.Itoa(watchdoginterval))
+	iniconf.Set("watchdog::maxheap", strconv.Itoa(watchdogmaxheap))
+	iniconf.Set("watchdog::maxgoroutine", strconv.Itoa(watchdogmaxgoroutine))
+	iniconf.Set("watchdog::maxfd", strconv.Itoa(watchdogmaxfd))
+	iniconf.Set("browser::scrolltimes", strconv.Itoa(browserscrolltimes))
+	iniconf.Set("browser::scrollsettle", strconv.Itoa(browserscrollsettle))
+	iniconf.Set("csv::rotaterows", strconv.Itoa(csvrotaterows))
+	iniconf.Set("csv::rotatebytes", strconv.Itoa(csvrotatebytes))
+	iniconf.Set("excel::rotaterows", strconv.Itoa(excelrotaterows))
+	iniconf.Set("jsonl::maxbytes", strconv.Itoa(jsonlmaxbytes))
+	iniconf.Set("jsonl::gzip", fmt.Sprint(jsonlgzip))
+	iniconf.Set("shard::count", strconv.Itoa(shardcount))
+	iniconf.Set("shard::index", strconv.Itoa(shardindex))
+	iniconf.Set("dial::timeout", strconv.Itoa(dialtimeout))
+	iniconf.Set("dial::keepalive", strconv.Itoa(dialkeepalive))
+	iniconf.Set("dial::happyeyeballs", fmt.Sprint(dialhappyeyeballs))
+	iniconf.Set("debug::mode", debugmode)
+	iniconf.Set("debug::dir", debugdir)
+	iniconf.Set("debug::maxfiles", strconv.Itoa(debugmaxfiles))
+	iniconf.Set("seen::enable", fmt.Sprint(seenenable))
+	iniconf.Set("seen::dir", seendir)
+	iniconf.Set("seen::ttl", strconv.Itoa(seenttl))
+	iniconf.Set("failed::path", failedpath)
+	iniconf.Set("failed::replay", failedreplay)
+	iniconf.Set("tor::socks", torsocks)
+	iniconf.Set("tor::control", torcontrol)
+	iniconf.Set("tor::password", torpassword)
+	iniconf.Set("tor::interval", strconv.Itoa(torinterval))
+	iniconf.Set("tor::maxrotate", strconv.Itoa(tormaxrotate))
+	iniconf.Set("breaker::threshold", strconv.Itoa(breakerthreshold))
+	iniconf.Set("breaker::cooldown", strconv.FormatInt(breakercooldown, 10))
 	iniconf.Set("run::mode", strconv.Itoa(mode))
 	iniconf.Set("run::port", strconv.Itoa(port))
 	iniconf.Set("run::master", master)
@@ -106,6 +245,15 @@ func defaultConfig(iniconf config.Configer) {
 	iniconf.Set("run::proxyminute", strconv.FormatInt(proxyminute, 10))
 	iniconf.Set("run::success", fmt.Sprint(success))
 	iniconf.Set("run::failure", fmt.Sprint(failure))
+	iniconf.Set("run::gracesecond", strconv.FormatInt(gracesecond, 10))
+	iniconf.Set("run::idletimeout", strconv.FormatInt(idletimeout, 10))
+	iniconf.Set("run::rampsecond", strconv.FormatInt(rampsecond, 10))
+	iniconf.Set("run::rampstart", strconv.Itoa(rampstart))
+	iniconf.Set("run::retryaftermax", strconv.FormatInt(retryaftermax, 10))
+	iniconf.Set("run::deterministic", fmt.Sprint(deterministic))
+	iniconf.Set("run::preview", strconv.Itoa(preview))
+	iniconf.Set("run::seeds", seeds)
+	iniconf.Set("run::seedrule", seedrule)
 }
 
 func trySet(iniconf config.Configer) {
@@ -199,6 +347,186 @@ func trySet(iniconf config.Configer) {
 		iniconf.Set("kafka::brokers", kafkabrokers)
 	}
 
+	if v := iniconf.String("clickhouse::connstring"); v == "" {
+		iniconf.Set("clickhouse::connstring", clickhouseconnstring)
+	}
+
+	if v := iniconf.String("clickhouse::database"); v == "" {
+		iniconf.Set("clickhouse::database", dbname)
+	}
+
+	if v, e := iniconf.Int("clickhouse::batchsize"); v <= 0 || e != nil {
+		iniconf.Set("clickhouse::batchsize", strconv.Itoa(clickhousebatchsize))
+	}
+
+	if v, e := iniconf.Int("clickhouse::flushinterval"); v <= 0 || e != nil {
+		iniconf.Set("clickhouse::flushinterval", strconv.Itoa(clickhouseflushinterval))
+	}
+
+	if v := iniconf.String("nats::url"); v == "" {
+		iniconf.Set("nats::url", natsurl)
+	}
+
+	if v := iniconf.String("nats::subject"); v == "" {
+		iniconf.Set("nats::subject", natssubject)
+	}
+
+	if _, e := iniconf.Bool("nats::jetstream"); e != nil {
+		iniconf.Set("nats::jetstream", fmt.Sprint(natsjetstream))
+	}
+
+	if v, e := iniconf.Int("nats::acktimeout"); v <= 0 || e != nil {
+		iniconf.Set("nats::acktimeout", strconv.Itoa(natsacktimeout))
+	}
+
+	if v, e := iniconf.Int("output::retrytimes"); v < 0 || e != nil {
+		iniconf.Set("output::retrytimes", strconv.Itoa(outputretrytimes))
+	}
+
+	if v, e := iniconf.Int("output::retrypause"); v <= 0 || e != nil {
+		iniconf.Set("output::retrypause", strconv.Itoa(outputretrypause))
+	}
+
+	if v := iniconf.String("output::deadletterdir"); v == "" {
+		iniconf.Set("output::deadletterdir", deadletterdir)
+	}
+
+	if v := iniconf.String("output::encoding"); v == "" {
+		iniconf.Set("output::encoding", outputencoding)
+	}
+
+	if v := iniconf.String("output::encodingpolicy"); v != "replace" && v != "skip" && v != "error" {
+		iniconf.Set("output::encodingpolicy", outputencodingpolicy)
+	}
+
+	if v, e := iniconf.Int("output::maxbuffered"); v < 0 || e != nil {
+		iniconf.Set("output::maxbuffered", strconv.Itoa(outputmaxbuffered))
+	}
+
+	if _, e := iniconf.Bool("output::taskid"); e != nil {
+		iniconf.Set("output::taskid", fmt.Sprint(outputtaskid))
+	}
+
+	if v, e := iniconf.Int("accesslog::maxsize"); v <= 0 || e != nil {
+		iniconf.Set("accesslog::maxsize", strconv.Itoa(accesslogmaxsize))
+	}
+
+	if v, e := iniconf.Int("queue::maxsize"); v < 0 || e != nil {
+		iniconf.Set("queue::maxsize", strconv.Itoa(queuemaxsize))
+	}
+
+	if v := iniconf.String("queue::overflow"); v != "spill" && v != "block" {
+		iniconf.Set("queue::overflow", queueoverflow)
+	}
+
+	if v := iniconf.String("queue::format"); v != "json" && v != "protobuf" {
+		iniconf.Set("queue::format", queueformat)
+	}
+
+	if v, e := iniconf.Int64("queue::maxage"); v < 0 || e != nil {
+		iniconf.Set("queue::maxage", strconv.FormatInt(queuemaxage, 10))
+	}
+
+	if v, e := iniconf.Int("watchdog::interval"); v < 0 || e != nil {
+		iniconf.Set("watchdog::interval", strconv.Itoa(watchdoginterval))
+	}
+
+	if v, e := iniconf.Int("watchdog::maxheap"); v < 0 || e != nil {
+		iniconf.Set("watchdog::maxheap", strconv.Itoa(watchdogmaxheap))
+	}
+
+	if v, e := iniconf.Int("watchdog::maxgoroutine"); v < 0 || e != nil {
+		iniconf.Set("watchdog::maxgoroutine", strconv.Itoa(watchdogmaxgoroutine))
+	}
+
+	if v, e := iniconf.Int("watchdog::maxfd"); v < 0 || e != nil {
+		iniconf.Set("watchdog::maxfd", strconv.Itoa(watchdogmaxfd))
+	}
+
+	if v, e := iniconf.Int("browser::scrolltimes"); v <= 0 || e != nil {
+		iniconf.Set("browser::scrolltimes", strconv.Itoa(browserscrolltimes))
+	}
+
+	if v, e := iniconf.Int("browser::scrollsettle"); v < 0 || e != nil {
+		iniconf.Set("browser::scrollsettle", strconv.Itoa(browserscrollsettle))
+	}
+
+	if v, e := iniconf.Int("csv::rotaterows"); v < 0 || e != nil {
+		iniconf.Set("csv::rotaterows", strconv.Itoa(csvrotaterows))
+	}
+
+	if v, e := iniconf.Int("csv::rotatebytes"); v < 0 || e != nil {
+		iniconf.Set("csv::rotatebytes", strconv.Itoa(csvrotatebytes))
+	}
+
+	if v, e := iniconf.Int("excel::rotaterows"); v < 0 || e != nil {
+		iniconf.Set("excel::rotaterows", strconv.Itoa(excelrotaterows))
+	}
+
+	if v, e := iniconf.Int("jsonl::maxbytes"); v < 0 || e != nil {
+		iniconf.Set("jsonl::maxbytes", strconv.Itoa(jsonlmaxbytes))
+	}
+
+	if v, e := iniconf.Int("shard::count"); v <= 0 || e != nil {
+		iniconf.Set("shard::count", strconv.Itoa(shardcount))
+	}
+
+	if v, e := iniconf.Int("shard::index"); v < 0 || v >= iniconf.DefaultInt("shard::count", shardcount) || e != nil {
+		iniconf.Set("shard::index", strconv.Itoa(shardindex))
+	}
+
+	if v, e := iniconf.Int("dial::timeout"); v < 0 || e != nil {
+		iniconf.Set("dial::timeout", strconv.Itoa(dialtimeout))
+	}
+
+	if v, e := iniconf.Int("dial::keepalive"); v < -1 || e != nil {
+		iniconf.Set("dial::keepalive", strconv.Itoa(dialkeepalive))
+	}
+
+	if _, e := iniconf.Bool("dial::happyeyeballs"); e != nil {
+		iniconf.Set("dial::happyeyeballs", fmt.Sprint(dialhappyeyeballs))
+	}
+
+	if v := iniconf.String("debug::mode"); v != "" && v != "all" && v != "failing" {
+		iniconf.Set("debug::mode", debugmode)
+	}
+
+	if v := iniconf.String("debug::dir"); v == "" {
+		iniconf.Set("debug::dir", debugdir)
+	}
+
+	if v, e := iniconf.Int("debug::maxfiles"); v < 0 || e != nil {
+		iniconf.Set("debug::maxfiles", strconv.Itoa(debugmaxfiles))
+	}
+
+	if _, e := iniconf.Bool("seen::enable"); e != nil {
+		iniconf.Set("seen::enable", fmt.Sprint(seenenable))
+	}
+
+	if v := iniconf.String("seen::dir"); v == "" {
+		iniconf.Set("seen::dir", seendir)
+	}
+
+	if v, e := iniconf.Int("seen::ttl"); v < 0 || e != nil {
+		iniconf.Set("seen::ttl", strconv.Itoa(seenttl))
+	}
+
+	if v, e := iniconf.Int("tor::interval"); v < 0 || e != nil {
+		iniconf.Set("tor::interval", strconv.Itoa(torinterval))
+	}
+
+	if v, e := iniconf.Int("tor::maxrotate"); v < 0 || e != nil {
+		iniconf.Set("tor::maxrotate", strconv.Itoa(tormaxrotate))
+	}
+
+	if v, e := iniconf.Int("breaker::threshold"); v < 0 || e != nil {
+		iniconf.Set("breaker::threshold", strconv.Itoa(breakerthreshold))
+	}
+
+	if v, e := iniconf.Int64("breaker::cooldown"); v <= 0 || e != nil {
+		iniconf.Set("breaker::cooldown", strconv.FormatInt(breakercooldown, 10))
+	}
+
 	if v, e := iniconf.Int("run::mode"); v < status.UNSET || v > status.CLIENT || e != nil {
 		iniconf.Set("run::mode", strconv.Itoa(mode))
 	}
@@ -243,6 +571,34 @@ func trySet(iniconf config.Configer) {
 		iniconf.Set("run::failure", fmt.Sprint(failure))
 	}
 
+	if v, e := iniconf.Int64("run::gracesecond"); v < 0 || e != nil {
+		iniconf.Set("run::gracesecond", strconv.FormatInt(gracesecond, 10))
+	}
+
+	if v, e := iniconf.Int64("run::idletimeout"); v < 0 || e != nil {
+		iniconf.Set("run::idletimeout", strconv.FormatInt(idletimeout, 10))
+	}
+
+	if v, e := iniconf.Int64("run::rampsecond"); v < 0 || e != nil {
+		iniconf.Set("run::rampsecond", strconv.FormatInt(rampsecond, 10))
+	}
+
+	if v, e := iniconf.Int("run::rampstart"); v <= 0 || e != nil {
+		iniconf.Set("run::rampstart", strconv.Itoa(rampstart))
+	}
+
+	if v, e := iniconf.Int64("run::retryaftermax"); v < 0 || e != nil {
+		iniconf.Set("run::retryaftermax", strconv.FormatInt(retryaftermax, 10))
+	}
+
+	if _, e := iniconf.Bool("run::deterministic"); e != nil {
+		iniconf.Set("run::deterministic", fmt.Sprint(deterministic))
+	}
+
+	if v, e := iniconf.Int("run::preview"); v < 0 || e != nil {
+		iniconf.Set("run::preview", strconv.Itoa(preview))
+	}
+
 	iniconf.SaveConfigFile(CONFIG)
 }
 
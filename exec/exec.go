@@ -3,14 +3,19 @@ package exec
 import (
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/henrylee2cn/pholcus/app"
 	"github.com/henrylee2cn/pholcus/cmd"
 	"github.com/henrylee2cn/pholcus/common/gc"
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
 	"github.com/henrylee2cn/pholcus/web"
@@ -30,6 +35,11 @@ var (
 	dockerflag         *int
 	successInheritflag *bool
 	failureInheritflag *bool
+	deterministicflag  *bool
+	previewflag        *int
+	seedsflag          *string
+	seedruleflag       *string
+	seenresetflag      *string
 )
 
 func init() {
@@ -50,9 +60,28 @@ func DefaultRun(uiDefault string) {
 	flag.String("z", "", "README:   参数设置参考 [xxx] 提示，参数中包含多个值时以 \",\" 间隔。\r\n")
 	flag.Parse()
 	writeFlag()
+	resetSeen(*seenresetflag)
 	run(*uiflag)
 }
 
+// 阻塞直至收到SIGINT/SIGTERM信号，随后优雅终止当前任务并退出；
+// 等待期间再次收到信号时立即退出
+func waitSignal() {
+	ctrl := make(chan os.Signal, 2)
+	signal.Notify(ctrl, os.Interrupt, syscall.SIGTERM)
+	<-ctrl
+	go func() {
+		<-ctrl
+		os.Exit(1)
+	}()
+	if !app.LogicApp.IsStopped() {
+		grace := time.Duration(config.GRACE_SECOND) * time.Second
+		logs.Log.Informational(" *     收到终止信号，等待进行中的请求完成（至多 %v）...\n", grace)
+		app.LogicApp.GracefulStop(grace)
+	}
+	os.Exit(0)
+}
+
 func flagCommon() {
 	//运行模式
 	modeflag = flag.Int(
@@ -93,7 +122,7 @@ func flagCommon() {
 			for _, v := range app.LogicApp.GetOutputLib() {
 				outputlib += "[" + v + "] "
 			}
-			return "   <输出方式: > " + strings.TrimRight(outputlib, " ")
+			return "   <输出方式，多个以逗号分隔时同时输出: > " + strings.TrimRight(outputlib, " ")
 		}())
 
 	// 并发协程数
@@ -131,6 +160,51 @@ func flagCommon() {
 		"a_failure",
 		cache.Task.FailureInherit,
 		"   <继承并保存失败记录> [true] [false]")
+
+	// 确定性模式
+	deterministicflag = flag.Bool(
+		"a_deterministic",
+		cache.Task.Deterministic,
+		"   <确定性模式: 单协程按先进先出顺序执行，速度很慢，仅用于开发与测试> [true] [false]")
+
+	// 预览模式
+	previewflag = flag.Int(
+		"a_preview",
+		cache.Task.Preview,
+		"   <预览模式: 每个蜘蛛成功解析该数量的页面后即结束，用于快速抽样，0为不限> [>=0]")
+
+	// 种子URL文件
+	seedsflag = flag.String(
+		"a_seeds",
+		cache.Task.Seeds,
+		"   <种子URL文件: 每行一个URL或\"URL,规则名,优先级\"，#开头为注释，\"-\"为标准输入>")
+
+	// 种子URL绑定的规则
+	seedruleflag = flag.String(
+		"a_seedrule",
+		cache.Task.SeedRule,
+		"   <种子URL未指定规则名时绑定的规则>")
+
+	// 清空结果去重记录
+	seenresetflag = flag.String(
+		"a_seenreset",
+		"",
+		"   <运行前清空跨任务的结果去重记录（见seen::enable）: 蜘蛛名，多个以\",\"间隔，\"*\"为全部>")
+}
+
+// 清空指定蜘蛛的结果去重记录
+func resetSeen(names string) {
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if name == "*" {
+			name = ""
+		}
+		if err := app.LogicApp.ResetSeen(name); err != nil {
+			logs.Log.Error(" *     [结果去重] 清空记录失败: %v\n", err)
+		}
+	}
 }
 
 func writeFlag() {
@@ -146,4 +220,8 @@ func writeFlag() {
 	cache.Task.DockerCap = *dockerflag
 	cache.Task.SuccessInherit = *successInheritflag
 	cache.Task.FailureInherit = *failureInheritflag
+	cache.Task.Deterministic = *deterministicflag
+	cache.Task.Preview = *previewflag
+	cache.Task.Seeds = *seedsflag
+	cache.Task.SeedRule = *seedruleflag
 }
@@ -1,9 +1,7 @@
 package exec
 
 import (
-	"os"
 	"os/exec"
-	"os/signal"
 
 	"github.com/henrylee2cn/pholcus/config"
 
@@ -17,14 +15,13 @@ func run(which string) {
 	// 选择运行界面
 	switch which {
 	case "cmd":
+		go waitSignal()
 		cmd.Run()
 
 	case "web":
 		fallthrough
 	default:
-		ctrl := make(chan os.Signal, 1)
-		signal.Notify(ctrl, os.Interrupt, os.Kill)
 		go web.Run()
-		<-ctrl
+		waitSignal()
 	}
 }
@@ -2,9 +2,7 @@
 package exec
 
 import (
-	"os"
 	"os/exec"
-	"os/signal"
 
 	"github.com/henrylee2cn/pholcus/config"
 
@@ -19,17 +17,17 @@ func run(which string) {
 	// 选择运行界面
 	switch which {
 	case "gui":
+		go waitSignal()
 		gui.Run()
 
 	case "cmd":
+		go waitSignal()
 		cmd.Run()
 
 	case "web":
 		fallthrough
 	default:
-		ctrl := make(chan os.Signal, 1)
-		signal.Notify(ctrl, os.Interrupt, os.Kill)
 		go web.Run()
-		<-ctrl
+		waitSignal()
 	}
 }
@@ -1,7 +1,10 @@
 package cache
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"runtime"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -15,12 +18,16 @@ type AppConf struct {
 	Master         string // 服务器(主节点)地址，不含端口
 	ThreadNum      int    // 全局最大并发量
 	Pausetime      int64  // 暂停时长参考/ms(随机: Pausetime/2 ~ Pausetime*2)
-	OutType        string // 输出方式
+	OutType        string // 输出方式，以逗号分隔多个时同时输出至各目标，如"mgo,csv"
 	DockerCap      int    // 分段转储容器容量
 	Limit          int64  // 采集上限，0为不限，若在规则中设置初始值为LIMIT则为自定义限制，否则默认限制请求数
 	ProxyMinute    int64  // 代理IP更换的间隔分钟数
 	SuccessInherit bool   // 继承历史成功记录
 	FailureInherit bool   // 继承历史失败记录
+	Deterministic  bool   // 确定性模式：单协程、按先进先出顺序执行，速度很慢，仅用于开发与测试
+	Preview        int    // 预览模式：每个蜘蛛成功解析该数量的页面后即结束，用于快速抽样，0为不限
+	Seeds          string // 种子URL文件，每行一个URL或"URL,规则名,优先级"，"-"为标准输入，为空时不启用
+	SeedRule       string // 种子URL未指定规则名时绑定的规则
 	// 选填项
 	Keyins string // 自定义输入，后期切分为多个任务的Keyin自定义配置
 }
@@ -28,6 +35,24 @@ type AppConf struct {
 // 该初始值即默认值
 var Task = new(AppConf)
 
+// 返回Task.OutType中的各输出方式，至少包含一项，首项同时用作成功与失败记录的存储方式
+func OutTypes() []string {
+	var outs []string
+	seen := make(map[string]bool)
+	for _, out := range strings.Split(Task.OutType, ",") {
+		out = strings.TrimSpace(out)
+		if out == "" || seen[out] {
+			continue
+		}
+		seen[out] = true
+		outs = append(outs, out)
+	}
+	if len(outs) == 0 {
+		outs = []string{Task.OutType}
+	}
+	return outs
+}
+
 //****************************************任务报告*******************************************\\
 
 type Report struct {
@@ -37,18 +62,49 @@ type Report struct {
 	FileNum    uint64
 	// DataSize   uint64
 	// FileSize uint64
-	Time time.Duration
+	Time   time.Duration
+	Reason string // 结束原因，REASON_QUEUE_EMPTY等
+
+	Outputs map[string]OutputStat // 各输出目标的统计，键为输出方式
 }
 
+// 单个输出目标的统计
+type OutputStat struct {
+	DataNum   uint64 // 成功输出的数据条数
+	FailNum   uint64 // 输出失败（已存入死信文件）的数据条数
+	FailBatch uint64 // 输出失败的批次数
+	LastError string // 最近一次输出失败的原因
+}
+
+// 任务结束原因
+const (
+	REASON_QUEUE_EMPTY = "queue-empty" // 请求全部处理完毕
+	REASON_LIMIT       = "limit"       // 达到采集上限
+	REASON_PREVIEW     = "preview"     // 预览模式下成功解析的页面数已达到预览数量
+	REASON_SIGNAL      = "signal"      // 优雅终止：停止派发新请求，进行中的请求处理完毕，待重试的失败请求保存至失败记录
+	REASON_STOPPED     = "stopped"     // 被主动终止，进行中的请求被放弃
+	REASON_STALLED     = "stalled"     // 超过run::idletimeout没有请求完成而仍有待处理的请求，已优雅终止
+)
+
 var (
 	// 点击开始按钮的时间点
 	StartTime time.Time
+	// 本次任务的ID，任务开始时生成，用于区分多次运行的结果与日志
+	TaskID string
 	// 文本数据小结报告
 	ReportChan chan *Report
 	// 请求页面总数[]uint{总数，失败数}
 	pageSum [2]uint64
 )
 
+// 记录任务开始的时间点并生成任务ID，如"20060102-150405-1a2b3c"
+func StartTask() {
+	StartTime = time.Now()
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	TaskID = StartTime.Format("20060102-150405-") + hex.EncodeToString(suffix)
+}
+
 // 重置页面计数
 func ResetPageCount() {
 	pageSum = [2]uint64{}
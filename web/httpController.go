@@ -1,6 +1,7 @@
 package web
 
 import (
+	"encoding/json"
 	"net/http"
 	"text/template"
 
@@ -52,3 +53,19 @@ func web(rw http.ResponseWriter, req *http.Request) {
 	}
 	t.Execute(rw, data) //执行模板的merger操作
 }
+
+// 以JSON返回各蜘蛛请求队列的统计快照
+func queueStats(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(rw).Encode(app.LogicApp.QueueStats()); err != nil {
+		logs.Log.Error("%v", err)
+	}
+}
+
+// 以JSON返回各蜘蛛已收集但尚未输出的结果的统计快照
+func bufferStats(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(rw).Encode(app.LogicApp.BufferStats()); err != nil {
+		logs.Log.Error("%v", err)
+	}
+}
@@ -19,6 +19,10 @@ func Router() {
 	http.Handle("/ws/log", ws.Handler(wsLogHandle))
 	//设置http访问的路由
 	http.HandleFunc("/", web)
+	// 请求队列统计，供外部监控使用
+	http.HandleFunc("/queue", queueStats)
+	// 结果缓存统计
+	http.HandleFunc("/buffer", bufferStats)
 	//static file server
 
 	http.Handle("/public/", http.StripPrefix("/public/", http.FileServer(assetFS())))